@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"text2sql/internal/config"
+	"text2sql/internal/logger"
+	"text2sql/internal/text2sql"
+)
+
+// runCommand 执行离线维护子命令，返回进程退出码
+func runCommand(cfg *config.Config, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "reencrypt":
+		return runReencrypt(cfg)
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s（可用: migrate、reencrypt）\n", args[0])
+		return 2
+	}
+}
+
+// runMigrate 查看（status，默认）或执行（up）SQLite 上下文存储的表结构迁移
+func runMigrate(cfg *config.Config, args []string) int {
+	if cfg.ContextStore != "sqlite" {
+		logger.Error("migrate 仅支持 context_store: sqlite", "context_store", cfg.ContextStore)
+		return 1
+	}
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "status":
+		statuses, err := text2sql.SQLiteMigrationStatus(cfg.Database.DSN)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED_AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+		if err != nil {
+			logger.Error("read migration status failed", "error", err)
+			return 1
+		}
+		return 0
+	case "up":
+		applied, err := text2sql.MigrateSQLite(cfg.Database.DSN)
+		if err != nil {
+			logger.Error("migrate failed", "error", err)
+			return 1
+		}
+		for _, m := range applied {
+			logger.Info("migration applied", "version", m.Version, "name", m.Name)
+		}
+		logger.Info("migrate finished", "applied", len(applied))
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知的 migrate 操作: %s（可用: status、up）\n", action)
+		return 2
+	}
+}
+
+// runReencrypt 用 encryption.active_key 重新加密 SQLite 中的所有会话，轮换密钥或开启加密后在停机窗口内执行
+func runReencrypt(cfg *config.Config) int {
+	if cfg.ContextStore != "sqlite" {
+		logger.Error("reencrypt 仅支持 context_store: sqlite", "context_store", cfg.ContextStore)
+		return 1
+	}
+	keyring, err := newKeyring(cfg.Encryption)
+	if err != nil {
+		logger.Error("load encryption keys failed", "error", err)
+		return 1
+	}
+	if keyring.ActiveKeyID() == "" {
+		logger.Error("reencrypt 需要配置 encryption.active_key")
+		return 1
+	}
+	store, err := text2sql.NewSQLiteContextStoreWithOptions(cfg.Database.DSN, text2sql.SQLiteStoreOptions{Keyring: keyring})
+	if err != nil {
+		logger.Error("create sqlite context store failed", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	n, err := store.Reencrypt()
+	if err != nil {
+		logger.Error("reencrypt failed", "converted", n, "error", err)
+		return 1
+	}
+	logger.Info("reencrypt finished", "active_key", keyring.ActiveKeyID(), "converted", n)
+	return 0
+}
+
+// newKeyring 按配置加载主密钥，未配置密钥时返回 nil（不加密）
+func newKeyring(cfg config.EncryptionConfig) (*text2sql.Keyring, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		var key []byte
+		var err error
+		if k.KeyFile != "" {
+			key, err = text2sql.ReadEncryptionKeyFile(k.KeyFile)
+		} else {
+			key, err = text2sql.ParseEncryptionKey(k.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("加密密钥 %s: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+	return text2sql.NewKeyring(cfg.ActiveKey, keys)
+}
@@ -32,6 +32,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 离线维护子命令，如 server migrate、server reencrypt
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1:]))
+	}
+
 	if len(cfg.APIKeys) == 0 {
 		logger.Error("api_key 未配置")
 		os.Exit(1)
@@ -45,23 +50,111 @@ func main() {
 
 	cachedProvider := llm.NewCachedProvider(llmProvider, 5*time.Minute)
 
+	retention := text2sql.RetentionPolicy{
+		SlidingTTL:      cfg.Retention.SlidingTTL,
+		AbsoluteTTL:     cfg.Retention.AbsoluteTTL,
+		CleanupInterval: cfg.Retention.CleanupInterval,
+	}
 	var store text2sql.ContextStore
 	switch cfg.ContextStore {
 	case "sqlite":
-		sqliteStore, err := text2sql.NewSQLiteContextStore(cfg.Database.DSN)
+		keyring, err := newKeyring(cfg.Encryption)
+		if err != nil {
+			logger.Error("load encryption keys failed", "error", err)
+			os.Exit(1)
+		}
+		sqliteStore, err := text2sql.NewSQLiteContextStoreWithOptions(cfg.Database.DSN, text2sql.SQLiteStoreOptions{
+			Retention:          retention,
+			Keyring:            keyring,
+			DisableAutoMigrate: cfg.Database.DisableAutoMigrate,
+		})
 		if err != nil {
 			logger.Error("create sqlite context store failed", "error", err)
 			os.Exit(1)
 		}
 		store = sqliteStore
+	case "redis":
+		redisStore, err := text2sql.NewRedisContextStore(text2sql.RedisStoreOptions{
+			Addr:      cfg.Redis.Addr,
+			Username:  cfg.Redis.Username,
+			Password:  cfg.Redis.Password,
+			DB:        cfg.Redis.DB,
+			KeyPrefix: cfg.Redis.KeyPrefix,
+			Retention: retention,
+		})
+		if err != nil {
+			logger.Error("create redis context store failed", "error", err)
+			os.Exit(1)
+		}
+		store = redisStore
+	case "sql":
+		sqlStore, err := text2sql.NewSQLContextStore(text2sql.SQLStoreOptions{
+			Driver:          cfg.Database.Driver,
+			DSN:             cfg.Database.DSN,
+			MaxOpenConns:    cfg.Database.MaxOpenConns,
+			MaxIdleConns:    cfg.Database.MaxIdleConns,
+			ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+			Retention:       retention,
+		})
+		if err != nil {
+			logger.Error("create sql context store failed", "error", err)
+			os.Exit(1)
+		}
+		store = sqlStore
 	default:
-		store = text2sql.NewMemoryContextStore()
+		store = text2sql.NewMemoryContextStoreWithRetention(retention)
+	}
+
+	var prompts *text2sql.PromptTemplates
+	if cfg.Prompts.Dir != "" {
+		prompts, err = text2sql.LoadPromptTemplates(cfg.Prompts.Dir)
+		if err != nil {
+			logger.Error("load prompt templates failed", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("prompt templates loaded", "dir", prompts.Dir(), "templates", prompts.Names())
 	}
 
-	validator := text2sql.NewSQLValidator()
-	svc := text2sql.NewServiceWithContextStore(cachedProvider, validator, 2, store)
+	validator := text2sql.NewSQLValidatorWithOptions(text2sql.ValidateOptions{MaxRows: cfg.Validator.MaxRows}.
+		WithDialect("redis", text2sql.RedisLimits{
+			AllowUnboundedKeys: cfg.Validator.Redis.AllowUnboundedKeys,
+			MaxScanCount:       cfg.Validator.Redis.MaxScanCount,
+			MaxRangeSize:       cfg.Validator.Redis.MaxRangeSize,
+		}).
+		WithDialect("clickhouse", text2sql.ClickHouseLimits{
+			RequirePartitionFilter: !cfg.Validator.ClickHouse.AllowFullScan,
+			LargeTableRows:         cfg.Validator.ClickHouse.LargeTableRows,
+		}))
+	logger.Info("conversation retention", "sliding_ttl", cfg.Retention.SlidingTTL, "absolute_ttl", cfg.Retention.AbsoluteTTL,
+		"max_turns", cfg.Retention.MaxTurns, "max_conversations_per_key", cfg.Retention.MaxConversationsPerKey)
+	history := cfg.LLM.ResolveHistory()
+	logger.Info("conversation history", "strategy", history.Strategy, "budget_tokens", history.BudgetTokens, "model", cfg.LLM.Model())
+	svc := text2sql.NewServiceWithOptions(cachedProvider, validator, text2sql.ServiceOptions{
+		MaxRetries:       2,
+		ContextStore:     store,
+		StructuredOutput: cfg.LLM.StructuredOutput,
+		Prompts:          prompts,
+		History: text2sql.HistoryOptions{
+			Strategy:      history.Strategy,
+			BudgetTokens:  history.BudgetTokens,
+			SummaryTokens: history.SummaryTokens,
+		},
+		Retention: retention,
+		Limits: text2sql.ConversationLimits{
+			MaxTurns:                 cfg.Retention.MaxTurns,
+			MaxConversationsPerOwner: cfg.Retention.MaxConversationsPerKey,
+		},
+	})
 
-	handler := api.NewHandler(svc, cfg.APIKeys)
+	principals := make(map[string]text2sql.Principal, len(cfg.APIKeys))
+	for _, k := range cfg.APIKeys {
+		principals[k.Key] = text2sql.Principal{Name: k.Name, Tenant: k.Tenant}
+	}
+	handler := api.NewHandlerWithOptions(svc, principals, api.HandlerOptions{DebugEndpoint: cfg.Prompts.DebugEndpoint})
+	if cfg.Prompts.DebugEndpoint {
+		logger.Warn("debug prompt endpoint enabled", "path", "/api/v1/debug/prompt")
+	}
 
 	r := chi.NewRouter()
 	handler.Routes(r)
@@ -75,11 +168,21 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if prompts != nil {
+		if cfg.Prompts.ReloadInterval > 0 {
+			go prompts.Watch(watchCtx, cfg.Prompts.ReloadInterval)
+		}
+		go reloadPromptsOnSIGHUP(watchCtx, prompts)
+	}
+
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 		<-sigint
 		logger.Info("Shutting down server...")
+		stopWatch()
 
 		if err := store.Close(); err != nil {
 			logger.Error("Error closing context store", "error", err)
@@ -100,3 +203,22 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// reloadPromptsOnSIGHUP 收到 SIGHUP 时重新加载提示词模板，失败时继续使用当前模板
+func reloadPromptsOnSIGHUP(ctx context.Context, prompts *text2sql.PromptTemplates) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+		}
+		if err := prompts.Reload(); err != nil {
+			logger.Error("reload prompt templates failed", "error", err)
+			continue
+		}
+		logger.Info("prompt templates reloaded", "dir", prompts.Dir(), "templates", prompts.Names())
+	}
+}
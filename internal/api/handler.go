@@ -1,9 +1,16 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,31 +23,75 @@ import (
 // Handler API 处理器
 type Handler struct {
 	text2sql    *text2sql.Service
-	apiKeys     map[string]bool
+	principals  map[string]text2sql.Principal // API Key 到请求方的映射
 	validate    *validator.Validate
 	rateLimiter *RateLimiter
+	opts        HandlerOptions
+}
+
+// HandlerOptions Handler 选项
+type HandlerOptions struct {
+	DebugEndpoint bool // 是否注册 /api/v1/debug/prompt，该接口返回完整提示词（含 schema），默认关闭
 }
 
 const maxRequestBodyBytes int64 = 1 << 20 // 1MB
 
-// NewHandler 创建 Handler
-func NewHandler(text2sql *text2sql.Service, apiKeys []string) *Handler {
-	keyMap := make(map[string]bool)
+// NewHandler 创建 Handler，每个 API Key 是一个独立的请求方，只能访问自己创建的会话
+func NewHandler(svc *text2sql.Service, apiKeys []string) *Handler {
+	principals := make(map[string]text2sql.Principal, len(apiKeys))
 	for _, key := range apiKeys {
-		keyMap[key] = true
+		principals[key] = text2sql.Principal{}
+	}
+	return NewHandlerWithPrincipals(svc, principals)
+}
+
+// NewHandlerWithPrincipals 创建 Handler，principals 为 API Key 到请求方的映射；
+// 多个 Key 可映射到同一请求方以共享会话，Name 为空时由 Key 的摘要派生
+func NewHandlerWithPrincipals(svc *text2sql.Service, principals map[string]text2sql.Principal) *Handler {
+	return NewHandlerWithOptions(svc, principals, HandlerOptions{})
+}
+
+// NewHandlerWithOptions 使用自定义选项创建 Handler，principals 同 NewHandlerWithPrincipals
+func NewHandlerWithOptions(svc *text2sql.Service, principals map[string]text2sql.Principal, opts HandlerOptions) *Handler {
+	resolved := make(map[string]text2sql.Principal, len(principals))
+	for key, p := range principals {
+		if p.Name == "" {
+			p.Name = apiKeyOwner(key)
+		}
+		resolved[key] = p
 	}
 	return &Handler{
-		text2sql:    text2sql,
-		apiKeys:     keyMap,
-		validate:    validator.New(),
+		text2sql:    svc,
+		principals:  resolved,
+		validate:    newRequestValidator(),
 		rateLimiter: NewRateLimiter(10, time.Minute), // 每分钟10个请求
+		opts:        opts,
 	}
 }
 
-// Routes 注册路由
+// newRequestValidator 创建请求校验器：database.type 取值为已注册的方言，注册新方言无需修改校验规则
+func newRequestValidator() *validator.Validate {
+	v := validator.New()
+	_ = v.RegisterValidation("dialect", func(fl validator.FieldLevel) bool {
+		_, err := text2sql.GetDialect(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// Routes 注册路由，调试接口仅在 HandlerOptions.DebugEndpoint 开启时注册
 func (h *Handler) Routes(r chi.Router) {
 	r.Get("/api/v1/health", h.Health)
 	r.With(h.authMiddleware, h.rateLimitMiddleware).Post("/api/v1/sql/generate", h.Generate)
+	if h.opts.DebugEndpoint {
+		r.With(h.authMiddleware, h.rateLimitMiddleware).Post("/api/v1/debug/prompt", h.RenderPrompt)
+	}
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Get("/api/v1/conversations", h.ListConversations)
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Get("/api/v1/conversations/{id}", h.GetConversation)
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Patch("/api/v1/conversations/{id}", h.UpdateConversation)
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Delete("/api/v1/conversations/{id}", h.DeleteConversation)
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Post("/api/v1/conversations/{id}/fork", h.ForkConversation)
+	r.With(h.authMiddleware, h.rateLimitMiddleware).Post("/api/v1/conversations/{id}/rollback", h.RollbackConversation)
 }
 
 // authMiddleware API Key 认证
@@ -51,14 +102,21 @@ func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "缺少 API Key")
 			return
 		}
-		if !h.apiKeys[key] {
+		principal, ok := h.principals[key]
+		if !ok {
 			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "API Key 无效")
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(text2sql.WithPrincipal(r.Context(), principal)))
 	})
 }
 
+// apiKeyOwner 由 API Key 派生未命名请求方的名称，存储中不保存 Key 本身
+func apiKeyOwner(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
 func extractAPIKey(r *http.Request) string {
 	if k := r.Header.Get("Authorization"); k != "" {
 		if strings.HasPrefix(k, "Bearer ") {
@@ -87,10 +145,201 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 
 // Generate 生成 SQL
 func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" && !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+	req, ok := h.decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := h.text2sql.Generate(r.Context(), req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RenderPrompt 调试接口：返回按请求构建的 LLM 消息，不调用 LLM
+func (h *Handler) RenderPrompt(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := h.text2sql.RenderPrompt(r.Context(), req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListConversations 分页列出当前请求方的会话，支持按 database_type 和 updated_after/updated_before（RFC3339）过滤
+func (h *Handler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseConversationFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	page, err := h.text2sql.ListConversations(r.Context(), filter)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseConversationFilter 解析会话列表的查询参数
+func parseConversationFilter(q url.Values) (text2sql.ConversationFilter, error) {
+	filter := text2sql.ConversationFilter{DatabaseType: q.Get("database_type")}
+	for _, p := range []struct {
+		name string
+		dst  *int
+		min  int
+		max  int
+	}{
+		{"limit", &filter.Limit, 1, text2sql.MaxConversationPageSize},
+		{"offset", &filter.Offset, 0, math.MaxInt32},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < p.min || n > p.max {
+			return filter, fmt.Errorf("%s 必须为 %d 到 %d 之间的整数", p.name, p.min, p.max)
+		}
+		*p.dst = n
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("%s 必须为 RFC3339 时间，如 2024-01-02T15:04:05Z", p.name)
+		}
+		*p.dst = t
+	}
+	if v := q.Get("pinned"); v != "" {
+		pinned, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("pinned 必须为 true 或 false")
+		}
+		filter.Pinned = &pinned
+	}
+	return filter, nil
+}
+
+// GetConversation 获取会话详情与完整的对话历史
+func (h *Handler) GetConversation(w http.ResponseWriter, r *http.Request) {
+	detail, err := h.text2sql.GetConversation(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// UpdateConversation 修改会话的 title、tags、pinned 和 shared_with
+func (h *Handler) UpdateConversation(w http.ResponseWriter, r *http.Request) {
+	var update text2sql.ConversationUpdate
+	if !decodeJSONBody(w, r, &update, false) {
+		return
+	}
+	detail, err := h.text2sql.UpdateConversation(r.Context(), chi.URLParam(r, "id"), update)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// forkRequest 分叉请求，turn 省略时复制全部轮次
+type forkRequest struct {
+	Turn *int `json:"turn"`
+}
+
+// ForkConversation 从指定轮次分叉出新会话
+func (h *Handler) ForkConversation(w http.ResponseWriter, r *http.Request) {
+	var req forkRequest
+	if !decodeJSONBody(w, r, &req, true) {
+		return
+	}
+	detail, err := h.text2sql.ForkConversation(r.Context(), chi.URLParam(r, "id"), req.Turn)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, detail)
+}
+
+// rollbackRequest 回滚请求，turns 省略时回滚 1 轮
+type rollbackRequest struct {
+	Turns int `json:"turns"`
+}
+
+// RollbackConversation 删除会话最后 N 轮
+func (h *Handler) RollbackConversation(w http.ResponseWriter, r *http.Request) {
+	req := rollbackRequest{Turns: 1}
+	if !decodeJSONBody(w, r, &req, true) {
+		return
+	}
+	detail, err := h.text2sql.RollbackConversation(r.Context(), chi.URLParam(r, "id"), req.Turns)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// decodeJSONBody 解析 JSON 请求体，失败时已写入错误响应。optional 为 true 时允许空请求体
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any, optional bool) bool {
+	if optional && r.ContentLength == 0 {
+		return true
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
 		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Content-Type 必须为 application/json")
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if optional && errors.Is(err, io.EOF) {
+			return true
+		}
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "请求体解析失败: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// DeleteConversation 删除会话
+func (h *Handler) DeleteConversation(w http.ResponseWriter, r *http.Request) {
+	if err := h.text2sql.DeleteConversation(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeServiceError(w, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeGenerateRequest 解析并校验生成请求，失败时已写入错误响应
+func (h *Handler) decodeGenerateRequest(w http.ResponseWriter, r *http.Request) (*text2sql.GenerateRequest, bool) {
+	if r.Header.Get("Content-Type") != "application/json" && !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Content-Type 必须为 application/json")
+		return nil, false
+	}
 
 	var req text2sql.GenerateRequest
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
@@ -98,81 +347,126 @@ func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
 		var maxErr *http.MaxBytesError
 		if errors.As(err, &maxErr) {
 			writeError(w, http.StatusRequestEntityTooLarge, "INVALID_REQUEST", "请求体过大")
-			return
+			return nil, false
 		}
 		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "请求体解析失败: "+err.Error())
-		return
+		return nil, false
 	}
 
 	if err := h.validate.Struct(&req); err != nil {
 		if ve, ok := err.(validator.ValidationErrors); ok {
 			writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "参数校验失败: "+ve.Error())
-			return
+			return nil, false
 		}
 		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "参数校验失败")
-		return
+		return nil, false
 	}
 
 	if req.Query == "" {
 		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "query 不能为空")
-		return
+		return nil, false
+	}
+	// 未指定 language 时按 Accept-Language 选择，仍无法确定时使用默认语言
+	if req.Language == "" {
+		req.Language = text2sql.LanguageFromAcceptLanguage(r.Header.Get("Accept-Language"))
+	} else if lang, ok := text2sql.NormalizeLanguage(req.Language); ok {
+		req.Language = lang
+	} else {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "不支持的 language: "+req.Language+"（可选 "+strings.Join(text2sql.SupportedLanguages(), "、")+"）")
+		return nil, false
 	}
 	// 新会话或 conversation_id 无效时，schema 和 database 必填
-	if req.ConversationID == "" && (len(req.Schema.Tables) == 0 || req.Database.Type == "") {
-		if len(req.Schema.Tables) == 0 {
-			writeError(w, http.StatusBadRequest, "INVALID_SCHEMA", "新会话需提供 schema.tables")
-			return
+	if req.ConversationID == "" && (req.Schema.IsEmpty() || req.Database.Type == "") {
+		if req.Schema.IsEmpty() {
+			writeError(w, http.StatusBadRequest, "INVALID_SCHEMA", "新会话需提供 schema（tables、keys、collections、indices 或 nodes）")
+			return nil, false
 		}
 		writeError(w, http.StatusBadRequest, "INVALID_DATABASE", "新会话需提供 database.type")
-		return
+		return nil, false
 	}
+	return &req, true
+}
 
-	resp, err := h.text2sql.Generate(r.Context(), &req)
-	if err != nil {
-		if errors.Is(err, text2sql.ErrSQLValidation) {
-			writeError(w, http.StatusBadRequest, "SQL_VALIDATION_FAILED", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrConversationNotFound) {
-			writeError(w, http.StatusNotFound, "CONVERSATION_NOT_FOUND", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrSchemaMismatch) {
-			writeError(w, http.StatusBadRequest, "SCHEMA_MISMATCH", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrDatabaseMismatch) {
-			writeError(w, http.StatusBadRequest, "DATABASE_MISMATCH", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrSchemaRequired) {
-			writeError(w, http.StatusBadRequest, "SCHEMA_REQUIRED", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrDatabaseRequired) {
-			writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", err.Error())
-			return
-		}
-		if errors.Is(err, text2sql.ErrLLMError) {
-			writeError(w, http.StatusInternalServerError, "LLM_ERROR", err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "INVALID_REQUEST", err.Error())
+// writeServiceError 将 Service 返回的错误映射为错误码
+func writeServiceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, text2sql.ErrSQLValidation) {
+		var diags text2sql.Diagnostics
+		errors.As(err, &diags)
+		writeErrorWithDiagnostics(w, http.StatusBadRequest, "SQL_VALIDATION_FAILED", err.Error(), diags)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	if errors.Is(err, text2sql.ErrConversationNotFound) {
+		writeError(w, http.StatusNotFound, "CONVERSATION_NOT_FOUND", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrSchemaMismatch) {
+		var diff text2sql.SchemaDiff
+		errors.As(err, &diff)
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: "SCHEMA_MISMATCH", Message: err.Error(), SchemaDiff: diff})
+		return
+	}
+	if errors.Is(err, text2sql.ErrDatabaseMismatch) {
+		writeError(w, http.StatusBadRequest, "DATABASE_MISMATCH", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrSchemaRequired) {
+		writeError(w, http.StatusBadRequest, "SCHEMA_REQUIRED", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrDatabaseRequired) {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrUnsupportedDatabase) {
+		writeError(w, http.StatusBadRequest, "UNSUPPORTED_DATABASE", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrInvalidConversationUpdate) {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrInvalidTurn) {
+		writeError(w, http.StatusBadRequest, "INVALID_TURN", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrTurnLimitExceeded) {
+		writeError(w, http.StatusConflict, "TURN_LIMIT_EXCEEDED", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrConversationLimitExceeded) {
+		writeError(w, http.StatusConflict, "CONVERSATION_LIMIT_EXCEEDED", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrForbidden) {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+		return
+	}
+	if errors.Is(err, text2sql.ErrLLMError) {
+		writeError(w, http.StatusInternalServerError, "LLM_ERROR", err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "INVALID_REQUEST", err.Error())
 }
 
 type errorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code        string               `json:"code"`
+	Message     string               `json:"message"`
+	Diagnostics text2sql.Diagnostics `json:"diagnostics,omitempty"` // 校验失败时的结构化诊断
+	SchemaDiff  text2sql.SchemaDiff  `json:"schema_diff,omitempty"` // schema 与历史会话不一致时的结构变更
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
 }
 
 func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorWithDiagnostics(w, status, code, message, nil)
+}
+
+func writeErrorWithDiagnostics(w http.ResponseWriter, status int, code, message string, diags text2sql.Diagnostics) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+	_ = json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message, Diagnostics: diags})
 }
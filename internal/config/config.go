@@ -5,20 +5,45 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"text2sql/internal/llmfactory"
+	"text2sql/internal/principal"
 )
 
 // Config 应用配置
 type Config struct {
 	Server       ServerConfig              `yaml:"server"`
 	APIKey       string                    `yaml:"api_key"`
-	APIKeys      []string                  `yaml:"api_keys"` // 支持多个 API Key
+	APIKeys      []APIKeyConfig            `yaml:"api_keys"` // 支持多个 API Key
 	Database     DatabaseConfig            `yaml:"database"`
-	ContextStore string                    `yaml:"context_store"` // memory | sqlite，默认 memory
+	ContextStore string                    `yaml:"context_store"` // memory | sqlite | redis | sql，默认 memory
+	Redis        RedisConfig               `yaml:"redis"`         // context_store 为 redis 时使用
+	Retention    RetentionConfig           `yaml:"retention"`
+	Encryption   EncryptionConfig          `yaml:"encryption"` // context_store 为 sqlite 时可加密存储的会话内容
 	LLM          llmfactory.ProviderConfig `yaml:"llm"`
+	Validator    ValidatorConfig           `yaml:"validator"`
+	Prompts      PromptsConfig             `yaml:"prompts"`
+}
+
+// APIKeyConfig API Key 及其对应的请求方。会话归属请求方，同一租户内可通过 shared_with 共享；
+// 在 YAML 中也可以直接写 Key 字符串，此时请求方名称由 Key 的摘要派生
+type APIKeyConfig struct {
+	Key    string `yaml:"key"`    // 支持 ${ENV} 展开
+	Name   string `yaml:"name"`   // 可选：请求方名称，多个 Key 可使用同一名称以访问相同的会话
+	Tenant string `yaml:"tenant"` // 可选：租户，不同租户之间不能共享会话
+}
+
+// UnmarshalYAML 兼容 api_keys 的字符串写法
+func (k *APIKeyConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		k.Key = node.Value
+		return nil
+	}
+	type plain APIKeyConfig
+	return node.Decode((*plain)(k))
 }
 
 // ServerConfig 服务配置
@@ -26,10 +51,74 @@ type ServerConfig struct {
 	Port int `yaml:"port"`
 }
 
-// DatabaseConfig 数据库配置
+// DatabaseConfig 数据库配置。context_store 为 sql 时 driver 可选 postgres、mysql、sqlite
 type DatabaseConfig struct {
-	Driver string `yaml:"driver"`
-	DSN    string `yaml:"dsn"`
+	Driver          string        `yaml:"driver"`
+	DSN             string        `yaml:"dsn"`                // 支持 ${ENV} 展开
+	MaxOpenConns    int           `yaml:"max_open_conns"`     // 最大连接数，默认 25
+	MaxIdleConns    int           `yaml:"max_idle_conns"`     // 最大空闲连接数，默认 5
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // 连接最长存活时间，默认 5m
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // 连接最长空闲时间，0 表示不限制
+	// DisableAutoMigrate context_store 为 sqlite 时启动不自动迁移表结构，需先执行 server migrate up
+	DisableAutoMigrate bool `yaml:"disable_auto_migrate"`
+}
+
+// RedisConfig Redis 上下文存储配置
+type RedisConfig struct {
+	Addr      string `yaml:"addr"`       // 地址，默认 localhost:6379
+	Username  string `yaml:"username"`   // ACL 用户名，可选
+	Password  string `yaml:"password"`   // 密码，支持 ${ENV} 展开
+	DB        int    `yaml:"db"`         // 数据库编号
+	KeyPrefix string `yaml:"key_prefix"` // key 前缀，默认 text2sql:
+}
+
+// EncryptionConfig 会话内容的信封加密（AES-256-GCM）。active_key 为空时新会话不加密，keys 中的密钥仍用于读取已加密的会话
+type EncryptionConfig struct {
+	ActiveKey string                `yaml:"active_key"` // 加密新会话使用的密钥 ID
+	Keys      []EncryptionKeyConfig `yaml:"keys"`       // 轮换期间保留旧密钥，重新加密完成后再移除
+}
+
+// EncryptionKeyConfig 主密钥，key 与 key_file 二选一
+type EncryptionKeyConfig struct {
+	ID      string `yaml:"id"`       // 保存在每个会话中，用于选择解密的主密钥
+	Key     string `yaml:"key"`      // base64 编码的 32 字节密钥，支持 ${ENV} 展开
+	KeyFile string `yaml:"key_file"` // 密钥文件，内容为 32 字节原始密钥或其 base64 编码
+}
+
+// RetentionConfig 会话保留策略与数量限制，对所有上下文存储生效；置顶的会话不过期也不被淘汰
+type RetentionConfig struct {
+	SlidingTTL             time.Duration `yaml:"sliding_ttl"`               // 最后一次使用后的保留时间，默认 24h，负数表示不按最后使用时间过期
+	AbsoluteTTL            time.Duration `yaml:"absolute_ttl"`              // 创建后的最长保留时间，0 表示不限制
+	CleanupInterval        time.Duration `yaml:"cleanup_interval"`          // 后台清理间隔，默认 1h（redis 由原生 TTL 过期）
+	MaxTurns               int           `yaml:"max_turns"`                 // 单个会话的最大轮数，0 表示不限制
+	MaxConversationsPerKey int           `yaml:"max_conversations_per_key"` // 每个 API Key 的最大会话数，超出时淘汰最久未使用的会话，0 表示不限制
+}
+
+// PromptsConfig 外部提示词模板
+type PromptsConfig struct {
+	Dir            string        `yaml:"dir"`             // 模板目录，为空时只使用内置提示词
+	ReloadInterval time.Duration `yaml:"reload_interval"` // 检查模板变更的间隔，默认 2s，负数表示只在 SIGHUP 时重新加载
+	DebugEndpoint  bool          `yaml:"debug_endpoint"`  // 是否开放 POST /api/v1/debug/prompt，默认关闭
+}
+
+// ValidatorConfig 校验器配置
+type ValidatorConfig struct {
+	Redis      RedisValidatorConfig      `yaml:"redis"`
+	ClickHouse ClickHouseValidatorConfig `yaml:"clickhouse"`
+	MaxRows    int                       `yaml:"max_rows"` // 生成语句的行数上限，0 表示不改写（目前用于 mssql 的 TOP 改写）
+}
+
+// RedisValidatorConfig Redis 命令限制，数值为 0 时使用默认值，负数表示不限制
+type RedisValidatorConfig struct {
+	AllowUnboundedKeys bool `yaml:"allow_unbounded_keys"` // 是否允许 KEYS * 这类无前缀匹配
+	MaxScanCount       int  `yaml:"max_scan_count"`       // SCAN 系列 COUNT 上限，默认 1000
+	MaxRangeSize       int  `yaml:"max_range_size"`       // LRANGE/ZRANGE 单次返回元素上限，默认 1000
+}
+
+// ClickHouseValidatorConfig ClickHouse 查询防护
+type ClickHouseValidatorConfig struct {
+	AllowFullScan  bool  `yaml:"allow_full_scan"`  // 是否允许大表不带分区键过滤
+	LargeTableRows int64 `yaml:"large_table_rows"` // 大表行数阈值，默认 10000000，负数表示所有分区表
 }
 
 // Load 加载配置文件
@@ -47,8 +136,13 @@ func Load(path string) (*Config, error) {
 	// 展开环境变量
 	cfg.APIKey = os.ExpandEnv(cfg.APIKey)
 	for i := range cfg.APIKeys {
-		cfg.APIKeys[i] = os.ExpandEnv(cfg.APIKeys[i])
+		cfg.APIKeys[i].Key = os.ExpandEnv(cfg.APIKeys[i].Key)
 	}
+	for i := range cfg.Encryption.Keys {
+		cfg.Encryption.Keys[i].Key = os.ExpandEnv(cfg.Encryption.Keys[i].Key)
+	}
+	cfg.Redis.Password = os.ExpandEnv(cfg.Redis.Password)
+	cfg.Database.DSN = os.ExpandEnv(cfg.Database.DSN)
 	if cfg.LLM.OpenAI != nil {
 		cfg.LLM.OpenAI.APIKey = os.ExpandEnv(cfg.LLM.OpenAI.APIKey)
 	}
@@ -66,7 +160,7 @@ func Load(path string) (*Config, error) {
 
 	// 如果只有一个 api_key，添加到 api_keys 列表
 	if cfg.APIKey != "" && len(cfg.APIKeys) == 0 {
-		cfg.APIKeys = []string{cfg.APIKey}
+		cfg.APIKeys = []APIKeyConfig{{Key: cfg.APIKey}}
 	}
 
 	// 默认值
@@ -82,6 +176,29 @@ func Load(path string) (*Config, error) {
 	if cfg.ContextStore == "" {
 		cfg.ContextStore = "memory"
 	}
+	if cfg.ContextStore == "redis" {
+		if cfg.Redis.Addr == "" {
+			cfg.Redis.Addr = "localhost:6379"
+		}
+	}
+	if cfg.Retention.SlidingTTL == 0 {
+		cfg.Retention.SlidingTTL = 24 * time.Hour
+	}
+	if cfg.Retention.CleanupInterval == 0 {
+		cfg.Retention.CleanupInterval = time.Hour
+	}
+	if cfg.Validator.Redis.MaxScanCount == 0 {
+		cfg.Validator.Redis.MaxScanCount = 1000
+	}
+	if cfg.Validator.Redis.MaxRangeSize == 0 {
+		cfg.Validator.Redis.MaxRangeSize = 1000
+	}
+	if cfg.Prompts.Dir != "" && cfg.Prompts.ReloadInterval == 0 {
+		cfg.Prompts.ReloadInterval = 2 * time.Second
+	}
+	if cfg.Validator.ClickHouse.LargeTableRows == 0 {
+		cfg.Validator.ClickHouse.LargeTableRows = 10_000_000
+	}
 
 	// 验证配置
 	if err := cfg.Validate(); err != nil {
@@ -110,6 +227,24 @@ func (c *Config) Validate() error {
 	if len(c.APIKeys) == 0 && c.APIKey == "" {
 		return errors.New("api_key or api_keys is required")
 	}
+	seen := make(map[string]APIKeyConfig, len(c.APIKeys))
+	for i, k := range c.APIKeys {
+		if k.Key == "" {
+			return fmt.Errorf("api_keys[%d].key is required", i)
+		}
+		for field, v := range map[string]string{"name": k.Name, "tenant": k.Tenant} {
+			if v == "" {
+				continue
+			}
+			if err := principal.ValidateName(v); err != nil {
+				return fmt.Errorf("invalid api_keys[%d].%s: %w", i, field, err)
+			}
+		}
+		if prev, ok := seen[k.Key]; ok && prev != k {
+			return fmt.Errorf("api_keys[%d]: the same key is mapped to different principals", i)
+		}
+		seen[k.Key] = k
+	}
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		return errors.New("invalid server port (must be 1-65535)")
 	}
@@ -122,8 +257,74 @@ func (c *Config) Validate() error {
 	if !validProviders[c.LLM.Provider] {
 		return fmt.Errorf("invalid llm.provider: %s (supported: ollama, openai, openrouter, kimi)", c.LLM.Provider)
 	}
-	if c.ContextStore != "memory" && c.ContextStore != "sqlite" {
-		return fmt.Errorf("invalid context_store: %s (must be memory or sqlite)", c.ContextStore)
+	for name, h := range c.LLM.History {
+		if name != "default" && !validProviders[name] {
+			return fmt.Errorf("invalid llm.history key: %s (must be default or a provider name)", name)
+		}
+		switch h.Strategy {
+		case "", "summary", "recent", "none":
+		default:
+			return fmt.Errorf("invalid llm.history.%s.strategy: %s (must be summary, recent or none)", name, h.Strategy)
+		}
+		if h.BudgetTokens < 0 || h.SummaryTokens < 0 {
+			return fmt.Errorf("llm.history.%s token limits must not be negative", name)
+		}
+	}
+	switch c.ContextStore {
+	case "memory", "sqlite":
+	case "sql":
+		switch c.Database.Driver {
+		case "postgres", "mysql", "sqlite":
+		default:
+			return fmt.Errorf("invalid database.driver: %s (context_store sql supports postgres, mysql, sqlite)", c.Database.Driver)
+		}
+		if c.Database.DSN == "" {
+			return errors.New("database.dsn is required when context_store is sql")
+		}
+		if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+			return errors.New("database connection pool sizes must not be negative")
+		}
+	case "redis":
+		if c.Redis.Addr == "" {
+			return errors.New("redis.addr is required when context_store is redis")
+		}
+	default:
+		return fmt.Errorf("invalid context_store: %s (must be memory, sqlite, redis or sql)", c.ContextStore)
+	}
+	if c.Retention.AbsoluteTTL < 0 || c.Retention.CleanupInterval < 0 {
+		return errors.New("retention.absolute_ttl and retention.cleanup_interval must not be negative")
+	}
+	if c.Retention.MaxTurns < 0 || c.Retention.MaxConversationsPerKey < 0 {
+		return errors.New("retention limits must not be negative")
+	}
+	if err := c.Encryption.validate(c.ContextStore); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e EncryptionConfig) validate(contextStore string) error {
+	if len(e.Keys) == 0 && e.ActiveKey == "" {
+		return nil
+	}
+	if contextStore != "sqlite" {
+		return fmt.Errorf("encryption is only supported by context_store sqlite, got %s", contextStore)
+	}
+	ids := make(map[string]bool, len(e.Keys))
+	for i, k := range e.Keys {
+		if k.ID == "" {
+			return fmt.Errorf("encryption.keys[%d].id is required", i)
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("duplicate encryption key id: %s", k.ID)
+		}
+		ids[k.ID] = true
+		if (k.Key == "") == (k.KeyFile == "") {
+			return fmt.Errorf("encryption.keys[%d]: exactly one of key and key_file is required", i)
+		}
+	}
+	if e.ActiveKey != "" && !ids[e.ActiveKey] {
+		return fmt.Errorf("encryption.active_key %s is not in encryption.keys", e.ActiveKey)
 	}
 	return nil
 }
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"reflect"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 
 	"text2sql/internal/llmfactory"
 )
@@ -25,7 +29,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid config with api_keys",
 			config: Config{
-				APIKeys:      []string{"key1", "key2"},
+				APIKeys:      []APIKeyConfig{{Key: "key1"}, {Key: "key2"}},
 				Server:       ServerConfig{Port: 8080},
 				LLM:          llmfactory.ProviderConfig{Provider: "openai"},
 				ContextStore: "sqlite",
@@ -61,6 +65,201 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid redis context store",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "redis",
+				Redis:        RedisConfig{Addr: "localhost:6379"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "redis context store without addr",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "redis",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid sql context store",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "sql",
+				Database:     DatabaseConfig{Driver: "postgres", DSN: "postgres://localhost/text2sql"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "sql context store with unsupported driver",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "sql",
+				Database:     DatabaseConfig{Driver: "oracle", DSN: "oracle://localhost"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid llm history",
+			config: Config{
+				APIKey: "test-key",
+				Server: ServerConfig{Port: 8080},
+				LLM: llmfactory.ProviderConfig{Provider: "ollama", History: map[string]llmfactory.HistoryConfig{
+					"default": {Strategy: "summary", BudgetTokens: 4000},
+					"ollama":  {BudgetTokens: 1000},
+				}},
+				ContextStore: "memory",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid llm history strategy",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama", History: map[string]llmfactory.HistoryConfig{"default": {Strategy: "all"}}},
+				ContextStore: "memory",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid llm history provider",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama", History: map[string]llmfactory.HistoryConfig{"gemini": {BudgetTokens: 1000}}},
+				ContextStore: "memory",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid retention",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+				Retention:    RetentionConfig{SlidingTTL: -1, AbsoluteTTL: 720 * time.Hour, MaxTurns: 50, MaxConversationsPerKey: 100},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative retention limit",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+				Retention:    RetentionConfig{MaxTurns: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative absolute ttl",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+				Retention:    RetentionConfig{AbsoluteTTL: -time.Hour},
+			},
+			wantErr: true,
+		},
+		{
+			name: "api keys with principals",
+			config: Config{
+				APIKeys:      []APIKeyConfig{{Key: "k1", Name: "alice", Tenant: "acme"}, {Key: "k2", Name: "alice", Tenant: "acme"}, {Key: "k1", Name: "alice", Tenant: "acme"}},
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid principal name",
+			config: Config{
+				APIKeys:      []APIKeyConfig{{Key: "k1", Name: "acme/alice"}},
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+			},
+			wantErr: true,
+		},
+		{
+			name: "key mapped to different principals",
+			config: Config{
+				APIKeys:      []APIKeyConfig{{Key: "k1", Name: "alice"}, {Key: "k1", Name: "bob"}},
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid encryption",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "sqlite",
+				Encryption: EncryptionConfig{ActiveKey: "k2", Keys: []EncryptionKeyConfig{
+					{ID: "k1", Key: "base64-key"}, {ID: "k2", KeyFile: "/run/secrets/k2"},
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "encryption unknown active key",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "sqlite",
+				Encryption:   EncryptionConfig{ActiveKey: "k2", Keys: []EncryptionKeyConfig{{ID: "k1", Key: "base64-key"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "encryption key and key_file",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "sqlite",
+				Encryption:   EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k1", Key: "base64-key", KeyFile: "/run/secrets/k1"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "encryption unsupported store",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "memory",
+				Encryption:   EncryptionConfig{ActiveKey: "k1", Keys: []EncryptionKeyConfig{{ID: "k1", Key: "base64-key"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid context store",
+			config: Config{
+				APIKey:       "test-key",
+				Server:       ServerConfig{Port: 8080},
+				LLM:          llmfactory.ProviderConfig{Provider: "ollama"},
+				ContextStore: "etcd",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -72,3 +271,21 @@ func TestConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyConfig_UnmarshalYAML(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+api_keys:
+  - plain-key
+  - key: named-key
+    name: alice
+    tenant: acme
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKeyConfig{{Key: "plain-key"}, {Key: "named-key", Name: "alice", Tenant: "acme"}}
+	if !reflect.DeepEqual(cfg.APIKeys, want) {
+		t.Errorf("api_keys = %+v, want %+v", cfg.APIKeys, want)
+	}
+}
@@ -66,6 +66,11 @@ func (cp *CachedProvider) generateCacheKey(req *CompleteRequest) string {
 		hash.Write([]byte(msg.Content))
 	}
 	hash.Write([]byte(req.Model))
+	// 结构化与自由文本的输出格式不同，不能共用缓存
+	if req.ResponseFormat != nil {
+		hash.Write([]byte(req.ResponseFormat.Name))
+		hash.Write(req.ResponseFormat.Schema)
+	}
 	return hex.EncodeToString(hash.Sum(nil))
 }
 
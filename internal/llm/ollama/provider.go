@@ -56,6 +56,8 @@ type ollamaRequest struct {
 	Stream      bool      `json:"stream"`
 	Options     options   `json:"options,omitempty"`
 	Temperature *float64  `json:"temperature,omitempty"`
+	// Format 结构化输出的 JSON Schema（Ollama 0.5 及以上）
+	Format json.RawMessage `json:"format,omitempty"`
 }
 
 type message struct {
@@ -92,6 +94,9 @@ func (p *Provider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm
 	if t > 0 {
 		body.Temperature = &t
 	}
+	if req.ResponseFormat != nil {
+		body.Format = req.ResponseFormat.Schema
+	}
 
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -59,6 +59,19 @@ type openaiRequest struct {
 	Messages    []message `json:"messages"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	Temperature float64   `json:"temperature,omitempty"`
+	// ResponseFormat 结构化输出，type 为 json_schema
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *jsonSchema `json:"json_schema,omitempty"`
+}
+
+type jsonSchema struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict"`
+	Schema json.RawMessage `json:"schema"`
 }
 
 type message struct {
@@ -96,6 +109,12 @@ func (p *Provider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm
 	if body.MaxTokens <= 0 {
 		body.MaxTokens = 2048
 	}
+	if f := req.ResponseFormat; f != nil {
+		body.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: &jsonSchema{Name: f.Name, Strict: true, Schema: f.Schema},
+		}
+	}
 
 	data, err := json.Marshal(body)
 	if err != nil {
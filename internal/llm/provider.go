@@ -1,6 +1,9 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 // Provider 统一 LLM provider 接口
 type Provider interface {
@@ -14,6 +17,14 @@ type CompleteRequest struct {
 	Messages    []Message // 消息列表
 	MaxTokens   int       // 最大生成 token 数
 	Temperature float64   // 温度
+	// ResponseFormat 结构化输出约束（可选），为 nil 时模型返回自由文本
+	ResponseFormat *ResponseFormat
+}
+
+// ResponseFormat 要求模型返回符合 JSON Schema 的 JSON 对象
+type ResponseFormat struct {
+	Name   string          // schema 名称，只能包含字母、数字、_ 和 -（OpenAI 要求）
+	Schema json.RawMessage // JSON Schema
 }
 
 // CompleteResponse 标准化响应
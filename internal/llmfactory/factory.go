@@ -16,6 +16,10 @@ type ProviderConfig struct {
 	OpenAI     *openai.Config   `yaml:"openai,omitempty"`
 	OpenRouter *openai.Config   `yaml:"openrouter,omitempty"` // OpenAI 兼容 API
 	Kimi       *openai.Config   `yaml:"kimi,omitempty"`       // Kimi 月之暗面，OpenAI 兼容 API
+	// StructuredOutput 是否要求模型按 JSON Schema 返回结构化结果（OpenAI response_format / Ollama format）
+	StructuredOutput bool `yaml:"structured_output"`
+	// History 多轮对话历史的预算与策略，default 对所有 provider 生效，以 provider 名为 key 的配置覆盖 default
+	History map[string]HistoryConfig `yaml:"history"`
 }
 
 // NewProviderFromConfig 根据配置创建 Provider
@@ -23,14 +27,11 @@ func NewProviderFromConfig(cfg *ProviderConfig) (llm.Provider, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("llm config is nil")
 	}
-	name := cfg.Provider
-	if name == "" {
-		name = "ollama"
-	}
+	name := cfg.providerName()
 
 	switch name {
 	case "ollama":
-		c := ollama.Config{BaseURL: "http://localhost:11434", Model: "llama3"}
+		c := ollama.Config{BaseURL: "http://localhost:11434", Model: defaultModels["ollama"]}
 		if cfg.Ollama != nil {
 			if cfg.Ollama.BaseURL != "" {
 				c.BaseURL = cfg.Ollama.BaseURL
@@ -41,7 +42,7 @@ func NewProviderFromConfig(cfg *ProviderConfig) (llm.Provider, error) {
 		}
 		return ollama.New(&c), nil
 	case "openai":
-		c := openai.Config{BaseURL: "https://api.openai.com/v1", Model: "gpt-4o"}
+		c := openai.Config{BaseURL: "https://api.openai.com/v1", Model: defaultModels["openai"]}
 		if cfg.OpenAI != nil {
 			if cfg.OpenAI.APIKey != "" {
 				c.APIKey = cfg.OpenAI.APIKey
@@ -55,7 +56,7 @@ func NewProviderFromConfig(cfg *ProviderConfig) (llm.Provider, error) {
 		}
 		return openai.New(&c), nil
 	case "openrouter":
-		c := openai.Config{BaseURL: "https://openrouter.ai/api/v1", Model: "anthropic/claude-3-haiku"}
+		c := openai.Config{BaseURL: "https://openrouter.ai/api/v1", Model: defaultModels["openrouter"]}
 		if cfg.OpenRouter != nil {
 			if cfg.OpenRouter.APIKey != "" {
 				c.APIKey = cfg.OpenRouter.APIKey
@@ -69,7 +70,7 @@ func NewProviderFromConfig(cfg *ProviderConfig) (llm.Provider, error) {
 		}
 		return openai.New(&c), nil
 	case "kimi":
-		c := openai.Config{BaseURL: "https://api.moonshot.cn/v1", Model: "kimi-k2.5"}
+		c := openai.Config{BaseURL: "https://api.moonshot.cn/v1", Model: defaultModels["kimi"]}
 		if cfg.Kimi != nil {
 			if cfg.Kimi.APIKey != "" {
 				c.APIKey = cfg.Kimi.APIKey
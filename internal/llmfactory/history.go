@@ -0,0 +1,116 @@
+package llmfactory
+
+import "strings"
+
+// HistoryConfig 多轮对话历史的 token 预算与策略
+type HistoryConfig struct {
+	Strategy      string `yaml:"strategy"`       // summary（默认）| recent | none
+	BudgetTokens  int    `yaml:"budget_tokens"`  // 历史（含摘要）可占用的 token 数，0 表示按模型取默认值
+	SummaryTokens int    `yaml:"summary_tokens"` // 滚动摘要的 token 上限，0 表示默认 400
+}
+
+// defaultModels 各 provider 未配置 model 时使用的模型
+var defaultModels = map[string]string{
+	"ollama":     "llama3",
+	"openai":     "gpt-4o",
+	"openrouter": "anthropic/claude-3-haiku",
+	"kimi":       "kimi-k2.5",
+}
+
+// defaultHistoryBudget 未知模型的历史预算
+const defaultHistoryBudget = 2000
+
+// modelHistoryBudgets 按模型名前缀取默认历史预算，约为上下文窗口的 1/16，其余留给 schema、提示词和输出。
+// 按顺序匹配，更具体的前缀在前
+var modelHistoryBudgets = []struct {
+	prefix string
+	budget int
+}{
+	{"gpt-3.5", 1000},
+	{"gpt-4o", 8000},
+	{"gpt-4.1", 8000},
+	{"gpt-4-turbo", 8000},
+	{"gpt-4", 500},
+	{"o1", 8000},
+	{"o3", 8000},
+	{"claude", 12000},
+	{"kimi", 8000},
+	{"moonshot-v1-8k", 500},
+	{"moonshot-v1-32k", 2000},
+	{"moonshot-v1-128k", 8000},
+	{"llama3.1", 8000},
+	{"llama3.2", 8000},
+	{"llama3", 500},
+	{"qwen", 2000},
+}
+
+// HistoryBudgetForModel 返回模型的默认历史预算。模型名忽略大小写、OpenRouter 的厂商前缀和 Ollama 的标签
+func HistoryBudgetForModel(model string) int {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, m := range modelHistoryBudgets {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.budget
+		}
+	}
+	return defaultHistoryBudget
+}
+
+// providerName 未配置 provider 时默认为 ollama
+func (c *ProviderConfig) providerName() string {
+	if c.Provider == "" {
+		return "ollama"
+	}
+	return c.Provider
+}
+
+// Model 返回当前 provider 实际使用的模型
+func (c *ProviderConfig) Model() string {
+	name := c.providerName()
+	var model string
+	switch name {
+	case "ollama":
+		if c.Ollama != nil {
+			model = c.Ollama.Model
+		}
+	case "openai":
+		if c.OpenAI != nil {
+			model = c.OpenAI.Model
+		}
+	case "openrouter":
+		if c.OpenRouter != nil {
+			model = c.OpenRouter.Model
+		}
+	case "kimi":
+		if c.Kimi != nil {
+			model = c.Kimi.Model
+		}
+	}
+	if model == "" {
+		model = defaultModels[name]
+	}
+	return model
+}
+
+// ResolveHistory 返回当前 provider 的历史配置：history.<provider> 中的非零字段覆盖 history.default，
+// 仍未设置预算时按模型取默认值
+func (c *ProviderConfig) ResolveHistory() HistoryConfig {
+	h := c.History["default"]
+	if override, ok := c.History[c.providerName()]; ok {
+		if override.Strategy != "" {
+			h.Strategy = override.Strategy
+		}
+		if override.BudgetTokens != 0 {
+			h.BudgetTokens = override.BudgetTokens
+		}
+		if override.SummaryTokens != 0 {
+			h.SummaryTokens = override.SummaryTokens
+		}
+	}
+	if h.BudgetTokens == 0 {
+		h.BudgetTokens = HistoryBudgetForModel(c.Model())
+	}
+	return h
+}
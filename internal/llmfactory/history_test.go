@@ -0,0 +1,55 @@
+package llmfactory
+
+import (
+	"testing"
+
+	"text2sql/internal/llm/openai"
+)
+
+func TestHistoryBudgetForModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4o-mini", 8000},
+		{"gpt-4", 500},
+		{"anthropic/claude-3-haiku", 12000},
+		{"llama3:8b", 500},
+		{"llama3.1:70b", 8000},
+		{"Qwen2.5:7b", 2000},
+		{"unknown-model", defaultHistoryBudget},
+	}
+	for _, tt := range tests {
+		if got := HistoryBudgetForModel(tt.model); got != tt.want {
+			t.Errorf("HistoryBudgetForModel(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestProviderConfig_ResolveHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ProviderConfig
+		want HistoryConfig
+	}{
+		{"model default", ProviderConfig{Provider: "openai"}, HistoryConfig{BudgetTokens: 8000}},
+		{"configured model", ProviderConfig{Provider: "openai", OpenAI: &openai.Config{Model: "gpt-3.5-turbo"}}, HistoryConfig{BudgetTokens: 1000}},
+		{
+			"provider overrides default",
+			ProviderConfig{Provider: "kimi", History: map[string]HistoryConfig{
+				"default": {Strategy: "recent", BudgetTokens: 3000, SummaryTokens: 200},
+				"kimi":    {BudgetTokens: 6000},
+				"ollama":  {Strategy: "none"},
+			}},
+			HistoryConfig{Strategy: "recent", BudgetTokens: 6000, SummaryTokens: 200},
+		},
+		{"empty provider is ollama", ProviderConfig{History: map[string]HistoryConfig{"ollama": {Strategy: "none"}}}, HistoryConfig{Strategy: "none", BudgetTokens: 500}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.ResolveHistory(); got != tt.want {
+				t.Errorf("ResolveHistory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
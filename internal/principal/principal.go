@@ -0,0 +1,24 @@
+// Package principal 请求方名称规则，由配置校验与会话服务共用，不依赖其他内部包
+package principal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxNameLength 请求方名称或租户的最大字符数
+const MaxNameLength = 64
+
+// ValidateName 校验请求方名称或租户：非空、不超过 64 个字符且不含 / 和空白
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	if len([]rune(name)) > MaxNameLength {
+		return fmt.Errorf("名称 %q 超过 %d 个字符", name, MaxNameLength)
+	}
+	if strings.ContainsAny(name, "/ \t\r\n") {
+		return fmt.Errorf("名称 %q 不能包含 / 或空白", name)
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package text2sql
 
 import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -8,19 +13,38 @@ import (
 // ConversationContext 会话上下文
 type ConversationContext struct {
 	ConversationID string
+	Title          string   // 用户设置的标题，可为空
+	Tags           []string // 用户设置的标签
+	Owner          string   // 所有者：创建会话的请求方 ID（Principal.ID），为空表示未知，不限制访问
+	SharedWith     []string // 被共享的请求方名称，限所有者的租户内
+	Pinned         bool     // 置顶的会话不会过期，也不会因会话数上限被淘汰
 	Schema         Schema
 	Database       Database
 	History        []ConversationTurn
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	// Summary 较早轮次的滚动摘要，覆盖 History 的前 SummarizedTurns 轮
+	Summary         string
+	SummarizedTurns int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// clone 复制会话及其切片字段，使调用方修改副本时不影响存储中的会话。
+// Schema 只会被整体替换，不深拷贝
+func (c *ConversationContext) clone() *ConversationContext {
+	cp := *c
+	cp.Tags = slices.Clone(c.Tags)
+	cp.SharedWith = slices.Clone(c.SharedWith)
+	cp.Database.Modules = slices.Clone(c.Database.Modules)
+	cp.History = slices.Clone(c.History)
+	return &cp
 }
 
 // ConversationTurn 对话轮次
 type ConversationTurn struct {
-	Query       string
-	SQL         string
-	Explanation string
-	Timestamp   time.Time
+	Query       string    `json:"query"`
+	SQL         string    `json:"sql"`
+	Explanation string    `json:"explanation,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
 }
 
 // ContextStore 上下文存储接口
@@ -28,22 +52,183 @@ type ContextStore interface {
 	Get(conversationID string) (*ConversationContext, error)
 	Save(ctx *ConversationContext) error
 	Delete(conversationID string) error
-	Cleanup(maxAge time.Duration) error
+	List(filter ConversationFilter) (*ConversationPage, error) // 按 updated_at 倒序分页列出会话
+	// Fork 将会话的 schema、database、标题、标签和前 turns 轮复制到新会话 newID，turns 为负数时复制全部轮次；
+	// 新会话的所有者为 owner，为空时沿用原会话的所有者；新会话不继承置顶
+	Fork(conversationID, newID, owner string, turns int) (*ConversationContext, error)
+	// Rollback 删除会话最后 n 轮并返回回滚后的会话。
+	// 分叉与回滚后，滚动摘要覆盖的轮次超出剩余历史时清空摘要，由剩余轮次重新生成
+	Rollback(conversationID string, n int) (*ConversationContext, error)
+	// Cleanup 删除按策略已过期的未置顶会话
+	Cleanup(policy RetentionPolicy) error
 	Close() error // 关闭存储，释放资源
 }
 
-// MemoryContextStore 内存上下文存储
+const (
+	DefaultConversationPageSize = 20
+	MaxConversationPageSize     = 100
+)
+
+// ConversationFilter 会话列表的过滤与分页条件，时间范围为 [UpdatedAfter, UpdatedBefore)
+type ConversationFilter struct {
+	DatabaseType  string    // 按数据库类型过滤，为空时不过滤
+	Owner         string    // 按所有者过滤，为空时不过滤
+	Pinned        *bool     // 按是否置顶过滤，nil 时不过滤
+	UpdatedAfter  time.Time // 零值表示不限制
+	UpdatedBefore time.Time // 零值表示不限制
+	Offset        int
+	Limit         int // 0 表示 DefaultConversationPageSize
+}
+
+// normalize 补全默认分页大小，并限制在 MaxConversationPageSize 以内
+func (f ConversationFilter) normalize() ConversationFilter {
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultConversationPageSize
+	}
+	if f.Limit > MaxConversationPageSize {
+		f.Limit = MaxConversationPageSize
+	}
+	return f
+}
+
+// matches 判断会话是否满足过滤条件（不含分页）
+func (f ConversationFilter) matches(c ConversationSummary) bool {
+	if f.DatabaseType != "" && c.Database.Type != f.DatabaseType {
+		return false
+	}
+	if f.Owner != "" && c.Owner != f.Owner {
+		return false
+	}
+	if f.Pinned != nil && c.Pinned != *f.Pinned {
+		return false
+	}
+	if !f.UpdatedAfter.IsZero() && c.UpdatedAt.Before(f.UpdatedAfter) {
+		return false
+	}
+	if !f.UpdatedBefore.IsZero() && !c.UpdatedAt.Before(f.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// ConversationSummary 会话列表项，不含 schema 和对话历史
+type ConversationSummary struct {
+	ConversationID string     `json:"conversation_id"`
+	Title          string     `json:"title"`
+	Tags           []string   `json:"tags"`
+	Owner          string     `json:"owner,omitempty"`
+	Pinned         bool       `json:"pinned"`
+	Database       Database   `json:"database"`
+	TurnCount      int        `json:"turn_count"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // 按保留策略计算的过期时间，置顶或不限制时省略
+}
+
+// ConversationPage 一页会话列表
+type ConversationPage struct {
+	Conversations []ConversationSummary `json:"conversations"`
+	Total         int                   `json:"total"` // 满足过滤条件的会话总数
+	Offset        int                   `json:"offset"`
+	Limit         int                   `json:"limit"`
+}
+
+// summarize 生成会话的列表项
+func summarize(conv *ConversationContext) ConversationSummary {
+	return ConversationSummary{
+		ConversationID: conv.ConversationID,
+		Title:          conv.Title,
+		Tags:           conv.Tags,
+		Owner:          conv.Owner,
+		Pinned:         conv.Pinned,
+		Database:       conv.Database,
+		TurnCount:      len(conv.History),
+		CreatedAt:      conv.CreatedAt,
+		UpdatedAt:      conv.UpdatedAt,
+	}
+}
+
+// forkTurns 校验并返回分叉时复制的轮数
+func forkTurns(turns, total int) (int, error) {
+	if turns < 0 {
+		return total, nil
+	}
+	if turns > total {
+		return 0, fmt.Errorf("%w: 会话只有 %d 轮，无法从第 %d 轮分叉", ErrInvalidTurn, total, turns)
+	}
+	return turns, nil
+}
+
+// checkRollback 校验回滚轮数
+func checkRollback(n, total int) error {
+	if n < 1 || n > total {
+		return fmt.Errorf("%w: 回滚轮数须在 1 到 %d 之间，当前为 %d", ErrInvalidTurn, total, n)
+	}
+	return nil
+}
+
+// encodeStrings 将标签、共享名单等字符串列表编码为 JSON 以便持久化，列表为空时为空字符串
+func encodeStrings(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
+
+// decodeStrings 解析 encodeStrings 的结果
+func decodeStrings(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var tags []string
+	err := json.Unmarshal([]byte(s), &tags)
+	return tags, err
+}
+
+// paginate 对已过滤的会话按 updated_at 倒序排序并分页，供无法在存储端分页的实现使用
+func paginate(items []ConversationSummary, filter ConversationFilter) *ConversationPage {
+	filter = filter.normalize()
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].UpdatedAt.Equal(items[j].UpdatedAt) {
+			return items[i].UpdatedAt.After(items[j].UpdatedAt)
+		}
+		return items[i].ConversationID < items[j].ConversationID
+	})
+	page := &ConversationPage{Conversations: []ConversationSummary{}, Total: len(items), Offset: filter.Offset, Limit: filter.Limit}
+	if filter.Offset < len(items) {
+		end := filter.Offset + filter.Limit
+		if end > len(items) {
+			end = len(items)
+		}
+		page.Conversations = items[filter.Offset:end]
+	}
+	return page
+}
+
+// MemoryContextStore 内存上下文存储。读写都复制会话，调用方持有的会话与存储中的会话互不共享，
+// 只能通过 Save 等方法在锁内修改
 type MemoryContextStore struct {
-	mu     sync.RWMutex
-	store  map[string]*ConversationContext
-	stopCh chan struct{}
+	mu        sync.RWMutex
+	store     map[string]*ConversationContext
+	retention RetentionPolicy
+	stopCh    chan struct{}
 }
 
-// NewMemoryContextStore 创建内存上下文存储
+// NewMemoryContextStore 创建内存上下文存储，使用默认保留策略
 func NewMemoryContextStore() *MemoryContextStore {
+	return NewMemoryContextStoreWithRetention(RetentionPolicy{})
+}
+
+// NewMemoryContextStoreWithRetention 创建按指定保留策略清理的内存上下文存储
+func NewMemoryContextStoreWithRetention(policy RetentionPolicy) *MemoryContextStore {
 	store := &MemoryContextStore{
-		store:  make(map[string]*ConversationContext),
-		stopCh: make(chan struct{}),
+		store:     make(map[string]*ConversationContext),
+		retention: policy.withDefaults(),
+		stopCh:    make(chan struct{}),
 	}
 	// 启动后台清理任务
 	go store.startCleanupTask()
@@ -58,7 +243,7 @@ func (m *MemoryContextStore) Get(conversationID string) (*ConversationContext, e
 	if !ok {
 		return nil, ErrConversationNotFound
 	}
-	return ctx, nil
+	return ctx.clone(), nil
 }
 
 // Save 保存上下文
@@ -66,7 +251,7 @@ func (m *MemoryContextStore) Save(ctx *ConversationContext) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	ctx.UpdatedAt = time.Now()
-	m.store[ctx.ConversationID] = ctx
+	m.store[ctx.ConversationID] = ctx.clone()
 	return nil
 }
 
@@ -78,13 +263,77 @@ func (m *MemoryContextStore) Delete(conversationID string) error {
 	return nil
 }
 
+// List 列出会话
+func (m *MemoryContextStore) List(filter ConversationFilter) (*ConversationPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []ConversationSummary
+	for _, conv := range m.store {
+		if summary := summarize(conv); filter.matches(summary) {
+			items = append(items, summary)
+		}
+	}
+	return paginate(items, filter), nil
+}
+
+// Fork 复制会话
+func (m *MemoryContextStore) Fork(conversationID, newID, owner string, turns int) (*ConversationContext, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	src, ok := m.store[conversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+	turns, err := forkTurns(turns, len(src.History))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	fork := &ConversationContext{
+		ConversationID: newID,
+		Title:          src.Title,
+		Tags:           append([]string(nil), src.Tags...),
+		Owner:          cmp.Or(owner, src.Owner),
+		Schema:         src.Schema,
+		Database:       src.Database,
+		History:        append([]ConversationTurn{}, src.History[:turns]...),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if src.SummarizedTurns <= turns {
+		fork.Summary, fork.SummarizedTurns = src.Summary, src.SummarizedTurns
+	}
+	m.store[newID] = fork
+	return fork.clone(), nil
+}
+
+// Rollback 删除最后 n 轮
+func (m *MemoryContextStore) Rollback(conversationID string, n int) (*ConversationContext, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conv, ok := m.store[conversationID]
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+	if err := checkRollback(n, len(conv.History)); err != nil {
+		return nil, err
+	}
+	// 复制切片，避免调用方持有的旧历史被后续追加覆盖
+	conv.History = append([]ConversationTurn{}, conv.History[:len(conv.History)-n]...)
+	if conv.SummarizedTurns > len(conv.History) {
+		conv.Summary, conv.SummarizedTurns = "", 0
+	}
+	conv.UpdatedAt = time.Now()
+	return conv.clone(), nil
+}
+
 // Cleanup 清理过期上下文
-func (m *MemoryContextStore) Cleanup(maxAge time.Duration) error {
+func (m *MemoryContextStore) Cleanup(policy RetentionPolicy) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	now := time.Now()
 	for id, ctx := range m.store {
-		if now.Sub(ctx.UpdatedAt) > maxAge {
+		if policy.expired(ctx, now) {
 			delete(m.store, id)
 		}
 	}
@@ -93,14 +342,14 @@ func (m *MemoryContextStore) Cleanup(maxAge time.Duration) error {
 
 // startCleanupTask 启动清理任务
 func (m *MemoryContextStore) startCleanupTask() {
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := time.NewTicker(m.retention.CleanupInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-m.stopCh:
 			return
 		case <-ticker.C:
-			_ = m.Cleanup(24 * time.Hour) // 清理24小时未更新的会话
+			_ = m.Cleanup(m.retention)
 		}
 	}
 }
@@ -0,0 +1,478 @@
+package text2sql
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisDefaultKeyPrefix = "text2sql:"
+	redisOpTimeout        = 5 * time.Second
+	redisSaveRetries      = 3
+	redisListBatch        = 100 // List 每次流水线读取的会话数
+)
+
+// RedisStoreOptions Redis 上下文存储选项
+type RedisStoreOptions struct {
+	Addr      string          // 地址，如 localhost:6379
+	Username  string          // ACL 用户名，可选
+	Password  string          // 密码，可选
+	DB        int             // 数据库编号
+	KeyPrefix string          // key 前缀，默认 text2sql:
+	Retention RetentionPolicy // 会话保留策略，由 key 的 TTL 实现；CleanupInterval 不适用
+}
+
+// RedisContextStore Redis 上下文存储，供多实例部署共享会话。
+// 每个会话使用一个 hash 保存元数据、一个 list 按顺序保存对话轮次，两者都按保留策略由 Redis 原生 TTL 过期，
+// 置顶会话不设 TTL，无需后台清理任务。
+// key 中的会话 ID 使用 {} 包裹，集群模式下同一会话的 key 落在同一个槽位，事务只涉及这两个 key。
+// 另有一个以 updated_at 为分数的 sorted set 作为会话索引供 List 使用，它与会话 key 不在同一槽位，
+// 在会话事务提交后单独更新；索引中残留的已删除或已过期会话在 List 时移除。
+type RedisContextStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	retention RetentionPolicy
+}
+
+// NewRedisContextStore 连接 Redis 并创建上下文存储
+func NewRedisContextStore(opts RedisStoreOptions) (*RedisContextStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Username: opts.Username,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接 Redis: %w", err)
+	}
+	return NewRedisContextStoreWithClient(client, opts.KeyPrefix, opts.Retention), nil
+}
+
+// NewRedisContextStoreWithClient 使用已有的客户端（单机、哨兵或集群）创建上下文存储，Close 时关闭该客户端
+func NewRedisContextStoreWithClient(client redis.UniversalClient, keyPrefix string, policy RetentionPolicy) *RedisContextStore {
+	if keyPrefix == "" {
+		keyPrefix = redisDefaultKeyPrefix
+	}
+	return &RedisContextStore{client: client, keyPrefix: keyPrefix, retention: policy.withDefaults()}
+}
+
+// redisTurn 对话轮次在 list 中的 JSON 结构
+type redisTurn struct {
+	Query       string    `json:"query"`
+	SQL         string    `json:"sql"`
+	Explanation string    `json:"explanation,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (s *RedisContextStore) indexKey() string {
+	return s.keyPrefix + "conversations"
+}
+
+func (s *RedisContextStore) metaKey(conversationID string) string {
+	return s.keyPrefix + "conv:{" + conversationID + "}"
+}
+
+func (s *RedisContextStore) turnsKey(conversationID string) string {
+	return s.keyPrefix + "conv:{" + conversationID + "}:turns"
+}
+
+// expire 按保留策略设置会话两个 key 的 TTL，以 updatedAt（即本次写入时间）为起点；置顶会话移除 TTL
+func (s *RedisContextStore) expire(ctx context.Context, pipe redis.Pipeliner, conversationID string, pinned bool, createdAt, updatedAt time.Time) {
+	expires := s.retention.expiresAt(pinned, createdAt, updatedAt)
+	for _, key := range []string{s.metaKey(conversationID), s.turnsKey(conversationID)} {
+		if expires == nil {
+			pipe.Persist(ctx, key)
+		} else {
+			pipe.PExpire(ctx, key, expires.Sub(updatedAt))
+		}
+	}
+}
+
+// Get 获取上下文
+func (s *RedisContextStore) Get(conversationID string) (*ConversationContext, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	var meta *redis.MapStringStringCmd
+	var turns *redis.StringSliceCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		meta = pipe.HGetAll(ctx, s.metaKey(conversationID))
+		turns = pipe.LRange(ctx, s.turnsKey(conversationID), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields := meta.Val()
+	if len(fields) == 0 {
+		return nil, ErrConversationNotFound
+	}
+
+	var schema Schema
+	if err := json.Unmarshal([]byte(fields["schema"]), &schema); err != nil {
+		return nil, fmt.Errorf("解析会话 schema: %w", err)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, fields["created_at"])
+	if err != nil {
+		return nil, fmt.Errorf("解析会话 created_at: %w", err)
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, fields["updated_at"])
+	if err != nil {
+		return nil, fmt.Errorf("解析会话 updated_at: %w", err)
+	}
+
+	database := Database{Type: fields["database_type"], Version: fields["database_version"]}
+	if modules := fields["database_modules"]; modules != "" {
+		database.Modules = strings.Split(modules, ",")
+	}
+
+	tags, err := decodeStrings(fields["tags"])
+	if err != nil {
+		return nil, fmt.Errorf("解析会话标签: %w", err)
+	}
+	sharedWith, err := decodeStrings(fields["shared_with"])
+	if err != nil {
+		return nil, fmt.Errorf("解析会话共享名单: %w", err)
+	}
+	var summarizedTurns int
+	if v := fields["summarized_turns"]; v != "" {
+		if summarizedTurns, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("解析会话 summarized_turns: %w", err)
+		}
+	}
+
+	history := make([]ConversationTurn, 0, len(turns.Val()))
+	for _, raw := range turns.Val() {
+		var turn redisTurn
+		if err := json.Unmarshal([]byte(raw), &turn); err != nil {
+			return nil, fmt.Errorf("解析对话轮次: %w", err)
+		}
+		history = append(history, ConversationTurn{
+			Query:       turn.Query,
+			SQL:         turn.SQL,
+			Explanation: turn.Explanation,
+			Timestamp:   turn.Timestamp,
+		})
+	}
+
+	return &ConversationContext{
+		ConversationID:  conversationID,
+		Title:           fields["title"],
+		Tags:            tags,
+		Owner:           fields["owner"],
+		SharedWith:      sharedWith,
+		Pinned:          fields["pinned"] == "1",
+		Schema:          schema,
+		Database:        database,
+		History:         history,
+		Summary:         fields["summary"],
+		SummarizedTurns: summarizedTurns,
+		CreatedAt:       createdAt,
+		UpdatedAt:       updatedAt,
+	}, nil
+}
+
+// Save 保存上下文：更新元数据，追加 list 中尚未保存的轮次，并按保留策略刷新两个 key 的 TTL，提交后再更新会话索引。
+// 使用 WATCH 检测其他实例对同一会话的并发追加，冲突时重试
+func (s *RedisContextStore) Save(conv *ConversationContext) error {
+	schemaJSON, err := json.Marshal(conv.Schema)
+	if err != nil {
+		return err
+	}
+	conv.UpdatedAt = time.Now()
+	if conv.CreatedAt.IsZero() {
+		conv.CreatedAt = conv.UpdatedAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	metaKey, turnsKey := s.metaKey(conv.ConversationID), s.turnsKey(conv.ConversationID)
+	save := func(tx *redis.Tx) error {
+		saved, err := tx.LLen(ctx, turnsKey).Result()
+		if err != nil {
+			return err
+		}
+		var pending []any
+		for i := int(saved); i < len(conv.History); i++ {
+			turn := conv.History[i]
+			raw, err := json.Marshal(redisTurn{
+				Query:       turn.Query,
+				SQL:         turn.SQL,
+				Explanation: turn.Explanation,
+				Timestamp:   turn.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+			pending = append(pending, string(raw))
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, metaKey,
+				"title", conv.Title,
+				"tags", encodeStrings(conv.Tags),
+				"owner", conv.Owner,
+				"shared_with", encodeStrings(conv.SharedWith),
+				"pinned", redisBool(conv.Pinned),
+				"schema", string(schemaJSON),
+				"database_type", conv.Database.Type,
+				"database_version", conv.Database.Version,
+				"database_modules", strings.Join(conv.Database.Modules, ","),
+				"summary", conv.Summary,
+				"summarized_turns", conv.SummarizedTurns,
+				"created_at", conv.CreatedAt.Format(time.RFC3339Nano),
+				"updated_at", conv.UpdatedAt.Format(time.RFC3339Nano),
+			)
+			if len(pending) > 0 {
+				pipe.RPush(ctx, turnsKey, pending...)
+			}
+			s.expire(ctx, pipe, conv.ConversationID, conv.Pinned, conv.CreatedAt, conv.UpdatedAt)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < redisSaveRetries; i++ {
+		err = s.client.Watch(ctx, save, turnsKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.index(ctx, conv.ConversationID, conv.UpdatedAt)
+	}
+	return fmt.Errorf("保存会话 %s: 并发冲突: %w", conv.ConversationID, err)
+}
+
+// index 在会话索引中记录会话的更新时间
+func (s *RedisContextStore) index(ctx context.Context, conversationID string, updatedAt time.Time) error {
+	if err := s.client.ZAdd(ctx, s.indexKey(), redis.Z{Score: float64(updatedAt.UnixMilli()), Member: conversationID}).Err(); err != nil {
+		return fmt.Errorf("更新会话索引: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除上下文，再从索引中移除；移除失败时由 List 清理
+func (s *RedisContextStore) Delete(conversationID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Del(ctx, s.metaKey(conversationID), s.turnsKey(conversationID)).Err(); err != nil {
+		return err
+	}
+	return s.client.ZRem(ctx, s.indexKey(), conversationID).Err()
+}
+
+// Fork 复制会话及其前 turns 轮
+func (s *RedisContextStore) Fork(conversationID, newID, owner string, turns int) (*ConversationContext, error) {
+	src, err := s.Get(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if turns, err = forkTurns(turns, len(src.History)); err != nil {
+		return nil, err
+	}
+	fork := &ConversationContext{
+		ConversationID: newID,
+		Title:          src.Title,
+		Tags:           src.Tags,
+		Owner:          cmp.Or(owner, src.Owner),
+		Schema:         src.Schema,
+		Database:       src.Database,
+		History:        src.History[:turns],
+	}
+	if src.SummarizedTurns <= turns {
+		fork.Summary, fork.SummarizedTurns = src.Summary, src.SummarizedTurns
+	}
+	if err := s.Save(fork); err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+// Rollback 删除最后 n 轮，与 Save 一样使用 WATCH 检测并发追加
+func (s *RedisContextStore) Rollback(conversationID string, n int) (*ConversationContext, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	metaKey, turnsKey := s.metaKey(conversationID), s.turnsKey(conversationID)
+	var now time.Time
+	rollback := func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, metaKey).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrConversationNotFound
+		}
+		total, err := tx.LLen(ctx, turnsKey).Result()
+		if err != nil {
+			return err
+		}
+		if err := checkRollback(n, int(total)); err != nil {
+			return err
+		}
+		meta, err := tx.HMGet(ctx, metaKey, "summarized_turns", "pinned", "created_at").Result()
+		if err != nil {
+			return err
+		}
+		var summarized int64
+		if v, ok := meta[0].(string); ok && v != "" {
+			if summarized, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return fmt.Errorf("解析会话 summarized_turns: %w", err)
+			}
+		}
+		createdAt, _ := meta[2].(string)
+		created, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return fmt.Errorf("解析会话 created_at: %w", err)
+		}
+		now = time.Now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if keep := total - int64(n); keep > 0 {
+				pipe.LTrim(ctx, turnsKey, 0, keep-1)
+			} else {
+				pipe.Del(ctx, turnsKey)
+			}
+			pipe.HSet(ctx, metaKey, "updated_at", now.Format(time.RFC3339Nano))
+			if summarized > total-int64(n) {
+				pipe.HSet(ctx, metaKey, "summary", "", "summarized_turns", 0)
+			}
+			s.expire(ctx, pipe, conversationID, meta[1] == "1", created, now)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < redisSaveRetries; i++ {
+		err = s.client.Watch(ctx, rollback, metaKey, turnsKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.index(ctx, conversationID, now); err != nil {
+			return nil, err
+		}
+		return s.Get(conversationID)
+	}
+	return nil, fmt.Errorf("回滚会话 %s: 并发冲突: %w", conversationID, err)
+}
+
+// List 列出会话：按时间范围从索引取出会话 ID，再批量读取元数据过滤数据库类型、所有者和置顶状态。
+// 已过期的会话在读取时发现并从索引中移除；复杂度与时间范围内的会话数成正比
+func (s *RedisContextStore) List(filter ConversationFilter) (*ConversationPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	rng := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !filter.UpdatedAfter.IsZero() {
+		rng.Min = strconv.FormatInt(filter.UpdatedAfter.UnixMilli(), 10)
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		rng.Max = "(" + strconv.FormatInt(filter.UpdatedBefore.UnixMilli(), 10)
+	}
+	ids, err := s.client.ZRevRangeByScore(ctx, s.indexKey(), rng).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ConversationSummary
+	var missing []any
+	for start := 0; start < len(ids); start += redisListBatch {
+		batch := ids[start:min(start+redisListBatch, len(ids))]
+		metas := make([]*redis.SliceCmd, len(batch))
+		lens := make([]*redis.IntCmd, len(batch))
+		_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, id := range batch {
+				metas[i] = pipe.HMGet(ctx, s.metaKey(id), "title", "tags", "database_type", "database_version", "database_modules", "created_at", "updated_at", "owner", "pinned")
+				lens[i] = pipe.LLen(ctx, s.turnsKey(id))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range batch {
+			summary, ok, err := redisSummary(id, metas[i].Val(), int(lens[i].Val()))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				missing = append(missing, id)
+				continue
+			}
+			if filter.matches(summary) {
+				items = append(items, summary)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		s.client.ZRem(ctx, s.indexKey(), missing...)
+	}
+	return paginate(items, filter), nil
+}
+
+// redisSummary 由 HMGET 的结果构建列表项，会话已不存在时返回 false
+func redisSummary(id string, values []any, turns int) (ConversationSummary, bool, error) {
+	field := func(i int) string {
+		v, _ := values[i].(string)
+		return v
+	}
+	if values[6] == nil {
+		return ConversationSummary{}, false, nil
+	}
+	summary := ConversationSummary{
+		ConversationID: id,
+		Title:          field(0),
+		Owner:          field(7),
+		Pinned:         field(8) == "1",
+		Database:       Database{Type: field(2), Version: field(3)},
+		TurnCount:      turns,
+	}
+	var err error
+	if summary.Tags, err = decodeStrings(field(1)); err != nil {
+		return summary, false, fmt.Errorf("解析会话标签: %w", err)
+	}
+	if modules := field(4); modules != "" {
+		summary.Database.Modules = strings.Split(modules, ",")
+	}
+	if summary.CreatedAt, err = time.Parse(time.RFC3339Nano, field(5)); err != nil {
+		return summary, false, fmt.Errorf("解析会话 created_at: %w", err)
+	}
+	if summary.UpdatedAt, err = time.Parse(time.RFC3339Nano, field(6)); err != nil {
+		return summary, false, fmt.Errorf("解析会话 updated_at: %w", err)
+	}
+	return summary, true, nil
+}
+
+// Cleanup 会话由 Redis 原生 TTL 过期，无需清理
+func (s *RedisContextStore) Cleanup(policy RetentionPolicy) error {
+	return nil
+}
+
+// redisBool 布尔字段在 hash 中保存为 1 或 0
+func redisBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+// Close 关闭 Redis 客户端
+func (s *RedisContextStore) Close() error {
+	return s.client.Close()
+}
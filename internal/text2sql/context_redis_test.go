@@ -0,0 +1,280 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T, mr *miniredis.Miniredis, ttl time.Duration) *RedisContextStore {
+	t.Helper()
+	store, err := NewRedisContextStore(RedisStoreOptions{Addr: mr.Addr(), Retention: RetentionPolicy{SlidingTTL: ttl}})
+	if err != nil {
+		t.Fatalf("NewRedisContextStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRedisContextStore_SaveAndGet(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr, 0)
+
+	if _, err := store.Get("conv_missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+
+	conv := &ConversationContext{
+		ConversationID: "conv_1",
+		Schema:         Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database:       Database{Type: "redis", Version: "7.2", Modules: []string{"json", "search"}},
+		CreatedAt:      time.Now(),
+	}
+	for _, q := range []string{"查询用户", "只要 id"} {
+		conv.History = append(conv.History, ConversationTurn{Query: q, SQL: "SELECT id FROM users", Explanation: "解释", Timestamp: time.Now()})
+		if err := store.Save(conv); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	got, err := store.Get("conv_1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Database.Type != "redis" || got.Database.Version != "7.2" || len(got.Database.Modules) != 2 || len(got.Schema.Tables) != 1 || got.Schema.Tables[0].Columns[0].Type != "int" {
+		t.Errorf("unexpected metadata: %+v", got)
+	}
+	if len(got.History) != 2 || got.History[0].Query != "查询用户" || got.History[1].Query != "只要 id" {
+		t.Errorf("unexpected history: %+v", got.History)
+	}
+	if !got.CreatedAt.Equal(conv.CreatedAt) || !got.UpdatedAt.Equal(conv.UpdatedAt) {
+		t.Errorf("timestamps not preserved: %v/%v", got.CreatedAt, got.UpdatedAt)
+	}
+
+	// 元数据为 hash，轮次为 list
+	if typ := mr.Type("text2sql:conv:{conv_1}"); typ != "hash" {
+		t.Errorf("meta key type = %q, want hash", typ)
+	}
+	if typ := mr.Type("text2sql:conv:{conv_1}:turns"); typ != "list" {
+		t.Errorf("turns key type = %q, want list", typ)
+	}
+
+	if err := store.Delete("conv_1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("conv_1"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound after delete, got %v", err)
+	}
+}
+
+func TestRedisContextStore_TTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr, time.Hour)
+
+	conv := &ConversationContext{ConversationID: "conv_ttl", Database: Database{Type: "mysql"}}
+	conv.History = append(conv.History, ConversationTurn{Query: "q", SQL: "SELECT 1"})
+	if err := store.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("text2sql:conv:{conv_ttl}:turns"); ttl != time.Hour {
+		t.Errorf("turns ttl = %v, want 1h", ttl)
+	}
+
+	// 再次保存会刷新 TTL
+	mr.FastForward(40 * time.Minute)
+	if err := store.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(40 * time.Minute)
+	if _, err := store.Get("conv_ttl"); err != nil {
+		t.Fatalf("conversation should survive after refresh: %v", err)
+	}
+
+	mr.FastForward(time.Hour)
+	if _, err := store.Get("conv_ttl"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected conversation to expire, got %v", err)
+	}
+
+	// 过期会话不出现在列表中，并从索引中移除
+	page, err := store.List(ConversationFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 0 {
+		t.Errorf("expired conversation listed: %+v", page)
+	}
+	if members, _ := mr.ZMembers("text2sql:conversations"); len(members) != 0 {
+		t.Errorf("index not pruned: %v", members)
+	}
+}
+
+func TestRedisContextStore_SharedAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	podA := newTestRedisStore(t, mr, 0)
+	podB := newTestRedisStore(t, mr, 0)
+
+	conv := &ConversationContext{ConversationID: "conv_shared", Database: Database{Type: "postgresql"}}
+	conv.History = append(conv.History, ConversationTurn{Query: "第一轮", SQL: "SELECT 1"})
+	if err := podA.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	// 后续请求落到另一个实例
+	loaded, err := podB.Get("conv_shared")
+	if err != nil {
+		t.Fatalf("podB Get failed: %v", err)
+	}
+	loaded.History = append(loaded.History, ConversationTurn{Query: "第二轮", SQL: "SELECT 2"})
+	if err := podB.Save(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := podA.Get("conv_shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.History) != 2 || got.History[1].Query != "第二轮" {
+		t.Errorf("unexpected history: %+v", got.History)
+	}
+}
+
+func TestRedisContextStore_Retention(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisContextStore(RedisStoreOptions{Addr: mr.Addr(), Retention: RetentionPolicy{SlidingTTL: time.Hour, AbsoluteTTL: 3 * time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// 创建 2.5 小时的会话只剩 30 分钟的绝对过期时间
+	conv := &ConversationContext{ConversationID: "conv_abs", Database: Database{Type: "mysql"}, CreatedAt: time.Now().Add(-150 * time.Minute)}
+	conv.History = append(conv.History, ConversationTurn{Query: "q", SQL: "SELECT 1"})
+	if err := store.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("text2sql:conv:{conv_abs}"); ttl <= 29*time.Minute || ttl > 30*time.Minute {
+		t.Errorf("meta ttl = %v, want about 30m", ttl)
+	}
+
+	// 置顶的会话不设 TTL，取消置顶后恢复
+	conv.Pinned = true
+	if err := store.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"text2sql:conv:{conv_abs}", "text2sql:conv:{conv_abs}:turns"} {
+		if ttl := mr.TTL(key); ttl != 0 {
+			t.Errorf("%s ttl = %v, want none for pinned conversation", key, ttl)
+		}
+	}
+	if _, err := store.Rollback("conv_abs", 1); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("text2sql:conv:{conv_abs}"); ttl != 0 {
+		t.Errorf("rollback set ttl %v on pinned conversation", ttl)
+	}
+	mr.FastForward(4 * time.Hour)
+	page, err := store.List(ConversationFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || !page.Conversations[0].Pinned {
+		t.Errorf("pinned conversation should stay listed: %+v", page)
+	}
+
+	got, err := store.Get("conv_abs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Pinned = false
+	got.CreatedAt = time.Now()
+	if err := store.Save(got); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("text2sql:conv:{conv_abs}"); ttl != time.Hour {
+		t.Errorf("ttl after unpin = %v, want 1h", ttl)
+	}
+}
+
+// slotRecorder 记录每个 MULTI 事务中命令涉及的 key
+type slotRecorder struct {
+	mu  sync.Mutex
+	txs [][]string
+}
+
+func (r *slotRecorder) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *slotRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (r *slotRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if len(cmds) > 0 && cmds[0].Name() == "multi" {
+			var keys []string
+			for _, cmd := range cmds[1 : len(cmds)-1] {
+				args := cmd.Args()
+				if cmd.Name() == "del" {
+					for _, arg := range args[1:] {
+						keys = append(keys, arg.(string))
+					}
+				} else {
+					keys = append(keys, args[1].(string))
+				}
+			}
+			r.mu.Lock()
+			r.txs = append(r.txs, keys)
+			r.mu.Unlock()
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestRedisContextStore_TransactionsStayInOneSlot(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	recorder := &slotRecorder{}
+	client.AddHook(recorder)
+	store := NewRedisContextStoreWithClient(client, "", RetentionPolicy{SlidingTTL: time.Hour})
+	t.Cleanup(func() { store.Close() })
+
+	conv := &ConversationContext{ConversationID: "conv_slot", Database: Database{Type: "mysql"}}
+	for _, q := range []string{"q1", "q2"} {
+		conv.History = append(conv.History, ConversationTurn{Query: q, SQL: "SELECT 1"})
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Rollback("conv_slot", 1); err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.List(ConversationFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Fatalf("expected conversation in index, got %+v", page)
+	}
+	if err := store.Delete("conv_slot"); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := mr.ZMembers("text2sql:conversations"); len(members) != 0 {
+		t.Errorf("index not cleaned on delete: %v", members)
+	}
+
+	// 集群模式下事务中的 key 必须落在同一槽位，即共享同一个 {hash tag}
+	if len(recorder.txs) == 0 {
+		t.Fatal("no transactions recorded")
+	}
+	for _, keys := range recorder.txs {
+		for _, key := range keys {
+			if !strings.Contains(key, "{conv_slot}") {
+				t.Errorf("transaction mixes slots: %v", keys)
+				break
+			}
+		}
+	}
+}
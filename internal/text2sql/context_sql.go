@@ -0,0 +1,635 @@
+package text2sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// SQLStoreOptions 基于 database/sql 的上下文存储选项
+type SQLStoreOptions struct {
+	Driver          string          // postgres | mysql | sqlite
+	DSN             string          // 连接串，mysql 会自动开启 parseTime 和 clientFoundRows
+	MaxOpenConns    int             // 最大连接数，0 表示使用默认值 25
+	MaxIdleConns    int             // 最大空闲连接数，0 表示使用默认值 5
+	ConnMaxLifetime time.Duration   // 连接最长存活时间，0 表示使用默认值 5m
+	ConnMaxIdleTime time.Duration   // 连接最长空闲时间，0 表示不限制
+	Retention       RetentionPolicy // 会话保留策略，零值表示最后一次保存 24h 后过期、每小时清理一次
+}
+
+// sqlStoreDialect 不同数据库在建表、占位符和 upsert 上的差异
+type sqlStoreDialect struct {
+	driverName   string   // sql.Open 使用的驱动名
+	numbered     bool     // 占位符为 $1、$2（PostgreSQL），否则为 ?
+	schema       []string // 建表语句，需可重复执行
+	upsertSuffix string   // 会话元数据的 upsert 子句
+}
+
+var sqlStoreDialects = map[string]*sqlStoreDialect{
+	"postgres": {
+		driverName: "pgx",
+		numbered:   true,
+		schema: []string{
+			`CREATE TABLE IF NOT EXISTS text2sql_conversations (
+				id VARCHAR(64) PRIMARY KEY,
+				title VARCHAR(255) NOT NULL,
+				tags TEXT NOT NULL,
+				owner VARCHAR(255) NOT NULL,
+				shared_with TEXT NOT NULL,
+				pinned BOOLEAN NOT NULL,
+				schema_json TEXT NOT NULL,
+				database_type VARCHAR(64) NOT NULL,
+				database_version VARCHAR(64) NOT NULL,
+				database_modules VARCHAR(255) NOT NULL,
+				summary TEXT NOT NULL,
+				summarized_turns INTEGER NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_text2sql_conversations_updated ON text2sql_conversations (updated_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_text2sql_conversations_owner ON text2sql_conversations (owner, updated_at)`,
+			`CREATE TABLE IF NOT EXISTS text2sql_conversation_turns (
+				conversation_id VARCHAR(64) NOT NULL,
+				turn_number INTEGER NOT NULL,
+				query TEXT NOT NULL,
+				statement TEXT NOT NULL,
+				explanation TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (conversation_id, turn_number)
+			)`,
+		},
+		upsertSuffix: sqlStoreOnConflictUpsert,
+	},
+	"mysql": {
+		driverName: "mysql",
+		schema: []string{
+			`CREATE TABLE IF NOT EXISTS text2sql_conversations (
+				id VARCHAR(64) PRIMARY KEY,
+				title VARCHAR(255) NOT NULL,
+				tags TEXT NOT NULL,
+				owner VARCHAR(255) NOT NULL,
+				shared_with TEXT NOT NULL,
+				pinned BOOLEAN NOT NULL,
+				schema_json LONGTEXT NOT NULL,
+				database_type VARCHAR(64) NOT NULL,
+				database_version VARCHAR(64) NOT NULL,
+				database_modules VARCHAR(255) NOT NULL,
+				summary TEXT NOT NULL,
+				summarized_turns INT NOT NULL,
+				created_at DATETIME(6) NOT NULL,
+				updated_at DATETIME(6) NOT NULL,
+				INDEX idx_text2sql_conversations_updated (updated_at),
+				INDEX idx_text2sql_conversations_owner (owner, updated_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS text2sql_conversation_turns (
+				conversation_id VARCHAR(64) NOT NULL,
+				turn_number INT NOT NULL,
+				query TEXT NOT NULL,
+				statement MEDIUMTEXT NOT NULL,
+				explanation TEXT NOT NULL,
+				created_at DATETIME(6) NOT NULL,
+				PRIMARY KEY (conversation_id, turn_number)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+		upsertSuffix: `ON DUPLICATE KEY UPDATE
+			title = VALUES(title),
+			tags = VALUES(tags),
+			owner = VALUES(owner),
+			shared_with = VALUES(shared_with),
+			pinned = VALUES(pinned),
+			schema_json = VALUES(schema_json),
+			database_type = VALUES(database_type),
+			database_version = VALUES(database_version),
+			database_modules = VALUES(database_modules),
+			summary = VALUES(summary),
+			summarized_turns = VALUES(summarized_turns),
+			updated_at = VALUES(updated_at)`,
+	},
+	"sqlite": {
+		driverName: "sqlite",
+		schema: []string{
+			`CREATE TABLE IF NOT EXISTS text2sql_conversations (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				tags TEXT NOT NULL,
+				owner TEXT NOT NULL,
+				shared_with TEXT NOT NULL,
+				pinned INTEGER NOT NULL,
+				schema_json TEXT NOT NULL,
+				database_type TEXT NOT NULL,
+				database_version TEXT NOT NULL,
+				database_modules TEXT NOT NULL,
+				summary TEXT NOT NULL,
+				summarized_turns INTEGER NOT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_text2sql_conversations_updated ON text2sql_conversations (updated_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_text2sql_conversations_owner ON text2sql_conversations (owner, updated_at)`,
+			`CREATE TABLE IF NOT EXISTS text2sql_conversation_turns (
+				conversation_id TEXT NOT NULL,
+				turn_number INTEGER NOT NULL,
+				query TEXT NOT NULL,
+				statement TEXT NOT NULL,
+				explanation TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (conversation_id, turn_number)
+			)`,
+		},
+		upsertSuffix: sqlStoreOnConflictUpsert,
+	},
+}
+
+const sqlStoreOnConflictUpsert = `ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title,
+			tags = excluded.tags,
+			owner = excluded.owner,
+			shared_with = excluded.shared_with,
+			pinned = excluded.pinned,
+			schema_json = excluded.schema_json,
+			database_type = excluded.database_type,
+			database_version = excluded.database_version,
+			database_modules = excluded.database_modules,
+			summary = excluded.summary,
+			summarized_turns = excluded.summarized_turns,
+			updated_at = excluded.updated_at`
+
+// SQLStoreDrivers 支持的驱动
+func SQLStoreDrivers() []string {
+	return []string{"postgres", "mysql", "sqlite"}
+}
+
+// SQLContextStore 基于 database/sql 的上下文存储，支持 PostgreSQL、MySQL 和 SQLite。
+// 表名带 text2sql_ 前缀，便于与业务表共用一个库；时间统一以 UTC 保存
+type SQLContextStore struct {
+	db        *sql.DB
+	dialect   *sqlStoreDialect
+	retention RetentionPolicy
+	stopCh    chan struct{}
+}
+
+// NewSQLContextStore 连接数据库、建表并启动过期清理任务
+func NewSQLContextStore(opts SQLStoreOptions) (*SQLContextStore, error) {
+	dialect, ok := sqlStoreDialects[opts.Driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的上下文存储驱动: %s（可选 %s）", opts.Driver, strings.Join(SQLStoreDrivers(), "、"))
+	}
+	dsn := opts.DSN
+	if opts.Driver == "mysql" {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("解析 mysql dsn: %w", err)
+		}
+		cfg.ParseTime = true
+		// UPDATE 的影响行数按匹配行计算，用于判断会话是否存在
+		cfg.ClientFoundRows = true
+		dsn = cfg.FormatDSN()
+	}
+	db, err := sql.Open(dialect.driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	applySQLPoolOptions(db, opts)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store, err := NewSQLContextStoreWithDB(db, opts.Driver, opts.Retention)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLContextStoreWithDB 使用已有的连接池创建上下文存储，Close 时关闭该连接池。
+// mysql 连接需开启 parseTime 和 clientFoundRows
+func NewSQLContextStoreWithDB(db *sql.DB, driver string, policy RetentionPolicy) (*SQLContextStore, error) {
+	dialect, ok := sqlStoreDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的上下文存储驱动: %s（可选 %s）", driver, strings.Join(SQLStoreDrivers(), "、"))
+	}
+	store := &SQLContextStore{db: db, dialect: dialect, retention: policy.withDefaults(), stopCh: make(chan struct{})}
+	for _, stmt := range dialect.schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("初始化上下文存储表: %w", err)
+		}
+	}
+	go store.startCleanupTask()
+	return store, nil
+}
+
+func applySQLPoolOptions(db *sql.DB, opts SQLStoreOptions) {
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = 25
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = 5
+	}
+	if opts.ConnMaxLifetime <= 0 {
+		opts.ConnMaxLifetime = 5 * time.Minute
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// rebind 将 ? 占位符转换为方言的占位符
+func (s *SQLContextStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Get 获取上下文
+func (s *SQLContextStore) Get(conversationID string) (*ConversationContext, error) {
+	var schemaJSON, tags, sharedWith, modules string
+	conv := &ConversationContext{ConversationID: conversationID}
+	err := s.db.QueryRow(s.rebind(`
+		SELECT title, tags, owner, shared_with, pinned, schema_json, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at
+		FROM text2sql_conversations WHERE id = ?
+	`), conversationID).Scan(&conv.Title, &tags, &conv.Owner, &sharedWith, &conv.Pinned, &schemaJSON, &conv.Database.Type, &conv.Database.Version, &modules,
+		&conv.Summary, &conv.SummarizedTurns, &conv.CreatedAt, &conv.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(schemaJSON), &conv.Schema); err != nil {
+		return nil, fmt.Errorf("解析会话 schema: %w", err)
+	}
+	if conv.Tags, err = decodeStrings(tags); err != nil {
+		return nil, fmt.Errorf("解析会话标签: %w", err)
+	}
+	if conv.SharedWith, err = decodeStrings(sharedWith); err != nil {
+		return nil, fmt.Errorf("解析会话共享名单: %w", err)
+	}
+	if modules != "" {
+		conv.Database.Modules = strings.Split(modules, ",")
+	}
+
+	rows, err := s.db.Query(s.rebind(`
+		SELECT query, statement, explanation, created_at
+		FROM text2sql_conversation_turns
+		WHERE conversation_id = ?
+		ORDER BY turn_number ASC
+	`), conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var turn ConversationTurn
+		if err := rows.Scan(&turn.Query, &turn.SQL, &turn.Explanation, &turn.Timestamp); err != nil {
+			return nil, err
+		}
+		conv.History = append(conv.History, turn)
+	}
+	return conv, rows.Err()
+}
+
+// Save 保存上下文：upsert 会话元数据，并追加尚未保存的轮次
+func (s *SQLContextStore) Save(conv *ConversationContext) error {
+	schemaJSON, err := json.Marshal(conv.Schema)
+	if err != nil {
+		return err
+	}
+	conv.UpdatedAt = time.Now()
+	if conv.CreatedAt.IsZero() {
+		conv.CreatedAt = conv.UpdatedAt
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(s.rebind(`
+		INSERT INTO text2sql_conversations (id, title, tags, owner, shared_with, pinned, schema_json, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+s.dialect.upsertSuffix),
+		conv.ConversationID,
+		conv.Title,
+		encodeStrings(conv.Tags),
+		conv.Owner,
+		encodeStrings(conv.SharedWith),
+		conv.Pinned,
+		string(schemaJSON),
+		conv.Database.Type,
+		conv.Database.Version,
+		strings.Join(conv.Database.Modules, ","),
+		conv.Summary,
+		conv.SummarizedTurns,
+		conv.CreatedAt.UTC(),
+		conv.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("保存会话: %w", err)
+	}
+
+	var saved int
+	if err := tx.QueryRow(s.rebind(`SELECT COUNT(*) FROM text2sql_conversation_turns WHERE conversation_id = ?`), conv.ConversationID).Scan(&saved); err != nil {
+		return err
+	}
+	for i := saved; i < len(conv.History); i++ {
+		turn := conv.History[i]
+		_, err := tx.Exec(s.rebind(`
+			INSERT INTO text2sql_conversation_turns (conversation_id, turn_number, query, statement, explanation, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`), conv.ConversationID, i, turn.Query, turn.SQL, turn.Explanation, turn.Timestamp.UTC())
+		if err != nil {
+			return fmt.Errorf("保存对话轮次: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete 删除上下文及其轮次
+func (s *SQLContextStore) Delete(conversationID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(s.rebind(`DELETE FROM text2sql_conversation_turns WHERE conversation_id = ?`), conversationID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM text2sql_conversations WHERE id = ?`), conversationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List 列出会话
+func (s *SQLContextStore) List(filter ConversationFilter) (*ConversationPage, error) {
+	filter = filter.normalize()
+	where, args := conversationFilterClause(filter)
+
+	page := &ConversationPage{Conversations: []ConversationSummary{}, Offset: filter.Offset, Limit: filter.Limit}
+	if err := s.db.QueryRow(s.rebind(`SELECT COUNT(*) FROM text2sql_conversations c`+where), args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(s.rebind(`
+		SELECT c.id, c.title, c.tags, c.owner, c.pinned, c.database_type, c.database_version, c.database_modules, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM text2sql_conversation_turns t WHERE t.conversation_id = c.id)
+		FROM text2sql_conversations c`+where+`
+		ORDER BY c.updated_at DESC, c.id ASC
+		LIMIT ? OFFSET ?
+	`), append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		summary, err := scanConversationSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Conversations = append(page.Conversations, summary)
+	}
+	return page, rows.Err()
+}
+
+// Fork 复制会话及其前 turns 轮，轮次从 0 重新编号
+func (s *SQLContextStore) Fork(conversationID, newID, owner string, turns int) (*ConversationContext, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(s.rebind(`
+		INSERT INTO text2sql_conversations (id, title, tags, owner, shared_with, pinned, schema_json, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at)
+		SELECT ?, title, tags, COALESCE(NULLIF(?, ''), owner), '', FALSE, schema_json, database_type, database_version, database_modules, summary, summarized_turns, ?, ?
+		FROM text2sql_conversations WHERE id = ?
+	`), newID, owner, now, now, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("复制会话: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrConversationNotFound
+	}
+
+	var total int
+	if err := tx.QueryRow(s.rebind(`SELECT COUNT(*) FROM text2sql_conversation_turns WHERE conversation_id = ?`), conversationID).Scan(&total); err != nil {
+		return nil, err
+	}
+	if turns, err = forkTurns(turns, total); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(s.rebind(`
+		SELECT query, statement, explanation, created_at FROM text2sql_conversation_turns
+		WHERE conversation_id = ? ORDER BY turn_number ASC LIMIT ?
+	`), conversationID, turns)
+	if err != nil {
+		return nil, err
+	}
+	var history []ConversationTurn
+	for rows.Next() {
+		var turn ConversationTurn
+		if err := rows.Scan(&turn.Query, &turn.SQL, &turn.Explanation, &turn.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		history = append(history, turn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, turn := range history {
+		_, err := tx.Exec(s.rebind(`
+			INSERT INTO text2sql_conversation_turns (conversation_id, turn_number, query, statement, explanation, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`), newID, i, turn.Query, turn.SQL, turn.Explanation, turn.Timestamp.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("复制对话轮次: %w", err)
+		}
+	}
+	if _, err := tx.Exec(s.rebind(`UPDATE text2sql_conversations SET summary = '', summarized_turns = 0 WHERE id = ? AND summarized_turns > ?`), newID, turns); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Rollback 删除最后 n 轮
+func (s *SQLContextStore) Rollback(conversationID string, n int) (*ConversationContext, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 先更新会话行，同时锁住该会话，避免并发追加
+	res, err := tx.Exec(s.rebind(`UPDATE text2sql_conversations SET updated_at = ? WHERE id = ?`), time.Now().UTC(), conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, ErrConversationNotFound
+	}
+	var total int
+	if err := tx.QueryRow(s.rebind(`SELECT COUNT(*) FROM text2sql_conversation_turns WHERE conversation_id = ?`), conversationID).Scan(&total); err != nil {
+		return nil, err
+	}
+	if err := checkRollback(n, total); err != nil {
+		return nil, err
+	}
+	// MySQL 不允许在 DELETE 的子查询中引用同一张表，先查出要删除的第一轮
+	var first int
+	if err := tx.QueryRow(s.rebind(`
+		SELECT turn_number FROM text2sql_conversation_turns WHERE conversation_id = ?
+		ORDER BY turn_number DESC LIMIT 1 OFFSET ?
+	`), conversationID, n-1).Scan(&first); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM text2sql_conversation_turns WHERE conversation_id = ? AND turn_number >= ?`), conversationID, first); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(s.rebind(`UPDATE text2sql_conversations SET summary = '', summarized_turns = 0 WHERE id = ? AND summarized_turns > ?`), conversationID, total-n); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(conversationID)
+}
+
+// conversationFilterClause 生成会话表（别名 c）的 WHERE 子句，使用 ? 占位符
+func conversationFilterClause(filter ConversationFilter) (string, []any) {
+	var conds []string
+	var args []any
+	if filter.DatabaseType != "" {
+		conds = append(conds, "c.database_type = ?")
+		args = append(args, filter.DatabaseType)
+	}
+	if filter.Owner != "" {
+		conds = append(conds, "c.owner = ?")
+		args = append(args, filter.Owner)
+	}
+	if filter.Pinned != nil {
+		conds = append(conds, "c.pinned = ?")
+		args = append(args, *filter.Pinned)
+	}
+	if !filter.UpdatedAfter.IsZero() {
+		conds = append(conds, "c.updated_at >= ?")
+		args = append(args, filter.UpdatedAfter.UTC())
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		conds = append(conds, "c.updated_at < ?")
+		args = append(args, filter.UpdatedBefore.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// scanConversationSummary 读取 List 查询的一行
+func scanConversationSummary(rows *sql.Rows) (ConversationSummary, error) {
+	var summary ConversationSummary
+	var tags, modules string
+	if err := rows.Scan(&summary.ConversationID, &summary.Title, &tags, &summary.Owner, &summary.Pinned, &summary.Database.Type, &summary.Database.Version,
+		&modules, &summary.CreatedAt, &summary.UpdatedAt, &summary.TurnCount); err != nil {
+		return summary, err
+	}
+	var err error
+	if summary.Tags, err = decodeStrings(tags); err != nil {
+		return summary, fmt.Errorf("解析会话标签: %w", err)
+	}
+	if modules != "" {
+		summary.Database.Modules = strings.Split(modules, ",")
+	}
+	return summary, nil
+}
+
+// retentionClause 生成按策略已过期的未置顶会话的条件（不含 WHERE），使用 ? 占位符，策略不限制时返回空
+func retentionClause(policy RetentionPolicy, now time.Time) (string, []any) {
+	updatedBefore, createdBefore := policy.cutoffs(now)
+	var conds []string
+	args := []any{false}
+	if !updatedBefore.IsZero() {
+		conds = append(conds, "updated_at < ?")
+		args = append(args, updatedBefore.UTC())
+	}
+	if !createdBefore.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, createdBefore.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "pinned = ? AND (" + strings.Join(conds, " OR ") + ")", args
+}
+
+// Cleanup 清理按策略已过期的未置顶会话
+func (s *SQLContextStore) Cleanup(policy RetentionPolicy) error {
+	cond, args := retentionClause(policy, time.Now())
+	if cond == "" {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(s.rebind(`
+		DELETE FROM text2sql_conversation_turns
+		WHERE conversation_id IN (SELECT id FROM text2sql_conversations WHERE `+cond+`)
+	`), args...)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM text2sql_conversations WHERE `+cond), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// startCleanupTask 启动后台清理任务
+func (s *SQLContextStore) startCleanupTask() {
+	ticker := time.NewTicker(s.retention.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			_ = s.Cleanup(s.retention)
+		}
+	}
+}
+
+// Close 停止清理任务并关闭连接池
+func (s *SQLContextStore) Close() error {
+	close(s.stopCh)
+	return s.db.Close()
+}
@@ -1,78 +1,105 @@
 package text2sql
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
-)
 
-const (
-	sqliteCleanupInterval = 1 * time.Hour
-	sqliteMaxAge          = 24 * time.Hour
+	"text2sql/internal/logger"
 )
 
 // SQLiteContextStore SQLite 持久化上下文存储
 type SQLiteContextStore struct {
-	db    *sql.DB
-	mu    sync.RWMutex
-	stopCh chan struct{}
+	db        *sql.DB
+	mu        sync.RWMutex
+	retention RetentionPolicy
+	keyring   *Keyring
+	stopCh    chan struct{}
+}
+
+// SQLiteStoreOptions SQLite 上下文存储的选项
+type SQLiteStoreOptions struct {
+	Retention RetentionPolicy
+	// Keyring 可选：加密 schema、摘要和每轮的 query、sql、explanation。为 nil 时不加密，已加密的会话无法读取
+	Keyring *Keyring
+	// DisableAutoMigrate 启动时不执行迁移，有待执行的迁移时返回错误，需先通过 MigrateSQLite（server migrate up）执行
+	DisableAutoMigrate bool
 }
 
-// NewSQLiteContextStore 创建 SQLite 上下文存储
+// NewSQLiteContextStore 创建 SQLite 上下文存储，使用默认保留策略
 func NewSQLiteContextStore(dsn string) (*SQLiteContextStore, error) {
-	db, err := sql.Open("sqlite", dsn)
+	return NewSQLiteContextStoreWithRetention(dsn, RetentionPolicy{})
+}
+
+// NewSQLiteContextStoreWithRetention 创建按指定保留策略清理的 SQLite 上下文存储
+func NewSQLiteContextStoreWithRetention(dsn string, policy RetentionPolicy) (*SQLiteContextStore, error) {
+	return NewSQLiteContextStoreWithOptions(dsn, SQLiteStoreOptions{Retention: policy})
+}
+
+// NewSQLiteContextStoreWithOptions 按选项创建 SQLite 上下文存储
+func NewSQLiteContextStoreWithOptions(dsn string, opts SQLiteStoreOptions) (*SQLiteContextStore, error) {
+	db, err := openSQLite(dsn)
 	if err != nil {
 		return nil, err
 	}
-	// 配置连接池
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	if err := db.Ping(); err != nil {
+	if err := prepareSQLiteSchema(db, opts.DisableAutoMigrate); err != nil {
 		db.Close()
 		return nil, err
 	}
 	store := &SQLiteContextStore{
-		db:    db,
-		stopCh: make(chan struct{}),
+		db:        db,
+		retention: opts.Retention.withDefaults(),
+		keyring:   opts.Keyring,
+		stopCh:    make(chan struct{}),
 	}
-	if err := store.initSchema(); err != nil {
+	go store.startCleanupTask()
+	return store, nil
+}
+
+// openSQLite 打开 SQLite 数据库并配置连接池
+func openSQLite(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	if err := db.Ping(); err != nil {
 		db.Close()
 		return nil, err
 	}
-	go store.startCleanupTask()
-	return store, nil
+	return db, nil
 }
 
-// initSchema 初始化数据库表
-func (s *SQLiteContextStore) initSchema() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS conversations (
-			id TEXT PRIMARY KEY,
-			schema_json TEXT NOT NULL,
-			database_type TEXT NOT NULL,
-			database_version TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE TABLE IF NOT EXISTS conversation_turns (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			conversation_id TEXT NOT NULL,
-			query TEXT NOT NULL,
-			sql TEXT NOT NULL,
-			explanation TEXT,
-			turn_number INTEGER NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_conversation_turns_conv ON conversation_turns(conversation_id);
-		CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at);
-	`)
-	return err
+// prepareSQLiteSchema 执行尚未执行的迁移；关闭自动迁移时只检查版本
+func prepareSQLiteSchema(db *sql.DB, manual bool) error {
+	ctx := context.Background()
+	if manual {
+		pending, err := pendingSQLiteMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("SQLite 上下文存储有 %d 个待执行的迁移，请先执行 server migrate up", pending)
+		}
+		return nil
+	}
+	applied, err := migrateSQLite(ctx, db)
+	if err != nil {
+		return fmt.Errorf("迁移 SQLite 上下文存储: %w", err)
+	}
+	for _, m := range applied {
+		logger.Info("已执行 SQLite 迁移", "version", m.Version, "name", m.Name)
+	}
+	return nil
 }
 
 // Get 获取上下文
@@ -80,12 +107,14 @@ func (s *SQLiteContextStore) Get(conversationID string) (*ConversationContext, e
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var schemaJSON, dbType, dbVersion string
+	var schemaJSON, title, tagsJSON, owner, sharedJSON, dbType, dbVersion, dbModules, summary, keyID, dataKey string
+	var summarizedTurns int
+	var pinned bool
 	var createdAt, updatedAt time.Time
 	err := s.db.QueryRow(`
-		SELECT schema_json, database_type, database_version, created_at, updated_at
+		SELECT schema_json, title, tags, owner, shared_with, pinned, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at, key_id, data_key
 		FROM conversations WHERE id = ?
-	`, conversationID).Scan(&schemaJSON, &dbType, &dbVersion, &createdAt, &updatedAt)
+	`, conversationID).Scan(&schemaJSON, &title, &tagsJSON, &owner, &sharedJSON, &pinned, &dbType, &dbVersion, &dbModules, &summary, &summarizedTurns, &createdAt, &updatedAt, &keyID, &dataKey)
 	if err == sql.ErrNoRows {
 		return nil, ErrConversationNotFound
 	}
@@ -93,10 +122,28 @@ func (s *SQLiteContextStore) Get(conversationID string) (*ConversationContext, e
 		return nil, err
 	}
 
+	c, err := s.keyring.openDataKey(keyID, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if schemaJSON, err = c.decrypt("schema_json", schemaJSON); err != nil {
+		return nil, err
+	}
+	if summary, err = c.decrypt("summary", summary); err != nil {
+		return nil, err
+	}
 	var schema Schema
 	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
 		return nil, err
 	}
+	tags, err := decodeStrings(tagsJSON)
+	if err != nil {
+		return nil, err
+	}
+	sharedWith, err := decodeStrings(sharedJSON)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := s.db.Query(`
 		SELECT query, sql, explanation, created_at
@@ -116,24 +163,35 @@ func (s *SQLiteContextStore) Get(conversationID string) (*ConversationContext, e
 		if err := rows.Scan(&q, &sqlStr, &expl, &ts); err != nil {
 			return nil, err
 		}
-		history = append(history, ConversationTurn{
-			Query:       q,
-			SQL:         sqlStr,
-			Explanation: expl,
-			Timestamp:   ts,
-		})
+		turn := ConversationTurn{Timestamp: ts}
+		if turn.Query, turn.SQL, turn.Explanation, err = c.decryptTurn(q, sqlStr, expl); err != nil {
+			return nil, err
+		}
+		history = append(history, turn)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
+	database := Database{Type: dbType, Version: dbVersion}
+	if dbModules != "" {
+		database.Modules = strings.Split(dbModules, ",")
+	}
+
 	return &ConversationContext{
-		ConversationID: conversationID,
-		Schema:         schema,
-		Database:       Database{Type: dbType, Version: dbVersion},
-		History:        history,
-		CreatedAt:      createdAt,
-		UpdatedAt:      updatedAt,
+		ConversationID:  conversationID,
+		Title:           title,
+		Tags:            tags,
+		Owner:           owner,
+		SharedWith:      sharedWith,
+		Pinned:          pinned,
+		Schema:          schema,
+		Database:        database,
+		History:         history,
+		Summary:         summary,
+		SummarizedTurns: summarizedTurns,
+		CreatedAt:       createdAt,
+		UpdatedAt:       updatedAt,
 	}, nil
 }
 
@@ -148,7 +206,7 @@ func (s *SQLiteContextStore) Save(ctx *ConversationContext) error {
 	}
 
 	ctx.UpdatedAt = time.Now()
-	now := ctx.UpdatedAt
+	now := ctx.UpdatedAt.UTC()
 
 	// 使用事务确保数据一致性
 	tx, err := s.db.Begin()
@@ -157,33 +215,70 @@ func (s *SQLiteContextStore) Save(ctx *ConversationContext) error {
 	}
 	defer tx.Rollback()
 
+	// 已有会话沿用创建时的数据密钥（未加密的会话保持不加密，由 Reencrypt 转换），新会话按 active 主密钥加密
+	var keyID, dataKey string
+	var c *fieldCipher
+	err = tx.QueryRow(`SELECT key_id, data_key FROM conversations WHERE id = ?`, ctx.ConversationID).Scan(&keyID, &dataKey)
+	switch {
+	case err == sql.ErrNoRows:
+		keyID, dataKey, c, err = s.keyring.newDataKey()
+	case err == nil:
+		c, err = s.keyring.openDataKey(keyID, dataKey)
+	}
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec(`
-		INSERT INTO conversations (id, schema_json, database_type, database_version, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO conversations (id, title, tags, owner, shared_with, pinned, schema_json, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at, key_id, data_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			tags = excluded.tags,
+			owner = excluded.owner,
+			shared_with = excluded.shared_with,
+			pinned = excluded.pinned,
+			summary = excluded.summary,
+			summarized_turns = excluded.summarized_turns,
 			schema_json = excluded.schema_json,
 			database_type = excluded.database_type,
 			database_version = excluded.database_version,
+			database_modules = excluded.database_modules,
 			updated_at = excluded.updated_at
 	`,
 		ctx.ConversationID,
-		string(schemaJSON),
+		ctx.Title,
+		encodeStrings(ctx.Tags),
+		ctx.Owner,
+		encodeStrings(ctx.SharedWith),
+		ctx.Pinned,
+		c.encrypt("schema_json", string(schemaJSON)),
 		ctx.Database.Type,
 		ctx.Database.Version,
-		ctx.CreatedAt,
+		strings.Join(ctx.Database.Modules, ","),
+		c.encrypt("summary", ctx.Summary),
+		ctx.SummarizedTurns,
+		ctx.CreatedAt.UTC(),
 		now,
+		keyID,
+		dataKey,
 	)
 	if err != nil {
 		return err
 	}
 
-	turnNum := len(ctx.History)
-	if turnNum > 0 {
-		turn := ctx.History[turnNum-1]
+	// 追加尚未保存的轮次
+	var saved int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM conversation_turns WHERE conversation_id = ?`, ctx.ConversationID).Scan(&saved); err != nil {
+		return err
+	}
+	for i := saved; i < len(ctx.History); i++ {
+		turn := ctx.History[i]
+		query, sqlStr, expl := c.encryptTurn(turn.Query, turn.SQL, turn.Explanation)
 		_, err = tx.Exec(`
 			INSERT INTO conversation_turns (conversation_id, query, sql, explanation, turn_number, created_at)
 			VALUES (?, ?, ?, ?, ?, ?)
-		`, ctx.ConversationID, turn.Query, turn.SQL, turn.Explanation, turnNum-1, turn.Timestamp)
+		`, ctx.ConversationID, query, sqlStr, expl, i, turn.Timestamp.UTC())
 		if err != nil {
 			return err
 		}
@@ -196,36 +291,312 @@ func (s *SQLiteContextStore) Save(ctx *ConversationContext) error {
 func (s *SQLiteContextStore) Delete(conversationID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_, err := s.db.Exec(`DELETE FROM conversations WHERE id = ?`, conversationID)
+	// 未开启 foreign_keys，级联删除不生效，需显式删除轮次
+	_, err := s.db.Exec(`
+		DELETE FROM conversation_turns WHERE conversation_id = ?;
+		DELETE FROM conversations WHERE id = ?;
+	`, conversationID, conversationID)
 	return err
 }
 
+// Fork 复制会话及其前 turns 轮，轮次从 0 重新编号。加密的会话原样复制密文和数据密钥
+func (s *SQLiteContextStore) Fork(conversationID, newID, owner string, turns int) (*ConversationContext, error) {
+	if err := s.fork(conversationID, newID, owner, turns); err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *SQLiteContextStore) fork(conversationID, newID, owner string, turns int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`
+		INSERT INTO conversations (id, title, tags, owner, pinned, schema_json, database_type, database_version, database_modules, summary, summarized_turns, created_at, updated_at, key_id, data_key)
+		SELECT ?, title, tags, COALESCE(NULLIF(?, ''), owner), 0, schema_json, database_type, database_version, database_modules, summary, summarized_turns, ?, ?, key_id, data_key
+		FROM conversations WHERE id = ?
+	`, newID, owner, now, now, conversationID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+
+	var total int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM conversation_turns WHERE conversation_id = ?`, conversationID).Scan(&total); err != nil {
+		return err
+	}
+	if turns, err = forkTurns(turns, total); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`
+		SELECT query, sql, explanation, created_at FROM conversation_turns
+		WHERE conversation_id = ? ORDER BY turn_number ASC LIMIT ?
+	`, conversationID, turns)
+	if err != nil {
+		return err
+	}
+	var history []ConversationTurn
+	for rows.Next() {
+		var turn ConversationTurn
+		if err := rows.Scan(&turn.Query, &turn.SQL, &turn.Explanation, &turn.Timestamp); err != nil {
+			rows.Close()
+			return err
+		}
+		history = append(history, turn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, turn := range history {
+		_, err := tx.Exec(`
+			INSERT INTO conversation_turns (conversation_id, query, sql, explanation, turn_number, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, newID, turn.Query, turn.SQL, turn.Explanation, i, turn.Timestamp.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE conversations SET summary = '', summarized_turns = 0 WHERE id = ? AND summarized_turns > ?`, newID, turns); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Rollback 删除最后 n 轮
+func (s *SQLiteContextStore) Rollback(conversationID string, n int) (*ConversationContext, error) {
+	if err := s.rollback(conversationID, n); err != nil {
+		return nil, err
+	}
+	return s.Get(conversationID)
+}
+
+func (s *SQLiteContextStore) rollback(conversationID string, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, time.Now().UTC(), conversationID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrConversationNotFound
+	}
+	var total int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM conversation_turns WHERE conversation_id = ?`, conversationID).Scan(&total); err != nil {
+		return err
+	}
+	if err := checkRollback(n, total); err != nil {
+		return err
+	}
+	var first int
+	if err := tx.QueryRow(`
+		SELECT turn_number FROM conversation_turns WHERE conversation_id = ?
+		ORDER BY turn_number DESC LIMIT 1 OFFSET ?
+	`, conversationID, n-1).Scan(&first); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM conversation_turns WHERE conversation_id = ? AND turn_number >= ?`, conversationID, first); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE conversations SET summary = '', summarized_turns = 0 WHERE id = ? AND summarized_turns > ?`, conversationID, total-n); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reencrypt 重新加密所有未使用 active 主密钥的会话：解密后以新生成的数据密钥加密，未加密的会话同时被加密。
+// 每个会话在单独的事务中转换，中断后可重复执行；返回转换的会话数
+func (s *SQLiteContextStore) Reencrypt() (int, error) {
+	active := s.keyring.ActiveKeyID()
+	if active == "" {
+		return 0, errors.New("未配置 active 加密密钥")
+	}
+	rows, err := s.db.Query(`SELECT id FROM conversations WHERE key_id <> ?`, active)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for _, id := range ids {
+		ok, err := s.reencrypt(id, active)
+		if err != nil {
+			return converted, fmt.Errorf("重新加密会话 %s: %w", id, err)
+		}
+		if ok {
+			converted++
+		}
+	}
+	return converted, nil
+}
+
+// reencrypt 重新加密单个会话，会话已被删除或已使用 active 主密钥时返回 false。不修改 updated_at，不影响过期时间
+func (s *SQLiteContextStore) reencrypt(conversationID, active string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var keyID, dataKey, schemaJSON, summary string
+	err = tx.QueryRow(`SELECT key_id, data_key, schema_json, summary FROM conversations WHERE id = ?`, conversationID).
+		Scan(&keyID, &dataKey, &schemaJSON, &summary)
+	if err == sql.ErrNoRows || err == nil && keyID == active {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	old, err := s.keyring.openDataKey(keyID, dataKey)
+	if err != nil {
+		return false, err
+	}
+	newKeyID, newDataKey, c, err := s.keyring.newDataKey()
+	if err != nil {
+		return false, err
+	}
+	if schemaJSON, err = old.decrypt("schema_json", schemaJSON); err != nil {
+		return false, err
+	}
+	if summary, err = old.decrypt("summary", summary); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE conversations SET schema_json = ?, summary = ?, key_id = ?, data_key = ? WHERE id = ?`,
+		c.encrypt("schema_json", schemaJSON), c.encrypt("summary", summary), newKeyID, newDataKey, conversationID); err != nil {
+		return false, err
+	}
+
+	type storedTurn struct {
+		number                  int
+		query, sql, explanation string
+	}
+	rows, err := tx.Query(`SELECT turn_number, query, sql, explanation FROM conversation_turns WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return false, err
+	}
+	var turns []storedTurn
+	for rows.Next() {
+		var t storedTurn
+		if err := rows.Scan(&t.number, &t.query, &t.sql, &t.explanation); err != nil {
+			rows.Close()
+			return false, err
+		}
+		turns = append(turns, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	for _, t := range turns {
+		query, sqlStr, expl, err := old.decryptTurn(t.query, t.sql, t.explanation)
+		if err != nil {
+			return false, err
+		}
+		query, sqlStr, expl = c.encryptTurn(query, sqlStr, expl)
+		if _, err := tx.Exec(`UPDATE conversation_turns SET query = ?, sql = ?, explanation = ? WHERE conversation_id = ? AND turn_number = ?`,
+			query, sqlStr, expl, conversationID, t.number); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List 列出会话
+func (s *SQLiteContextStore) List(filter ConversationFilter) (*ConversationPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	filter = filter.normalize()
+	where, args := conversationFilterClause(filter)
+
+	page := &ConversationPage{Conversations: []ConversationSummary{}, Offset: filter.Offset, Limit: filter.Limit}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM conversations c`+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`
+		SELECT c.id, c.title, c.tags, c.owner, c.pinned, c.database_type, c.database_version, c.database_modules, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM conversation_turns t WHERE t.conversation_id = c.id)
+		FROM conversations c`+where+`
+		ORDER BY c.updated_at DESC, c.id ASC
+		LIMIT ? OFFSET ?
+	`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		summary, err := scanConversationSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Conversations = append(page.Conversations, summary)
+	}
+	return page, rows.Err()
+}
+
 // Cleanup 清理过期上下文
-func (s *SQLiteContextStore) Cleanup(maxAge time.Duration) error {
+func (s *SQLiteContextStore) Cleanup(policy RetentionPolicy) error {
+	// 驱动按 Go 的时间格式保存 DATETIME，SQLite 的 datetime() 无法解析；时间统一以 UTC 保存，直接比较即可
+	cond, args := retentionClause(policy, time.Now())
+	if cond == "" {
+		return nil
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	hours := int64(maxAge / time.Hour)
-	if hours < 1 {
-		hours = 1
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
 	}
-	modifier := fmt.Sprintf("-%d hours", hours)
-	_, err := s.db.Exec(`
-		DELETE FROM conversations
-		WHERE datetime(updated_at) < datetime('now', ?)
-	`, modifier)
-	return err
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM conversation_turns WHERE conversation_id IN (SELECT id FROM conversations WHERE `+cond+`)`, args...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM conversations WHERE `+cond, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // startCleanupTask 启动后台清理任务
 func (s *SQLiteContextStore) startCleanupTask() {
-	ticker := time.NewTicker(sqliteCleanupInterval)
+	ticker := time.NewTicker(s.retention.CleanupInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-s.stopCh:
 			return
 		case <-ticker.C:
-			_ = s.Cleanup(sqliteMaxAge)
+			_ = s.Cleanup(s.retention)
 		}
 	}
 }
@@ -0,0 +1,636 @@
+package text2sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// contextStoreFactories 参与一致性测试的存储实现。PostgreSQL 和 MySQL 需通过
+// TEXT2SQL_TEST_POSTGRES_DSN、TEXT2SQL_TEST_MYSQL_DSN 提供测试库，未设置时跳过
+var contextStoreFactories = map[string]func(t *testing.T) ContextStore{
+	"memory": func(t *testing.T) ContextStore {
+		return NewMemoryContextStore()
+	},
+	"sqlite": func(t *testing.T) ContextStore {
+		store, err := NewSQLiteContextStore(filepath.Join(t.TempDir(), "context.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+	"sqlite/encrypted": func(t *testing.T) ContextStore {
+		store, err := NewSQLiteContextStoreWithOptions(filepath.Join(t.TempDir(), "context.db"), SQLiteStoreOptions{
+			Keyring: newTestKeyring(t, "k1", "k1"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+	"redis": func(t *testing.T) ContextStore {
+		store, err := NewRedisContextStore(RedisStoreOptions{Addr: miniredis.RunT(t).Addr()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+	"sql/sqlite": func(t *testing.T) ContextStore {
+		return newTestSQLStore(t, "sqlite", filepath.Join(t.TempDir(), "context.db"))
+	},
+	"sql/postgres": func(t *testing.T) ContextStore {
+		return newTestSQLStore(t, "postgres", os.Getenv("TEXT2SQL_TEST_POSTGRES_DSN"))
+	},
+	"sql/mysql": func(t *testing.T) ContextStore {
+		return newTestSQLStore(t, "mysql", os.Getenv("TEXT2SQL_TEST_MYSQL_DSN"))
+	},
+}
+
+func newTestSQLStore(t *testing.T, driver, dsn string) ContextStore {
+	t.Helper()
+	if dsn == "" {
+		t.Skipf("未设置 %s 测试库", driver)
+	}
+	store, err := NewSQLContextStore(SQLStoreOptions{Driver: driver, DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// TestContextStoreConformance 所有 ContextStore 实现必须通过的行为约定
+func TestContextStoreConformance(t *testing.T) {
+	for name, factory := range contextStoreFactories {
+		t.Run(name, func(t *testing.T) {
+			testContextStoreConformance(t, factory)
+		})
+	}
+}
+
+func testContextStoreConformance(t *testing.T, newStore func(t *testing.T) ContextStore) {
+	open := func(t *testing.T) ContextStore {
+		store := newStore(t)
+		t.Cleanup(func() {
+			if err := store.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+		return store
+	}
+	newConversation := func() *ConversationContext {
+		return &ConversationContext{
+			ConversationID: generateConversationID(),
+			Schema: Schema{
+				Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}, {Name: "name", Type: "varchar(100)"}}}},
+				Nodes:  []NodeLabel{{Label: "Person", Properties: []Column{{Name: "name", Type: "string"}}}},
+			},
+			Database:  Database{Type: "redis", Version: "7.2", Modules: []string{"json", "search"}},
+			CreatedAt: time.Now().Add(-time.Minute),
+		}
+	}
+	addTurn := func(conv *ConversationContext, query string) {
+		conv.History = append(conv.History, ConversationTurn{
+			Query:       query,
+			SQL:         "SELECT id FROM users -- " + query,
+			Explanation: "解释 " + query,
+			Timestamp:   time.Now(),
+		})
+	}
+	closeTime := func(a, b time.Time) bool {
+		d := a.Sub(b)
+		return d < time.Millisecond && d > -time.Millisecond
+	}
+
+	t.Run("get missing", func(t *testing.T) {
+		store := open(t)
+		if _, err := store.Get(generateConversationID()); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("expected ErrConversationNotFound, got %v", err)
+		}
+	})
+
+	t.Run("unsaved changes stay local", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		conv.Title = "原标题"
+		addTurn(conv, "第一轮")
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		conv.Title = "保存后修改"
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.Tags = append(got.Tags, "x")
+		addTurn(got, "未保存")
+		if got, err = store.Get(conv.ConversationID); err != nil || got.Title != "原标题" || len(got.Tags) != 0 || len(got.History) != 1 {
+			t.Errorf("stored conversation changed without Save: %+v, err %v", got, err)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		addTurn(conv, "第一轮")
+		before := time.Now()
+		if err := store.Save(conv); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if conv.UpdatedAt.Before(before) {
+			t.Errorf("Save should set UpdatedAt, got %v", conv.UpdatedAt)
+		}
+
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if got.ConversationID != conv.ConversationID {
+			t.Errorf("conversation id = %q", got.ConversationID)
+		}
+		if !schemaDeepEqual(got.Schema, conv.Schema) {
+			t.Errorf("schema = %+v, want %+v", got.Schema, conv.Schema)
+		}
+		if got.Database.Type != "redis" || got.Database.Version != "7.2" || len(got.Database.Modules) != 2 || got.Database.Modules[1] != "search" {
+			t.Errorf("database = %+v", got.Database)
+		}
+		if !closeTime(got.CreatedAt, conv.CreatedAt) || !closeTime(got.UpdatedAt, conv.UpdatedAt) {
+			t.Errorf("timestamps = %v/%v, want %v/%v", got.CreatedAt, got.UpdatedAt, conv.CreatedAt, conv.UpdatedAt)
+		}
+		if len(got.History) != 1 {
+			t.Fatalf("history = %+v", got.History)
+		}
+		turn := got.History[0]
+		if turn.Query != "第一轮" || turn.SQL != conv.History[0].SQL || turn.Explanation != "解释 第一轮" || !closeTime(turn.Timestamp, conv.History[0].Timestamp) {
+			t.Errorf("turn = %+v", turn)
+		}
+	})
+
+	t.Run("append turns", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		addTurn(conv, "1")
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		// 一次追加多轮，以及从重新加载的上下文继续追加
+		addTurn(conv, "2")
+		addTurn(conv, "3")
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addTurn(loaded, "4")
+		if err := store.Save(loaded); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var queries []string
+		for _, turn := range got.History {
+			queries = append(queries, turn.Query)
+		}
+		if len(queries) != 4 || queries[0] != "1" || queries[1] != "2" || queries[2] != "3" || queries[3] != "4" {
+			t.Errorf("history order = %v", queries)
+		}
+	})
+
+	t.Run("update metadata", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		conv.Schema.Tables = append(conv.Schema.Tables, Table{Name: "orders"})
+		conv.Database = Database{Type: "mysql", Version: "8.0"}
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Schema.Tables) != 2 || got.Database.Type != "mysql" || len(got.Database.Modules) != 0 || len(got.History) != 0 {
+			t.Errorf("unexpected context after update: %+v", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		addTurn(conv, "q")
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(conv.ConversationID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err := store.Get(conv.ConversationID); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("expected ErrConversationNotFound after delete, got %v", err)
+		}
+		if err := store.Delete(conv.ConversationID); err != nil {
+			t.Errorf("deleting a missing conversation should succeed, got %v", err)
+		}
+
+		// 同一 ID 重新保存时不应带回已删除的轮次
+		fresh := newConversation()
+		fresh.ConversationID = conv.ConversationID
+		if err := store.Save(fresh); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.History) != 0 {
+			t.Errorf("deleted turns came back: %+v", got.History)
+		}
+	})
+
+	t.Run("title and tags", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		conv.Title = "月度报表"
+		conv.Tags = []string{"finance", "a,b"}
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "月度报表" || len(got.Tags) != 2 || got.Tags[1] != "a,b" {
+			t.Errorf("title/tags = %q/%v", got.Title, got.Tags)
+		}
+		got.Title = ""
+		got.Tags = nil
+		if err := store.Save(got); err != nil {
+			t.Fatal(err)
+		}
+		if got, err = store.Get(conv.ConversationID); err != nil || got.Title != "" || len(got.Tags) != 0 {
+			t.Errorf("cleared title/tags = %q/%v, err %v", got.Title, got.Tags, err)
+		}
+	})
+
+	t.Run("owner, sharing and pinned", func(t *testing.T) {
+		store := open(t)
+		// 共享的测试库中可能有其他会话，用唯一的所有者隔离
+		owner := "key_" + generateConversationID()[5:13]
+		pinned := newConversation()
+		pinned.Owner, pinned.Pinned = owner, true
+		pinned.SharedWith = []string{"alice", "bob"}
+		plain := newConversation()
+		plain.Owner = owner
+		for _, conv := range []*ConversationContext{pinned, plain, newConversation()} {
+			if err := store.Save(conv); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := store.Get(pinned.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Owner != owner || !got.Pinned || !reflect.DeepEqual(got.SharedWith, pinned.SharedWith) {
+			t.Errorf("owner/shared_with/pinned = %q/%v/%v", got.Owner, got.SharedWith, got.Pinned)
+		}
+
+		page, err := store.List(ConversationFilter{Owner: owner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 2 {
+			t.Errorf("owner filtered page = %+v", page)
+		}
+		no := false
+		page, err = store.List(ConversationFilter{Owner: owner, Pinned: &no})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 1 || page.Conversations[0].ConversationID != plain.ConversationID || page.Conversations[0].Pinned {
+			t.Errorf("unpinned page = %+v", page)
+		}
+
+		// 分叉继承所有者，不继承共享名单和置顶
+		fork, err := store.Fork(pinned.ConversationID, generateConversationID(), "", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fork, err = store.Get(fork.ConversationID); err != nil {
+			t.Fatal(err)
+		}
+		if fork.Owner != owner || fork.Pinned || len(fork.SharedWith) != 0 {
+			t.Errorf("fork owner/shared_with/pinned = %q/%v/%v", fork.Owner, fork.SharedWith, fork.Pinned)
+		}
+
+		got.Pinned = false
+		if err := store.Save(got); err != nil {
+			t.Fatal(err)
+		}
+		if got, err = store.Get(pinned.ConversationID); err != nil || got.Pinned {
+			t.Errorf("unpinned conversation = %+v, err %v", got, err)
+		}
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		for _, q := range []string{"1", "2", "3", "4"} {
+			addTurn(conv, q)
+		}
+		conv.Summary = "用户关注 2024 年的订单"
+		conv.SummarizedTurns = 2
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Summary != conv.Summary || got.SummarizedTurns != 2 {
+			t.Errorf("summary = %q/%d", got.Summary, got.SummarizedTurns)
+		}
+
+		// 分叉保留覆盖范围内的摘要，覆盖范围超出分叉轮次时清空
+		if fork, err := store.Fork(conv.ConversationID, generateConversationID(), "", 3); err != nil || fork.Summary != conv.Summary || fork.SummarizedTurns != 2 {
+			t.Errorf("fork(3) summary = %+v, err %v", fork, err)
+		}
+		if fork, err := store.Fork(conv.ConversationID, generateConversationID(), "", 1); err != nil || fork.Summary != "" || fork.SummarizedTurns != 0 {
+			t.Errorf("fork(1) summary = %+v, err %v", fork, err)
+		}
+
+		if rolled, err := store.Rollback(conv.ConversationID, 2); err != nil || rolled.SummarizedTurns != 2 {
+			t.Errorf("rollback within summary range = %+v, err %v", rolled, err)
+		}
+		if rolled, err := store.Rollback(conv.ConversationID, 1); err != nil || rolled.Summary != "" || rolled.SummarizedTurns != 0 {
+			t.Errorf("rollback into summary range = %+v, err %v", rolled, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		store := open(t)
+		// 共享的测试库中可能有其他会话，用唯一的数据库类型隔离
+		dbType := "list_" + generateConversationID()[5:13]
+		var convs []*ConversationContext
+		for i := 0; i < 3; i++ {
+			conv := newConversation()
+			conv.Database = Database{Type: dbType, Version: "1"}
+			conv.Title = "会话 " + string(rune('A'+i))
+			for j := 0; j <= i; j++ {
+				addTurn(conv, "q")
+			}
+			if err := store.Save(conv); err != nil {
+				t.Fatal(err)
+			}
+			convs = append(convs, conv)
+			time.Sleep(5 * time.Millisecond)
+		}
+		other := newConversation()
+		if err := store.Save(other); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := store.List(ConversationFilter{DatabaseType: dbType, Limit: 2})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if page.Total != 3 || page.Limit != 2 || len(page.Conversations) != 2 {
+			t.Fatalf("page = %+v", page)
+		}
+		first := page.Conversations[0]
+		if first.ConversationID != convs[2].ConversationID || first.Title != "会话 C" || first.TurnCount != 3 || first.Database.Type != dbType {
+			t.Errorf("first summary = %+v", first)
+		}
+		if page.Conversations[1].ConversationID != convs[1].ConversationID {
+			t.Errorf("expected updated_at descending order, got %+v", page.Conversations)
+		}
+
+		page, err = store.List(ConversationFilter{DatabaseType: dbType, Limit: 2, Offset: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 3 || len(page.Conversations) != 1 || page.Conversations[0].ConversationID != convs[0].ConversationID {
+			t.Errorf("second page = %+v", page)
+		}
+
+		// 时间范围为 [UpdatedAfter, UpdatedBefore)
+		page, err = store.List(ConversationFilter{DatabaseType: dbType, UpdatedAfter: convs[1].UpdatedAt, UpdatedBefore: convs[2].UpdatedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 1 || len(page.Conversations) != 1 || page.Conversations[0].ConversationID != convs[1].ConversationID {
+			t.Errorf("time filtered page = %+v", page)
+		}
+
+		if err := store.Delete(convs[2].ConversationID); err != nil {
+			t.Fatal(err)
+		}
+		if page, err = store.List(ConversationFilter{DatabaseType: dbType}); err != nil || page.Total != 2 {
+			t.Errorf("after delete page = %+v, err %v", page, err)
+		}
+	})
+
+	t.Run("fork", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		conv.Title = "原会话"
+		conv.Tags = []string{"t"}
+		for _, q := range []string{"1", "2", "3"} {
+			addTurn(conv, q)
+		}
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+
+		forkID := generateConversationID()
+		fork, err := store.Fork(conv.ConversationID, forkID, "", 2)
+		if err != nil {
+			t.Fatalf("Fork failed: %v", err)
+		}
+		if fork.ConversationID != forkID || fork.Title != "原会话" || len(fork.Tags) != 1 || len(fork.History) != 2 || fork.History[1].Query != "2" {
+			t.Errorf("fork = %+v", fork)
+		}
+		if !schemaDeepEqual(fork.Schema, conv.Schema) || fork.Database.Type != conv.Database.Type {
+			t.Errorf("fork schema/database not copied: %+v", fork)
+		}
+
+		// 分叉后两个会话互不影响
+		got, err := store.Get(forkID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addTurn(got, "fork-3")
+		if err := store.Save(got); err != nil {
+			t.Fatal(err)
+		}
+		src, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(src.History) != 3 || src.History[2].Query != "3" {
+			t.Errorf("source changed after fork: %+v", src.History)
+		}
+		if got, err = store.Get(forkID); err != nil || len(got.History) != 3 || got.History[2].Query != "fork-3" {
+			t.Errorf("fork history = %+v, err %v", got.History, err)
+		}
+
+		if all, err := store.Fork(conv.ConversationID, generateConversationID(), "", -1); err != nil || len(all.History) != 3 {
+			t.Errorf("fork all = %+v, err %v", all, err)
+		}
+		if empty, err := store.Fork(conv.ConversationID, generateConversationID(), "", 0); err != nil || len(empty.History) != 0 {
+			t.Errorf("fork none = %+v, err %v", empty, err)
+		}
+		owned, err := store.Fork(conv.ConversationID, generateConversationID(), "key_b", 1)
+		if err != nil || owned.Owner != "key_b" {
+			t.Errorf("fork with owner = %+v, err %v", owned, err)
+		}
+		if got, err := store.Get(owned.ConversationID); err != nil || got.Owner != "key_b" {
+			t.Errorf("stored fork owner = %+v, err %v", got, err)
+		}
+		if fork.Owner != conv.Owner {
+			t.Errorf("fork without owner should keep %q, got %q", conv.Owner, fork.Owner)
+		}
+		if _, err := store.Fork(conv.ConversationID, generateConversationID(), "", 4); !errors.Is(err, ErrInvalidTurn) {
+			t.Errorf("expected ErrInvalidTurn, got %v", err)
+		}
+		if _, err := store.Fork(generateConversationID(), generateConversationID(), "", 1); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("expected ErrConversationNotFound, got %v", err)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		for _, q := range []string{"1", "2", "3"} {
+			addTurn(conv, q)
+		}
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+
+		rolled, err := store.Rollback(conv.ConversationID, 2)
+		if err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		if len(rolled.History) != 1 || rolled.History[0].Query != "1" {
+			t.Errorf("rolled back history = %+v", rolled.History)
+		}
+
+		// 回滚后继续追加
+		addTurn(rolled, "2b")
+		if err := store.Save(rolled); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get(conv.ConversationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.History) != 2 || got.History[1].Query != "2b" {
+			t.Errorf("history after rollback and append = %+v", got.History)
+		}
+
+		for _, n := range []int{0, 3} {
+			if _, err := store.Rollback(conv.ConversationID, n); !errors.Is(err, ErrInvalidTurn) {
+				t.Errorf("Rollback(%d): expected ErrInvalidTurn, got %v", n, err)
+			}
+		}
+		if rolled, err = store.Rollback(conv.ConversationID, 2); err != nil || len(rolled.History) != 0 {
+			t.Errorf("rollback all = %+v, err %v", rolled, err)
+		}
+		if _, err := store.Rollback(generateConversationID(), 1); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("expected ErrConversationNotFound, got %v", err)
+		}
+	})
+
+	t.Run("cleanup keeps recent conversations", func(t *testing.T) {
+		store := open(t)
+		conv := newConversation()
+		if err := store.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Cleanup(RetentionPolicy{SlidingTTL: time.Hour}); err != nil {
+			t.Fatalf("Cleanup failed: %v", err)
+		}
+		if _, err := store.Get(conv.ConversationID); err != nil {
+			t.Errorf("recent conversation should survive cleanup: %v", err)
+		}
+	})
+}
+
+// schemaDeepEqual 通过 JSON 比较 schema，忽略 nil 与空切片的差异
+func schemaDeepEqual(a, b Schema) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+func TestSQLiteStores_CleanupRemovesStale(t *testing.T) {
+	sqliteStore, err := NewSQLiteContextStore(filepath.Join(t.TempDir(), "context.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.Close()
+	sqlStore := newTestSQLStore(t, "sqlite", filepath.Join(t.TempDir(), "context.db")).(*SQLContextStore)
+	defer sqlStore.Close()
+
+	tests := []struct {
+		name     string
+		store    ContextStore
+		backdate string
+		db       *sql.DB
+	}{
+		{"sqlite", sqliteStore, `UPDATE conversations SET updated_at = ? WHERE id = ?`, sqliteStore.db},
+		{"sql/sqlite", sqlStore, `UPDATE text2sql_conversations SET updated_at = ? WHERE id = ?`, sqlStore.db},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale := &ConversationContext{ConversationID: "conv_stale", History: []ConversationTurn{{Query: "q", SQL: "SELECT 1"}}}
+			fresh := &ConversationContext{ConversationID: "conv_fresh"}
+			pinned := &ConversationContext{ConversationID: "conv_pinned", Pinned: true}
+			old := &ConversationContext{ConversationID: "conv_old", CreatedAt: time.Now().Add(-10 * 24 * time.Hour)}
+			for _, conv := range []*ConversationContext{stale, fresh, pinned, old} {
+				if err := tt.store.Save(conv); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, id := range []string{"conv_stale", "conv_pinned"} {
+				if _, err := tt.db.Exec(tt.backdate, time.Now().Add(-48*time.Hour).UTC(), id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.store.Cleanup(RetentionPolicy{SlidingTTL: 24 * time.Hour}); err != nil {
+				t.Fatalf("Cleanup failed: %v", err)
+			}
+			if _, err := tt.store.Get("conv_stale"); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("stale conversation should be removed, got %v", err)
+			}
+			for _, id := range []string{"conv_fresh", "conv_pinned", "conv_old"} {
+				if _, err := tt.store.Get(id); err != nil {
+					t.Errorf("%s should survive: %v", id, err)
+				}
+			}
+
+			// 绝对过期时间按 created_at 计算，置顶的会话仍然保留
+			if err := tt.store.Cleanup(RetentionPolicy{SlidingTTL: 24 * time.Hour, AbsoluteTTL: 7 * 24 * time.Hour}); err != nil {
+				t.Fatalf("Cleanup failed: %v", err)
+			}
+			if _, err := tt.store.Get("conv_old"); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("conversation past absolute ttl should be removed, got %v", err)
+			}
+			if _, err := tt.store.Get("conv_pinned"); err != nil {
+				t.Errorf("pinned conversation should survive: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package text2sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"text2sql/internal/logger"
+)
+
+const (
+	maxConversationTitleLength = 200
+	maxConversationTags        = 20
+	maxConversationTagLength   = 50
+)
+
+// ConversationDetail 会话详情，含 schema、完整的对话历史和较早轮次的滚动摘要
+type ConversationDetail struct {
+	ConversationSummary
+	SharedWith      []string           `json:"shared_with,omitempty"` // 被共享的请求方名称
+	Schema          Schema             `json:"schema"`
+	History         []ConversationTurn `json:"history"`
+	Summary         string             `json:"summary,omitempty"`
+	SummarizedTurns int                `json:"summarized_turns,omitempty"` // 摘要覆盖的前若干轮
+}
+
+// ConversationUpdate 会话的可修改字段，nil 表示不修改
+type ConversationUpdate struct {
+	Title  *string   `json:"title"`
+	Tags   *[]string `json:"tags"`
+	Pinned *bool     `json:"pinned"` // 置顶的会话不会过期，也不会因会话数上限被淘汰
+	// SharedWith 替换共享名单：同一租户内的请求方名称，被共享者可以读取、续会话和分叉，不能修改或删除
+	SharedWith *[]string `json:"shared_with"`
+}
+
+func (s *Service) newConversationDetail(conv *ConversationContext) *ConversationDetail {
+	detail := &ConversationDetail{
+		ConversationSummary: s.summarize(conv),
+		SharedWith:          conv.SharedWith,
+		Schema:              conv.Schema,
+		History:             conv.History,
+		Summary:             conv.Summary,
+		SummarizedTurns:     conv.SummarizedTurns,
+	}
+	if detail.History == nil {
+		detail.History = []ConversationTurn{}
+	}
+	return detail
+}
+
+// summarize 生成会话的列表项，并按保留策略计算过期时间
+func (s *Service) summarize(conv *ConversationContext) ConversationSummary {
+	summary := summarize(conv)
+	summary.ExpiresAt = s.retention.expiresAt(conv.Pinned, conv.CreatedAt, conv.UpdatedAt)
+	return summary
+}
+
+// ListConversations 按 updated_at 倒序分页列出会话，ctx 中有请求方时只列出其拥有的会话
+func (s *Service) ListConversations(ctx context.Context, filter ConversationFilter) (*ConversationPage, error) {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		filter.Owner = p.ID()
+	}
+	page, err := s.contextStore.List(filter.normalize())
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Conversations {
+		c := &page.Conversations[i]
+		c.ExpiresAt = s.retention.expiresAt(c.Pinned, c.CreatedAt, c.UpdatedAt)
+	}
+	return page, nil
+}
+
+// GetConversation 获取会话详情，不存在时返回 ErrConversationNotFound
+func (s *Service) GetConversation(ctx context.Context, conversationID string) (*ConversationDetail, error) {
+	conv, err := s.loadConversation(ctx, conversationID, accessRead)
+	if err != nil {
+		return nil, err
+	}
+	return s.newConversationDetail(conv), nil
+}
+
+// UpdateConversation 修改会话的标题、标签、置顶状态和共享名单，仅所有者可用。标题与标签会去除首尾空白，标签去重并保持顺序
+func (s *Service) UpdateConversation(ctx context.Context, conversationID string, update ConversationUpdate) (*ConversationDetail, error) {
+	if update.Title == nil && update.Tags == nil && update.Pinned == nil && update.SharedWith == nil {
+		return nil, fmt.Errorf("%w: 需提供 title、tags、pinned 或 shared_with", ErrInvalidConversationUpdate)
+	}
+	var title string
+	var tags []string
+	if update.Title != nil {
+		title = strings.TrimSpace(*update.Title)
+		if len([]rune(title)) > maxConversationTitleLength {
+			return nil, fmt.Errorf("%w: title 不能超过 %d 个字符", ErrInvalidConversationUpdate, maxConversationTitleLength)
+		}
+	}
+	if update.Tags != nil {
+		seen := make(map[string]bool)
+		for _, tag := range *update.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				return nil, fmt.Errorf("%w: 标签不能为空", ErrInvalidConversationUpdate)
+			}
+			if len([]rune(tag)) > maxConversationTagLength {
+				return nil, fmt.Errorf("%w: 标签 %q 超过 %d 个字符", ErrInvalidConversationUpdate, tag, maxConversationTagLength)
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > maxConversationTags {
+			return nil, fmt.Errorf("%w: 标签不能超过 %d 个", ErrInvalidConversationUpdate, maxConversationTags)
+		}
+	}
+
+	conv, err := s.loadConversation(ctx, conversationID, accessOwner)
+	if err != nil {
+		return nil, err
+	}
+	if update.SharedWith != nil {
+		if conv.SharedWith, err = normalizeShares(conv.Owner, *update.SharedWith); err != nil {
+			return nil, err
+		}
+	}
+	if update.Title != nil {
+		conv.Title = title
+	}
+	if update.Tags != nil {
+		conv.Tags = tags
+	}
+	if update.Pinned != nil {
+		conv.Pinned = *update.Pinned
+	}
+	if err := s.contextStore.Save(conv); err != nil {
+		return nil, fmt.Errorf("保存会话失败: %w", err)
+	}
+	return s.newConversationDetail(conv), nil
+}
+
+// DeleteConversation 删除会话，仅所有者可用，不存在时返回 ErrConversationNotFound
+func (s *Service) DeleteConversation(ctx context.Context, conversationID string) error {
+	if _, err := s.loadConversation(ctx, conversationID, accessOwner); err != nil {
+		return err
+	}
+	return s.contextStore.Delete(conversationID)
+}
+
+// ForkConversation 从会话的第 turn 轮（含）分叉出新会话，turn 为 nil 时复制全部轮次，为 0 时只复制 schema 和 database。
+// 新会话归属发起分叉的请求方（被共享者分叉得到自己的副本），计入其会话数，不继承共享名单
+func (s *Service) ForkConversation(ctx context.Context, conversationID string, turn *int) (*ConversationDetail, error) {
+	turns := -1
+	if turn != nil {
+		if *turn < 0 {
+			return nil, fmt.Errorf("%w: turn 不能为负数", ErrInvalidTurn)
+		}
+		turns = *turn
+	}
+	src, err := s.loadConversation(ctx, conversationID, accessRead)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := forkTurns(turns, len(src.History)); err != nil {
+		return nil, err
+	}
+	owner := src.Owner
+	if p, ok := PrincipalFromContext(ctx); ok {
+		owner = p.ID()
+	}
+	// 先检查会话数上限，分叉成功后才淘汰，分叉失败不丢失已有会话
+	if _, err := s.conversationsToEvict(owner, "", conversationID); err != nil {
+		return nil, err
+	}
+	fork, err := s.contextStore.Fork(conversationID, generateConversationID(), owner, turns)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reserveConversation(owner, fork.ConversationID, conversationID); err != nil {
+		if err := s.contextStore.Delete(fork.ConversationID); err != nil {
+			logger.Warn("删除分叉会话失败", "conversation_id", fork.ConversationID, "error", err)
+		}
+		return nil, err
+	}
+	return s.newConversationDetail(fork), nil
+}
+
+// RollbackConversation 删除会话最后 n 轮，之后的请求以剩余的历史为上下文，仅所有者可用
+func (s *Service) RollbackConversation(ctx context.Context, conversationID string, n int) (*ConversationDetail, error) {
+	if _, err := s.loadConversation(ctx, conversationID, accessOwner); err != nil {
+		return nil, err
+	}
+	conv, err := s.contextStore.Rollback(conversationID, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.newConversationDetail(conv), nil
+}
@@ -0,0 +1,144 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestService_ConversationManagement(t *testing.T) {
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{})
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	id := resp.ConversationID
+
+	page, err := svc.ListConversations(context.Background(), ConversationFilter{DatabaseType: "mysql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Limit != DefaultConversationPageSize || page.Conversations[0].TurnCount != 1 {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	title, tags := "  用户报表 ", []string{"report", " report", "users"}
+	detail, err := svc.UpdateConversation(context.Background(), id, ConversationUpdate{Title: &title, Tags: &tags})
+	if err != nil {
+		t.Fatalf("UpdateConversation failed: %v", err)
+	}
+	if detail.Title != "用户报表" || len(detail.Tags) != 2 || detail.Tags[1] != "users" || len(detail.History) != 1 {
+		t.Errorf("unexpected detail: %+v", detail)
+	}
+
+	// 只修改标签时保留标题
+	tags = nil
+	if detail, err = svc.UpdateConversation(context.Background(), id, ConversationUpdate{Tags: &tags}); err != nil || detail.Title != "用户报表" || len(detail.Tags) != 0 {
+		t.Errorf("tags-only update = %+v, err %v", detail, err)
+	}
+
+	long := string(make([]rune, maxConversationTitleLength+1))
+	empty := []string{" "}
+	for _, update := range []ConversationUpdate{{}, {Title: &long}, {Tags: &empty}} {
+		if _, err := svc.UpdateConversation(context.Background(), id, update); !errors.Is(err, ErrInvalidConversationUpdate) {
+			t.Errorf("expected ErrInvalidConversationUpdate for %+v, got %v", update, err)
+		}
+	}
+
+	if err := svc.DeleteConversation(context.Background(), id); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	if _, err := svc.GetConversation(context.Background(), id); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound, got %v", err)
+	}
+	if err := svc.DeleteConversation(context.Background(), id); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound on second delete, got %v", err)
+	}
+	if _, err := svc.UpdateConversation(context.Background(), id, ConversationUpdate{Title: &title}); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound on update, got %v", err)
+	}
+}
+
+func TestService_ForkAndRollback(t *testing.T) {
+	provider := &recordingProvider{content: "SELECT id FROM users"}
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{})
+	var id string
+	for _, turn := range []struct{ query, sql string }{
+		{"查询用户", "SELECT id FROM users"},
+		{"只要前 10 个", "SELECT id FROM users LIMIT 10"},
+	} {
+		provider.content = turn.sql
+		resp, err := svc.Generate(context.Background(), &GenerateRequest{
+			Query:          turn.query,
+			ConversationID: id,
+			Schema:         Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+			Database:       Database{Type: "mysql", Version: "8.0"},
+		})
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		id = resp.ConversationID
+	}
+
+	one := 1
+	fork, err := svc.ForkConversation(context.Background(), id, &one)
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %v", err)
+	}
+	if fork.ConversationID == id || len(fork.History) != 1 || fork.History[0].Query != "查询用户" {
+		t.Errorf("unexpected fork: %+v", fork)
+	}
+	negative := -1
+	if _, err := svc.ForkConversation(context.Background(), id, &negative); !errors.Is(err, ErrInvalidTurn) {
+		t.Errorf("expected ErrInvalidTurn, got %v", err)
+	}
+
+	// 回滚后续会话以剩余历史的最后一条语句为 previous_sql
+	if _, err := svc.RollbackConversation(context.Background(), id, 1); err != nil {
+		t.Fatalf("RollbackConversation failed: %v", err)
+	}
+	if _, err := svc.Generate(context.Background(), &GenerateRequest{Query: "按 id 排序", ConversationID: id}); err != nil {
+		t.Fatal(err)
+	}
+	messages := provider.requests[len(provider.requests)-1].Messages
+	if user := messages[len(messages)-1].Content; !strings.Contains(user, "SELECT id FROM users") || strings.Contains(user, "LIMIT 10") {
+		t.Errorf("expected previous SQL from the remaining turn, got %q", user)
+	}
+}
+
+// 在 -race 下运行：修改会话与列出会话并发时不共享存储中的会话
+func TestService_ConcurrentUpdateAndList(t *testing.T) {
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{})
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			title, tags := "报表", []string{"report"}
+			if _, err := svc.UpdateConversation(context.Background(), resp.ConversationID, ConversationUpdate{Title: &title, Tags: &tags}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.ListConversations(context.Background(), ConversationFilter{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
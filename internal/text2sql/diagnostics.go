@@ -0,0 +1,170 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity 诊断级别
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// 诊断码：对客户端稳定，可用于程序化处理
+const (
+	CodeEmptyQuery             = "EMPTY_QUERY"
+	CodeUnsupportedDatabase    = "UNSUPPORTED_DATABASE"
+	CodeSyntaxError            = "SYNTAX_ERROR"
+	CodeNotReadOnly            = "NOT_READ_ONLY"
+	CodeMultipleStatements     = "MULTIPLE_STATEMENTS"
+	CodeUnsupportedFeature     = "UNSUPPORTED_FEATURE"
+	CodeUnverifiedSyntax       = "UNVERIFIED_SYNTAX"
+	CodeSelectStar             = "SELECT_STAR"
+	CodeRedisWriteCommand      = "REDIS_WRITE_COMMAND"
+	CodeRedisUnknownCommand    = "REDIS_UNKNOWN_COMMAND"
+	CodeRedisSyntaxError       = "REDIS_SYNTAX_ERROR"
+	CodeRedisWrongArity        = "REDIS_WRONG_ARITY"
+	CodeRedisInvalidArgument   = "REDIS_INVALID_ARGUMENT"
+	CodeRedisLimitExceeded     = "REDIS_LIMIT_EXCEEDED"
+	CodeRedisUnknownKey        = "REDIS_UNKNOWN_KEY"
+	CodeRedisWrongType         = "REDIS_WRONG_TYPE"
+	CodeMongoInvalidQuery      = "MONGO_INVALID_QUERY"
+	CodeMongoUnknownStage      = "MONGO_UNKNOWN_STAGE"
+	CodeMongoServerScript      = "MONGO_SERVER_SCRIPT"
+	CodeMongoUnknownCollection = "MONGO_UNKNOWN_COLLECTION"
+	CodeMongoUnknownField      = "MONGO_UNKNOWN_FIELD"
+	CodeForbiddenFunction      = "FORBIDDEN_FUNCTION"
+	CodeForbiddenSetting       = "FORBIDDEN_SETTING"
+	CodeMissingPartitionFilter = "MISSING_PARTITION_FILTER"
+	CodeESInvalidQuery         = "ES_INVALID_QUERY"
+	CodeESScript               = "ES_SCRIPT"
+	CodeESUnknownIndex         = "ES_UNKNOWN_INDEX"
+	CodeESUnknownField         = "ES_UNKNOWN_FIELD"
+	CodeESFieldType            = "ES_FIELD_TYPE"
+	CodeCypherUnknownLabel     = "CYPHER_UNKNOWN_LABEL"
+	CodeCypherUnknownRelType   = "CYPHER_UNKNOWN_RELATIONSHIP"
+	CodeCypherUnknownProperty  = "CYPHER_UNKNOWN_PROPERTY"
+)
+
+// ValidationError 结构化校验诊断。
+// Line/Column 从 1 开始，Column 按字符（rune）计数；位置未知时为 0。
+type ValidationError struct {
+	Code       string   `json:"code"`
+	Severity   Severity `json:"severity"`
+	Message    string   `json:"message"`
+	Line       int      `json:"line,omitempty"`
+	Column     int      `json:"column,omitempty"`
+	EndLine    int      `json:"end_line,omitempty"`
+	EndColumn  int      `json:"end_column,omitempty"`
+	Token      string   `json:"token,omitempty"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+// Error 实现 error 接口，输出带位置和修改建议的描述（同时用于重试时反馈给 LLM）
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "（第 %d 行第 %d 列", e.Line, e.Column)
+		if e.Token != "" {
+			fmt.Fprintf(&b, "，附近 '%s'", e.Token)
+		}
+		b.WriteString("）")
+	} else if e.Token != "" {
+		fmt.Fprintf(&b, "（附近 '%s'）", e.Token)
+	}
+	if e.Suggestion != "" {
+		fmt.Fprintf(&b, "，建议：%s", e.Suggestion)
+	}
+	return b.String()
+}
+
+// newDiagnostic 创建诊断
+func newDiagnostic(code string, severity Severity, format string, args ...any) *ValidationError {
+	return &ValidationError{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)}
+}
+
+// at 根据源文本和字节偏移设置位置与 token
+func (e *ValidationError) at(src string, offset int, token string) *ValidationError {
+	if offset < 0 || offset > len(src) {
+		return e
+	}
+	e.Line, e.Column = lineColumn(src, offset)
+	e.EndLine, e.EndColumn = lineColumn(src, min(offset+len(token), len(src)))
+	e.Token = token
+	return e
+}
+
+// atToken 将诊断定位到词法单元
+func (e *ValidationError) atToken(src string, t sqlToken) *ValidationError {
+	return e.at(src, t.pos, t.text)
+}
+
+// withSuggestion 设置修改建议
+func (e *ValidationError) withSuggestion(s string) *ValidationError {
+	e.Suggestion = s
+	return e
+}
+
+// lineColumn 将字节偏移转换为 1 起始的行号和字符列号
+func lineColumn(src string, offset int) (int, int) {
+	prefix := src[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	lineStart := strings.LastIndexByte(prefix, '\n') + 1
+	return line, utf8.RuneCountInString(prefix[lineStart:]) + 1
+}
+
+// Diagnostics 一次校验产生的全部诊断（错误与警告）
+type Diagnostics []*ValidationError
+
+// HasErrors 是否包含错误级诊断
+func (d Diagnostics) HasErrors() bool {
+	for _, e := range d {
+		if e.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors 返回错误级诊断
+func (d Diagnostics) Errors() Diagnostics {
+	return d.filter(SeverityError)
+}
+
+// Warnings 返回警告级诊断
+func (d Diagnostics) Warnings() Diagnostics {
+	return d.filter(SeverityWarning)
+}
+
+func (d Diagnostics) filter(severity Severity) Diagnostics {
+	var out Diagnostics
+	for _, e := range d {
+		if e.Severity == severity {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Error 实现 error 接口，仅拼接错误级诊断
+func (d Diagnostics) Error() string {
+	errs := d.Errors()
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "；")
+}
+
+// Err 存在错误级诊断时返回自身作为 error，否则返回 nil
+func (d Diagnostics) Err() error {
+	if !d.HasErrors() {
+		return nil
+	}
+	return d
+}
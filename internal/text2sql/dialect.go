@@ -0,0 +1,161 @@
+package text2sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dialect 目标查询语言：提示词、输出解析、校验、版本特性与标识符引用。
+// 新增目标时实现该接口并通过 RegisterDialect 注册，无需修改 Service。
+type Dialect interface {
+	// Name 方言名，与 Database.Type 对应
+	Name() string
+	// DisplayName 在提示信息中的展示名，如 MySQL、Redis
+	DisplayName() string
+	// StatementName 生成语句的称呼，用于校验失败时反馈给 LLM，如 SQL、Redis 命令
+	StatementName() string
+	// SystemPrompt 构建 system prompt；modify 为 true 时为在已有语句基础上修改的模式
+	SystemPrompt(database Database, schema Schema, modify bool) string
+	// ExtractOutput 从 LLM 输出中提取语句和解释
+	ExtractOutput(content string) (statement, explanation string)
+	// Validate 校验生成的语句，返回全部诊断（错误与警告）
+	Validate(statement string, database Database, schema Schema, opts ValidateOptions) Diagnostics
+	// Features 版本特性矩阵，无版本差异时返回 nil
+	Features() []FeatureVersion
+	// QuoteIdentifier 按方言规则引用标识符
+	QuoteIdentifier(name string) string
+}
+
+// FeatureVersion 方言特性及其最低版本，Since 为空表示该方言不支持
+type FeatureVersion struct {
+	Feature string `json:"feature"`
+	Since   string `json:"since,omitempty"`
+}
+
+// RowLimiter 可选接口：为未限制行数的查询加上行数上限
+type RowLimiter interface {
+	LimitRows(statement string, maxRows int) string
+}
+
+// ValidateOptions 校验时的可配置项
+type ValidateOptions struct {
+	MaxRows int // 生成语句的行数上限，<= 0 时不改写；仅对实现了 RowLimiter 的方言生效
+	// Dialects 按方言名（Dialect.Name，小写）保存各方言自己的配置，值的类型由方言约定，
+	// 如 redis 为 RedisLimits、clickhouse 为 ClickHouseLimits。用 WithDialect 设置，方言通过 DialectOptions 读取
+	Dialects map[string]any
+}
+
+// DefaultValidateOptions 各方言的默认限制
+func DefaultValidateOptions() ValidateOptions {
+	return ValidateOptions{}.
+		WithDialect("redis", DefaultRedisLimits()).
+		WithDialect("clickhouse", DefaultClickHouseLimits())
+}
+
+// WithDialect 返回设置了 name 方言配置的副本，不修改原有的 Dialects
+func (o ValidateOptions) WithDialect(name string, config any) ValidateOptions {
+	dialects := make(map[string]any, len(o.Dialects)+1)
+	for k, v := range o.Dialects {
+		dialects[k] = v
+	}
+	dialects[strings.ToLower(name)] = config
+	o.Dialects = dialects
+	return o
+}
+
+// DialectOptions 读取 name 方言的配置，未配置或类型不符时返回 def
+func DialectOptions[T any](opts ValidateOptions, name string, def T) T {
+	if config, ok := opts.Dialects[strings.ToLower(name)].(T); ok {
+		return config
+	}
+	return def
+}
+
+var (
+	dialects       = make(map[string]Dialect)
+	dialectAliases = make(map[string]string)
+	dialectsMu     sync.RWMutex
+)
+
+// RegisterDialect 注册方言，aliases 为 Database.Type 的其他写法。同名方言会被覆盖。
+func RegisterDialect(d Dialect, aliases ...string) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	name := strings.ToLower(d.Name())
+	dialects[name] = d
+	for _, a := range aliases {
+		dialectAliases[strings.ToLower(a)] = name
+	}
+}
+
+// UnregisterDialect 注销方言及指向它的别名，未注册时不做任何事
+func UnregisterDialect(name string) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	name = strings.ToLower(name)
+	delete(dialects, name)
+	for alias, canonical := range dialectAliases {
+		if canonical == name {
+			delete(dialectAliases, alias)
+		}
+	}
+}
+
+// GetDialect 按 Database.Type（或别名）获取方言
+func GetDialect(name string) (Dialect, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	name = strings.ToLower(name)
+	if canonical, ok := dialectAliases[name]; ok {
+		name = canonical
+	}
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持的数据库类型: %s", ErrUnsupportedDatabase, name)
+	}
+	return d, nil
+}
+
+// ListDialects 列出所有已注册的方言名（不含别名）
+func ListDialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for n := range dialects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterDialect(&sqlDialect{name: "mysql", strict: true, quote: '`', literals: sqlStringsBackslash})
+	RegisterDialect(&sqlDialect{name: "postgresql", quote: '"', literals: sqlStringsPostgres}, "postgres")
+	RegisterDialect(&sqlDialect{name: "sqlite", quote: '"'})
+	RegisterDialect(redisDialect{})
+	RegisterDialect(mongoDialect{}, "mongo")
+	RegisterDialect(clickhouseDialect{})
+	RegisterDialect(mssqlDialect{}, "sqlserver")
+	RegisterDialect(oracleDialect{})
+	RegisterDialect(duckdbDialect{})
+	RegisterDialect(elasticsearchDialect{}, "es")
+	RegisterDialect(cypherDialect{}, "neo4j")
+}
+
+// unsupportedFeatures 返回目标版本不可用的特性；版本未知时只返回方言本身不支持的特性
+func unsupportedFeatures(d Dialect, version string) []string {
+	current, versionKnown := parseDBVersion(version)
+	var names []string
+	for _, f := range d.Features() {
+		if f.Since == "" {
+			names = append(names, f.Feature)
+			continue
+		}
+		if since, _ := parseDBVersion(f.Since); versionKnown && current.less(since) {
+			names = append(names, f.Feature)
+		}
+	}
+	return names
+}
@@ -0,0 +1,247 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClickHouseLimits ClickHouse 查询防护
+type ClickHouseLimits struct {
+	RequirePartitionFilter bool  // 大表必须在 WHERE/PREWHERE 中按分区键过滤
+	LargeTableRows         int64 // 估算行数达到该值的表视为大表；<= 0 时所有声明了分区键的表都视为大表
+}
+
+// DefaultClickHouseLimits 默认：行数达到一千万的表要求分区过滤
+func DefaultClickHouseLimits() ClickHouseLimits {
+	return ClickHouseLimits{RequirePartitionFilter: true, LargeTableRows: 10_000_000}
+}
+
+// clickhouseWriteKeywords 写操作与管理语句关键字
+var clickhouseWriteKeywords = map[string]bool{
+	"INSERT": true, "ALTER": true, "SYSTEM": true, "KILL": true, "OPTIMIZE": true, "TRUNCATE": true,
+	"DROP": true, "CREATE": true, "RENAME": true, "EXCHANGE": true, "ATTACH": true, "DETACH": true,
+	"DELETE": true, "UPDATE": true, "GRANT": true, "REVOKE": true, "SET": true, "USE": true,
+}
+
+// clickhouseExternalTableFunctions 访问外部系统或本地文件的表函数
+var clickhouseExternalTableFunctions = map[string]bool{
+	"url": true, "s3": true, "s3cluster": true, "file": true, "remote": true, "remotesecure": true,
+	"mysql": true, "postgresql": true, "mongodb": true, "redis": true, "sqlite": true, "hdfs": true,
+	"executable": true, "jdbc": true, "odbc": true, "input": true, "azureblobstorage": true, "gcs": true,
+	"deltalake": true, "hudi": true, "iceberg": true,
+}
+
+// clickhouseProtectedSettings 不允许在查询的 SETTINGS 子句中修改的设置（权限与资源限制）
+var clickhouseProtectedSettings = map[string]bool{
+	"readonly": true, "allow_ddl": true, "allow_introspection_functions": true,
+	"max_execution_time": true, "max_memory_usage": true, "max_rows_to_read": true, "max_bytes_to_read": true,
+	"max_result_rows": true, "max_result_bytes": true, "max_threads": true,
+}
+
+// clickhouseDialect ClickHouse 分析查询
+type clickhouseDialect struct{}
+
+func (clickhouseDialect) Name() string { return "clickhouse" }
+
+func (clickhouseDialect) DisplayName() string { return "ClickHouse" }
+
+func (clickhouseDialect) StatementName() string { return "SQL" }
+
+func (d clickhouseDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的数据库表结构和自然语言问题，生成对应的 ClickHouse SELECT 查询。"
+	output := `第一行是 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	if modify {
+		intro = "用户会提供现有的 SQL 语句和新的需求，你需要在现有 SQL 基础上进行修改。"
+		output = `第一行是修改后的完整 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	}
+	prompt := fmt.Sprintf(`你是一个 ClickHouse 专家%s。%s
+
+规则：
+1. 只生成 SELECT 查询，不要生成 INSERT/ALTER/SYSTEM/KILL/OPTIMIZE 等语句，不要使用 INTO OUTFILE
+2. 使用 ClickHouse 语法而不是 MySQL 写法：日期按月/天聚合用 toStartOfMonth()、toStartOfDay()、toDate()，条件聚合用 countIf()、sumIf()，近似去重用 uniq()
+3. 数组使用 has()、arrayJoin()、arrayMap(x -> ...)、arrayFilter() 等函数或 ARRAY JOIN 子句
+4. ReplacingMergeTree 等需要合并去重的表按需使用 FINAL；超大表抽样统计可使用 SAMPLE 0.1；每组取前 N 条使用 LIMIT n BY 列
+5. 不要使用 url()、s3()、file()、remote()、mysql() 等访问外部数据的表函数，不要在 SETTINGS 中修改 readonly、max_execution_time 等限制
+6. 表名和列名使用 schema 中提供的名称，标识符需要引用时使用反引号
+7. 输出格式：%s`, versionNote(database.Version), intro, output)
+	if tables := partitionedTables(schema.Tables); tables != "" {
+		prompt += "\n\n注意：以下表数据量大，必须在 WHERE 或 PREWHERE 中按分区键过滤：" + tables
+	}
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		prompt += "\n\n注意：ClickHouse 不支持以下特性，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (clickhouseDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutput(content)
+}
+
+func (clickhouseDialect) Validate(sql string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateClickHouse(sql, database, schema.Tables, DialectOptions(opts, "clickhouse", DefaultClickHouseLimits()))
+}
+
+func (clickhouseDialect) Features() []FeatureVersion {
+	return featureVersions("clickhouse")
+}
+
+func (clickhouseDialect) QuoteIdentifier(name string) string {
+	return quoteIdent(name, '`')
+}
+
+// partitionedTables 声明了分区键的表及其分区键，用于 prompt
+func partitionedTables(tables []Table) string {
+	var parts []string
+	for _, t := range tables {
+		if len(t.PartitionKey) > 0 {
+			parts = append(parts, fmt.Sprintf("%s（%s）", t.Name, strings.Join(t.PartitionKey, ", ")))
+		}
+	}
+	return strings.Join(parts, "、")
+}
+
+// validateClickHouse ClickHouse 的 SELECT 语法与 sqlparser 差异较大，采用词法级校验：
+// 语句结构 → 只读 → 外部表函数 → SETTINGS → 版本特性 → 大表分区过滤
+func validateClickHouse(sql string, database Database, tables []Table, limits ClickHouseLimits) Diagnostics {
+	tokens := tokenizeSQL(sql, sqlStringsBackslash)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "SQL 不能为空")}
+	}
+	if d := checkSelectStructure(sql, tokens, "ClickHouse", clickhouseWriteKeywords); d != nil {
+		return Diagnostics{d}
+	}
+
+	var diags Diagnostics
+	for i, t := range tokens {
+		if t.kind != tokWord {
+			continue
+		}
+		qualified := (i > 0 && tokens[i-1].isPunct(".")) || (i+1 < len(tokens) && tokens[i+1].isPunct("."))
+		switch {
+		case clickhouseWriteKeywords[t.upper] && !qualified:
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+				atToken(sql, t).withSuggestion("只生成 SELECT 查询，不要包含写操作"))
+		case t.is("INTO") && i+1 < len(tokens) && tokens[i+1].is("OUTFILE"):
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 INTO OUTFILE 写出文件").
+				atToken(sql, t).withSuggestion("去掉 INTO OUTFILE，直接返回查询结果"))
+		case i+1 < len(tokens) && tokens[i+1].isPunct("(") && clickhouseExternalTableFunctions[strings.ToLower(t.text)]:
+			diags = append(diags, newDiagnostic(CodeForbiddenFunction, SeverityError, "不允许使用访问外部数据的表函数: %s", t.text).
+				atToken(sql, t).withSuggestion("只查询 schema 中提供的表"))
+		}
+	}
+	diags = append(diags, checkClickHouseSettings(sql, tokens)...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, checkSQLFeatures("clickhouse", database.Version, sql, tokens)...)
+	if limits.RequirePartitionFilter {
+		diags = append(diags, checkPartitionFilter(sql, tokens, tables, limits.LargeTableRows)...)
+	}
+	return append(diags, selectStarWarnings(sql, tokens)...)
+}
+
+// checkClickHouseSettings SETTINGS name = value[, ...] 中不得修改权限与资源限制
+func checkClickHouseSettings(sql string, tokens []sqlToken) Diagnostics {
+	var diags Diagnostics
+	for i, t := range tokens {
+		if !t.is("SETTINGS") {
+			continue
+		}
+		for j := i + 1; j+2 < len(tokens) && tokens[j].kind == tokWord && tokens[j+1].isOp("="); j += 3 {
+			if clickhouseProtectedSettings[strings.ToLower(tokens[j].text)] {
+				diags = append(diags, newDiagnostic(CodeForbiddenSetting, SeverityError, "不允许在查询中修改设置: %s", tokens[j].text).
+					atToken(sql, tokens[j]).withSuggestion("去掉该设置，使用服务端配置的限制"))
+			}
+			if j+3 >= len(tokens) || !tokens[j+3].isPunct(",") {
+				break
+			}
+			j++
+		}
+	}
+	return diags
+}
+
+// checkPartitionFilter 大表必须在 WHERE / PREWHERE 中引用分区键，避免全表扫描
+func checkPartitionFilter(sql string, tokens []sqlToken, tables []Table, largeRows int64) Diagnostics {
+	var diags Diagnostics
+	for _, ref := range referencedTables(tokens) {
+		t := findTable(tables, ref.name)
+		if t == nil || len(t.PartitionKey) == 0 || (largeRows > 0 && t.Rows < largeRows) {
+			continue
+		}
+		if !filtersOnColumns(tokens, t.PartitionKey) {
+			diags = append(diags, newDiagnostic(CodeMissingPartitionFilter, SeverityError, "大表 %s 缺少分区键过滤条件（%s）", t.Name, strings.Join(t.PartitionKey, ", ")).
+				atToken(sql, ref.token).withSuggestion(fmt.Sprintf("在 WHERE 或 PREWHERE 中按 %s 限定时间或分区范围", strings.Join(t.PartitionKey, ", "))))
+		}
+	}
+	return diags
+}
+
+type tableRef struct {
+	name  string
+	token sqlToken
+}
+
+// referencedTables FROM / JOIN 之后引用的表名（含 db.table 形式）
+func referencedTables(tokens []sqlToken) []tableRef {
+	var refs []tableRef
+	for i := 0; i+1 < len(tokens); i++ {
+		if !tokens[i].is("FROM") && !tokens[i].is("JOIN") {
+			continue
+		}
+		j := i + 1
+		if tokens[j].kind != tokWord && tokens[j].kind != tokQuotedIdent {
+			continue
+		}
+		if j+1 < len(tokens) && tokens[j+1].isPunct("(") {
+			continue // 表函数
+		}
+		name := unquoteIdent(tokens[j].text)
+		if j+2 < len(tokens) && tokens[j+1].isPunct(".") {
+			name += "." + unquoteIdent(tokens[j+2].text)
+		}
+		refs = append(refs, tableRef{name: name, token: tokens[j]})
+	}
+	return refs
+}
+
+// findTable 按表名查找 schema 中的表，db.table 与 table 互相匹配
+func findTable(tables []Table, name string) *Table {
+	short := name[strings.LastIndexByte(name, '.')+1:]
+	for i := range tables {
+		n := tables[i].Name
+		if strings.EqualFold(n, name) || strings.EqualFold(n[strings.LastIndexByte(n, '.')+1:], short) {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// filtersOnColumns WHERE / PREWHERE 之后是否引用了任一列
+func filtersOnColumns(tokens []sqlToken, columns []string) bool {
+	inFilter := false
+	for _, t := range tokens {
+		switch {
+		case t.is("WHERE") || t.is("PREWHERE"):
+			inFilter = true
+		case t.is("GROUP") || t.is("ORDER") || t.is("LIMIT") || t.is("HAVING") || t.is("SETTINGS") || t.is("FORMAT"):
+			inFilter = false
+		case inFilter && (t.kind == tokWord || t.kind == tokQuotedIdent):
+			for _, c := range columns {
+				if strings.EqualFold(unquoteIdent(t.text), c) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// unquoteIdent 去掉标识符两侧的引号
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && (s[0] == '`' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
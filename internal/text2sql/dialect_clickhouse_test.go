@@ -0,0 +1,98 @@
+package text2sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateClickHouse(t *testing.T) {
+	v := NewSQLValidator()
+	schema := Schema{Tables: []Table{
+		{Name: "events", PartitionKey: []string{"event_date"}, Rows: 5_000_000_000,
+			Columns: []Column{{Name: "event_date"}, {Name: "user_id"}, {Name: "tags"}}},
+		{Name: "users", Columns: []Column{{Name: "id"}, {Name: "name"}}},
+	}}
+	database := Database{Type: "clickhouse", Version: "23.8"}
+	tests := []struct {
+		name     string
+		sql      string
+		wantCode string
+	}{
+		{"monthly", "SELECT toStartOfMonth(event_date) AS m, countIf(user_id > 0) FROM events WHERE event_date >= '2024-01-01' GROUP BY m", ""},
+		{"prewhere", "SELECT user_id FROM events PREWHERE event_date = today() LIMIT 10", ""},
+		{"final sample limit by", "SELECT user_id, event_date FROM events FINAL SAMPLE 0.1 WHERE event_date > today() - 7 ORDER BY event_date DESC LIMIT 3 BY user_id", ""},
+		{"array join lambda", "SELECT tag, count() FROM events ARRAY JOIN arrayFilter(x -> x != '', tags) AS tag WHERE event_date = today() GROUP BY tag", ""},
+		{"small table", "SELECT name FROM users", ""},
+		{"system table", "SELECT table, sum(rows) FROM system.parts GROUP BY table", ""},
+		{"settings allowed", "SELECT count() FROM users SETTINGS max_block_size = 1000", ""},
+		{"insert", "INSERT INTO users VALUES (1, 'a')", CodeNotReadOnly},
+		{"system", "SYSTEM DROP DNS CACHE", CodeNotReadOnly},
+		{"kill", "KILL QUERY WHERE user = 'x'", CodeNotReadOnly},
+		{"optimize", "OPTIMIZE TABLE events FINAL", CodeNotReadOnly},
+		{"into outfile", "SELECT * FROM users INTO OUTFILE '/tmp/u.csv'", CodeNotReadOnly},
+		{"multiple statements", "SELECT 1; SELECT 2", CodeMultipleStatements},
+		{"unbalanced", "SELECT count( FROM users", CodeSyntaxError},
+		{"url function", "SELECT * FROM url('http://example.com/data.csv', CSV)", CodeForbiddenFunction},
+		{"remote function", "SELECT count() FROM remote('other:9000', default.users)", CodeForbiddenFunction},
+		{"readonly setting", "SELECT name FROM users SETTINGS readonly = 0", CodeForbiddenSetting},
+		{"second setting", "SELECT name FROM users SETTINGS max_block_size = 10, max_execution_time = 0", CodeForbiddenSetting},
+		{"missing partition filter", "SELECT count() FROM events", CodeMissingPartitionFilter},
+		{"filter on other column", "SELECT count() FROM events WHERE user_id = 1", CodeMissingPartitionFilter},
+		{"returning", "SELECT name FROM users RETURNING id", CodeUnsupportedFeature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.DiagnoseWithSchema(tt.sql, database, schema).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateClickHouse_Limits(t *testing.T) {
+	schema := Schema{Tables: []Table{{Name: "logs", PartitionKey: []string{"day"}, Rows: 1000}}}
+	database := Database{Type: "clickhouse"}
+	sql := "SELECT count() FROM logs"
+
+	if errs := NewSQLValidator().DiagnoseWithSchema(sql, database, schema).Errors(); len(errs) > 0 {
+		t.Fatalf("table below threshold should pass, got %v", errs)
+	}
+
+	limits := DefaultClickHouseLimits()
+	limits.LargeTableRows = 0
+	opts := DefaultValidateOptions().WithDialect("clickhouse", limits)
+	errs := NewSQLValidatorWithOptions(opts).DiagnoseWithSchema(sql, database, schema).Errors()
+	if len(errs) != 1 || errs[0].Code != CodeMissingPartitionFilter || errs[0].Token != "logs" {
+		t.Fatalf("expected MISSING_PARTITION_FILTER on logs, got %v", errs)
+	}
+
+	limits.RequirePartitionFilter = false
+	opts = opts.WithDialect("clickhouse", limits)
+	if errs := NewSQLValidatorWithOptions(opts).DiagnoseWithSchema(sql, database, schema).Errors(); len(errs) > 0 {
+		t.Fatalf("full scan allowed, got %v", errs)
+	}
+}
+
+func TestClickHouseSystemPrompt(t *testing.T) {
+	d, err := GetDialect("clickhouse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := Schema{Tables: []Table{{Name: "events", PartitionKey: []string{"event_date"}}}}
+	prompt := d.SystemPrompt(Database{Type: "clickhouse"}, schema, false)
+	for _, want := range []string{"toStartOfMonth", "countIf", "FINAL", "LIMIT n BY", "events（event_date）"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+	if got := d.QuoteIdentifier("order"); got != "`order`" {
+		t.Errorf("QuoteIdentifier = %s", got)
+	}
+}
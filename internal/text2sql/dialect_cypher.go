@@ -0,0 +1,596 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// cypherReadClauses 查询可以使用的起始子句
+var cypherReadClauses = map[string]bool{
+	"MATCH": true, "OPTIONAL MATCH": true, "WITH": true, "UNWIND": true, "RETURN": true, "CALL": true, "USE": true,
+}
+
+// cypherWriteClauses 写入数据、修改 schema 与权限管理的子句
+var cypherWriteClauses = map[string]bool{
+	"CREATE": true, "MERGE": true, "SET": true, "DELETE": true, "DETACH": true, "REMOVE": true,
+	"FOREACH": true, "DROP": true, "ALTER": true, "GRANT": true, "REVOKE": true, "DENY": true,
+}
+
+// cypherClauseKeywords 其余子句关键字
+var cypherClauseKeywords = map[string]bool{
+	"MATCH": true, "OPTIONAL": true, "WHERE": true, "WITH": true, "RETURN": true, "UNWIND": true,
+	"ORDER": true, "SKIP": true, "LIMIT": true, "UNION": true, "CALL": true, "YIELD": true, "USE": true, "LOAD": true,
+}
+
+// cypherProcedureRule 按过程或函数名前缀（小写）拒绝的调用
+type cypherProcedureRule struct {
+	Prefix string
+	Code   string
+	Reason string
+}
+
+// cypherProcedureRules 管理过程、有副作用的 APOC 过程与执行动态 Cypher、访问外部资源的调用，
+// 命中时给出具体原因；其余不在 cypherReadOnlyProcedures 中的调用一律拒绝
+var cypherProcedureRules = []cypherProcedureRule{
+	{"dbms.", CodeForbiddenFunction, "不允许调用 dbms 管理过程"},
+	{"db.create", CodeNotReadOnly, "不允许调用修改 schema 的过程"},
+	{"db.index.fulltext.create", CodeNotReadOnly, "不允许调用修改 schema 的过程"},
+	{"db.index.fulltext.drop", CodeNotReadOnly, "不允许调用修改 schema 的过程"},
+	{"db.clearquerycaches", CodeForbiddenFunction, "不允许调用 dbms 管理过程"},
+	{"apoc.create.node", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.create.relationship", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.create.add", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.create.set", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.create.remove", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.merge.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.refactor.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.nodes.delete", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.nodes.link", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.atomic.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.lock.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.schema.assert", CodeNotReadOnly, "不允许调用修改 schema 的过程"},
+	{"apoc.trigger.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.uuid.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.ttl.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.custom.", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+	{"apoc.periodic.", CodeForbiddenFunction, "不允许通过 APOC 执行动态 Cypher"},
+	{"apoc.cypher.", CodeForbiddenFunction, "不允许通过 APOC 执行动态 Cypher"},
+	{"apoc.do.", CodeForbiddenFunction, "不允许通过 APOC 执行动态 Cypher"},
+	{"apoc.load.", CodeForbiddenFunction, "不允许通过 APOC 访问外部文件或网络"},
+	{"apoc.import.", CodeForbiddenFunction, "不允许通过 APOC 访问外部文件或网络"},
+	{"apoc.export.", CodeForbiddenFunction, "不允许通过 APOC 访问外部文件或网络"},
+	{"apoc.systemdb.", CodeForbiddenFunction, "不允许调用 dbms 管理过程"},
+	{"apoc.convert.setjsonproperty", CodeNotReadOnly, "不允许调用写入数据的 APOC 过程"},
+}
+
+// cypherReadOnlyProcedures 允许 CALL 或调用的只读过程与带命名空间的函数，以 "." 结尾的按前缀匹配，
+// 其余按全名匹配（不区分大小写）
+var cypherReadOnlyProcedures = []string{
+	"db.labels", "db.relationshiptypes", "db.propertykeys", "db.indexes", "db.constraints", "db.info",
+	"db.schema.", "db.index.fulltext.querynodes", "db.index.fulltext.queryrelationships",
+	"db.index.vector.querynodes", "db.index.vector.queryrelationships",
+	"date.", "datetime.", "localdatetime.", "localtime.", "time.", "duration.", "point.", "vector.similarity.",
+	"apoc.path.", "apoc.meta.", "apoc.text.", "apoc.coll.", "apoc.map.", "apoc.convert.", "apoc.math.",
+	"apoc.number.", "apoc.date.", "apoc.temporal.", "apoc.agg.", "apoc.node.", "apoc.rel.", "apoc.label.",
+	"apoc.any.", "apoc.algo.", "apoc.neighbors.", "apoc.hashing.", "apoc.scoring.", "apoc.diff.", "apoc.bitwise.",
+	"apoc.nodes.connected", "apoc.nodes.isdense", "apoc.nodes.relationship.types", "apoc.nodes.relationships.exist",
+	"apoc.create.vnode", "apoc.create.vnodes", "apoc.create.vrelationship", "apoc.create.vpattern",
+	"apoc.create.vpatternfull", "apoc.create.virtual.",
+}
+
+// cypherReadOnlyProcedure 判断小写的过程或函数全名是否在只读白名单中
+func cypherReadOnlyProcedure(lower string) bool {
+	for _, p := range cypherReadOnlyProcedures {
+		if strings.HasSuffix(p, ".") && strings.HasPrefix(lower, p) || lower == p {
+			return true
+		}
+	}
+	return false
+}
+
+// cypherDialect Neo4j 等图数据库的 Cypher 查询
+type cypherDialect struct{}
+
+func (cypherDialect) Name() string { return "cypher" }
+
+func (cypherDialect) DisplayName() string { return "Neo4j Cypher" }
+
+func (cypherDialect) StatementName() string { return "Cypher 查询" }
+
+func (d cypherDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的图结构（节点标签、关系类型及属性）和自然语言问题，生成对应的只读 Cypher 查询。"
+	output := `先输出 Cypher 查询（可多行），之后以"解释："开头是简要说明（可选）`
+	if modify {
+		intro = "用户会提供现有的 Cypher 查询和新的需求，你需要在现有查询基础上进行修改。"
+		output = `先输出修改后的完整 Cypher 查询（可多行），之后以"解释："开头是简要说明（可选）`
+	}
+	prompt := fmt.Sprintf(`你是一个 Neo4j Cypher 专家%s。%s
+
+规则：
+1. 只生成单条 MATCH ... RETURN 只读查询，不要使用 CREATE、MERGE、SET、DELETE、REMOVE、FOREACH、LOAD CSV
+2. 只调用 db.labels()、db.schema.*、apoc.path.*、apoc.text.* 等只读过程与函数；不要调用 dbms.* 过程，不要使用 apoc.create.*、apoc.merge.*、apoc.refactor.*、apoc.periodic.*、apoc.cypher.* 等有副作用或执行动态 Cypher 的 APOC 过程
+3. 节点标签、关系类型和属性使用 schema 中 nodes、relationships 提供的名称，关系方向与 from → to 一致
+4. 可选匹配使用 OPTIONAL MATCH，变长路径使用 [:TYPE*1..3] 并限制最大跳数，最短路径使用 shortestPath()
+5. 聚合使用 count()、collect()、sum()，RETURN 中的非聚合表达式即分组键；可能返回大量结果时加 LIMIT
+6. 名称包含空格或特殊字符时使用反引号，如 %s；字符串使用单引号
+7. 输出格式：%s`, versionNote(database.Version), intro, d.QuoteIdentifier("Credit Card"), output)
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		prompt += "\n\n注意：目标 Neo4j 版本不支持以下特性，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (cypherDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutputCypher(content)
+}
+
+func (cypherDialect) Validate(query string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateCypher(query, database, schema)
+}
+
+func (cypherDialect) Features() []FeatureVersion {
+	return featureVersions("cypher")
+}
+
+func (cypherDialect) QuoteIdentifier(name string) string {
+	return quoteIdent(name, '`')
+}
+
+// cypherOperators 多字符运算符，按长度降序匹配
+var cypherOperators = []string{"<-", "->", "--", "=~", "<>", "<=", ">=", "+=", "!="}
+
+// tokenizeCypher Cypher 词法分析：// 与 /* */ 注释，单双引号为字符串，反引号为标识符，$name 为参数。
+// -- 在 Cypher 中是无方向关系而不是注释，因此不复用 tokenizeSQL。
+func tokenizeCypher(query string) []sqlToken {
+	var tokens []sqlToken
+	n := len(query)
+	i := 0
+	for i < n {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '/' && i+1 < n && query[i+1] == '/':
+			i = skipLineComment(query, i)
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+		case c == '\'' || c == '"':
+			end := scanQuoted(query, i, c, true)
+			tokens = append(tokens, newSQLToken(tokString, query[i:end], i))
+			i = end
+		case c == '`':
+			end := scanQuoted(query, i, c, false)
+			tokens = append(tokens, newSQLToken(tokQuotedIdent, query[i:end], i))
+			i = end
+		case c == '$' && i+1 < n && isIdentPart(query[i+1]):
+			j := i + 1
+			for j < n && isIdentPart(query[j]) {
+				j++
+			}
+			tokens = append(tokens, newSQLToken(tokParam, query[i:j], i))
+			i = j
+		case isDigit(c):
+			// 1..3 为范围，小数点后须紧跟数字
+			j := i + 1
+			for j < n && (isIdentPart(query[j]) || (query[j] == '.' && j+1 < n && isDigit(query[j+1]))) {
+				j++
+			}
+			tokens = append(tokens, newSQLToken(tokNumber, query[i:j], i))
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < n && isIdentPart(query[j]) {
+				j++
+			}
+			tokens = append(tokens, newSQLToken(tokWord, query[i:j], i))
+			i = j
+		case strings.IndexByte("()[]{},;.:|", c) >= 0:
+			tokens = append(tokens, newSQLToken(tokPunct, string(c), i))
+			i++
+		default:
+			op := string(c)
+			for _, candidate := range cypherOperators {
+				if strings.HasPrefix(query[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			tokens = append(tokens, newSQLToken(tokOperator, op, i))
+			i += len(op)
+		}
+	}
+	return tokens
+}
+
+// cypherClause 子句，OPTIONAL MATCH、DETACH DELETE、ORDER BY、LOAD CSV 合并为一个关键字
+type cypherClause struct {
+	Keyword string
+	tok     sqlToken
+	index   int // 在 tokens 中的下标
+	depth   int // 括号嵌套深度，0 为顶层
+}
+
+// parseCypherClauses 按关键字切分子句，包括 CALL { } / EXISTS { } 子查询与 FOREACH 中的子句。
+// 属性名（n.set）、标签（:Create）和 map 键（{delete: 1}）不视为子句。
+func parseCypherClauses(tokens []sqlToken) []cypherClause {
+	var clauses []cypherClause
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isPunct("(") || t.isPunct("[") || t.isPunct("{"):
+			depth++
+			continue
+		case t.isPunct(")") || t.isPunct("]") || t.isPunct("}"):
+			depth--
+			continue
+		}
+		if t.kind != tokWord || !(cypherClauseKeywords[t.upper] || cypherWriteClauses[t.upper]) {
+			continue
+		}
+		if i > 0 && (tokens[i-1].isPunct(".") || tokens[i-1].isPunct(":") || tokens[i-1].isPunct("|")) {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].isPunct(":") {
+			continue
+		}
+		next := func(keyword string) bool { return i+1 < len(tokens) && tokens[i+1].is(keyword) }
+		clause := cypherClause{Keyword: t.upper, tok: t, index: i, depth: depth}
+		switch t.upper {
+		case "WITH":
+			if i > 0 && (tokens[i-1].is("STARTS") || tokens[i-1].is("ENDS")) {
+				continue
+			}
+		case "OPTIONAL", "ORDER", "LOAD", "DETACH":
+			second := map[string]string{"OPTIONAL": "MATCH", "ORDER": "BY", "LOAD": "CSV", "DETACH": "DELETE"}[t.upper]
+			if !next(second) {
+				continue
+			}
+			clause.Keyword += " " + second
+			i++
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses
+}
+
+// validateCypher 词法级校验：起始子句 → 语句结构 → 写入子句与 LOAD CSV → 过程调用 → RETURN → 图结构 → 版本特性
+func validateCypher(query string, database Database, schema Schema) Diagnostics {
+	tokens := tokenizeCypher(query)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "Cypher 查询不能为空")}
+	}
+	clauses := parseCypherClauses(tokens)
+	// LOAD CSV 开头时交给下方的子句检查给出 FORBIDDEN_FUNCTION
+	startsWithLoad := len(clauses) > 0 && clauses[0].index == 0 && clauses[0].Keyword == "LOAD CSV"
+	if first := tokens[0]; !startsWithLoad && (len(clauses) == 0 || clauses[0].index != 0 || !cypherReadClauses[clauses[0].Keyword]) {
+		if first.kind == tokWord && cypherWriteClauses[first.upper] {
+			return Diagnostics{newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 %s 子句", first.upper).
+				atToken(query, first).withSuggestion("只生成 MATCH ... RETURN 只读查询")}
+		}
+		return Diagnostics{newDiagnostic(CodeSyntaxError, SeverityError, "Cypher 语法错误: 只支持 MATCH ... RETURN 查询").atToken(query, first)}
+	}
+	if semi, ok := findStatementSeparator(tokens); ok {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许单条 Cypher 查询").
+			atToken(query, semi).withSuggestion("删除多余的语句，只保留一条 MATCH ... RETURN 查询")}
+	}
+	if d := checkBalancedParens(query, tokens); d != nil {
+		return Diagnostics{d}
+	}
+
+	var diags Diagnostics
+	hasReturn := false
+	for _, c := range clauses {
+		switch {
+		case cypherWriteClauses[c.tok.upper]:
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 %s 子句", c.Keyword).
+				atToken(query, c.tok).withSuggestion("只生成 MATCH ... RETURN 只读查询"))
+		case c.Keyword == "LOAD CSV":
+			diags = append(diags, newDiagnostic(CodeForbiddenFunction, SeverityError, "不允许 LOAD CSV 读取外部文件").
+				atToken(query, c.tok).withSuggestion("只查询图中已有的数据"))
+		case c.Keyword == "RETURN" && c.depth == 0:
+			hasReturn = true
+		}
+	}
+	diags = append(diags, cypherProcedureErrors(query, tokens)...)
+	if diags.HasErrors() {
+		return diags
+	}
+	// 单独的 CALL 过程调用（如 CALL db.labels()）可以省略 RETURN
+	standaloneCall := clauses[0].Keyword == "CALL" && len(tokens) > 1 && !tokens[1].isPunct("{")
+	if !hasReturn && !standaloneCall {
+		return Diagnostics{newDiagnostic(CodeSyntaxError, SeverityError, "Cypher 查询缺少 RETURN 子句").
+			atToken(query, tokens[len(tokens)-1]).withSuggestion("在查询末尾用 RETURN 返回需要的节点、关系或属性")}
+	}
+
+	diags = append(diags, cypherSchemaDiagnostics(query, tokens, schema)...)
+	return append(diags, checkSQLFeatures("cypher", database.Version, query, tokens)...)
+}
+
+// cypherProcedureErrors 检查 CALL 调用的过程与带命名空间的函数（如 apoc.cypher.runFirstColumnSingle()），
+// 反引号包围的名称片段去掉引号后再匹配
+func cypherProcedureErrors(query string, tokens []sqlToken) Diagnostics {
+	var diags Diagnostics
+	for i := 0; i < len(tokens); i++ {
+		if !cypherNamePart(tokens[i]) || (i > 0 && tokens[i-1].isPunct(".")) {
+			continue
+		}
+		parts := []string{cypherIdentName(tokens[i])}
+		j := i
+		for j+2 < len(tokens) && tokens[j+1].isPunct(".") && cypherNamePart(tokens[j+2]) {
+			parts = append(parts, cypherIdentName(tokens[j+2]))
+			j += 2
+		}
+		called := (i > 0 && tokens[i-1].is("CALL")) || (j+1 < len(tokens) && tokens[j+1].isPunct("("))
+		if len(parts) > 1 && called {
+			name := strings.Join(parts, ".")
+			lower := strings.ToLower(name)
+			code, reason, denied := CodeForbiddenFunction, "只允许调用只读过程与函数", false
+			for _, rule := range cypherProcedureRules {
+				if strings.HasPrefix(lower, rule.Prefix) {
+					code, reason, denied = rule.Code, rule.Reason, true
+					break
+				}
+			}
+			if denied || !cypherReadOnlyProcedure(lower) {
+				diags = append(diags, newDiagnostic(code, SeverityError, "%s: %s", reason, name).
+					atToken(query, tokens[i]).withSuggestion("只使用 MATCH 等只读子句或 db.labels()、apoc.path.* 等只读过程"))
+			}
+		}
+		i = j
+	}
+	return diags
+}
+
+// cypherNamePart 判断 token 能否作为过程或函数名的一段
+func cypherNamePart(t sqlToken) bool {
+	return t.kind == tokWord || t.kind == tokQuotedIdent
+}
+
+// cypherIdentName 返回名称片段的原文，反引号标识符去掉引号并还原转义的反引号
+func cypherIdentName(t sqlToken) string {
+	if t.kind == tokQuotedIdent && len(t.text) >= 2 {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], "``", "`")
+	}
+	return t.text
+}
+
+// cypherFrame 括号嵌套帧
+type cypherFrame struct {
+	kind  byte   // '(' 节点模式或表达式，'[' 关系模式，'l' 列表，'{' map，'s' 子查询
+	label string // 帧内第一个标签或关系类型
+	owner *cypherFrame
+}
+
+// cypherBinding 模式中绑定的变量
+type cypherBinding struct {
+	rel  bool
+	name string // 标签或关系类型
+}
+
+// cypherGraph 图结构索引，用于检查标签、关系类型和属性
+type cypherGraph struct {
+	labels     map[string]*NodeLabel
+	relTypes   map[string]*Relationship
+	labelNames []string // 按声明顺序，用于修改建议
+	typeNames  []string
+}
+
+func newCypherGraph(schema Schema) *cypherGraph {
+	g := &cypherGraph{labels: map[string]*NodeLabel{}, relTypes: map[string]*Relationship{}}
+	for i, n := range schema.Nodes {
+		g.labels[n.Label] = &schema.Nodes[i]
+		g.labelNames = append(g.labelNames, n.Label)
+	}
+	for i, r := range schema.Relationships {
+		g.relTypes[r.Type] = &schema.Relationships[i]
+		g.typeNames = append(g.typeNames, r.Type)
+	}
+	return g
+}
+
+// properties 返回标签或关系类型声明的属性，未声明属性时返回 nil（不检查）
+func (g *cypherGraph) properties(rel bool, name string) map[string]bool {
+	var props []Column
+	if rel {
+		if r := g.relTypes[name]; r != nil {
+			props = r.Properties
+		}
+	} else if n := g.labels[name]; n != nil {
+		props = n.Properties
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	declared := make(map[string]bool, len(props))
+	for _, p := range props {
+		declared[p.Name] = true
+	}
+	return declared
+}
+
+// cypherSchemaDiagnostics 按 schema 检查模式中的节点标签、关系类型（错误）和属性（警告）
+func cypherSchemaDiagnostics(query string, tokens []sqlToken, schema Schema) Diagnostics {
+	if len(schema.Nodes) == 0 && len(schema.Relationships) == 0 {
+		return nil
+	}
+	g := newCypherGraph(schema)
+	bindings := map[string]cypherBinding{}
+	seen := map[string]bool{}
+	var diags Diagnostics
+
+	checkName := func(tok sqlToken, rel bool) {
+		name := unquoteIdent(tok.text)
+		key := fmt.Sprintf("%t:%s", rel, name)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		switch {
+		case rel && len(schema.Relationships) > 0 && g.relTypes[name] == nil:
+			diags = append(diags, newDiagnostic(CodeCypherUnknownRelType, SeverityError, "关系类型 %s 不在 schema 中", name).
+				atToken(query, tok).withSuggestion("使用 schema 中声明的关系类型："+strings.Join(g.typeNames, "、")))
+		case !rel && len(schema.Nodes) > 0 && g.labels[name] == nil:
+			diags = append(diags, newDiagnostic(CodeCypherUnknownLabel, SeverityError, "节点标签 %s 不在 schema 中", name).
+				atToken(query, tok).withSuggestion("使用 schema 中声明的标签："+strings.Join(g.labelNames, "、")))
+		}
+	}
+	checkProperty := func(tok sqlToken, rel bool, owner string) {
+		prop := unquoteIdent(tok.text)
+		key := owner + "." + prop
+		if props := g.properties(rel, owner); props == nil || props[prop] || seen[key] {
+			return
+		}
+		seen[key] = true
+		diags = append(diags, newDiagnostic(CodeCypherUnknownProperty, SeverityWarning, "属性 %s 未在 %s 中声明", prop, owner).atToken(query, tok))
+	}
+
+	var stack []*cypherFrame
+	top := func() *cypherFrame {
+		if len(stack) == 0 {
+			return &cypherFrame{kind: 's'}
+		}
+		return stack[len(stack)-1]
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		var prev sqlToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		switch {
+		case t.isPunct("("):
+			stack = append(stack, &cypherFrame{kind: '('})
+		case t.isPunct("["):
+			kind := byte('l')
+			if prev.isOp("-") || prev.isOp("<-") {
+				kind = '['
+			}
+			stack = append(stack, &cypherFrame{kind: kind})
+		case t.isPunct("{"):
+			if prev.is("CALL") || prev.is("EXISTS") || prev.is("COUNT") || prev.is("COLLECT") || prev.isPunct(")") {
+				stack = append(stack, &cypherFrame{kind: 's'})
+			} else {
+				stack = append(stack, &cypherFrame{kind: '{', owner: top()})
+			}
+		case t.isPunct(")") || t.isPunct("]") || t.isPunct("}"):
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case t.isPunct(":"):
+			f := top()
+			if f.kind == '{' {
+				// 节点或关系模式中的属性 map：{name: 'x'}
+				if o := f.owner; o != nil && (o.kind == '(' || o.kind == '[') && o.label != "" && (prev.kind == tokWord || prev.kind == tokQuotedIdent) {
+					checkProperty(prev, o.kind == '[', o.label)
+				}
+				continue
+			}
+			names, end := cypherLabelChain(tokens, i, f.kind == '(' || f.kind == '[')
+			if len(names) == 0 {
+				continue
+			}
+			i = end
+			variable := ""
+			if prev.kind == tokWord || prev.kind == tokQuotedIdent {
+				variable = unquoteIdent(prev.text)
+			}
+			rel := f.kind == '['
+			if f.kind != '[' && f.kind != '(' {
+				// WHERE n:Label 形式的谓词，按变量绑定判断是标签还是关系类型
+				rel = bindings[variable].rel
+			}
+			for _, name := range names {
+				checkName(name, rel)
+			}
+			if f.kind == '(' || f.kind == '[' {
+				if f.label == "" {
+					f.label = unquoteIdent(names[0].text)
+				}
+				if _, ok := bindings[variable]; variable != "" && !ok {
+					bindings[variable] = cypherBinding{rel: rel, name: f.label}
+				}
+			}
+		}
+	}
+
+	// 属性访问 n.prop，函数命名空间（apoc.text.join()）除外
+	for i := 0; i+2 < len(tokens); i++ {
+		t := tokens[i]
+		if (t.kind != tokWord && t.kind != tokQuotedIdent) || !tokens[i+1].isPunct(".") || (i > 0 && tokens[i-1].isPunct(".")) {
+			continue
+		}
+		b, ok := bindings[unquoteIdent(t.text)]
+		prop := tokens[i+2]
+		if !ok || (prop.kind != tokWord && prop.kind != tokQuotedIdent) || (i+3 < len(tokens) && tokens[i+3].isPunct("(")) {
+			continue
+		}
+		checkProperty(prop, b.rel, b.name)
+	}
+	return diags
+}
+
+// cypherLabelChain 解析 : 之后的标签或关系类型表达式，如 :Person:Customer、:KNOWS|LIKES、:!Deleted。
+// pattern 为 true 时才把 | 视为标签分隔符（列表推导式 [x IN l WHERE x:A | x.name] 中 | 是投影）。
+// 返回名称 token 与最后消费的下标。
+func cypherLabelChain(tokens []sqlToken, i int, pattern bool) ([]sqlToken, int) {
+	var names []sqlToken
+	for {
+		j := i + 1
+		for j < len(tokens) && (tokens[j].isOp("!") || tokens[j].isPunct(":")) {
+			j++
+		}
+		if j >= len(tokens) || (tokens[j].kind != tokWord && tokens[j].kind != tokQuotedIdent) {
+			return names, i
+		}
+		names = append(names, tokens[j])
+		i = j
+		if i+1 < len(tokens) && (tokens[i+1].isPunct(":") || tokens[i+1].isOp("&") || (pattern && tokens[i+1].isPunct("|"))) {
+			i++
+			continue
+		}
+		return names, i
+	}
+}
+
+// parseLLMOutputCypher 解析 LLM 输出，提取多行 Cypher 查询和解释
+func parseLLMOutputCypher(content string) (query, explanation string) {
+	var lines []string
+	for _, line := range splitLines(content) {
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, line)
+		}
+	}
+	for i, line := range lines {
+		if !isCypherStartLine(strings.TrimSpace(line)) {
+			continue
+		}
+		var stmt []string
+		for _, l := range lines[i:] {
+			t := strings.TrimSpace(l)
+			if t == "" || isExplanationLine(t) {
+				break
+			}
+			stmt = append(stmt, t)
+		}
+		query = strings.TrimSpace(strings.TrimSuffix(strings.Join(stmt, "\n"), ";"))
+		return query, explanationAfter(strings.Join(lines[i+len(stmt):], "\n"))
+	}
+	return parseLLMOutput(content)
+}
+
+// isCypherStartLine 判断一行是否以查询的起始子句开头
+func isCypherStartLine(line string) bool {
+	end := strings.IndexFunc(line, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(line)
+	}
+	word := strings.ToUpper(line[:end])
+	return cypherReadClauses[word] || word == "OPTIONAL"
+}
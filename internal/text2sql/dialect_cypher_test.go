@@ -0,0 +1,147 @@
+package text2sql
+
+import (
+	"strings"
+	"testing"
+)
+
+var cypherTestSchema = Schema{
+	Nodes: []NodeLabel{
+		{Label: "Person", Properties: []Column{{Name: "name"}, {Name: "risk_score"}}},
+		{Label: "Account", Properties: []Column{{Name: "iban"}, {Name: "opened_at"}}},
+		{Label: "Device"},
+	},
+	Relationships: []Relationship{
+		{Type: "OWNS", From: "Person", To: "Account"},
+		{Type: "TRANSFER", From: "Account", To: "Account", Properties: []Column{{Name: "amount"}, {Name: "at"}}},
+		{Type: "USES", From: "Person", To: "Device"},
+	},
+}
+
+func TestValidateCypher(t *testing.T) {
+	v := NewSQLValidator()
+	database := Database{Type: "cypher", Version: "5.15"}
+	tests := []struct {
+		name     string
+		query    string
+		database Database
+		wantCode string
+	}{
+		{"match return", "MATCH (p:Person)-[:OWNS]->(a:Account) WHERE p.risk_score > 0.8 RETURN p.name, count(a) AS accounts ORDER BY accounts DESC LIMIT 10", database, ""},
+		{"variable length", "MATCH path = (a:Account {iban: $iban})-[:TRANSFER*1..3]->(b:Account) RETURN b.iban, length(path)", database, ""},
+		{"undirected and optional", "MATCH (p:Person)--(d:Device)\nOPTIONAL MATCH (p)-[o:OWNS]->(a) RETURN p, d, collect(a) AS accounts", database, ""},
+		{"relationship properties", "MATCH (:Account)-[t:TRANSFER]->(:Account) WHERE t.amount > 10000 AND t.at >= datetime('2024-01-01') RETURN sum(t.amount)", database, ""},
+		{"with and unwind", "MATCH (d:Device)<-[:USES]-(p:Person) WITH d, collect(p) AS people WHERE size(people) > 3 UNWIND people AS person RETURN d, person.name", database, ""},
+		{"starts with", "MATCH (p:Person) WHERE p.name STARTS WITH 'A' RETURN p.name", database, ""},
+		{"keyword as map key and property", "MATCH (p:Person) RETURN p {.name, set: 1}", database, ""},
+		{"comment", "// 高风险用户\nMATCH (p:Person) RETURN p.name // 名称", database, ""},
+		{"exists subquery", "MATCH (p:Person) WHERE EXISTS { MATCH (p)-[:USES]->(:Device) } RETURN p.name", database, ""},
+		{"read-only procedure", "CALL db.labels() YIELD label RETURN label", database, ""},
+		{"standalone call", "CALL db.schema.visualization()", database, ""},
+		{"apoc path", "MATCH (p:Person {name: 'x'}) CALL apoc.path.subgraphNodes(p, {maxLevel: 2}) YIELD node RETURN node", database, ""},
+		{"create", "CREATE (p:Person {name: 'x'}) RETURN p", database, CodeNotReadOnly},
+		{"merge", "MERGE (p:Person {name: 'x'}) RETURN p", database, CodeNotReadOnly},
+		{"set after match", "MATCH (p:Person) SET p.risk_score = 0 RETURN p", database, CodeNotReadOnly},
+		{"detach delete", "MATCH (p:Person) DETACH DELETE p", database, CodeNotReadOnly},
+		{"write in subquery", "MATCH (p:Person) CALL { WITH p DELETE p } RETURN count(*)", database, CodeNotReadOnly},
+		{"foreach", "MATCH p = (:Person)-[:OWNS]->(:Account) FOREACH (n IN nodes(p) | REMOVE n.flag) RETURN p", database, CodeNotReadOnly},
+		{"load csv", "LOAD CSV FROM 'file:///x.csv' AS row RETURN row", database, CodeForbiddenFunction},
+		{"load csv after match", "MATCH (p:Person) LOAD CSV FROM 'https://example.com/x.csv' AS row RETURN row", database, CodeForbiddenFunction},
+		{"dbms procedure", "CALL dbms.killQuery('query-1')", database, CodeForbiddenFunction},
+		{"apoc create", "MATCH (p:Person) CALL apoc.create.setProperty(p, 'flag', true) YIELD node RETURN node", database, CodeNotReadOnly},
+		{"apoc periodic", "CALL apoc.periodic.iterate('MATCH (n) RETURN n', 'DETACH DELETE n', {})", database, CodeForbiddenFunction},
+		{"apoc cypher function", "RETURN apoc.cypher.runFirstColumnSingle('MATCH (n) RETURN count(n)', {})", database, CodeForbiddenFunction},
+		{"quoted procedure name", "MATCH (n) CALL `apoc`.`cypher`.`doIt`('MATCH (m) DETACH DELETE m', {}) YIELD value RETURN n", database, CodeForbiddenFunction},
+		{"partly quoted function name", "RETURN apoc.`cypher`.doIt('MATCH (m) DETACH DELETE m', {})", database, CodeForbiddenFunction},
+		{"unlisted procedure", "CALL gds.graph.drop('g')", database, CodeForbiddenFunction},
+		{"namespaced temporal function", "MATCH (p:Person) RETURN duration.between(p.created_at, datetime.realtime())", database, ""},
+		{"show", "SHOW DATABASES", database, CodeSyntaxError},
+		{"multiple statements", "MATCH (p:Person) RETURN p; MATCH (a:Account) RETURN a", database, CodeMultipleStatements},
+		{"unbalanced", "MATCH (p:Person RETURN p", database, CodeSyntaxError},
+		{"missing return", "MATCH (p:Person) WHERE p.risk_score > 0.5", database, CodeSyntaxError},
+		{"unknown label", "MATCH (c:Customer) RETURN c", database, CodeCypherUnknownLabel},
+		{"unknown label predicate", "MATCH (n) WHERE n:Merchant RETURN n", database, CodeCypherUnknownLabel},
+		{"unknown relationship", "MATCH (p:Person)-[:KNOWS]->(q:Person) RETURN q", database, CodeCypherUnknownRelType},
+		{"unknown relationship in union", "MATCH (a:Account)-[:TRANSFER|PAYS]->(b) RETURN b", database, CodeCypherUnknownRelType},
+		{"count subquery too old", "MATCH (p:Person) RETURN p.name, COUNT { (p)-[:OWNS]->() } AS n", Database{Type: "cypher", Version: "5.2"}, CodeUnsupportedFeature},
+		{"quantified path too old", "MATCH (a:Account) ((x)-[:TRANSFER]->(y)){1,3} (b:Account) RETURN b", Database{Type: "neo4j", Version: "5.8"}, CodeUnsupportedFeature},
+		{"call subquery on 3.5", "MATCH (p:Person) CALL { MATCH (a:Account) RETURN a } RETURN p, a", Database{Type: "cypher", Version: "3.5"}, CodeUnsupportedFeature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.DiagnoseWithSchema(tt.query, tt.database, cypherTestSchema).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateCypher_PropertyWarnings(t *testing.T) {
+	v := NewSQLValidator()
+	database := Database{Type: "cypher"}
+	query := "MATCH (p:Person {nickname: 'x'})-[:OWNS]->(a:Account)-[t:TRANSFER]->(:Device) WHERE a.balance > 0 AND t.amount > 0 RETURN p.name, apoc.text.join([a.iban], ',')"
+	diags := v.DiagnoseWithSchema(query, database, cypherTestSchema)
+	if diags.HasErrors() {
+		t.Fatalf("unknown properties should only warn, got %v", diags.Errors())
+	}
+	var got []string
+	for _, w := range diags.Warnings() {
+		if w.Code != CodeCypherUnknownProperty {
+			t.Fatalf("unexpected warning %v", w)
+		}
+		got = append(got, w.Token)
+	}
+	if strings.Join(got, ",") != "nickname,balance" {
+		t.Fatalf("expected warnings for nickname and balance, got %v", got)
+	}
+}
+
+func TestCypherSystemPrompt(t *testing.T) {
+	d, err := GetDialect("neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := d.SystemPrompt(Database{Type: "cypher", Version: "4.4"}, cypherTestSchema, false)
+	for _, want := range []string{"MATCH ... RETURN", "dbms.*", "apoc.periodic.*", "COUNT { } 子查询", "`Credit Card`"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+}
+
+func TestParseLLMOutputCypher(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		wantQuery       string
+		wantExplanation string
+	}{
+		{
+			"code block",
+			"```cypher\nMATCH (p:Person)\nRETURN p.name\nLIMIT 10;\n```\n解释：列出人员",
+			"MATCH (p:Person)\nRETURN p.name\nLIMIT 10",
+			"列出人员",
+		},
+		{
+			"plain with preface",
+			"查询如下：\nOPTIONAL MATCH (a:Account) RETURN count(a)\n解释：统计账户",
+			"OPTIONAL MATCH (a:Account) RETURN count(a)",
+			"统计账户",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, explanation := parseLLMOutputCypher(tt.content)
+			if query != tt.wantQuery || explanation != tt.wantExplanation {
+				t.Errorf("parseLLMOutputCypher() = %q, %q; want %q, %q", query, explanation, tt.wantQuery, tt.wantExplanation)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// duckdbWriteKeywords 写操作、文件导出、挂载数据库、扩展与会话设置关键字
+var duckdbWriteKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "CREATE": true, "DROP": true, "ALTER": true,
+	"TRUNCATE": true, "COPY": true, "EXPORT": true, "IMPORT": true, "ATTACH": true, "DETACH": true,
+	"INSTALL": true, "LOAD": true, "PRAGMA": true, "SET": true, "RESET": true, "CALL": true,
+	"CHECKPOINT": true, "VACUUM": true, "USE": true, "BEGIN": true, "COMMIT": true, "ROLLBACK": true,
+}
+
+// duckdbFileStatements 读写文件或挂载外部数据库的语句，给出更明确的拒绝原因
+var duckdbFileStatements = map[string]string{
+	"COPY":   "不允许 COPY 导入导出文件",
+	"EXPORT": "不允许 EXPORT DATABASE 写出文件",
+	"IMPORT": "不允许 IMPORT DATABASE 导入文件",
+	"ATTACH": "不允许 ATTACH 挂载其他数据库文件",
+}
+
+// duckdbNestedWriteKeywords 语句中间（CTE、子查询）检查的写操作：通用写操作与文件语句
+var duckdbNestedWriteKeywords = func() map[string]bool {
+	keywords := make(map[string]bool, len(sqlWriteKeywords)+len(duckdbFileStatements))
+	for k := range sqlWriteKeywords {
+		keywords[k] = true
+	}
+	for k := range duckdbFileStatements {
+		keywords[k] = true
+	}
+	return keywords
+}()
+
+// duckdbDialect DuckDB 分析查询
+type duckdbDialect struct{}
+
+func (duckdbDialect) Name() string { return "duckdb" }
+
+func (duckdbDialect) DisplayName() string { return "DuckDB" }
+
+func (duckdbDialect) StatementName() string { return "SQL" }
+
+func (d duckdbDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的数据库表结构和自然语言问题，生成对应的 DuckDB SELECT 查询。"
+	output := `第一行是 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	if modify {
+		intro = "用户会提供现有的 SQL 语句和新的需求，你需要在现有 SQL 基础上进行修改。"
+		output = `第一行是修改后的完整 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	}
+	prompt := fmt.Sprintf(`你是一个 DuckDB 专家%s。%s
+
+规则：
+1. 只生成单条 SELECT 查询，不要使用 COPY、EXPORT、ATTACH、INSTALL、LOAD、PRAGMA、SET 等语句
+2. 查询文件时使用 read_parquet('path/*.parquet')、read_csv('file.csv') 等表函数，路径使用 schema 中提供的名称
+3. 过滤窗口函数结果使用 QUALIFY，如 QUALIFY row_number() OVER (PARTITION BY user_id ORDER BY ts DESC) = 1
+4. 列表使用 [1, 2, 3]、list_contains()、unnest()，结构体使用 {'k': v} 与 s.field 访问字段
+5. 日期使用 date_trunc('month', ts)、strftime()、INTERVAL 1 DAY，字符串匹配可用 ILIKE 和 regexp_matches()
+6. 表名和列名使用 schema 中提供的名称，标识符需要引用时使用双引号，如 %s
+7. 输出格式：%s`, versionNote(database.Version), intro, d.QuoteIdentifier("order"), output)
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		prompt += "\n\n注意：目标 DuckDB 版本不支持以下特性，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (duckdbDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutput(content)
+}
+
+func (duckdbDialect) Validate(sql string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateDuckDB(sql, database)
+}
+
+func (duckdbDialect) Features() []FeatureVersion {
+	return featureVersions("duckdb")
+}
+
+func (duckdbDialect) QuoteIdentifier(name string) string {
+	return quoteIdent(name, '"')
+}
+
+// validateDuckDB 词法级校验：文件与挂载语句 → 语句结构（允许 FROM 开头）→ 只读 → 版本特性
+func validateDuckDB(sql string, database Database) Diagnostics {
+	tokens := tokenizeSQL(sql, sqlStringsPostgres)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "SQL 不能为空")}
+	}
+	if msg, ok := duckdbFileStatements[tokens[0].upper]; ok && tokens[0].kind == tokWord {
+		return Diagnostics{newDiagnostic(CodeNotReadOnly, SeverityError, "%s", msg).
+			atToken(sql, tokens[0]).withSuggestion("只生成 SELECT 查询，读取文件使用 read_parquet()、read_csv() 等表函数")}
+	}
+	if d := checkSelectStructure(sql, tokens, "DuckDB", duckdbWriteKeywords, "FROM", "PIVOT", "UNPIVOT"); d != nil {
+		return Diagnostics{d}
+	}
+
+	// 语句中间只检查语句位置上的 DML/DDL 与文件语句，LOAD、SET、copy 等作为列名时不误报
+	var diags Diagnostics
+	for _, t := range findWriteKeywords(tokens, duckdbNestedWriteKeywords) {
+		diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+			atToken(sql, t).withSuggestion("只生成 SELECT 查询，不要包含写操作"))
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, checkSQLFeatures("duckdb", database.Version, sql, tokens)...)
+	return append(diags, selectStarWarnings(sql, tokens)...)
+}
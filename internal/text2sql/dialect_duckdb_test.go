@@ -0,0 +1,49 @@
+package text2sql
+
+import "testing"
+
+func TestValidateDuckDB(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name     string
+		sql      string
+		version  string
+		wantCode string
+	}{
+		{"read_parquet", "SELECT user_id, count(*) FROM read_parquet('events/*.parquet') GROUP BY user_id", "1.1", ""},
+		{"read_csv", "SELECT * FROM read_csv('orders.csv', header = true) WHERE amount > 100", "", ""},
+		{"qualify", "SELECT user_id, ts FROM events QUALIFY row_number() OVER (PARTITION BY user_id ORDER BY ts DESC) = 1", "", ""},
+		{"list and struct", "SELECT tags[1], list_contains(tags, 'vip'), info.city, {'a': 1} AS s FROM users", "", ""},
+		{"lambda", "SELECT list_transform(tags, x -> upper(x)) FROM users", "", ""},
+		{"load column", "SELECT host, load FROM metrics", "", ""},
+		{"group by all", "SELECT city, count(*) FROM users GROUP BY ALL", "0.9.2", ""},
+		{"from first", "FROM users SELECT name", "1.0", ""},
+		{"copy to", "COPY (SELECT * FROM users) TO 'out.parquet' (FORMAT PARQUET)", "", CodeNotReadOnly},
+		{"export database", "EXPORT DATABASE 'backup'", "", CodeNotReadOnly},
+		{"attach", "ATTACH 'other.duckdb' AS other", "", CodeNotReadOnly},
+		{"install", "INSTALL httpfs", "", CodeNotReadOnly},
+		{"pragma", "PRAGMA enable_profiling", "", CodeNotReadOnly},
+		{"copy after select", "SELECT 1; COPY users TO 'u.csv'", "", CodeMultipleStatements},
+		{"backslash ends string", `SELECT a FROM t WHERE b = '\' ; COPY t TO 'out.csv' --'`, "", CodeMultipleStatements},
+		{"escape string", `SELECT a FROM t WHERE b = E'it\'s; COPY t TO out.csv'`, "", ""},
+		{"columns named like statements", "WITH j AS (SELECT copy, attach, load FROM jobs) SELECT * FROM j", "", ""},
+		{"insert in cte", "WITH x AS (INSERT INTO users VALUES (1) RETURNING *) SELECT * FROM x", "", CodeNotReadOnly},
+		{"group by all too old", "SELECT city, count(*) FROM users GROUP BY ALL", "0.5.1", CodeUnsupportedFeature},
+		{"from first too old", "FROM users", "0.6.1", CodeUnsupportedFeature},
+		{"pivot too old", "PIVOT sales ON year USING sum(amount)", "0.7.1", CodeUnsupportedFeature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.sql, Database{Type: "duckdb", Version: tt.version}).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,715 @@
+package text2sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// esqlSince ES|QL 的引入版本
+const esqlSince = "8.11"
+
+// esSearchBodyKeys _search 请求体允许的顶层字段
+var esSearchBodyKeys = map[string]bool{
+	"query": true, "aggs": true, "aggregations": true, "size": true, "from": true, "sort": true,
+	"_source": true, "track_total_hits": true, "collapse": true, "highlight": true, "search_after": true,
+	"post_filter": true, "fields": true, "docvalue_fields": true, "timeout": true, "terminate_after": true,
+	"min_score": true, "track_scores": true,
+}
+
+// esScriptKeys 执行 Painless 等脚本的查询、聚合与字段
+var esScriptKeys = []string{
+	"script", "script_score", "script_fields", "scripted_metric", "bucket_script", "bucket_selector", "runtime_mappings",
+}
+
+// esWriteEndpoints 写入与管理类 API
+var esWriteEndpoints = map[string]bool{
+	"_doc": true, "_create": true, "_update": true, "_bulk": true, "_delete_by_query": true,
+	"_update_by_query": true, "_reindex": true, "_close": true, "_open": true, "_forcemerge": true,
+	"_refresh": true, "_flush": true, "_rollover": true, "_shrink": true, "_split": true, "_clone": true,
+	"_settings": true, "_mapping": true, "_alias": true, "_aliases": true,
+}
+
+// esqlCommands ES|QL 处理命令及其引入版本
+var esqlCommands = map[string]string{
+	"WHERE": esqlSince, "EVAL": esqlSince, "STATS": esqlSince, "KEEP": esqlSince, "DROP": esqlSince,
+	"RENAME": esqlSince, "SORT": esqlSince, "LIMIT": esqlSince, "DISSECT": esqlSince, "GROK": esqlSince,
+	"ENRICH": esqlSince, "MV_EXPAND": esqlSince, "LOOKUP": "8.18",
+}
+
+// esqlKeywords ES|QL 表达式中的关键字，不视为字段引用
+var esqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "LIKE": true, "RLIKE": true, "IS": true, "NULL": true,
+	"ASC": true, "DESC": true, "NULLS": true, "FIRST": true, "LAST": true, "TRUE": true, "FALSE": true,
+	"BY": true, "AS": true, "ON": true, "WITH": true, "JOIN": true, "METADATA": true,
+}
+
+var (
+	esNumericTypes = []string{"long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float", "unsigned_long"}
+	esDateTypes    = []string{"date", "date_nanos"}
+	esTextTypes    = []string{"text", "match_only_text"}
+)
+
+// esRequestLine Kibana Dev Tools 风格的请求行，如 GET /logs-*/_search。方法与路径必须在同一行
+var esRequestLine = regexp.MustCompile(`(?i)^(GET|POST|PUT|DELETE|PATCH|HEAD)[ \t]+(\S+)`)
+
+// esRequestMethod 以 HTTP 方法开头的第一行，按 Query DSL 请求校验
+var esRequestMethod = regexp.MustCompile(`(?i)^(GET|POST|PUT|DELETE|PATCH|HEAD)\b`)
+
+// elasticsearchDialect Elasticsearch：_search 请求（Query DSL）或 ES|QL
+type elasticsearchDialect struct{}
+
+func (elasticsearchDialect) Name() string { return "elasticsearch" }
+
+func (elasticsearchDialect) DisplayName() string { return "Elasticsearch" }
+
+func (elasticsearchDialect) StatementName() string { return "Elasticsearch 查询" }
+
+func (d elasticsearchDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的索引映射（mapping）和自然语言问题，生成对应的只读 Elasticsearch 查询。"
+	if modify {
+		intro = "用户会提供现有的 Elasticsearch 查询和新的需求，你需要在现有查询基础上进行修改，输出修改后的完整查询。"
+	}
+	prompt := fmt.Sprintf(`你是一个 Elasticsearch 专家%s。%s
+
+输出格式：第一行是请求行 GET /索引名/_search，之后是 JSON 请求体，最后以"解释："开头是简要说明（可选）。例如：
+GET /logs-*/_search
+{"size": 0, "query": {"bool": {"filter": [{"term": {"level": "error"}}, {"range": {"@timestamp": {"gte": "now-1d/d"}}}]}}, "aggs": {"per_hour": {"date_histogram": {"field": "@timestamp", "calendar_interval": "hour"}}}}
+
+规则：
+1. 只使用 _search 或 _count，不要调用写入、删除、更新或管理 API
+2. 精确匹配、过滤使用 bool.filter 中的 term / terms / range，全文检索使用 match / multi_match
+3. text 字段不能用于 term 精确匹配、terms 聚合和排序，应使用其 keyword 子字段（如 message.keyword）
+4. 时间范围使用 range 与 now-7d/d 等日期数学表达式，按时间分桶使用 date_histogram
+5. 只统计聚合结果时设置 "size": 0
+6. 禁止 script、script_score、scripted_metric、bucket_script、runtime_mappings 等脚本
+7. 索引名和字段名使用 mapping 中提供的名称，嵌套字段使用点号路径`, versionNote(database.Version), intro)
+	if versionSupports(database.Version, esqlSince) {
+		prompt += "\n\n如果用户明确要求使用 ES|QL，直接输出 ES|QL 查询（如 FROM logs-* | WHERE level == \"error\" | STATS count = COUNT(*) BY host.name | LIMIT 10），不要输出请求行和 JSON。"
+	}
+	return prompt
+}
+
+func (elasticsearchDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutputES(content)
+}
+
+func (elasticsearchDialect) Validate(query string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateElasticsearch(query, database, schema.Indices)
+}
+
+func (elasticsearchDialect) Features() []FeatureVersion {
+	return []FeatureVersion{{Feature: "ES|QL", Since: esqlSince}, {Feature: "ES|QL LOOKUP JOIN", Since: esqlCommands["LOOKUP"]}}
+}
+
+// QuoteIdentifier 字段名在 JSON 中以字符串表示
+func (elasticsearchDialect) QuoteIdentifier(name string) string {
+	b, _ := json.Marshal(name)
+	return string(b)
+}
+
+// esIndex 已解析映射的索引
+type esIndex struct {
+	name   string
+	fields map[string]string // 字段路径 → 类型，含 multi-field 子字段（如 message.keyword）
+}
+
+// parseESMapping 将映射展开为 字段路径 → 类型，兼容 {"properties": ...} 与 {"mappings": {"properties": ...}}
+func parseESMapping(raw json.RawMessage) (map[string]string, error) {
+	var m struct {
+		Mappings   *json.RawMessage           `json:"mappings"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	if m.Mappings != nil {
+		return parseESMapping(*m.Mappings)
+	}
+	fields := make(map[string]string)
+	if err := collectESFields(fields, "", m.Properties); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func collectESFields(fields map[string]string, prefix string, properties map[string]json.RawMessage) error {
+	for name, raw := range properties {
+		var def struct {
+			Type       string                     `json:"type"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			Fields     map[string]json.RawMessage `json:"fields"`
+		}
+		if err := json.Unmarshal(raw, &def); err != nil {
+			return fmt.Errorf("字段 %s%s: %w", prefix, name, err)
+		}
+		field := prefix + name
+		if def.Type == "" {
+			def.Type = "object"
+		}
+		fields[field] = def.Type
+		if err := collectESFields(fields, field+".", def.Properties); err != nil {
+			return err
+		}
+		if err := collectESFields(fields, field+".", def.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newESIndices 解析 schema 中的索引映射，映射无法解析的索引只参与索引名校验
+func newESIndices(indices []Index) []esIndex {
+	result := make([]esIndex, 0, len(indices))
+	for _, idx := range indices {
+		fields, _ := parseESMapping(idx.Mappings)
+		result = append(result, esIndex{name: idx.Name, fields: fields})
+	}
+	return result
+}
+
+// matchESIndices 按逗号分隔的索引表达式（可含通配符）匹配 schema 中的索引，返回未匹配的表达式
+func matchESIndices(indices []esIndex, target string) (matched []esIndex, unknown []string) {
+	for _, expr := range strings.Split(target, ",") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		found := false
+		for _, idx := range indices {
+			if globMatch(expr, idx.name) || globMatch(idx.name, expr) {
+				matched = append(matched, idx)
+				found = true
+			}
+		}
+		if !found {
+			unknown = append(unknown, expr)
+		}
+	}
+	return matched, unknown
+}
+
+func globMatch(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// esFieldType 在匹配的索引中查找字段类型，未声明时返回 false（通配符和元数据字段视为已声明）
+func esFieldType(indices []esIndex, field string) (string, bool) {
+	if strings.ContainsAny(field, "*?") || strings.HasPrefix(field, "_") {
+		return "", true
+	}
+	for _, idx := range indices {
+		if idx.fields == nil {
+			return "", true
+		}
+		if t, ok := idx.fields[field]; ok {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// keywordSubfield text 字段的 keyword 子字段，用于修改建议
+func keywordSubfield(indices []esIndex, field string) string {
+	for _, idx := range indices {
+		for name, t := range idx.fields {
+			if t == "keyword" && strings.HasPrefix(name, field+".") {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// esFieldRef 查询中引用的字段及用法（查询类型、聚合类型或 sort）
+type esFieldRef struct {
+	field string
+	usage string
+}
+
+// validateElasticsearch 按输出形式分派：请求行 + JSON 为 Query DSL，否则按 ES|QL 校验
+func validateElasticsearch(query string, database Database, indices []Index) Diagnostics {
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, "{") {
+		return Diagnostics{newDiagnostic(CodeESInvalidQuery, SeverityError, "缺少请求行").
+			withSuggestion("第一行输出请求行，如 GET /索引名/_search，之后是 JSON 请求体")}
+	}
+	if line, _, _ := strings.Cut(query, "\n"); esRequestMethod.MatchString(line) {
+		return validateESSearch(query, indices)
+	}
+	return validateESQL(query, database, indices)
+}
+
+// validateESSearch 校验 _search / _count 请求：请求行（只读 API）→ 索引 → 请求体结构 → 脚本 → 字段与类型
+func validateESSearch(query string, indices []Index) Diagnostics {
+	line, body, _ := strings.Cut(query, "\n")
+	bodyStart := len(line) + 1
+	m := esRequestLine.FindStringSubmatch(line)
+	if m == nil {
+		return Diagnostics{newDiagnostic(CodeESInvalidQuery, SeverityError, "请求行缺少路径: %s", line).
+			at(query, 0, line).withSuggestion("在同一行写出方法和路径，如 GET /索引名/_search")}
+	}
+	method, target := strings.ToUpper(m[1]), m[2]
+	target, _, _ = strings.Cut(strings.TrimPrefix(target, "/"), "?")
+	segments := strings.Split(target, "/")
+	index, endpoint := "", segments[0]
+	if len(segments) > 1 {
+		index, endpoint = segments[0], segments[1]
+	}
+	lineDiag := func(code, format string, args ...any) *ValidationError {
+		return newDiagnostic(code, SeverityError, format, args...).at(query, 0, line)
+	}
+
+	switch {
+	case esWriteEndpoints[endpoint] || method == "PUT" || method == "DELETE" || method == "PATCH":
+		return Diagnostics{lineDiag(CodeNotReadOnly, "不允许调用写入或管理 API: %s", line).
+			withSuggestion("只使用 GET /索引名/_search 查询")}
+	case method == "HEAD" || (endpoint != "_search" && endpoint != "_count"):
+		return Diagnostics{lineDiag(CodeESInvalidQuery, "只支持 _search 和 _count 请求: %s", line).
+			withSuggestion("使用 GET /索引名/_search")}
+	}
+
+	known := newESIndices(indices)
+	matched := known
+	if len(known) > 0 {
+		if index == "" {
+			return Diagnostics{lineDiag(CodeESUnknownIndex, "请求未指定索引").
+				withSuggestion("在请求行中指定 schema 中的索引：" + esIndexNames(indices))}
+		}
+		var unknown []string
+		matched, unknown = matchESIndices(known, index)
+		if len(unknown) > 0 {
+			return Diagnostics{lineDiag(CodeESUnknownIndex, "索引 %s 不在 schema 中", strings.Join(unknown, ", ")).
+				withSuggestion("使用 schema 中声明的索引：" + esIndexNames(indices))}
+		}
+	}
+
+	if strings.TrimSpace(body) == "" {
+		return nil
+	}
+	bodyStart += len(body) - len(strings.TrimLeft(body, " \t\r\n"))
+	dec := json.NewDecoder(strings.NewReader(strings.TrimSpace(body)))
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return Diagnostics{jsonErrorDiagnostic(query, bodyStart, err, CodeESInvalidQuery)}
+	}
+	if dec.More() {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许一个请求体 JSON 对象").
+			at(query, bodyStart+int(dec.InputOffset()), "")}
+	}
+
+	var diags Diagnostics
+	for _, key := range esScriptKeys {
+		if containsJSONKey(doc, key) {
+			diags = append(diags, jsonKeyDiagnostic(query, key, CodeESScript, "不允许使用脚本: %s", key).
+				withSuggestion("改用 range、terms 等查询和 date_histogram、terms 等聚合实现"))
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	for _, key := range sortedKeys(doc) {
+		if !esSearchBodyKeys[key] || (endpoint == "_count" && key != "query") {
+			diags = append(diags, jsonKeyDiagnostic(query, key, CodeESInvalidQuery, "%s 请求体不支持字段 %s", endpoint, key))
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var refs []esFieldRef
+	esQueryFields(doc["query"], &refs)
+	esQueryFields(doc["post_filter"], &refs)
+	esAggFields(doc["aggs"], &refs)
+	esAggFields(doc["aggregations"], &refs)
+	esSortFields(doc["sort"], &refs)
+	for _, f := range esSourceFields(doc["_source"]) {
+		refs = append(refs, esFieldRef{field: f, usage: "_source"})
+	}
+	if len(known) == 0 {
+		return diags
+	}
+	return append(diags, checkESFields(query, matched, refs)...)
+}
+
+// checkESFields 字段必须在映射中声明，且类型适用于对应的查询、聚合或排序
+func checkESFields(src string, indices []esIndex, refs []esFieldRef) Diagnostics {
+	var diags Diagnostics
+	seen := make(map[esFieldRef]bool)
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		typ, ok := esFieldType(indices, ref.field)
+		if !ok {
+			diags = append(diags, jsonKeyDiagnostic(src, ref.field, CodeESUnknownField, "字段 %s 不在索引映射中", ref.field).
+				withSuggestion("使用 mapping 中声明的字段"))
+			continue
+		}
+		if typ == "" {
+			continue
+		}
+		if reason := esTypeMismatch(ref.usage, typ); reason != "" {
+			d := jsonKeyDiagnostic(src, ref.field, CodeESFieldType, "字段 %s 类型为 %s，%s", ref.field, typ, reason)
+			if kw := keywordSubfield(indices, ref.field); kw != "" && slices.Contains(esTextTypes, typ) {
+				d.withSuggestion("改用 keyword 子字段 " + kw)
+			}
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// esTypeMismatch 返回字段类型不适用于该用法的原因，适用时返回空串
+func esTypeMismatch(usage, typ string) string {
+	numeric := slices.Contains(esNumericTypes, typ)
+	date := slices.Contains(esDateTypes, typ)
+	switch usage {
+	case "term", "terms":
+		if slices.Contains(esTextTypes, typ) {
+			return "text 字段经过分词，不能用 " + usage + " 精确匹配"
+		}
+	case "agg:terms", "agg:cardinality", "agg:rare_terms", "agg:significant_terms", "sort":
+		if slices.Contains(esTextTypes, typ) {
+			return "text 字段不能用于聚合或排序"
+		}
+	case "agg:avg", "agg:sum", "agg:stats", "agg:extended_stats", "agg:percentiles", "agg:histogram", "agg:median_absolute_deviation":
+		if !numeric {
+			return "不能用于数值聚合 " + strings.TrimPrefix(usage, "agg:")
+		}
+	case "agg:min", "agg:max":
+		if !numeric && !date {
+			return "不能用于 " + strings.TrimPrefix(usage, "agg:") + " 聚合"
+		}
+	case "agg:date_histogram", "agg:date_range", "agg:auto_date_histogram":
+		if !date {
+			return "不能用于日期聚合 " + strings.TrimPrefix(usage, "agg:")
+		}
+	}
+	return ""
+}
+
+// esLeafQueries 以字段名为键的叶子查询
+var esLeafQueries = map[string]bool{
+	"term": true, "terms": true, "match": true, "match_phrase": true, "match_phrase_prefix": true,
+	"match_bool_prefix": true, "prefix": true, "wildcard": true, "regexp": true, "fuzzy": true,
+	"range": true, "term_set": true, "geo_bounding_box": true, "geo_distance": true, "geo_shape": true,
+}
+
+// esQueryParams 叶子查询中与字段并列的参数名
+var esQueryParams = map[string]bool{
+	"boost": true, "_name": true, "distance": true, "distance_type": true, "validation_method": true,
+}
+
+// esQueryFields 收集 Query DSL 中引用的字段
+func esQueryFields(q any, refs *[]esFieldRef) {
+	switch x := q.(type) {
+	case []any:
+		for _, item := range x {
+			esQueryFields(item, refs)
+		}
+	case map[string]any:
+		for typ, body := range x {
+			m, _ := body.(map[string]any)
+			switch {
+			case esLeafQueries[typ]:
+				for field := range m {
+					if !esQueryParams[field] {
+						*refs = append(*refs, esFieldRef{field: field, usage: typ})
+					}
+				}
+			case typ == "exists":
+				if f, ok := m["field"].(string); ok {
+					*refs = append(*refs, esFieldRef{field: f, usage: typ})
+				}
+			case typ == "multi_match" || typ == "query_string" || typ == "simple_query_string":
+				fields, _ := m["fields"].([]any)
+				for _, f := range fields {
+					if s, ok := f.(string); ok {
+						name, _, _ := strings.Cut(s, "^")
+						*refs = append(*refs, esFieldRef{field: name, usage: typ})
+					}
+				}
+			case typ == "bool":
+				for _, clause := range []string{"must", "should", "filter", "must_not"} {
+					esQueryFields(m[clause], refs)
+				}
+			case typ == "nested":
+				if p, ok := m["path"].(string); ok {
+					*refs = append(*refs, esFieldRef{field: p, usage: typ})
+				}
+				esQueryFields(m["query"], refs)
+			case typ == "constant_score":
+				esQueryFields(m["filter"], refs)
+			case typ == "dis_max":
+				esQueryFields(m["queries"], refs)
+			case typ == "boosting":
+				esQueryFields(m["positive"], refs)
+				esQueryFields(m["negative"], refs)
+			case typ == "function_score":
+				esQueryFields(m["query"], refs)
+			}
+		}
+	}
+}
+
+// esAggFields 收集聚合中 field 参数引用的字段，递归子聚合与 filter 聚合中的查询
+func esAggFields(aggs any, refs *[]esFieldRef) {
+	m, _ := aggs.(map[string]any)
+	for _, def := range m {
+		agg, _ := def.(map[string]any)
+		for typ, body := range agg {
+			switch typ {
+			case "aggs", "aggregations":
+				esAggFields(body, refs)
+			case "filter":
+				esQueryFields(body, refs)
+			case "filters":
+				if b, ok := body.(map[string]any); ok {
+					if fs, ok := b["filters"].(map[string]any); ok {
+						for _, q := range fs {
+							esQueryFields(q, refs)
+						}
+					} else {
+						esQueryFields(b["filters"], refs)
+					}
+				}
+			default:
+				if b, ok := body.(map[string]any); ok {
+					if f, ok := b["field"].(string); ok {
+						*refs = append(*refs, esFieldRef{field: f, usage: "agg:" + typ})
+					}
+				}
+			}
+		}
+	}
+}
+
+// esSortFields 收集 sort 中的字段，_score、_doc 等元数据字段除外
+func esSortFields(sortSpec any, refs *[]esFieldRef) {
+	items, ok := sortSpec.([]any)
+	if !ok {
+		items = []any{sortSpec}
+	}
+	for _, item := range items {
+		switch x := item.(type) {
+		case string:
+			*refs = append(*refs, esFieldRef{field: x, usage: "sort"})
+		case map[string]any:
+			for field := range x {
+				if field != "_geo_distance" && field != "_script" {
+					*refs = append(*refs, esFieldRef{field: field, usage: "sort"})
+				}
+			}
+		}
+	}
+}
+
+// esSourceFields _source 中列出的字段（布尔值表示是否返回原文，不含字段）
+func esSourceFields(source any) []string {
+	var fields []string
+	var collect func(v any)
+	collect = func(v any) {
+		switch x := v.(type) {
+		case string:
+			fields = append(fields, x)
+		case []any:
+			for _, item := range x {
+				collect(item)
+			}
+		case map[string]any:
+			collect(x["includes"])
+		}
+	}
+	collect(source)
+	return fields
+}
+
+// validateESQL 校验 ES|QL：版本 → 源命令与索引 → 处理命令 → 字段（未声明的字段给出警告）
+func validateESQL(query string, database Database, indices []Index) Diagnostics {
+	tokens := tokenizeSQL(query, sqlStringsBackslash)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "查询不能为空")}
+	}
+	first := tokens[0]
+	if !first.is("FROM") && !first.is("ROW") && !first.is("SHOW") {
+		return Diagnostics{newDiagnostic(CodeESInvalidQuery, SeverityError, "无法识别的查询：需要 GET /索引名/_search 请求或以 FROM 开头的 ES|QL").
+			atToken(query, first)}
+	}
+	if !versionSupports(database.Version, esqlSince) {
+		return Diagnostics{newDiagnostic(CodeUnsupportedFeature, SeverityError, "Elasticsearch %s 不支持 ES|QL（需要 %s 及以上版本）", database.Version, esqlSince).
+			atToken(query, first).withSuggestion("改用 GET /索引名/_search 与 Query DSL")}
+	}
+	if semi, ok := findStatementSeparator(tokens); ok {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许一条 ES|QL 查询").atToken(query, semi)}
+	}
+
+	var commands [][]sqlToken
+	start := 0
+	for i, t := range tokens {
+		if t.isOp("|") {
+			commands = append(commands, tokens[start:i])
+			start = i + 1
+		}
+	}
+	commands = append(commands, tokens[start:])
+
+	var diags Diagnostics
+	known := newESIndices(indices)
+	matched := known
+	if first.is("FROM") && len(known) > 0 {
+		var unknown []string
+		matched, unknown = matchESIndices(known, esqlSource(query, commands[0]))
+		if len(unknown) > 0 {
+			return Diagnostics{newDiagnostic(CodeESUnknownIndex, SeverityError, "索引 %s 不在 schema 中", strings.Join(unknown, ", ")).
+				atToken(query, first).withSuggestion("使用 schema 中声明的索引：" + esIndexNames(indices))}
+		}
+	}
+
+	defined := make(map[string]bool)
+	checkFields := first.is("FROM") && len(known) > 0
+	for _, cmd := range commands[1:] {
+		if len(cmd) == 0 {
+			return append(diags, newDiagnostic(CodeESInvalidQuery, SeverityError, "管道中存在空命令"))
+		}
+		name := cmd[0]
+		since, ok := esqlCommands[name.upper]
+		switch {
+		case name.kind != tokWord || !ok:
+			diags = append(diags, newDiagnostic(CodeESInvalidQuery, SeverityError, "不支持的 ES|QL 命令: %s", name.text).
+				atToken(query, name).withSuggestion("使用 WHERE、EVAL、STATS、KEEP、SORT、LIMIT 等处理命令"))
+			continue
+		case !versionSupports(database.Version, since):
+			diags = append(diags, newDiagnostic(CodeUnsupportedFeature, SeverityError, "Elasticsearch %s 不支持 ES|QL %s（需要 %s 及以上版本）", database.Version, name.upper, since).
+				atToken(query, name))
+			continue
+		case name.is("DISSECT") || name.is("GROK") || name.is("ENRICH") || name.is("LOOKUP"):
+			// 这些命令新增的字段无法从语句中可靠推断，之后不再检查字段
+			checkFields = false
+		}
+		if checkFields {
+			diags = append(diags, esqlFieldWarnings(query, cmd, matched, defined)...)
+		}
+	}
+	return diags
+}
+
+// esqlSource FROM 命令中的索引表达式（METADATA 之前的部分）
+func esqlSource(query string, cmd []sqlToken) string {
+	if len(cmd) < 2 {
+		return ""
+	}
+	end := len(query)
+	for _, t := range cmd[1:] {
+		if t.is("METADATA") {
+			end = t.pos
+			break
+		}
+	}
+	last := cmd[len(cmd)-1]
+	if last.pos+len(last.text) < end {
+		end = last.pos + len(last.text)
+	}
+	return strings.Join(strings.Fields(query[cmd[1].pos:end]), "")
+}
+
+// esqlFieldWarnings 处理命令中引用的字段应在映射中声明或由前面的 EVAL、STATS、RENAME 定义
+func esqlFieldWarnings(query string, cmd []sqlToken, indices []esIndex, defined map[string]bool) Diagnostics {
+	var diags Diagnostics
+	for i := 1; i < len(cmd); i++ {
+		t, prev := cmd[i], cmd[i-1]
+		if t.kind != tokWord || esqlKeywords[t.upper] {
+			continue
+		}
+		// 合并 @timestamp、a.b.c 形式的字段路径
+		field, end := t.text, i
+		if prev.isOp("@") {
+			field = "@" + field
+		}
+		for end+2 < len(cmd) && cmd[end+1].isPunct(".") && cmd[end+2].kind == tokWord {
+			field += "." + cmd[end+2].text
+			end += 2
+		}
+		i = end
+		var next, after sqlToken
+		if end+1 < len(cmd) {
+			next = cmd[end+1]
+		}
+		if end+2 < len(cmd) {
+			after = cmd[end+2]
+		}
+		switch {
+		case next.isPunct("("): // 函数
+		case next.isPunct(".") || next.isOp("*"): // 通配符，如 host.*
+		case prev.kind == tokNumber: // 时间间隔单位，如 1 day
+		case next.isOp("=") && !after.isOp("="), cmd[0].is("RENAME") && prev.is("AS"):
+			defined[field] = true // EVAL / STATS 的新列、RENAME 的新名称
+		case defined[field]:
+		default:
+			if _, ok := esFieldType(indices, field); !ok {
+				diags = append(diags, newDiagnostic(CodeESUnknownField, SeverityWarning, "字段 %s 不在索引映射中", field).
+					atToken(query, t))
+			}
+		}
+	}
+	return diags
+}
+
+func esIndexNames(indices []Index) string {
+	names := make([]string, len(indices))
+	for i, idx := range indices {
+		names[i] = idx.Name
+	}
+	return strings.Join(names, "、")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := mapKeys(m)
+	sort.Strings(keys)
+	return keys
+}
+
+// parseLLMOutputES 解析 LLM 输出：请求行 + JSON 请求体，或 ES|QL 管道
+func parseLLMOutputES(content string) (query, explanation string) {
+	var lines []string
+	for _, line := range splitLines(content) {
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, line)
+		}
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		rest := strings.Join(lines[i+1:], "\n")
+		switch {
+		case esRequestLine.MatchString(trimmed):
+			if !strings.Contains(rest, "{") {
+				return trimmed, explanationAfter(rest)
+			}
+			body, explanation := parseLLMOutputJSON(rest)
+			return trimmed + "\n" + body, explanation
+		case startsWithIgnoreCase(trimmed, "FROM ") || startsWithIgnoreCase(trimmed, "ROW ") || strings.EqualFold(trimmed, "SHOW INFO"):
+			var pipeline []string
+			for _, l := range lines[i:] {
+				t := strings.TrimSpace(l)
+				if t == "" || isExplanationLine(t) {
+					break
+				}
+				pipeline = append(pipeline, t)
+			}
+			return strings.Join(pipeline, "\n"), explanationAfter(strings.Join(lines[i+len(pipeline):], "\n"))
+		case strings.HasPrefix(trimmed, "{"):
+			return parseLLMOutputJSON(strings.Join(lines[i:], "\n"))
+		}
+		break
+	}
+	return parseLLMOutput(content)
+}
@@ -0,0 +1,152 @@
+package text2sql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var esTestSchema = Schema{Indices: []Index{{
+	Name: "logs-*",
+	Mappings: json.RawMessage(`{"properties": {
+		"@timestamp": {"type": "date"},
+		"level": {"type": "keyword"},
+		"message": {"type": "text", "fields": {"keyword": {"type": "keyword"}}},
+		"duration_ms": {"type": "long"},
+		"host": {"properties": {"name": {"type": "keyword"}}}
+	}}`),
+}}}
+
+func TestValidateElasticsearch(t *testing.T) {
+	v := NewSQLValidator()
+	database := Database{Type: "elasticsearch", Version: "8.12"}
+	tests := []struct {
+		name     string
+		query    string
+		database Database
+		wantCode string
+	}{
+		{"bool filter and date histogram", `GET /logs-2024.05/_search
+{"size": 0, "query": {"bool": {"filter": [{"term": {"level": "error"}}, {"range": {"@timestamp": {"gte": "now-1d/d"}}}], "must": [{"match": {"message": "timeout"}}]}}, "aggs": {"per_hour": {"date_histogram": {"field": "@timestamp", "calendar_interval": "hour"}, "aggs": {"p95": {"percentiles": {"field": "duration_ms"}}}}}}`, database, ""},
+		{"keyword subfield", `GET /logs-*/_search
+{"aggs": {"top": {"terms": {"field": "message.keyword"}}}, "sort": [{"@timestamp": "desc"}], "_source": ["host.*", "level"]}`, database, ""},
+		{"count without body", "GET /logs-*/_count", database, ""},
+		{"esql", `FROM logs-* | WHERE level == "error" AND @timestamp > NOW() - 1 day | EVAL secs = duration_ms / 1000 | STATS total = COUNT(*), avg_secs = AVG(secs) BY host.name | SORT total DESC | LIMIT 10`, database, ""},
+		{"missing request line", `{"query": {"match_all": {}}}`, database, CodeESInvalidQuery},
+		{"path on next line", "GET\n/logs-*/_search\n{}", database, CodeESInvalidQuery},
+		{"delete by query", `POST /logs-*/_delete_by_query
+{"query": {"match_all": {}}}`, database, CodeNotReadOnly},
+		{"put document", `PUT /logs-1/_doc/1
+{"level": "info"}`, database, CodeNotReadOnly},
+		{"delete index", "DELETE /logs-1", database, CodeNotReadOnly},
+		{"other api", "GET /_cat/indices", database, CodeESInvalidQuery},
+		{"unknown index", "GET /metrics/_search", database, CodeESUnknownIndex},
+		{"invalid json", "GET /logs-*/_search\n{\"query\": {match_all: {}}}", database, CodeSyntaxError},
+		{"script query", `GET /logs-*/_search
+{"query": {"script": {"script": "doc['duration_ms'].value > 100"}}}`, database, CodeESScript},
+		{"scripted metric", `GET /logs-*/_search
+{"aggs": {"x": {"scripted_metric": {"map_script": "state.x = 1"}}}}`, database, CodeESScript},
+		{"runtime mappings", `GET /logs-*/_search
+{"runtime_mappings": {"day": {"type": "keyword"}}}`, database, CodeESScript},
+		{"unknown body key", `GET /logs-*/_search
+{"query": {"match_all": {}}, "pit": {"id": "x"}}`, database, CodeESInvalidQuery},
+		{"unknown field", `GET /logs-*/_search
+{"query": {"term": {"status": 500}}}`, database, CodeESUnknownField},
+		{"term on text", `GET /logs-*/_search
+{"query": {"term": {"message": "timeout"}}}`, database, CodeESFieldType},
+		{"terms agg on text", `GET /logs-*/_search
+{"aggs": {"top": {"terms": {"field": "message"}}}}`, database, CodeESFieldType},
+		{"avg on keyword", `GET /logs-*/_search
+{"aggs": {"a": {"avg": {"field": "level"}}}}`, database, CodeESFieldType},
+		{"date histogram on number", `GET /logs-*/_search
+{"aggs": {"a": {"date_histogram": {"field": "duration_ms", "calendar_interval": "day"}}}}`, database, CodeESFieldType},
+		{"esql too old", `FROM logs-* | LIMIT 10`, Database{Type: "elasticsearch", Version: "8.9"}, CodeUnsupportedFeature},
+		{"esql lookup join too old", `FROM logs-* | LOOKUP JOIN hosts ON host.name`, database, CodeUnsupportedFeature},
+		{"esql unknown command", `FROM logs-* | DELETE`, database, CodeESInvalidQuery},
+		{"esql unknown index", `FROM metrics | LIMIT 1`, database, CodeESUnknownIndex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.DiagnoseWithSchema(tt.query, tt.database, esTestSchema).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateElasticsearch_Diagnostics(t *testing.T) {
+	v := NewSQLValidator()
+	database := Database{Type: "elasticsearch", Version: "8.12"}
+
+	errs := v.DiagnoseWithSchema("GET /logs-*/_search\n{\"query\": {\"term\": {\"message\": \"x\"}}}", database, esTestSchema).Errors()
+	if len(errs) != 1 || errs[0].Line != 2 || errs[0].Suggestion != "改用 keyword 子字段 message.keyword" {
+		t.Fatalf("expected ES_FIELD_TYPE on line 2 suggesting message.keyword, got %+v", errs)
+	}
+
+	diags := v.DiagnoseWithSchema(`FROM logs-* | WHERE stauts == 500 | RENAME level AS lvl | KEEP lvl, host.*`, database, esTestSchema)
+	if diags.HasErrors() {
+		t.Fatalf("unknown ES|QL fields should only warn, got %v", diags.Errors())
+	}
+	warnings := diags.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != CodeESUnknownField || warnings[0].Token != "stauts" {
+		t.Fatalf("expected one ES_UNKNOWN_FIELD warning for stauts, got %v", warnings)
+	}
+}
+
+func TestParseLLMOutputES(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		wantQuery       string
+		wantExplanation string
+	}{
+		{
+			"request with body",
+			"```\nGET /logs-*/_search\n{\"query\": {\"match_all\": {}}}\n```\n解释：查询全部日志",
+			"GET /logs-*/_search\n{\"query\": {\"match_all\": {}}}",
+			"查询全部日志",
+		},
+		{
+			"request without body",
+			"GET /logs-*/_count\n解释：统计日志数",
+			"GET /logs-*/_count",
+			"统计日志数",
+		},
+		{
+			"esql",
+			"```esql\nFROM logs-*\n| STATS c = COUNT(*) BY level\n```\n解释：按级别统计",
+			"FROM logs-*\n| STATS c = COUNT(*) BY level",
+			"按级别统计",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, explanation := parseLLMOutputES(tt.content)
+			if query != tt.wantQuery || explanation != tt.wantExplanation {
+				t.Errorf("parseLLMOutputES() = %q, %q; want %q, %q", query, explanation, tt.wantQuery, tt.wantExplanation)
+			}
+		})
+	}
+}
+
+func TestParseESMapping(t *testing.T) {
+	fields, err := parseESMapping(json.RawMessage(`{"mappings": {"properties": {"user": {"properties": {"name": {"type": "text", "fields": {"raw": {"type": "keyword"}}}}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user": "object", "user.name": "text", "user.name.raw": "keyword"}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("fields[%s] = %s, want %s", k, fields[k], v)
+		}
+	}
+}
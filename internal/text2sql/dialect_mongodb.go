@@ -0,0 +1,389 @@
+package text2sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// mongoStage 聚合阶段
+type mongoStage struct {
+	Since string // 引入版本
+	Write bool   // 写入阶段，始终禁止
+}
+
+// mongoStages 聚合阶段目录：只读阶段及其引入版本，写入阶段仅用于给出明确的拒绝原因
+var mongoStages = map[string]mongoStage{
+	"$match": {Since: "2.2"}, "$project": {Since: "2.2"}, "$group": {Since: "2.2"}, "$sort": {Since: "2.2"},
+	"$limit": {Since: "2.2"}, "$skip": {Since: "2.2"}, "$unwind": {Since: "2.2"},
+	"$geoNear": {Since: "2.4"}, "$redact": {Since: "2.6"},
+	"$sample": {Since: "3.2"}, "$lookup": {Since: "3.2"},
+	"$facet": {Since: "3.4"}, "$bucket": {Since: "3.4"}, "$bucketAuto": {Since: "3.4"}, "$sortByCount": {Since: "3.4"},
+	"$addFields": {Since: "3.4"}, "$replaceRoot": {Since: "3.4"}, "$graphLookup": {Since: "3.4"}, "$count": {Since: "3.4"},
+	"$set": {Since: "4.2"}, "$unset": {Since: "4.2"}, "$replaceWith": {Since: "4.2"},
+	"$unionWith": {Since: "4.4"}, "$setWindowFields": {Since: "5.0"},
+	"$densify": {Since: "5.1"}, "$documents": {Since: "5.1"}, "$fill": {Since: "5.3"},
+	"$out": {Write: true}, "$merge": {Write: true},
+}
+
+// mongoServerScriptOperators 执行服务端 JavaScript 的运算符
+var mongoServerScriptOperators = []string{"$where", "$function", "$accumulator"}
+
+// mongoQuery 生成的 MongoDB 查询：find 与 aggregate 二选一
+type mongoQuery struct {
+	Collection string            `json:"collection"`
+	Find       *mongoFind        `json:"find,omitempty"`
+	Aggregate  []json.RawMessage `json:"aggregate,omitempty"`
+}
+
+type mongoFind struct {
+	Filter     map[string]any `json:"filter"`
+	Projection map[string]any `json:"projection,omitempty"`
+	Sort       map[string]any `json:"sort,omitempty"`
+	Skip       *int64         `json:"skip,omitempty"`
+	Limit      *int64         `json:"limit,omitempty"`
+}
+
+// mongoDialect MongoDB find / 聚合查询（JSON 输出）
+type mongoDialect struct{}
+
+func (mongoDialect) Name() string { return "mongodb" }
+
+func (mongoDialect) DisplayName() string { return "MongoDB" }
+
+func (mongoDialect) StatementName() string { return "MongoDB 查询" }
+
+func (d mongoDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的集合结构和自然语言问题，生成对应的只读 MongoDB 查询。"
+	if modify {
+		intro = "用户会提供现有的 MongoDB 查询和新的需求，你需要在现有查询基础上进行修改，输出修改后的完整查询。"
+	}
+	prompt := fmt.Sprintf(`你是一个 MongoDB 专家%s。%s
+
+输出格式：先输出一个 JSON 对象，之后以"解释："开头是简要说明（可选）。JSON 为以下两种形式之一：
+1. find 查询：{"collection": "集合名", "find": {"filter": {...}, "projection": {...}, "sort": {...}, "skip": 0, "limit": 20}}
+2. 聚合查询：{"collection": "集合名", "aggregate": [{"$match": {...}}, {"$group": {...}}]}
+
+规则：
+1. 只生成只读查询，聚合管道禁止 $out、$merge 等写入阶段
+2. 禁止 $where、$function、$accumulator 等服务端 JavaScript
+3. 集合名和字段名使用 schema 中提供的名称，嵌套字段使用点号路径（如 address.city）
+4. 输出合法的 JSON：键名使用双引号，日期使用扩展 JSON 写法 {"$date": "2024-01-01T00:00:00Z"}
+5. 可能返回大量文档时设置 limit 或使用 $limit 阶段`, versionNote(database.Version), intro)
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		prompt += "\n\n注意：目标版本不支持以下聚合阶段，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (mongoDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutputJSON(content)
+}
+
+func (mongoDialect) Validate(query string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateMongo(query, database, schema.Collections)
+}
+
+// Features 聚合阶段的引入版本
+func (mongoDialect) Features() []FeatureVersion {
+	var features []FeatureVersion
+	for name, stage := range mongoStages {
+		if !stage.Write {
+			features = append(features, FeatureVersion{Feature: name, Since: stage.Since})
+		}
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i].Feature < features[j].Feature })
+	return features
+}
+
+// QuoteIdentifier 字段名在 JSON 中以字符串表示
+func (mongoDialect) QuoteIdentifier(name string) string {
+	b, _ := json.Marshal(name)
+	return string(b)
+}
+
+// validateMongo 校验 MongoDB 查询：JSON 结构 → 服务端脚本 → 聚合阶段（只读、版本）→ schema 中的集合与字段
+func validateMongo(query string, database Database, collections []Collection) Diagnostics {
+	dec := json.NewDecoder(strings.NewReader(query))
+	dec.DisallowUnknownFields()
+	var q mongoQuery
+	if err := dec.Decode(&q); err != nil {
+		return Diagnostics{jsonErrorDiagnostic(query, 0, err, CodeMongoInvalidQuery)}
+	}
+	if dec.More() {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许一个查询 JSON 对象").
+			at(query, int(dec.InputOffset()), "")}
+	}
+	if q.Collection == "" {
+		return Diagnostics{newDiagnostic(CodeMongoInvalidQuery, SeverityError, "缺少 collection 字段").
+			withSuggestion(`使用 {"collection": "集合名", "find": {...}} 格式`)}
+	}
+	if (q.Find == nil) == (q.Aggregate == nil) {
+		return Diagnostics{newDiagnostic(CodeMongoInvalidQuery, SeverityError, "find 与 aggregate 必须且只能提供一个").
+			withSuggestion("简单查询使用 find，分组统计等使用 aggregate")}
+	}
+
+	var doc any
+	_ = json.Unmarshal([]byte(query), &doc)
+	var diags Diagnostics
+	for _, op := range mongoServerScriptOperators {
+		if containsJSONKey(doc, op) {
+			diags = append(diags, jsonKeyDiagnostic(query, op, CodeMongoServerScript, "不允许执行服务端 JavaScript: %s", op).
+				withSuggestion("改用 $expr 与聚合表达式实现条件判断"))
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	known := make(map[string]*Collection, len(collections))
+	for i := range collections {
+		known[collections[i].Name] = &collections[i]
+	}
+	referenced := []string{q.Collection}
+
+	if q.Find != nil {
+		if (q.Find.Limit != nil && *q.Find.Limit < 0) || (q.Find.Skip != nil && *q.Find.Skip < 0) {
+			diags = append(diags, newDiagnostic(CodeMongoInvalidQuery, SeverityError, "find 的 skip 和 limit 不能为负数"))
+		}
+		if c := known[q.Collection]; c != nil {
+			diags = append(diags, mongoFieldWarnings(query, c, filterFields(q.Find.Filter))...)
+			diags = append(diags, mongoFieldWarnings(query, c, mapKeys(q.Find.Projection))...)
+		}
+	} else {
+		leading := true
+		for _, raw := range q.Aggregate {
+			var stage map[string]any
+			if err := json.Unmarshal(raw, &stage); err != nil || len(stage) != 1 {
+				diags = append(diags, newDiagnostic(CodeMongoInvalidQuery, SeverityError, "聚合阶段必须是只含一个阶段名的对象: %s", compactJSON(raw)))
+				continue
+			}
+			var name string
+			var body any
+			for k, v := range stage {
+				name, body = k, v
+			}
+			spec, ok := mongoStages[name]
+			switch {
+			case !ok:
+				diags = append(diags, jsonKeyDiagnostic(query, name, CodeMongoUnknownStage, "不支持的聚合阶段: %s", name).
+					withSuggestion("只使用 $match、$group、$project、$sort、$limit、$lookup 等只读阶段"))
+				continue
+			case spec.Write:
+				diags = append(diags, jsonKeyDiagnostic(query, name, CodeNotReadOnly, "不允许写入阶段: %s", name).
+					withSuggestion("去掉 $out / $merge，直接返回聚合结果"))
+				continue
+			case !versionSupports(database.Version, spec.Since):
+				diags = append(diags, jsonKeyDiagnostic(query, name, CodeUnsupportedFeature, "MongoDB %s 不支持 %s（需要 %s 及以上版本）", database.Version, name, spec.Since))
+				continue
+			}
+			referenced = append(referenced, stageCollections(name, body)...)
+			// 仅检查管道开头、文档结构尚未改变时的 $match 字段
+			switch name {
+			case "$match":
+				if c := known[q.Collection]; c != nil && leading {
+					m, _ := body.(map[string]any)
+					diags = append(diags, mongoFieldWarnings(query, c, filterFields(m))...)
+				}
+			case "$sort", "$limit", "$skip":
+			default:
+				leading = false
+			}
+		}
+	}
+
+	if len(collections) > 0 {
+		for _, name := range referenced {
+			if known[name] == nil {
+				diags = append(diags, jsonKeyDiagnostic(query, name, CodeMongoUnknownCollection, "集合 %s 不在 schema 中", name).
+					withSuggestion("使用 schema 中声明的集合："+collectionNames(collections)))
+			}
+		}
+	}
+	return diags
+}
+
+// jsonErrorDiagnostic 将 JSON 解析错误转换为带位置的诊断。
+// base 为 JSON 在 src 中的起始偏移，结构错误使用 invalidCode。
+func jsonErrorDiagnostic(src string, base int, err error, invalidCode string) *ValidationError {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return newDiagnostic(CodeSyntaxError, SeverityError, "JSON 语法错误: %v", err).
+			at(src, base+max(int(syntaxErr.Offset)-1, 0), "").withSuggestion("输出合法的 JSON，键名使用双引号")
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return newDiagnostic(invalidCode, SeverityError, "字段 %s 类型错误，应为 %s", typeErr.Field, typeErr.Type).
+			at(src, base+max(int(typeErr.Offset)-1, 0), "")
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return newDiagnostic(CodeSyntaxError, SeverityError, "JSON 不完整").withSuggestion("输出完整的 JSON 对象")
+	}
+	return newDiagnostic(invalidCode, SeverityError, "查询结构错误: %v", err)
+}
+
+// jsonKeyDiagnostic 创建定位到 JSON 键 "key" 首次出现位置的诊断
+func jsonKeyDiagnostic(src, key, code, format string, args ...any) *ValidationError {
+	d := newDiagnostic(code, SeverityError, format, args...)
+	if idx := strings.Index(src, `"`+key+`"`); idx >= 0 {
+		return d.at(src, idx+1, key)
+	}
+	return d
+}
+
+// containsJSONKey 递归判断 JSON 值中是否存在指定的键
+func containsJSONKey(v any, key string) bool {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, child := range x {
+			if k == key || containsJSONKey(child, key) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range x {
+			if containsJSONKey(child, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterFields 收集过滤条件中引用的字段，展开 $and / $or / $nor
+func filterFields(filter map[string]any) []string {
+	var fields []string
+	for k, v := range filter {
+		if !strings.HasPrefix(k, "$") {
+			fields = append(fields, k)
+			continue
+		}
+		if list, ok := v.([]any); ok {
+			for _, item := range list {
+				if m, ok := item.(map[string]any); ok {
+					fields = append(fields, filterFields(m)...)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// mongoFieldWarnings 字段未在集合中声明时给出警告（声明了前缀字段也视为已声明）
+func mongoFieldWarnings(src string, c *Collection, fields []string) Diagnostics {
+	if len(c.Fields) == 0 {
+		return nil
+	}
+	declared := make(map[string]bool, len(c.Fields))
+	for _, f := range c.Fields {
+		declared[f.Name] = true
+	}
+	sort.Strings(fields)
+	var diags Diagnostics
+	for _, field := range fields {
+		if field == "_id" || fieldDeclared(declared, field) {
+			continue
+		}
+		d := jsonKeyDiagnostic(src, field, CodeMongoUnknownField, "字段 %s 未在集合 %s 中声明", field, c.Name)
+		d.Severity = SeverityWarning
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+func fieldDeclared(declared map[string]bool, field string) bool {
+	for path := field; ; {
+		if declared[path] {
+			return true
+		}
+		i := strings.LastIndexByte(path, '.')
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+// stageCollections 阶段中引用的其他集合（$lookup、$graphLookup 的 from，$unionWith 的 coll）
+func stageCollections(name string, body any) []string {
+	switch name {
+	case "$lookup", "$graphLookup":
+		if m, ok := body.(map[string]any); ok {
+			if from, ok := m["from"].(string); ok {
+				return []string{from}
+			}
+		}
+	case "$unionWith":
+		if coll, ok := body.(string); ok {
+			return []string{coll}
+		}
+		if m, ok := body.(map[string]any); ok {
+			if coll, ok := m["coll"].(string); ok {
+				return []string{coll}
+			}
+		}
+	}
+	return nil
+}
+
+func collectionNames(collections []Collection) string {
+	names := make([]string, len(collections))
+	for i, c := range collections {
+		names[i] = c.Name
+	}
+	return strings.Join(names, "、")
+}
+
+func mapKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func compactJSON(raw []byte) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+// parseLLMOutputJSON 解析 LLM 输出，提取第一个 JSON 对象和解释
+func parseLLMOutputJSON(content string) (doc, explanation string) {
+	start := strings.IndexByte(content, '{')
+	if start < 0 {
+		return "", explanationAfter(content)
+	}
+	rest := content[start:]
+	dec := json.NewDecoder(strings.NewReader(rest))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		// 不合法的 JSON 原样交给校验阶段报告位置
+		end := len(rest)
+		for _, marker := range []string{"\n```", "\n解释", "\n说明", "\nExplanation"} {
+			if i := strings.Index(rest, marker); i >= 0 && i < end {
+				end = i
+			}
+		}
+		return strings.TrimSpace(rest[:end]), explanationAfter(rest[end:])
+	}
+	end := int(dec.InputOffset())
+	return strings.TrimSpace(rest[:end]), explanationAfter(rest[end:])
+}
+
+// explanationAfter 提取以"解释："、"Explanation:" 等标记开头的行
+func explanationAfter(content string) string {
+	for _, line := range splitLines(content) {
+		trimmed := strings.TrimSpace(line)
+		if e, ok := cutExplanation(trimmed); ok {
+			return e
+		}
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package text2sql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"text2sql/internal/llm"
+)
+
+func TestValidateMongo(t *testing.T) {
+	v := NewSQLValidator()
+	schema := Schema{Collections: []Collection{
+		{Name: "orders", Fields: []Column{{Name: "status"}, {Name: "amount"}, {Name: "customer"}, {Name: "created_at"}}},
+		{Name: "customers", Fields: []Column{{Name: "name"}}},
+	}}
+	database := Database{Type: "mongodb", Version: "6.0"}
+	tests := []struct {
+		name     string
+		query    string
+		database Database
+		wantCode string
+	}{
+		{"find", `{"collection": "orders", "find": {"filter": {"status": "paid", "amount": {"$gt": 100}}, "projection": {"amount": 1}, "limit": 20}}`, database, ""},
+		{"find nested field", `{"collection": "orders", "find": {"filter": {"customer.city": "Beijing"}}}`, database, ""},
+		{"aggregate", `{"collection": "orders", "aggregate": [{"$match": {"status": "paid"}}, {"$group": {"_id": "$customer", "total": {"$sum": "$amount"}}}, {"$sort": {"total": -1}}, {"$limit": 10}]}`, database, ""},
+		{"lookup declared", `{"collection": "orders", "aggregate": [{"$lookup": {"from": "customers", "localField": "customer", "foreignField": "_id", "as": "c"}}]}`, database, ""},
+		{"invalid json", `{"collection": "orders", "find": {"filter": {status: "paid"}}}`, database, CodeSyntaxError},
+		{"unknown top-level field", `{"collection": "orders", "update": {"status": "paid"}}`, database, CodeMongoInvalidQuery},
+		{"both find and aggregate", `{"collection": "orders", "find": {"filter": {}}, "aggregate": []}`, database, CodeMongoInvalidQuery},
+		{"missing collection", `{"find": {"filter": {}}}`, database, CodeMongoInvalidQuery},
+		{"out stage", `{"collection": "orders", "aggregate": [{"$match": {}}, {"$out": "backup"}]}`, database, CodeNotReadOnly},
+		{"merge stage", `{"collection": "orders", "aggregate": [{"$merge": {"into": "backup"}}]}`, database, CodeNotReadOnly},
+		{"where operator", `{"collection": "orders", "find": {"filter": {"$where": "this.amount > 100"}}}`, database, CodeMongoServerScript},
+		{"function in expr", `{"collection": "orders", "aggregate": [{"$addFields": {"x": {"$function": {"body": "function() {}", "args": [], "lang": "js"}}}}]}`, database, CodeMongoServerScript},
+		{"unknown stage", `{"collection": "orders", "aggregate": [{"$currentOp": {}}]}`, database, CodeMongoUnknownStage},
+		{"stage too new", `{"collection": "orders", "aggregate": [{"$setWindowFields": {"output": {}}}]}`, Database{Type: "mongodb", Version: "4.4"}, CodeUnsupportedFeature},
+		{"unknown collection", `{"collection": "products", "find": {"filter": {}}}`, database, CodeMongoUnknownCollection},
+		{"unknown lookup collection", `{"collection": "orders", "aggregate": [{"$lookup": {"from": "refunds", "localField": "_id", "foreignField": "order", "as": "r"}}]}`, database, CodeMongoUnknownCollection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.DiagnoseWithSchema(tt.query, tt.database, schema).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateMongo_Diagnostics(t *testing.T) {
+	v := NewSQLValidator()
+	schema := Schema{Collections: []Collection{{Name: "orders", Fields: []Column{{Name: "status"}}}}}
+
+	diags := v.DiagnoseWithSchema(`{"collection": "orders", "find": {"filter": {"$or": [{"status": "paid"}, {"stauts": "new"}]}}}`, Database{Type: "mongodb"}, schema)
+	if diags.HasErrors() {
+		t.Fatalf("unknown fields should only warn, got %v", diags.Errors())
+	}
+	warnings := diags.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != CodeMongoUnknownField || warnings[0].Token != "stauts" {
+		t.Fatalf("expected one MONGO_UNKNOWN_FIELD warning for stauts, got %v", warnings)
+	}
+
+	query := "{\"collection\": \"orders\",\n \"aggregate\": [{\"$out\": \"x\"}]}"
+	errs := v.Diagnose(query, Database{Type: "mongodb"}).Errors()
+	if len(errs) != 1 || errs[0].Line != 2 || errs[0].Token != "$out" {
+		t.Fatalf("expected $out located on line 2, got %+v", errs)
+	}
+}
+
+func TestParseLLMOutputJSON(t *testing.T) {
+	content := "```json\n{\"collection\": \"orders\", \"find\": {\"filter\": {\"note\": \"a } b\"}}}\n```\n解释：查询订单"
+	doc, explanation := parseLLMOutputJSON(content)
+	if doc != `{"collection": "orders", "find": {"filter": {"note": "a } b"}}}` {
+		t.Errorf("unexpected doc: %q", doc)
+	}
+	if explanation != "查询订单" {
+		t.Errorf("unexpected explanation: %q", explanation)
+	}
+}
+
+type sequenceProvider struct {
+	contents []string
+	calls    int
+	requests []*llm.CompleteRequest
+}
+
+func (p *sequenceProvider) Name() string { return "sequence" }
+
+func (p *sequenceProvider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm.CompleteResponse, error) {
+	p.requests = append(p.requests, req)
+	content := p.contents[min(p.calls, len(p.contents)-1)]
+	p.calls++
+	return &llm.CompleteResponse{Content: content}, nil
+}
+
+func TestService_Generate_MongoDBRetry(t *testing.T) {
+	provider := &sequenceProvider{contents: []string{
+		`{"collection": "orders", "aggregate": [{"$match": {"status": "paid"}}, {"$out": "paid_orders"}]}`,
+		"{\"collection\": \"orders\", \"find\": {\"filter\": {\"status\": \"paid\"}, \"limit\": 20}}\n解释：查询已支付订单",
+	}}
+	svc := NewService(provider, NewSQLValidator(), 3)
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "已支付的订单",
+		Schema:   Schema{Collections: []Collection{{Name: "orders", Fields: []Column{{Name: "status"}}}}},
+		Database: Database{Type: "mongodb", Version: "7.0"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Fatalf("expected one retry, got %d calls", provider.calls)
+	}
+	if !strings.Contains(resp.SQL, `"find"`) || resp.Explanation != "查询已支付订单" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	feedback := provider.requests[1].Messages[len(provider.requests[1].Messages)-1].Content
+	if !strings.Contains(feedback, "MongoDB 查询") || !strings.Contains(feedback, "$out") {
+		t.Errorf("expected retry feedback about $out, got %q", feedback)
+	}
+}
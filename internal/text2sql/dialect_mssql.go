@@ -0,0 +1,247 @@
+package text2sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// mssqlWriteKeywords T-SQL 写操作、管理与会话语句关键字
+var mssqlWriteKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "DROP": true, "CREATE": true,
+	"ALTER": true, "TRUNCATE": true, "GRANT": true, "REVOKE": true, "DENY": true, "BACKUP": true,
+	"RESTORE": true, "DBCC": true, "SHUTDOWN": true, "KILL": true, "RECONFIGURE": true, "USE": true,
+	"SET": true, "DECLARE": true, "WAITFOR": true, "BULK": true, "EXEC": true, "EXECUTE": true,
+}
+
+// mssqlForbiddenFunctions 访问外部数据源或执行系统命令的函数与存储过程
+var mssqlForbiddenFunctions = map[string]bool{
+	"OPENROWSET": true, "OPENDATASOURCE": true, "OPENQUERY": true,
+	"SP_EXECUTESQL": true, "SP_OACREATE": true, "SP_CONFIGURE": true,
+}
+
+// mssqlVersionYears 产品年份与主版本号的对应关系，特性矩阵按主版本号记录
+var mssqlVersionYears = map[int]string{
+	2005: "9", 2008: "10", 2012: "11", 2014: "12", 2016: "13", 2017: "14", 2019: "15", 2022: "16",
+}
+
+// mssqlDialect SQL Server（T-SQL）
+type mssqlDialect struct{}
+
+func (mssqlDialect) Name() string { return "mssql" }
+
+func (mssqlDialect) DisplayName() string { return "SQL Server" }
+
+func (mssqlDialect) StatementName() string { return "SQL" }
+
+func (d mssqlDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的数据库表结构和自然语言问题，生成对应的 T-SQL SELECT 查询。"
+	output := `第一行是 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	if modify {
+		intro = "用户会提供现有的 SQL 语句和新的需求，你需要在现有 SQL 基础上进行修改。"
+		output = `第一行是修改后的完整 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	}
+	prompt := fmt.Sprintf(`你是一个 SQL Server 专家%s。%s
+
+规则：
+1. 只生成单条 SELECT 查询，不要使用 EXEC、SELECT INTO、临时表、变量声明，不要用 GO 分隔多个批处理
+2. 限制行数使用 SELECT TOP (n)，分页使用 ORDER BY ... OFFSET m ROWS FETCH NEXT n ROWS ONLY，不要使用 LIMIT
+3. 日期计算使用 DATEADD()、DATEDIFF()、DATEPART()、EOMONTH()，当前时间使用 GETDATE() 或 SYSDATETIME()
+4. 空值处理使用 ISNULL() 或 COALESCE()，类型转换使用 CAST() 或 CONVERT()，关联派生表使用 CROSS APPLY / OUTER APPLY
+5. 不要使用 OPENROWSET、OPENQUERY、xp_cmdshell 等访问外部数据或系统命令的功能
+6. 表名和列名使用 schema 中提供的名称，标识符需要引用时使用方括号，如 %s
+7. 输出格式：%s`, versionNote(database.Version), intro, d.QuoteIdentifier("order"), output)
+	if unsupported := unsupportedFeatures(d, mssqlVersion(database.Version)); len(unsupported) > 0 {
+		prompt += "\n\n注意：目标 SQL Server 不支持以下特性，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (mssqlDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutput(content)
+}
+
+func (mssqlDialect) Validate(sql string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateMSSQL(sql, database)
+}
+
+func (mssqlDialect) Features() []FeatureVersion {
+	return featureVersions("mssql")
+}
+
+func (mssqlDialect) QuoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// LimitRows 未限制行数的查询在主 SELECT 后插入 TOP (n)；TOP 超过上限时收紧到上限。
+// 已使用 OFFSET ... FETCH 或顶层为 UNION 等集合运算时原样返回。
+func (mssqlDialect) LimitRows(sql string, maxRows int) string {
+	if maxRows <= 0 {
+		return sql
+	}
+	tokens := tokenizeTSQL(sql)
+	main := -1
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case depth > 0:
+		case t.is("UNION") || t.is("EXCEPT") || t.is("INTERSECT") || t.is("OFFSET"):
+			return sql
+		case t.is("SELECT") && main < 0:
+			main = i
+		}
+	}
+	if main < 0 {
+		return sql
+	}
+
+	i := main + 1
+	if i < len(tokens) && (tokens[i].is("DISTINCT") || tokens[i].is("ALL")) {
+		i++
+	}
+	if i < len(tokens) && tokens[i].is("TOP") {
+		if n, start, end, ok := mssqlTopCount(tokens, i); ok && n > maxRows {
+			return sql[:start] + strconv.Itoa(maxRows) + sql[end:]
+		}
+		return sql
+	}
+	pos := tokens[i-1].pos + len(tokens[i-1].text)
+	return sql[:pos] + fmt.Sprintf(" TOP (%d)", maxRows) + sql[pos:]
+}
+
+// mssqlTopCount 解析 TOP n / TOP (n) 中的行数及其在 SQL 中的位置，PERCENT 或表达式返回 false
+func mssqlTopCount(tokens []sqlToken, top int) (n, start, end int, ok bool) {
+	i := top + 1
+	paren := i < len(tokens) && tokens[i].isPunct("(")
+	if paren {
+		i++
+	}
+	if i >= len(tokens) || tokens[i].kind != tokNumber {
+		return 0, 0, 0, false
+	}
+	if paren && (i+1 >= len(tokens) || !tokens[i+1].isPunct(")")) {
+		return 0, 0, 0, false
+	}
+	next := i + 1
+	if paren {
+		next++
+	}
+	if next < len(tokens) && tokens[next].is("PERCENT") {
+		return 0, 0, 0, false
+	}
+	n, err := strconv.Atoi(tokens[i].text)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return n, tokens[i].pos, tokens[i].pos + len(tokens[i].text), true
+}
+
+// mssqlVersion 将 2019 这类产品年份转换为主版本号（15），便于与特性矩阵比较
+func mssqlVersion(version string) string {
+	v, ok := parseDBVersion(version)
+	if !ok {
+		return version
+	}
+	if major, ok := mssqlVersionYears[v[0]]; ok {
+		return major
+	}
+	return version
+}
+
+// tokenizeTSQL 在通用词法分析基础上将 [ident] 合并为引用标识符。
+// T-SQL 中 # 是临时表前缀而不是注释，按标识符字符处理，避免其后的内容被跳过；字符串中的单引号写作两个单引号，没有反斜杠转义。
+func tokenizeTSQL(sql string) []sqlToken {
+	tokens := tokenizeSQL(strings.ReplaceAll(sql, "#", "_"), sqlStringsStandard)
+	for i, t := range tokens {
+		tokens[i] = newSQLToken(t.kind, sql[t.pos:t.pos+len(t.text)], t.pos)
+	}
+	merged := make([]sqlToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].isPunct("[") {
+			merged = append(merged, tokens[i])
+			continue
+		}
+		j := i + 1
+		for j < len(tokens) && !tokens[j].isPunct("]") {
+			j++
+		}
+		if j == len(tokens) {
+			merged = append(merged, tokens[i:]...)
+			break
+		}
+		start, end := tokens[i].pos, tokens[j].pos+1
+		merged = append(merged, newSQLToken(tokQuotedIdent, sql[start:end], start))
+		i = j
+	}
+	return merged
+}
+
+// validateMSSQL T-SQL 与 sqlparser 的语法差异较大（TOP、方括号、APPLY），采用词法级校验：
+// 批处理与语句结构 → 只读（含 EXEC、SELECT INTO）→ 外部数据源与系统过程 → 版本特性
+func validateMSSQL(sql string, database Database) Diagnostics {
+	tokens := tokenizeTSQL(sql)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "SQL 不能为空")}
+	}
+	if goTok, ok := findBatchSeparator(sql, tokens); ok {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许单个批处理，不能使用 GO 分隔").
+			atToken(sql, goTok).withSuggestion("删除 GO 及其后的语句，只保留一条 SELECT 查询")}
+	}
+	if d := checkSelectStructure(sql, tokens, "SQL Server", mssqlWriteKeywords); d != nil {
+		return Diagnostics{d}
+	}
+
+	var diags Diagnostics
+	for i, t := range tokens {
+		if t.kind != tokWord {
+			continue
+		}
+		qualified := (i > 0 && tokens[i-1].isPunct(".")) || (i+1 < len(tokens) && tokens[i+1].isPunct("."))
+		switch {
+		case t.is("EXEC") || t.is("EXECUTE"):
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "不允许执行存储过程或动态 SQL: %s", t.text).
+				atToken(sql, t).withSuggestion("只生成 SELECT 查询"))
+		case t.is("INTO"):
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 SELECT INTO 创建表").
+				atToken(sql, t).withSuggestion("去掉 INTO 子句，直接返回查询结果"))
+		case mssqlWriteKeywords[t.upper] && !qualified:
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+				atToken(sql, t).withSuggestion("只生成 SELECT 查询，不要包含写操作"))
+		case mssqlForbiddenFunctions[t.upper] || strings.HasPrefix(t.upper, "XP_"):
+			diags = append(diags, newDiagnostic(CodeForbiddenFunction, SeverityError, "不允许访问外部数据源或执行系统过程: %s", t.text).
+				atToken(sql, t).withSuggestion("只查询 schema 中提供的表"))
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, checkSQLFeatures("mssql", mssqlVersion(database.Version), sql, tokens)...)
+	return append(diags, selectStarWarnings(sql, tokens)...)
+}
+
+// findBatchSeparator 查找独占一行的 GO [count] 批处理分隔符
+func findBatchSeparator(sql string, tokens []sqlToken) (sqlToken, bool) {
+	for i, t := range tokens {
+		if !t.is("GO") {
+			continue
+		}
+		lineStart := strings.LastIndexByte(sql[:t.pos], '\n') + 1
+		if strings.TrimSpace(sql[lineStart:t.pos]) != "" {
+			continue
+		}
+		rest := sql[t.pos+len(t.text):]
+		if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+			rest = rest[:nl]
+		}
+		rest = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest), ";"))
+		if _, err := strconv.Atoi(rest); rest == "" || err == nil {
+			return tokens[i], true
+		}
+	}
+	return sqlToken{}, false
+}
@@ -0,0 +1,117 @@
+package text2sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMSSQL(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name     string
+		sql      string
+		version  string
+		wantCode string
+	}{
+		{"top", "SELECT TOP (10) [order_id], [Customer Name] FROM [dbo].[orders] ORDER BY [order_id] DESC", "2019", ""},
+		{"top with ties", "SELECT TOP 5 WITH TIES name, score FROM players ORDER BY score DESC", "2019", ""},
+		{"offset fetch", "SELECT id FROM orders ORDER BY id OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY", "2012", ""},
+		{"dateadd", "SELECT COUNT(*) FROM orders WHERE created_at >= DATEADD(day, -7, GETDATE()) AND DATEDIFF(hour, created_at, paid_at) < 24", "", ""},
+		{"cross apply", "SELECT c.name, o.total FROM customers c CROSS APPLY (SELECT TOP 1 total FROM orders WHERE orders.customer_id = c.id ORDER BY total DESC) o", "", ""},
+		{"cte", "WITH t AS (SELECT customer_id, SUM(total) AS s FROM orders GROUP BY customer_id) SELECT TOP 10 * FROM t", "", ""},
+		{"system view", "SELECT name FROM sys.tables", "", ""},
+		{"go in string", "SELECT id FROM orders WHERE note = '\nGO\n'", "", ""},
+		{"exec", "EXEC sp_who", "", CodeNotReadOnly},
+		{"xp_cmdshell", "EXEC xp_cmdshell 'dir'", "", CodeNotReadOnly},
+		{"exec in select", "SELECT 1 FROM orders WHERE 1 = 1 EXECUTE ('DROP TABLE orders')", "", CodeNotReadOnly},
+		{"select into", "SELECT * INTO orders_backup FROM orders", "", CodeNotReadOnly},
+		{"select into temp", "SELECT id INTO #tmp FROM orders", "", CodeNotReadOnly},
+		{"hash is not a comment", "SELECT id FROM #tmp; DROP TABLE orders", "", CodeMultipleStatements},
+		{"openrowset", "SELECT * FROM OPENROWSET('SQLNCLI', 'Server=x;', 'SELECT 1')", "", CodeForbiddenFunction},
+		{"xp function", "SELECT * FROM orders WHERE id = xp_test(1)", "", CodeForbiddenFunction},
+		{"go batch", "SELECT 1 FROM orders\nGO\nSELECT 2 FROM orders", "", CodeMultipleStatements},
+		{"go count", "SELECT 1 FROM orders\n  go 5", "", CodeMultipleStatements},
+		{"semicolon", "SELECT 1; DROP TABLE orders", "", CodeMultipleStatements},
+		{"backslash ends string", `SELECT a FROM t WHERE b = '\' ; EXEC xp_cmdshell 'dir' --'`, "", CodeMultipleStatements},
+		{"backslash ends string before go", "SELECT a FROM t WHERE b = '\\'\nGO\nDROP TABLE t", "", CodeMultipleStatements},
+		{"trailing backslash", `SELECT a FROM t WHERE path = 'C:\'`, "", ""},
+		{"limit", "SELECT id FROM orders LIMIT 10", "", CodeUnsupportedFeature},
+		{"offset fetch on 2008", "SELECT id FROM orders ORDER BY id OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY", "2008", CodeUnsupportedFeature},
+		{"string_agg on 13", "SELECT STRING_AGG(name, ',') FROM customers", "13.0", CodeUnsupportedFeature},
+		{"string_agg on 2017", "SELECT STRING_AGG(name, ',') FROM customers", "2017", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.sql, Database{Type: "mssql", Version: tt.version}).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestMSSQLLimitRows(t *testing.T) {
+	d := mssqlDialect{}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"insert top", "SELECT id FROM orders", "SELECT TOP (100) id FROM orders"},
+		{"distinct", "SELECT DISTINCT name FROM customers", "SELECT DISTINCT TOP (100) name FROM customers"},
+		{"cte main select", "WITH t AS (SELECT id FROM orders) SELECT id FROM t", "WITH t AS (SELECT id FROM orders) SELECT TOP (100) id FROM t"},
+		{"clamp top", "SELECT TOP 5000 id FROM orders", "SELECT TOP 100 id FROM orders"},
+		{"clamp top paren", "SELECT TOP (500) id FROM orders", "SELECT TOP (100) id FROM orders"},
+		{"keep small top", "SELECT TOP (10) id FROM orders", "SELECT TOP (10) id FROM orders"},
+		{"keep percent", "SELECT TOP 50 PERCENT id FROM orders", "SELECT TOP 50 PERCENT id FROM orders"},
+		{"keep offset fetch", "SELECT id FROM orders ORDER BY id OFFSET 0 ROWS FETCH NEXT 500 ROWS ONLY", "SELECT id FROM orders ORDER BY id OFFSET 0 ROWS FETCH NEXT 500 ROWS ONLY"},
+		{"keep union", "SELECT id FROM a UNION ALL SELECT id FROM b", "SELECT id FROM a UNION ALL SELECT id FROM b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.LimitRows(tt.sql, 100); got != tt.want {
+				t.Errorf("LimitRows() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLValidator_LimitRows(t *testing.T) {
+	opts := DefaultValidateOptions()
+	opts.MaxRows = 50
+	v := NewSQLValidatorWithOptions(opts)
+	if got := v.LimitRows("SELECT id FROM orders", Database{Type: "sqlserver"}); got != "SELECT TOP (50) id FROM orders" {
+		t.Errorf("mssql LimitRows = %q", got)
+	}
+	if got := v.LimitRows("SELECT id FROM orders", Database{Type: "mysql"}); got != "SELECT id FROM orders" {
+		t.Errorf("dialect without RowLimiter should be unchanged, got %q", got)
+	}
+	if got := NewSQLValidator().LimitRows("SELECT id FROM orders", Database{Type: "mssql"}); got != "SELECT id FROM orders" {
+		t.Errorf("MaxRows 0 should be unchanged, got %q", got)
+	}
+}
+
+func TestMSSQLDialect(t *testing.T) {
+	d, err := GetDialect("sqlserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.QuoteIdentifier("a]b"); got != "[a]]b]" {
+		t.Errorf("QuoteIdentifier = %s", got)
+	}
+	prompt := d.SystemPrompt(Database{Type: "mssql", Version: "2016"}, Schema{}, false)
+	for _, want := range []string{"TOP (n)", "OFFSET", "DATEADD", "[order]", "STRING_AGG", "LIMIT 子句"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+	if strings.Contains(prompt, "OFFSET ... FETCH 分页") {
+		t.Error("OFFSET FETCH is supported on 2016")
+	}
+}
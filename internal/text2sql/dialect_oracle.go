@@ -0,0 +1,169 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// oracleWriteKeywords DML、DDL、事务控制与 PL/SQL 调用关键字
+var oracleWriteKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "DROP": true, "CREATE": true,
+	"ALTER": true, "TRUNCATE": true, "GRANT": true, "REVOKE": true, "RENAME": true, "FLASHBACK": true,
+	"PURGE": true, "CALL": true, "EXEC": true, "EXECUTE": true, "COMMIT": true, "ROLLBACK": true,
+	"SAVEPOINT": true, "BEGIN": true, "DECLARE": true,
+}
+
+// oracleForbiddenPackages 访问网络、文件或执行任意 SQL / 作业的内置包
+var oracleForbiddenPackages = map[string]bool{
+	"UTL_HTTP": true, "UTL_FILE": true, "UTL_TCP": true, "UTL_SMTP": true, "UTL_MAIL": true, "UTL_INADDR": true,
+	"DBMS_SQL": true, "DBMS_XMLGEN": true, "DBMS_SCHEDULER": true, "DBMS_JOB": true, "DBMS_PIPE": true,
+	"DBMS_LOCK": true, "DBMS_JAVA": true, "HTTPURITYPE": true,
+}
+
+// oracleDialect Oracle Database
+type oracleDialect struct{}
+
+func (oracleDialect) Name() string { return "oracle" }
+
+func (oracleDialect) DisplayName() string { return "Oracle" }
+
+func (oracleDialect) StatementName() string { return "SQL" }
+
+func (d oracleDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	intro := "根据用户提供的数据库表结构和自然语言问题，生成对应的 Oracle SELECT 查询。"
+	output := `第一行是 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	if modify {
+		intro = "用户会提供现有的 SQL 语句和新的需求，你需要在现有 SQL 基础上进行修改。"
+		output = `第一行是修改后的完整 SQL 语句，第二行以"解释："开头是简要说明（可选）`
+	}
+	limit := "限制行数使用 FETCH FIRST n ROWS ONLY，分页使用 OFFSET m ROWS FETCH NEXT n ROWS ONLY"
+	if !versionSupports(database.Version, "12") {
+		limit = "限制行数在子查询外层使用 WHERE ROWNUM <= n（排序需在子查询中完成）"
+	}
+	prompt := fmt.Sprintf(`你是一个 Oracle 专家%s。%s
+
+规则：
+1. 只生成单条 SELECT 查询，不要生成 PL/SQL 块（BEGIN/DECLARE）、DML、DDL，不要使用 FOR UPDATE，语句末尾不要加分号或 /
+2. %s，Oracle 不支持 LIMIT
+3. 空值处理使用 NVL() 或 COALESCE()，日期使用 TO_DATE('2024-01-01', 'YYYY-MM-DD')、TRUNC()、ADD_MONTHS()，当前时间使用 SYSDATE
+4. 不需要表的查询使用 FROM dual，字符串拼接使用 ||
+5. 表别名不要加 AS（如 FROM orders o），列别名可以使用 AS
+6. 不要使用 UTL_HTTP、UTL_FILE、DBMS_SQL 等访问网络、文件或执行动态 SQL 的包
+7. 表名和列名使用 schema 中提供的名称，双引号标识符区分大小写，只在必要时使用，如 %s
+8. 输出格式：%s`, versionNote(database.Version), intro, limit, d.QuoteIdentifier("order"), output)
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		prompt += "\n\n注意：目标 Oracle 版本不支持以下特性，请勿使用：" + strings.Join(unsupported, "、")
+	}
+	return prompt
+}
+
+func (oracleDialect) ExtractOutput(content string) (string, string) {
+	sql, explanation := parseLLMOutput(content)
+	// SQL*Plus 习惯在语句后单独一行写 /
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sql), "\n/")), explanation
+}
+
+func (oracleDialect) Validate(sql string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateOracle(sql, database)
+}
+
+func (oracleDialect) Features() []FeatureVersion {
+	return featureVersions("oracle")
+}
+
+func (oracleDialect) QuoteIdentifier(name string) string {
+	return quoteIdent(name, '"')
+}
+
+// validateOracle 词法级校验：PL/SQL 块与 WITH FUNCTION → 语句结构 → 只读 → 内置包 → 表别名 → 版本特性
+func validateOracle(sql string, database Database) Diagnostics {
+	tokens := tokenizeSQL(sql, sqlStringsOracle)
+	if len(tokens) == 0 {
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "SQL 不能为空")}
+	}
+	if first := tokens[0]; first.is("BEGIN") || first.is("DECLARE") {
+		return Diagnostics{newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 PL/SQL 块").
+			atToken(sql, first).withSuggestion("只生成单条 SELECT 查询")}
+	}
+	// WITH FUNCTION 内含分号，须在多语句检查之前识别
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].is("WITH") && (tokens[i+1].is("FUNCTION") || tokens[i+1].is("PROCEDURE")) {
+			return Diagnostics{newDiagnostic(CodeNotReadOnly, SeverityError, "不允许在 WITH 子句中声明 PL/SQL 函数").
+				atToken(sql, tokens[i]).withSuggestion("改用 SQL 表达式或内置函数")}
+		}
+	}
+	if slash, ok := findSlashTerminator(sql, tokens); ok {
+		return Diagnostics{newDiagnostic(CodeMultipleStatements, SeverityError, "只允许单条 SQL 语句，不能使用 / 分隔").
+			atToken(sql, slash).withSuggestion("删除 / 及其后的语句")}
+	}
+	if d := checkSelectStructure(sql, tokens, "Oracle", oracleWriteKeywords); d != nil {
+		return Diagnostics{d}
+	}
+
+	var diags Diagnostics
+	for i, t := range tokens {
+		if t.kind != tokWord {
+			continue
+		}
+		qualified := (i > 0 && tokens[i-1].isPunct(".")) || (i+1 < len(tokens) && tokens[i+1].isPunct("."))
+		switch {
+		case t.is("FOR") && i+1 < len(tokens) && tokens[i+1].is("UPDATE"):
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "不允许 SELECT ... FOR UPDATE 锁定行").
+				atToken(sql, t).withSuggestion("去掉 FOR UPDATE 子句"))
+		case t.is("UPDATE") && i > 0 && tokens[i-1].is("FOR"):
+		case oracleWriteKeywords[t.upper] && !qualified:
+			diags = append(diags, newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+				atToken(sql, t).withSuggestion("只生成 SELECT 查询，不要包含写操作或 PL/SQL"))
+		case oracleForbiddenPackages[t.upper]:
+			diags = append(diags, newDiagnostic(CodeForbiddenFunction, SeverityError, "不允许使用内置包: %s", t.text).
+				atToken(sql, t).withSuggestion("只查询 schema 中提供的表"))
+		}
+	}
+	diags = append(diags, oracleTableAliasErrors(sql, tokens)...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, checkSQLFeatures("oracle", database.Version, sql, tokens)...)
+	return append(diags, selectStarWarnings(sql, tokens)...)
+}
+
+// oracleTableAliasErrors Oracle 的表别名不能使用 AS（FROM orders AS o 会报 ORA-00933）
+func oracleTableAliasErrors(sql string, tokens []sqlToken) Diagnostics {
+	var diags Diagnostics
+	for i := 0; i+2 < len(tokens); i++ {
+		if !tokens[i].is("FROM") && !tokens[i].is("JOIN") {
+			continue
+		}
+		j := i + 1
+		if tokens[j].kind != tokWord && tokens[j].kind != tokQuotedIdent {
+			continue
+		}
+		for j+2 < len(tokens) && tokens[j+1].isPunct(".") {
+			j += 2
+		}
+		if j+1 < len(tokens) && tokens[j+1].is("AS") {
+			diags = append(diags, newDiagnostic(CodeSyntaxError, SeverityError, "Oracle 的表别名不能使用 AS").
+				atToken(sql, tokens[j+1]).withSuggestion("去掉 AS，直接写 FROM 表名 别名"))
+		}
+	}
+	return diags
+}
+
+// findSlashTerminator 查找独占一行的 /（SQL*Plus 的语句终止符），末尾的单个 / 除外
+func findSlashTerminator(sql string, tokens []sqlToken) (sqlToken, bool) {
+	for i, t := range tokens {
+		if !t.isOp("/") || i == len(tokens)-1 {
+			continue
+		}
+		lineStart := strings.LastIndexByte(sql[:t.pos], '\n') + 1
+		lineEnd := strings.IndexByte(sql[t.pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(sql) - t.pos
+		}
+		if strings.TrimSpace(sql[lineStart:t.pos+lineEnd]) == "/" {
+			return t, true
+		}
+	}
+	return sqlToken{}, false
+}
@@ -0,0 +1,93 @@
+package text2sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateOracle(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name     string
+		sql      string
+		version  string
+		wantCode string
+	}{
+		{"fetch first", "SELECT o.id, NVL(o.note, '-') FROM orders o WHERE o.created_at >= TO_DATE('2024-01-01', 'YYYY-MM-DD') ORDER BY o.id FETCH FIRST 10 ROWS ONLY", "19c", ""},
+		{"rownum", "SELECT * FROM (SELECT id FROM orders ORDER BY amount DESC) WHERE ROWNUM <= 10", "11g", ""},
+		{"dual", "SELECT SYSDATE FROM dual", "", ""},
+		{"column alias as", "SELECT TRUNC(created_at, 'MM') AS month, COUNT(*) AS cnt FROM orders GROUP BY TRUNC(created_at, 'MM')", "", ""},
+		{"trailing slash", "SELECT id FROM orders\n/", "", ""},
+		{"plsql block", "BEGIN DELETE FROM orders; END;", "", CodeNotReadOnly},
+		{"declare block", "DECLARE n NUMBER; BEGIN SELECT 1 INTO n FROM dual; END;", "", CodeNotReadOnly},
+		{"with function", "WITH FUNCTION f RETURN NUMBER IS BEGIN RETURN 1; END; SELECT f() FROM dual", "", CodeNotReadOnly},
+		{"for update", "SELECT id FROM orders WHERE id = 1 FOR UPDATE", "", CodeNotReadOnly},
+		{"execute immediate", "EXECUTE IMMEDIATE 'DROP TABLE orders'", "", CodeNotReadOnly},
+		{"slash separator", "SELECT 1 FROM dual\n/\nSELECT 2 FROM dual", "", CodeMultipleStatements},
+		{"backslash ends string", `SELECT a FROM t WHERE b = '\' ; BEGIN dbms_scheduler.run_job('x'); END; --'`, "", CodeMultipleStatements},
+		{"q quote", `SELECT a FROM t WHERE b = q'[it's]' ; DELETE FROM t --'`, "", CodeMultipleStatements},
+		{"q quote content", `SELECT a FROM t WHERE b = q'{it's; DELETE FROM t}' AND c = Nq'!x'!'`, "", ""},
+		{"utl_http", "SELECT UTL_HTTP.REQUEST('http://example.com') FROM dual", "", CodeForbiddenFunction},
+		{"table alias as", "SELECT o.id FROM orders AS o", "", CodeSyntaxError},
+		{"limit", "SELECT id FROM orders LIMIT 10", "19", CodeUnsupportedFeature},
+		{"fetch first on 11g", "SELECT id FROM orders FETCH FIRST 10 ROWS ONLY", "11g", CodeUnsupportedFeature},
+		{"qualify", "SELECT id FROM orders QUALIFY ROW_NUMBER() OVER (ORDER BY id) = 1", "23", CodeUnsupportedFeature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.sql, Database{Type: "oracle", Version: tt.version}).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestOracleSystemPrompt_Version(t *testing.T) {
+	d, err := GetDialect("oracle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := d.SystemPrompt(Database{Type: "oracle", Version: "11g"}, Schema{}, false)
+	if !strings.Contains(old, "ROWNUM") || !strings.Contains(old, "OFFSET ... FETCH 分页") {
+		t.Errorf("11g prompt should use ROWNUM and list FETCH FIRST as unsupported:\n%s", old)
+	}
+	current := d.SystemPrompt(Database{Type: "oracle", Version: "19c"}, Schema{}, false)
+	if !strings.Contains(current, "FETCH FIRST n ROWS ONLY") || strings.Contains(current, "OFFSET ... FETCH 分页") {
+		t.Errorf("19c prompt should use FETCH FIRST:\n%s", current)
+	}
+}
+
+func TestOracleExtractOutput(t *testing.T) {
+	sql, explanation := oracleDialect{}.ExtractOutput("SELECT id FROM orders\n/\n解释：查询订单")
+	if sql != "SELECT id FROM orders" || explanation != "查询订单" {
+		t.Errorf("ExtractOutput() = %q, %q", sql, explanation)
+	}
+}
+
+func TestValidateOracle_Suggestions(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name    string
+		sql     string
+		version string
+		want    string
+	}{
+		{"fetch first on 11g", "SELECT id FROM orders FETCH FIRST 10 ROWS ONLY", "11g", "ROWNUM"},
+		{"limit", "SELECT id FROM orders LIMIT 10", "19c", "FETCH FIRST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.sql, Database{Type: "oracle", Version: tt.version}).Errors()
+			if len(errs) == 0 || !strings.Contains(errs[0].Suggestion, tt.want) || strings.Contains(errs[0].Suggestion, "TOP") {
+				t.Fatalf("expected an Oracle suggestion mentioning %s, got %v", tt.want, errs)
+			}
+		})
+	}
+}
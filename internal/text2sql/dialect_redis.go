@@ -0,0 +1,39 @@
+package text2sql
+
+import "strings"
+
+// redisDialect Redis 只读命令
+type redisDialect struct{}
+
+func (redisDialect) Name() string { return "redis" }
+
+func (redisDialect) DisplayName() string { return "Redis" }
+
+func (redisDialect) StatementName() string { return "Redis 命令" }
+
+func (redisDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	if modify {
+		return buildSystemPromptForModifyRedis(database, schema)
+	}
+	return buildSystemPromptRedis(database, schema)
+}
+
+func (redisDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutputRedis(content)
+}
+
+func (redisDialect) Validate(commands string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return validateRedis(commands, database, schema.Keys, DialectOptions(opts, "redis", DefaultRedisLimits()))
+}
+
+// Features 命令与选项的版本要求由命令目录维护
+func (redisDialect) Features() []FeatureVersion { return nil }
+
+// QuoteIdentifier 按 redis-cli 规则为包含空白或引号的 key 加双引号
+func (redisDialect) QuoteIdentifier(name string) string {
+	if name != "" && !strings.ContainsAny(name, " \t\r\n\"'\\") {
+		return name
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(name) + `"`
+}
@@ -0,0 +1,104 @@
+package text2sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlDialect 关系型数据库方言（MySQL、PostgreSQL、SQLite）
+type sqlDialect struct {
+	name   string
+	strict bool // sqlparser 可完整解析时为 true：仅在使用了扩展语法时才退化为词法级校验
+	quote  byte // 标识符引号
+	// literals 字符串字面量的转义规则
+	literals sqlStringStyle
+}
+
+func (d *sqlDialect) Name() string { return d.name }
+
+func (d *sqlDialect) DisplayName() string { return dialectDisplayNames[d.name] }
+
+func (d *sqlDialect) StatementName() string { return "SQL" }
+
+func (d *sqlDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	prompt := buildSystemPrompt(d.name, database.Version)
+	if modify {
+		prompt = buildSystemPromptForModify(d.name, database.Version)
+	}
+	notes := []string{fmt.Sprintf("标识符包含特殊字符或与关键字冲突时使用 %s 引用", d.QuoteIdentifier("order"))}
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		notes = append(notes, "目标数据库不支持以下特性，请勿使用："+strings.Join(unsupported, "、"))
+	}
+	return prompt + "\n\n注意：\n- " + strings.Join(notes, "\n- ")
+}
+
+// LocalizedSystemPrompt 提供英文提示词，其他语言使用 SystemPrompt
+func (d *sqlDialect) LocalizedSystemPrompt(language string, database Database, schema Schema, modify bool) (string, bool) {
+	if language != LanguageEnglish {
+		return "", false
+	}
+	prompt := buildSystemPromptEnglish(d.name, database.Version)
+	if modify {
+		prompt = buildSystemPromptForModifyEnglish(d.name, database.Version)
+	}
+	notes := []string{fmt.Sprintf("Quote identifiers that contain special characters or clash with keywords, e.g. %s", d.QuoteIdentifier("order"))}
+	if unsupported := unsupportedFeatures(d, database.Version); len(unsupported) > 0 {
+		notes = append(notes, "The target database does not support the following features, do not use them: "+strings.Join(unsupported, ", "))
+	}
+	return prompt + "\n\nNotes:\n- " + strings.Join(notes, "\n- "), true
+}
+
+// buildSystemPromptEnglish 英文 system prompt
+func buildSystemPromptEnglish(dbType, version string) string {
+	v := ""
+	if version != "" {
+		v = fmt.Sprintf(" (version %s)", version)
+	}
+	return fmt.Sprintf(`You are an expert SQL developer. Given the database schema and a question in natural language, write the corresponding %s%s SQL query.
+
+Rules:
+1. Only generate SELECT queries; never generate INSERT/UPDATE/DELETE/DROP or other modifying statements
+2. The SQL must follow %s syntax
+3. Use the table and column names exactly as given in the schema
+4. Output format: the SQL statement first, then a line starting with "Explanation:" with a short explanation in English (optional)`, dbType, v, dbType)
+}
+
+// buildSystemPromptForModifyEnglish 英文追加修改模式的 system prompt
+func buildSystemPromptForModifyEnglish(dbType, version string) string {
+	v := ""
+	if version != "" {
+		v = fmt.Sprintf(" (version %s)", version)
+	}
+	return fmt.Sprintf(`You are an expert SQL developer. The user provides an existing SQL query and a new requirement; modify the existing query accordingly.
+
+Rules:
+1. Understand the intent of the existing query
+2. Add or change conditions on top of the existing query according to the new requirement
+3. Keep the query complete and correct
+4. Only generate SELECT queries; never generate INSERT/UPDATE/DELETE/DROP or other modifying statements
+5. The SQL must follow %s%s syntax
+6. Use the table and column names exactly as given in the schema
+7. Output format: the complete modified SQL statement first, then a line starting with "Explanation:" with a short explanation in English (optional)`, dbType, v)
+}
+
+func (d *sqlDialect) ExtractOutput(content string) (string, string) {
+	return parseLLMOutput(content)
+}
+
+func (d *sqlDialect) Validate(sql string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	return diagnoseSQL(sql, d.name, database.Version, d.strict, d.literals)
+}
+
+func (d *sqlDialect) Features() []FeatureVersion {
+	return featureVersions(d.name)
+}
+
+func (d *sqlDialect) QuoteIdentifier(name string) string {
+	return quoteIdent(name, d.quote)
+}
+
+// quoteIdent 用指定引号包围标识符，内部的引号加倍转义
+func quoteIdent(name string, quote byte) string {
+	q := string(quote)
+	return q + strings.ReplaceAll(name, q, q+q) + q
+}
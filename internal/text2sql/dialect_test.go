@@ -0,0 +1,139 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"text2sql/internal/llm"
+)
+
+// upperDialect 测试用方言：只接受以 FIND（或配置的前缀）开头的语句
+type upperDialect struct{}
+
+func (upperDialect) Name() string          { return "testql" }
+func (upperDialect) DisplayName() string   { return "TestQL" }
+func (upperDialect) StatementName() string { return "TestQL 语句" }
+func (upperDialect) SystemPrompt(database Database, schema Schema, modify bool) string {
+	return "生成 TestQL"
+}
+func (upperDialect) ExtractOutput(content string) (string, string) {
+	stmt, explanation, _ := strings.Cut(content, "\n")
+	return stmt, explanation
+}
+func (upperDialect) Validate(stmt string, database Database, schema Schema, opts ValidateOptions) Diagnostics {
+	if prefix := DialectOptions(opts, "testql", "FIND "); !strings.HasPrefix(stmt, prefix) {
+		return Diagnostics{newDiagnostic(CodeSyntaxError, SeverityError, "必须以 %s开头", prefix)}
+	}
+	return nil
+}
+func (upperDialect) Features() []FeatureVersion         { return nil }
+func (upperDialect) QuoteIdentifier(name string) string { return "<" + name + ">" }
+
+type recordingProvider struct {
+	content  string
+	err      error
+	requests []*llm.CompleteRequest
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm.CompleteResponse, error) {
+	p.requests = append(p.requests, req)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &llm.CompleteResponse{Content: p.content}, nil
+}
+
+func TestRegisterDialect_ThirdParty(t *testing.T) {
+	RegisterDialect(upperDialect{}, "test-ql")
+	t.Cleanup(func() { UnregisterDialect("testql") })
+
+	d, err := GetDialect("TEST-QL")
+	if err != nil || d.Name() != "testql" {
+		t.Fatalf("expected alias to resolve to testql, got %v, %v", d, err)
+	}
+
+	provider := &recordingProvider{content: "FIND users\n查询用户"}
+	svc := NewService(provider, NewSQLValidator(), 2)
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}},
+		Database: Database{Type: "testql"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.SQL != "FIND users" || resp.Explanation != "查询用户" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if got := provider.requests[0].Messages[0].Content; got != "生成 TestQL" {
+		t.Errorf("expected dialect system prompt, got %q", got)
+	}
+
+	if errs := NewSQLValidator().Diagnose("SELECT 1", Database{Type: "testql"}).Errors(); len(errs) == 0 {
+		t.Error("expected validation to be delegated to the dialect")
+	}
+	v := NewSQLValidatorWithOptions(DefaultValidateOptions().WithDialect("testql", "SEEK "))
+	if errs := v.Diagnose("SEEK users", Database{Type: "test-ql"}).Errors(); len(errs) > 0 {
+		t.Errorf("expected the dialect to use its own options, got %v", errs)
+	}
+}
+
+func TestUnregisterDialect(t *testing.T) {
+	RegisterDialect(upperDialect{}, "test-ql")
+	UnregisterDialect("TestQL")
+	for _, name := range []string{"testql", "test-ql"} {
+		if _, err := GetDialect(name); !errors.Is(err, ErrUnsupportedDatabase) {
+			t.Errorf("expected %s to be unregistered, got %v", name, err)
+		}
+	}
+}
+
+func TestGetDialect(t *testing.T) {
+	for _, name := range []string{"mysql", "postgresql", "postgres", "sqlite", "redis"} {
+		if _, err := GetDialect(name); err != nil {
+			t.Errorf("expected built-in dialect %s, got %v", name, err)
+		}
+	}
+	if _, err := GetDialect("oracle9"); !errors.Is(err, ErrUnsupportedDatabase) {
+		t.Errorf("expected ErrUnsupportedDatabase, got %v", err)
+	}
+
+	svc := NewService(&recordingProvider{}, NewSQLValidator(), 1)
+	_, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}},
+		Database: Database{Type: "oracle9"},
+	})
+	if !errors.Is(err, ErrUnsupportedDatabase) {
+		t.Errorf("expected ErrUnsupportedDatabase from Generate, got %v", err)
+	}
+}
+
+func TestSQLDialect(t *testing.T) {
+	mysql, _ := GetDialect("mysql")
+	pg, _ := GetDialect("postgresql")
+	redis, _ := GetDialect("redis")
+
+	if got := mysql.QuoteIdentifier("or`der"); got != "`or``der`" {
+		t.Errorf("mysql quoting: got %s", got)
+	}
+	if got := pg.QuoteIdentifier(`a"b`); got != `"a""b"` {
+		t.Errorf("postgresql quoting: got %s", got)
+	}
+	if got := redis.QuoteIdentifier("user 1"); got != `"user 1"` {
+		t.Errorf("redis quoting: got %s", got)
+	}
+
+	prompt := mysql.SystemPrompt(Database{Type: "mysql", Version: "5.7"}, Schema{}, false)
+	if !strings.Contains(prompt, "CTE（WITH 子句）") || !strings.Contains(prompt, "窗口函数") {
+		t.Error("expected MySQL 5.7 prompt to list unsupported CTE and window functions")
+	}
+	prompt = mysql.SystemPrompt(Database{Type: "mysql", Version: "8.0"}, Schema{}, true)
+	if strings.Contains(prompt, "CTE（WITH 子句）") {
+		t.Error("MySQL 8.0 supports CTE and should not list it as unsupported")
+	}
+}
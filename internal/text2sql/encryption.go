@@ -0,0 +1,190 @@
+package text2sql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EncryptionKeySize 主密钥长度（AES-256）
+const EncryptionKeySize = 32
+
+// dataKeyAAD 包装数据密钥时的附加数据，避免把其他用途的密文当作数据密钥解开
+var dataKeyAAD = []byte("text2sql-data-key")
+
+// Keyring 信封加密的主密钥集合。每个会话使用随机生成的数据密钥加密，数据密钥由主密钥包装后与主密钥 ID 一起保存在会话行中；
+// 轮换时新增主密钥并设为 active，旧主密钥保留到离线重新加密完成
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring 创建主密钥集合。active 为加密新会话使用的主密钥 ID，为空时新会话不加密，已加密的会话仍可读取
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{active: active, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("加密密钥 ID 不能为空")
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("加密密钥 %s: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[active]; active != "" && !ok {
+		return nil, fmt.Errorf("active 加密密钥 %s 不存在", active)
+	}
+	return k, nil
+}
+
+// ActiveKeyID 加密新会话使用的主密钥 ID，为空表示新会话不加密
+func (k *Keyring) ActiveKeyID() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// ParseEncryptionKey 解析 base64 编码的 32 字节主密钥，可用 openssl rand -base64 32 生成
+func ParseEncryptionKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("加密密钥不是有效的 base64: %w", err)
+	}
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("加密密钥须为 %d 字节，当前为 %d 字节", EncryptionKeySize, len(key))
+	}
+	return key, nil
+}
+
+// ReadEncryptionKeyFile 读取主密钥文件，内容为 32 字节原始密钥或其 base64 编码
+func ReadEncryptionKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取加密密钥文件: %w", err)
+	}
+	if len(b) == EncryptionKeySize {
+		return b, nil
+	}
+	return ParseEncryptionKey(string(b))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("须为 %d 字节，当前为 %d 字节", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newDataKey 为新会话生成数据密钥并用 active 主密钥包装，未设置 active 时返回 nil（不加密）
+func (k *Keyring) newDataKey() (keyID, wrapped string, c *fieldCipher, err error) {
+	if k.ActiveKeyID() == "" {
+		return "", "", nil, nil
+	}
+	dek := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", "", nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return k.active, sealString(k.keys[k.active], dek, dataKeyAAD), &fieldCipher{aead: aead}, nil
+}
+
+// openDataKey 解开会话行中保存的数据密钥，keyID 为空表示该会话未加密
+func (k *Keyring) openDataKey(keyID, wrapped string) (*fieldCipher, error) {
+	if keyID == "" {
+		return nil, nil
+	}
+	if k == nil {
+		return nil, fmt.Errorf("会话已加密（密钥 %s），但未配置加密密钥", keyID)
+	}
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("会话已加密，但缺少加密密钥 %s", keyID)
+	}
+	dek, err := openString(kek, wrapped, dataKeyAAD)
+	if err != nil {
+		return nil, fmt.Errorf("解开数据密钥（密钥 %s）: %w", keyID, err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldCipher{aead: aead}, nil
+}
+
+// fieldCipher 用会话的数据密钥加解密字段，nil 表示会话未加密，原样读写。
+// 字段名作为附加数据，防止密文在字段之间互换；密文不绑定会话 ID，分叉时可直接复制
+type fieldCipher struct {
+	aead cipher.AEAD
+}
+
+func (c *fieldCipher) encrypt(field, plaintext string) string {
+	if c == nil || plaintext == "" {
+		return plaintext
+	}
+	return sealString(c.aead, []byte(plaintext), []byte(field))
+}
+
+func (c *fieldCipher) decrypt(field, ciphertext string) (string, error) {
+	if c == nil || ciphertext == "" {
+		return ciphertext, nil
+	}
+	b, err := openString(c.aead, ciphertext, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("解密 %s: %w", field, err)
+	}
+	return string(b), nil
+}
+
+// encryptTurn 加密一轮对话的 query、sql 和 explanation
+func (c *fieldCipher) encryptTurn(query, sql, explanation string) (string, string, string) {
+	return c.encrypt("query", query), c.encrypt("sql", sql), c.encrypt("explanation", explanation)
+}
+
+// decryptTurn 解密 encryptTurn 的结果
+func (c *fieldCipher) decryptTurn(query, sql, explanation string) (string, string, string, error) {
+	var err error
+	if query, err = c.decrypt("query", query); err != nil {
+		return "", "", "", err
+	}
+	if sql, err = c.decrypt("sql", sql); err != nil {
+		return "", "", "", err
+	}
+	if explanation, err = c.decrypt("explanation", explanation); err != nil {
+		return "", "", "", err
+	}
+	return query, sql, explanation, nil
+}
+
+// sealString 加密并编码为 base64(nonce || 密文)
+func sealString(aead cipher.AEAD, plaintext, aad []byte) string {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("生成随机数失败: %v", err))
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, aad))
+}
+
+func openString(aead cipher.AEAD, encoded string, aad []byte) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("密文长度无效")
+	}
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], aad)
+}
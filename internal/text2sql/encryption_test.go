@@ -0,0 +1,167 @@
+package text2sql
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestKeyring 创建测试用主密钥集合，每个 ID 的密钥由 ID 派生
+func newTestKeyring(t *testing.T, active string, ids ...string) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), EncryptionKeySize)
+	}
+	keyring, err := NewKeyring(active, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, EncryptionKeySize)
+	encoded := base64.StdEncoding.EncodeToString(key)
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"valid", encoded, false},
+		{"trailing newline", encoded + "\n", false},
+		{"not base64", "not-base64!", true},
+		{"too short", base64.StdEncoding.EncodeToString(key[:16]), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEncryptionKey(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEncryptionKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, key) {
+				t.Errorf("key = %x", got)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{"raw": key, "base64": []byte(encoded + "\n")} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ReadEncryptionKeyFile(path); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("%s key file = %x, err %v", name, got, err)
+		}
+	}
+
+	if _, err := NewKeyring("k2", map[string][]byte{"k1": key}); err == nil {
+		t.Error("expected error for missing active key")
+	}
+	if _, err := NewKeyring("k1", map[string][]byte{"k1": key[:16]}); err == nil {
+		t.Error("expected error for short key")
+	}
+}
+
+func TestSQLiteContextStore_Encryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "context.db")
+	openStore := func(keyring *Keyring) *SQLiteContextStore {
+		store, err := NewSQLiteContextStoreWithOptions(path, SQLiteStoreOptions{Keyring: keyring})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	newConversation := func() *ConversationContext {
+		return &ConversationContext{
+			ConversationID: generateConversationID(),
+			Schema:         Schema{Tables: []Table{{Name: "salaries", Columns: []Column{{Name: "amount", Type: "int", Comment: "机密薪资表"}}}}},
+			Database:       Database{Type: "mysql", Version: "8.0"},
+			Summary:        "此前查询了薪资",
+			History:        []ConversationTurn{{Query: "查询薪资", SQL: "SELECT amount FROM salaries", Explanation: "返回薪资", Timestamp: time.Now()}},
+			CreatedAt:      time.Now(),
+		}
+	}
+	plaintextIn := func(store *SQLiteContextStore, id string) bool {
+		var schemaJSON, summary, query, sqlStr, expl string
+		if err := store.db.QueryRow(`
+			SELECT c.schema_json, c.summary, t.query, t.sql, t.explanation
+			FROM conversations c JOIN conversation_turns t ON t.conversation_id = c.id WHERE c.id = ?
+		`, id).Scan(&schemaJSON, &summary, &query, &sqlStr, &expl); err != nil {
+			t.Fatal(err)
+		}
+		raw := strings.Join([]string{schemaJSON, summary, query, sqlStr, expl}, "\n")
+		return strings.Contains(raw, "机密薪资表") || strings.Contains(raw, "薪资") || strings.Contains(raw, "salaries")
+	}
+
+	// 未加密时写入的会话
+	plain := newConversation()
+	if err := openStore(nil).Save(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	// 开启加密后，新会话加密存储，旧会话仍可读取
+	store := openStore(newTestKeyring(t, "k1", "k1"))
+	encrypted := newConversation()
+	if err := store.Save(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if plaintextIn(store, encrypted.ConversationID) {
+		t.Error("encrypted conversation stored in plaintext")
+	}
+	if !plaintextIn(store, plain.ConversationID) {
+		t.Error("existing conversation should stay plaintext until reencrypted")
+	}
+	encrypted.History = append(encrypted.History, ConversationTurn{Query: "按部门汇总", SQL: "SELECT 1", Timestamp: time.Now()})
+	if err := store.Save(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(encrypted.ConversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Schema.Tables[0].Columns[0].Comment != "机密薪资表" || got.Summary != encrypted.Summary || len(got.History) != 2 || got.History[1].Query != "按部门汇总" {
+		t.Errorf("decrypted conversation = %+v", got)
+	}
+	fork, err := store.Fork(encrypted.ConversationID, generateConversationID(), "", 1)
+	if err != nil || fork.History[0].SQL != "SELECT amount FROM salaries" {
+		t.Errorf("fork = %+v, err %v", fork, err)
+	}
+
+	// 没有对应密钥时无法读取
+	if _, err := openStore(nil).Get(encrypted.ConversationID); err == nil {
+		t.Error("expected error reading encrypted conversation without keyring")
+	}
+
+	// 轮换：k2 设为 active 后重新加密，之后去掉 k1 仍可读取所有会话
+	rotated := openStore(newTestKeyring(t, "k2", "k1", "k2"))
+	n, err := rotated.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("reencrypted %d conversations, want 3", n)
+	}
+	if n, err := rotated.Reencrypt(); err != nil || n != 0 {
+		t.Errorf("second Reencrypt = %d, %v, want 0", n, err)
+	}
+	if plaintextIn(rotated, plain.ConversationID) {
+		t.Error("plaintext conversation should be encrypted by Reencrypt")
+	}
+	final := openStore(newTestKeyring(t, "k2", "k2"))
+	for _, id := range []string{plain.ConversationID, encrypted.ConversationID, fork.ConversationID} {
+		conv, err := final.Get(id)
+		if err != nil {
+			t.Fatalf("Get %s after rotation: %v", id, err)
+		}
+		if conv.Schema.Tables[0].Columns[0].Comment != "机密薪资表" || conv.History[0].Explanation != "返回薪资" {
+			t.Errorf("conversation %s after rotation = %+v", id, conv)
+		}
+	}
+}
@@ -9,5 +9,12 @@ var (
 	ErrDatabaseMismatch     = errors.New("DATABASE_MISMATCH")
 	ErrSchemaRequired       = errors.New("SCHEMA_REQUIRED")
 	ErrDatabaseRequired     = errors.New("DATABASE_REQUIRED")
+	ErrUnsupportedDatabase  = errors.New("UNSUPPORTED_DATABASE")
 	ErrLLMError             = errors.New("LLM_ERROR")
+
+	ErrInvalidConversationUpdate = errors.New("INVALID_CONVERSATION_UPDATE")
+	ErrInvalidTurn               = errors.New("INVALID_TURN")
+	ErrTurnLimitExceeded         = errors.New("TURN_LIMIT_EXCEEDED")
+	ErrConversationLimitExceeded = errors.New("CONVERSATION_LIMIT_EXCEEDED")
+	ErrForbidden                 = errors.New("FORBIDDEN")
 )
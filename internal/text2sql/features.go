@@ -0,0 +1,497 @@
+package text2sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dbVersion 数据库版本号（major.minor.patch）
+type dbVersion [3]int
+
+// parseDBVersion 解析版本号，兼容 "8"、"8.0.32"、"v14.2"、"5.7.33-log"、"PostgreSQL 15.4" 等写法。
+// 无法识别时返回 false，此时不做版本相关校验。
+func parseDBVersion(s string) (dbVersion, bool) {
+	var v dbVersion
+	start := strings.IndexAny(s, "0123456789")
+	if start < 0 {
+		return v, false
+	}
+	s = s[start:]
+	for i := 0; i < len(v); i++ {
+		end := 0
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, err := strconv.Atoi(s[:end])
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+		s = s[end:]
+		if len(s) < 2 || s[0] != '.' || !isDigit(s[1]) {
+			break
+		}
+		s = s[1:]
+	}
+	return v, true
+}
+
+// less 判断 v 是否低于 other
+func (v dbVersion) less(other dbVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+// versionSupports 版本是否不低于 since；任一版本无法识别时视为支持
+func versionSupports(version, since string) bool {
+	current, ok := parseDBVersion(version)
+	if !ok || since == "" {
+		return true
+	}
+	required, ok := parseDBVersion(since)
+	return !ok || !current.less(required)
+}
+
+// sqlFeature 需要特定数据库版本才支持的 SQL 特性
+type sqlFeature struct {
+	Name       string
+	Suggestion string                                   // 不支持时给出的改写建议
+	detect     func(tokens []sqlToken) (sqlToken, bool) // 返回首次出现的位置
+}
+
+// featureSupport 某方言对特性的支持情况，Since 为空表示该方言不支持
+type featureSupport struct {
+	Feature    *sqlFeature
+	Since      string
+	Suggestion string // 该方言专属的改写建议，为空时使用 Feature.Suggestion
+}
+
+// suggestion 不支持时反馈给 LLM 的改写建议
+func (fs featureSupport) suggestion() string {
+	if fs.Suggestion != "" {
+		return fs.Suggestion
+	}
+	return fs.Feature.Suggestion
+}
+
+var (
+	featureCTE = &sqlFeature{Name: "CTE（WITH 子句）", Suggestion: "改用子查询（派生表）", detect: detectCTE}
+
+	featureRecursiveCTE = &sqlFeature{Name: "递归 CTE（WITH RECURSIVE）", Suggestion: "改用多次查询或在应用层展开层级关系", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findSequence(tokens, "WITH", "RECURSIVE")
+	}}
+
+	featureMaterializedCTE = &sqlFeature{Name: "CTE 物化提示（AS [NOT] MATERIALIZED）", Suggestion: "去掉 MATERIALIZED / NOT MATERIALIZED 提示", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if t, ok := findSequence(tokens, "AS", "MATERIALIZED"); ok {
+			return t, true
+		}
+		return findSequence(tokens, "AS", "NOT", "MATERIALIZED")
+	}}
+
+	featureWindow = &sqlFeature{Name: "窗口函数（OVER / WINDOW）", Suggestion: "改用关联子查询或 GROUP BY 实现排名与累计", detect: detectWindow}
+
+	featureFilter = &sqlFeature{Name: "聚合 FILTER 子句", Suggestion: "改用 SUM(CASE WHEN ... THEN 1 ELSE 0 END) 等条件聚合", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		for i := 0; i+2 < len(tokens); i++ {
+			if tokens[i].is("FILTER") && tokens[i+1].isPunct("(") && tokens[i+2].is("WHERE") {
+				return tokens[i], true
+			}
+		}
+		return sqlToken{}, false
+	}}
+
+	featureGroupsFrame = &sqlFeature{Name: "GROUPS 窗口帧", Suggestion: "改用 ROWS 或 RANGE 窗口帧", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		for i := 0; i+1 < len(tokens); i++ {
+			if !tokens[i].is("GROUPS") {
+				continue
+			}
+			next := tokens[i+1]
+			if next.is("BETWEEN") || next.is("UNBOUNDED") || next.is("CURRENT") || next.kind == tokNumber {
+				return tokens[i], true
+			}
+		}
+		return sqlToken{}, false
+	}}
+
+	featureReturning = &sqlFeature{Name: "RETURNING 子句", Suggestion: "只生成 SELECT 查询", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findKeyword(tokens, "RETURNING")
+	}}
+
+	featureLateral = &sqlFeature{Name: "LATERAL 派生表", Suggestion: "改用关联子查询", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findKeyword(tokens, "LATERAL")
+	}}
+
+	featureNullsOrdering = &sqlFeature{Name: "NULLS FIRST / NULLS LAST 排序", Suggestion: "改用 ORDER BY col IS NULL, col 模拟空值排序", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if t, ok := findSequence(tokens, "NULLS", "FIRST"); ok {
+			return t, true
+		}
+		return findSequence(tokens, "NULLS", "LAST")
+	}}
+
+	featureRightFullJoin = &sqlFeature{Name: "RIGHT / FULL OUTER JOIN", Suggestion: "调换表顺序改用 LEFT JOIN，或用 LEFT JOIN 与 UNION 组合", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		for i := 0; i+1 < len(tokens); i++ {
+			if !tokens[i].is("RIGHT") && !tokens[i].is("FULL") {
+				continue
+			}
+			if tokens[i+1].is("JOIN") || tokens[i+1].is("OUTER") {
+				return tokens[i], true
+			}
+		}
+		return sqlToken{}, false
+	}}
+
+	featureFullOuterJoin = &sqlFeature{Name: "FULL OUTER JOIN", Suggestion: "改用 LEFT JOIN 与 RIGHT JOIN 的 UNION", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if t, ok := findSequence(tokens, "FULL", "JOIN"); ok {
+			return t, true
+		}
+		return findSequence(tokens, "FULL", "OUTER")
+	}}
+
+	featureJSONExtract = &sqlFeature{Name: "JSON 取值运算符 ->", Suggestion: "改用 JSON_EXTRACT() 等 JSON 函数", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findOperator(tokens, "->")
+	}}
+
+	featureJSONUnquote = &sqlFeature{Name: "JSON 取值运算符 ->>", Suggestion: "改用 JSON_UNQUOTE(JSON_EXTRACT()) 等 JSON 函数", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findOperator(tokens, "->>")
+	}}
+
+	featureJSONPath = &sqlFeature{Name: "JSON 路径运算符 #> / #>>", Suggestion: "改用 JSON 函数按路径取值", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findOperator(tokens, "#>", "#>>")
+	}}
+
+	featureJSONB = &sqlFeature{Name: "jsonb 运算符 @> / <@ / ?| / ?& / #-", Suggestion: "改用 JSON 函数比较", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findOperator(tokens, "@>", "<@", "?|", "?&", "#-")
+	}}
+
+	featureFetchWithTies = &sqlFeature{Name: "FETCH ... WITH TIES", Suggestion: "改用 RANK() 窗口函数或子查询实现并列取值", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findSequence(tokens, "WITH", "TIES")
+	}}
+
+	featureOffsetFetch = &sqlFeature{Name: "OFFSET ... FETCH 分页", Suggestion: "改用 TOP 或 ROW_NUMBER() 子查询分页", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if t, ok := findSequence(tokens, "FETCH", "NEXT"); ok {
+			return t, true
+		}
+		return findSequence(tokens, "FETCH", "FIRST")
+	}}
+
+	featureLimit = &sqlFeature{Name: "LIMIT 子句", Suggestion: "改用 SELECT TOP (n) 或 OFFSET ... FETCH NEXT n ROWS ONLY", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findKeyword(tokens, "LIMIT")
+	}}
+
+	featureStringAgg = &sqlFeature{Name: "STRING_AGG 字符串聚合", Suggestion: "改用 FOR XML PATH 拼接字符串", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findFunction(tokens, "STRING_AGG")
+	}}
+
+	featureQualify = &sqlFeature{Name: "QUALIFY 子句", Suggestion: "在子查询中计算窗口函数，再在外层 WHERE 中过滤", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findKeyword(tokens, "QUALIFY")
+	}}
+
+	featurePivot = &sqlFeature{Name: "PIVOT / UNPIVOT", Suggestion: "改用 CASE WHEN 条件聚合实现行列转换", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if t, ok := findKeyword(tokens, "PIVOT"); ok {
+			return t, true
+		}
+		return findKeyword(tokens, "UNPIVOT")
+	}}
+
+	featureGroupByAll = &sqlFeature{Name: "GROUP BY ALL", Suggestion: "显式列出分组列", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findSequence(tokens, "GROUP", "BY", "ALL")
+	}}
+
+	featureFromFirst = &sqlFeature{Name: "以 FROM 开头的查询", Suggestion: "改用 SELECT ... FROM ... 的标准写法", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		if len(tokens) > 0 && tokens[0].is("FROM") {
+			return tokens[0], true
+		}
+		return sqlToken{}, false
+	}}
+
+	featureGreatestLeast = &sqlFeature{Name: "GREATEST / LEAST 函数", Suggestion: "改用 CASE WHEN 比较取最大或最小值", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findFunction(tokens, "GREATEST", "LEAST")
+	}}
+
+	featureCallSubquery = &sqlFeature{Name: "CALL { } 子查询", Suggestion: "改用 WITH 串联多段 MATCH", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findBraceSubquery(tokens, "CALL")
+	}}
+
+	featureExistsSubquery = &sqlFeature{Name: "EXISTS { } 子查询", Suggestion: "改用模式谓词，如 WHERE (n)-[:REL]->()", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findBraceSubquery(tokens, "EXISTS")
+	}}
+
+	featureCountSubquery = &sqlFeature{Name: "COUNT { } 子查询", Suggestion: "改用 size([(n)-[:REL]->(m) | m]) 或 OPTIONAL MATCH 后 count()", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findBraceSubquery(tokens, "COUNT")
+	}}
+
+	featureCollectSubquery = &sqlFeature{Name: "COLLECT { } 子查询", Suggestion: "改用模式推导式或 OPTIONAL MATCH 后 collect()", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findBraceSubquery(tokens, "COLLECT")
+	}}
+
+	featureQuantifiedPath = &sqlFeature{Name: "量化路径模式 ((a)-[]->(b)){m,n}", Suggestion: "改用变长关系，如 [:REL*1..3]", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		for i := 0; i+2 < len(tokens); i++ {
+			if tokens[i].isPunct(")") && tokens[i+1].isPunct("{") && (tokens[i+2].kind == tokNumber || tokens[i+2].isPunct(",")) {
+				return tokens[i+1], true
+			}
+		}
+		return sqlToken{}, false
+	}}
+
+	featureElementID = &sqlFeature{Name: "elementId() 函数", Suggestion: "改用 id()", detect: func(tokens []sqlToken) (sqlToken, bool) {
+		return findFunction(tokens, "ELEMENTID")
+	}}
+)
+
+// sqlFeatureMatrix 各 SQL 方言的特性版本矩阵
+var sqlFeatureMatrix = map[string][]featureSupport{
+	"mysql": {
+		{Feature: featureCTE, Since: "8.0"},
+		{Feature: featureRecursiveCTE, Since: "8.0"},
+		{Feature: featureWindow, Since: "8.0"},
+		{Feature: featureLateral, Since: "8.0.14"},
+		{Feature: featureJSONExtract, Since: "5.7.9"},
+		{Feature: featureJSONUnquote, Since: "5.7.13"},
+		{Feature: featureMaterializedCTE},
+		{Feature: featureFilter},
+		{Feature: featureGroupsFrame},
+		{Feature: featureReturning},
+		{Feature: featureNullsOrdering},
+		{Feature: featureJSONPath},
+		{Feature: featureJSONB},
+		{Feature: featureFetchWithTies},
+		{Feature: featureFullOuterJoin},
+	},
+	"postgresql": {
+		{Feature: featureCTE, Since: "8.4"},
+		{Feature: featureRecursiveCTE, Since: "8.4"},
+		{Feature: featureWindow, Since: "8.4"},
+		{Feature: featureReturning, Since: "8.2"},
+		{Feature: featureLateral, Since: "9.3"},
+		{Feature: featureJSONExtract, Since: "9.3", Suggestion: "PostgreSQL 9.3 之前没有 JSON 运算符和函数，只能按文本比较 JSON 列或由应用层解析"},
+		{Feature: featureJSONUnquote, Since: "9.3", Suggestion: "PostgreSQL 9.3 之前没有 JSON 运算符和函数，只能按文本比较 JSON 列或由应用层解析"},
+		{Feature: featureJSONPath, Since: "9.3"},
+		{Feature: featureFilter, Since: "9.4"},
+		{Feature: featureJSONB, Since: "9.4"},
+		{Feature: featureGroupsFrame, Since: "11"},
+		{Feature: featureMaterializedCTE, Since: "12"},
+		{Feature: featureFetchWithTies, Since: "13"},
+	},
+	"sqlite": {
+		{Feature: featureCTE, Since: "3.8.3"},
+		{Feature: featureRecursiveCTE, Since: "3.8.3"},
+		{Feature: featureWindow, Since: "3.25.0"},
+		{Feature: featureGroupsFrame, Since: "3.28.0"},
+		{Feature: featureFilter, Since: "3.30.0"},
+		{Feature: featureNullsOrdering, Since: "3.30.0"},
+		{Feature: featureReturning, Since: "3.35.0"},
+		{Feature: featureMaterializedCTE, Since: "3.35.0"},
+		{Feature: featureJSONExtract, Since: "3.38.0", Suggestion: "改用 json_extract() 函数"},
+		{Feature: featureJSONUnquote, Since: "3.38.0", Suggestion: "改用 json_extract() 函数，文本值按 SQL 值返回"},
+		{Feature: featureRightFullJoin, Since: "3.39.0"},
+		{Feature: featureLateral},
+		{Feature: featureJSONPath},
+		{Feature: featureJSONB},
+		{Feature: featureFetchWithTies},
+	},
+	// SQL Server 按主版本号记录（11 为 2012，14 为 2017，16 为 2022），@> / #> 与变量、临时表写法冲突，不参与检测
+	"mssql": {
+		{Feature: featureOffsetFetch, Since: "11"},
+		{Feature: featureStringAgg, Since: "14"},
+		{Feature: featureGreatestLeast, Since: "16"},
+		{Feature: featureLimit},
+		{Feature: featureFilter},
+		{Feature: featureGroupsFrame},
+		{Feature: featureReturning},
+		{Feature: featureLateral},
+		{Feature: featureNullsOrdering},
+		{Feature: featureJSONExtract, Suggestion: "改用 JSON_VALUE() / JSON_QUERY() 取值"},
+		{Feature: featureJSONUnquote, Suggestion: "改用 JSON_VALUE() 取值"},
+	},
+	// Oracle 版本号按主版本记录，19c 解析为 19
+	"oracle": {
+		{Feature: featurePivot, Since: "11"},
+		{Feature: featureOffsetFetch, Since: "12", Suggestion: "改用 ROWNUM 或 ROW_NUMBER() 子查询分页"},
+		{Feature: featureFetchWithTies, Since: "12"},
+		{Feature: featureLateral, Since: "12"},
+		{Feature: featureGroupsFrame, Since: "21"},
+		{Feature: featureLimit, Suggestion: "改用 FETCH FIRST n ROWS ONLY（12c 及以上）或 ROWNUM 子查询"},
+		{Feature: featureQualify},
+		{Feature: featureFilter},
+		{Feature: featureMaterializedCTE},
+		{Feature: featureJSONExtract, Suggestion: "改用 JSON_VALUE() / JSON_QUERY() 取值"},
+		{Feature: featureJSONUnquote, Suggestion: "改用 JSON_VALUE() 取值"},
+	},
+	// DuckDB 的 -> 同时用于 lambda 与 JSON 取值，均受支持
+	"duckdb": {
+		{Feature: featureGroupByAll, Since: "0.6.0"},
+		{Feature: featureFromFirst, Since: "0.7.0"},
+		{Feature: featurePivot, Since: "0.8.0"},
+	},
+	// ClickHouse 的 -> 为 lambda 运算符，不参与 JSON 运算符检测
+	"clickhouse": {
+		{Feature: featureReturning},
+		{Feature: featureLateral},
+		{Feature: featureJSONB},
+	},
+	// Neo4j 的 Cypher 特性，按 Neo4j 版本记录
+	"cypher": {
+		{Feature: featureCallSubquery, Since: "4.0"},
+		{Feature: featureExistsSubquery, Since: "4.0"},
+		{Feature: featureElementID, Since: "5.0"},
+		{Feature: featureCountSubquery, Since: "5.3"},
+		{Feature: featureCollectSubquery, Since: "5.6"},
+		{Feature: featureQuantifiedPath, Since: "5.9"},
+	},
+}
+
+// dialectDisplayNames 方言在提示信息中的展示名
+var dialectDisplayNames = map[string]string{
+	"mysql":      "MySQL",
+	"postgresql": "PostgreSQL",
+	"sqlite":     "SQLite",
+	"clickhouse": "ClickHouse",
+	"mssql":      "SQL Server",
+	"oracle":     "Oracle",
+	"duckdb":     "DuckDB",
+	"cypher":     "Neo4j",
+}
+
+// featureVersions 将方言的特性矩阵转换为 FeatureVersion 列表
+func featureVersions(dialect string) []FeatureVersion {
+	matrix := sqlFeatureMatrix[dialect]
+	features := make([]FeatureVersion, len(matrix))
+	for i, fs := range matrix {
+		features[i] = FeatureVersion{Feature: fs.Feature.Name, Since: fs.Since}
+	}
+	return features
+}
+
+// checkSQLFeatures 检测 SQL 中使用了当前方言/版本不支持的特性。
+// 方言本身不支持的特性始终报错；需要特定版本的特性仅在版本可识别时检查。
+func checkSQLFeatures(dialect, version, sql string, tokens []sqlToken) Diagnostics {
+	current, versionKnown := parseDBVersion(version)
+	name := dialectDisplayNames[dialect]
+	var diags Diagnostics
+	for _, fs := range sqlFeatureMatrix[dialect] {
+		tok, used := fs.Feature.detect(tokens)
+		if !used {
+			continue
+		}
+		if fs.Since == "" {
+			diags = append(diags, newDiagnostic(CodeUnsupportedFeature, SeverityError,
+				"%s 不支持 %s", name, fs.Feature.Name).atToken(sql, tok).withSuggestion(fs.suggestion()))
+			continue
+		}
+		since, _ := parseDBVersion(fs.Since)
+		if versionKnown && current.less(since) {
+			diags = append(diags, newDiagnostic(CodeUnsupportedFeature, SeverityError,
+				"%s %s 不支持 %s（需要 %s 及以上版本）", name, version, fs.Feature.Name, fs.Since).
+				atToken(sql, tok).withSuggestion(fs.suggestion()))
+		}
+	}
+	return diags
+}
+
+// usesExtendedSyntax 判断 SQL 是否使用了 sqlparser 无法解析的较新语法（CTE、窗口函数等）
+func usesExtendedSyntax(tokens []sqlToken) bool {
+	for _, f := range []*sqlFeature{featureCTE, featureWindow, featureLateral, featureFilter, featureNullsOrdering} {
+		if _, ok := f.detect(tokens); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// detectCTE 识别 WITH [RECURSIVE] name [(cols)] AS，排除 WITH ROLLUP / WITH TIME ZONE 等
+func detectCTE(tokens []sqlToken) (sqlToken, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !tokens[i].is("WITH") {
+			continue
+		}
+		if tokens[i+1].is("RECURSIVE") {
+			return tokens[i], true
+		}
+		if tokens[i+1].kind != tokWord && tokens[i+1].kind != tokQuotedIdent {
+			continue
+		}
+		if i+2 < len(tokens) && (tokens[i+2].is("AS") || tokens[i+2].isPunct("(")) {
+			return tokens[i], true
+		}
+	}
+	return sqlToken{}, false
+}
+
+// detectWindow 识别 OVER (...) / OVER w / WINDOW w AS (...)
+func detectWindow(tokens []sqlToken) (sqlToken, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].is("OVER") && (tokens[i+1].isPunct("(") || tokens[i+1].kind == tokWord) {
+			return tokens[i], true
+		}
+		if tokens[i].is("WINDOW") && i+2 < len(tokens) && tokens[i+2].is("AS") {
+			return tokens[i], true
+		}
+	}
+	return sqlToken{}, false
+}
+
+func findKeyword(tokens []sqlToken, keyword string) (sqlToken, bool) {
+	for _, t := range tokens {
+		if t.is(keyword) {
+			return t, true
+		}
+	}
+	return sqlToken{}, false
+}
+
+func findFunction(tokens []sqlToken, names ...string) (sqlToken, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !tokens[i+1].isPunct("(") {
+			continue
+		}
+		for _, n := range names {
+			if tokens[i].is(n) {
+				return tokens[i], true
+			}
+		}
+	}
+	return sqlToken{}, false
+}
+
+func findSequence(tokens []sqlToken, keywords ...string) (sqlToken, bool) {
+	for i := 0; i+len(keywords) <= len(tokens); i++ {
+		matched := true
+		for j, k := range keywords {
+			if !tokens[i+j].is(k) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return tokens[i], true
+		}
+	}
+	return sqlToken{}, false
+}
+
+func findOperator(tokens []sqlToken, ops ...string) (sqlToken, bool) {
+	for _, t := range tokens {
+		for _, op := range ops {
+			if t.isOp(op) {
+				return t, true
+			}
+		}
+	}
+	return sqlToken{}, false
+}
+
+// findBraceSubquery 查找 keyword { 形式的子查询（Cypher 的 CALL / EXISTS / COUNT / COLLECT）
+func findBraceSubquery(tokens []sqlToken, keyword string) (sqlToken, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].is(keyword) && tokens[i+1].isPunct("{") {
+			return tokens[i], true
+		}
+	}
+	return sqlToken{}, false
+}
@@ -0,0 +1,173 @@
+package text2sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"text2sql/internal/llm"
+)
+
+// 多轮对话历史的选择策略
+const (
+	// HistoryStrategySummary 预算内的最近轮次原样发送，更早的轮次由 LLM 合并为滚动摘要（默认）
+	HistoryStrategySummary = "summary"
+	// HistoryStrategyRecent 只发送预算内的最近轮次，更早的轮次直接丢弃
+	HistoryStrategyRecent = "recent"
+	// HistoryStrategyNone 不发送历史，只通过 previous_sql 延续会话
+	HistoryStrategyNone = "none"
+)
+
+const (
+	defaultHistoryBudgetTokens  = 4000
+	defaultHistorySummaryTokens = 400
+	// messageOverheadTokens 每条消息在角色、分隔符上的额外开销
+	messageOverheadTokens = 4
+)
+
+// HistoryOptions 多轮对话历史的 token 预算与策略
+type HistoryOptions struct {
+	Strategy      string // HistoryStrategySummary（默认）、HistoryStrategyRecent 或 HistoryStrategyNone
+	BudgetTokens  int    // 历史（含摘要）可占用的 token 数，默认 4000
+	SummaryTokens int    // 滚动摘要的 token 上限，默认 400
+}
+
+// HistoryStrategies 支持的历史策略
+func HistoryStrategies() []string {
+	return []string{HistoryStrategySummary, HistoryStrategyRecent, HistoryStrategyNone}
+}
+
+func (o HistoryOptions) withDefaults() HistoryOptions {
+	if o.Strategy == "" {
+		o.Strategy = HistoryStrategySummary
+	}
+	if o.BudgetTokens <= 0 {
+		o.BudgetTokens = defaultHistoryBudgetTokens
+	}
+	if o.SummaryTokens <= 0 {
+		o.SummaryTokens = defaultHistorySummaryTokens
+	}
+	return o
+}
+
+// estimateTokens 粗略估算文本的 token 数：CJK 等宽字符按 1 个 token，其余按 4 个字符 1 个 token。
+// 不同模型的分词器差异较大，预算应留有余量
+func estimateTokens(s string) int {
+	wide, narrow := 0, 0
+	for _, r := range s {
+		if r > unicode.MaxLatin1 && !unicode.IsSpace(r) {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	return wide + (narrow+3)/4
+}
+
+// turnTokens 一轮对话作为 user/assistant 两条消息发送时的 token 数
+func turnTokens(set *promptSet, turn ConversationTurn) int {
+	return estimateTokens(turn.Query) + estimateTokens(fmt.Sprintf(set.historyAnswer, turn.SQL, turn.Explanation)) + 2*messageOverheadTokens
+}
+
+// recentStart 从 from 开始、自后向前选取总量不超过 budget 的轮次，返回第一轮的下标；一轮也放不下时返回 len(history)
+func recentStart(set *promptSet, history []ConversationTurn, from, budget int) int {
+	start, used := len(history), 0
+	for i := len(history) - 1; i >= from; i-- {
+		used += turnTokens(set, history[i])
+		if used > budget {
+			break
+		}
+		start = i
+	}
+	return start
+}
+
+// historySelection 本次请求携带的历史
+type historySelection struct {
+	summary string             // 滚动摘要，为空时不发送
+	turns   []ConversationTurn // 原样发送的最近轮次
+	pending int                // 未被摘要覆盖、也超出预算的较早轮数，需要并入摘要
+}
+
+// selectHistory 按策略与预算选择历史：摘要先占用预算，剩余预算从最新的轮次往前分配
+func selectHistory(set *promptSet, opts HistoryOptions, conv *ConversationContext) historySelection {
+	if conv == nil || opts.Strategy == HistoryStrategyNone {
+		return historySelection{}
+	}
+	var sel historySelection
+	budget, from := opts.BudgetTokens, 0
+	if opts.Strategy == HistoryStrategySummary {
+		from = min(conv.SummarizedTurns, len(conv.History))
+		if conv.Summary != "" {
+			sel.summary = conv.Summary
+			budget -= estimateTokens(fmt.Sprintf(set.historySummary, conv.Summary)) + messageOverheadTokens
+		}
+	}
+	start := recentStart(set, conv.History, from, budget)
+	sel.turns = conv.History[start:]
+	if opts.Strategy == HistoryStrategySummary {
+		sel.pending = start - from
+	}
+	return sel
+}
+
+// historyMessages 将选出的历史转换为 LLM 消息
+func historyMessages(set *promptSet, sel historySelection) []llm.Message {
+	var messages []llm.Message
+	if sel.summary != "" {
+		messages = append(messages, llm.Message{Role: "system", Content: fmt.Sprintf(set.historySummary, sel.summary)})
+	}
+	for _, turn := range sel.turns {
+		messages = append(messages,
+			llm.Message{Role: "user", Content: turn.Query},
+			llm.Message{Role: "assistant", Content: fmt.Sprintf(set.historyAnswer, turn.SQL, turn.Explanation)},
+		)
+	}
+	return messages
+}
+
+// compactHistory 下一次请求的历史超出预算时，将较早的轮次并入滚动摘要。
+// 合并后原样保留的轮次控制在预算的一半以内，避免每轮都触发摘要；摘要失败时保持原状，下次再试
+func (s *Service) compactHistory(ctx context.Context, language string, conv *ConversationContext) error {
+	if s.history.Strategy != HistoryStrategySummary {
+		return nil
+	}
+	_, set := getPromptSet(language)
+	if selectHistory(set, s.history, conv).pending == 0 {
+		return nil
+	}
+
+	from := min(conv.SummarizedTurns, len(conv.History))
+	keep := recentStart(set, conv.History, from, s.history.BudgetTokens/2-s.history.SummaryTokens)
+	if keep == from {
+		return nil
+	}
+	var turns strings.Builder
+	for _, turn := range conv.History[from:keep] {
+		fmt.Fprintf(&turns, "Q: %s\n%s\n\n", turn.Query, fmt.Sprintf(set.historyAnswer, turn.SQL, turn.Explanation))
+	}
+	previous := conv.Summary
+	if previous == "" {
+		previous = set.summaryNone
+	}
+
+	resp, err := s.llm.Complete(ctx, &llm.CompleteRequest{
+		Messages: []llm.Message{
+			{Role: "system", Content: fmt.Sprintf(set.summarize, s.history.SummaryTokens)},
+			{Role: "user", Content: fmt.Sprintf(set.summarizeContent, previous, strings.TrimSpace(turns.String()))},
+		},
+		MaxTokens:   s.history.SummaryTokens * 2,
+		Temperature: 0,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: 生成对话摘要: %w", ErrLLMError, err)
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return fmt.Errorf("%w: 对话摘要为空", ErrLLMError)
+	}
+	conv.Summary = summary
+	conv.SummarizedTurns = keep
+	return nil
+}
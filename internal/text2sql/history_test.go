@@ -0,0 +1,133 @@
+package text2sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"text2sql/internal/llm"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"SELECT id FROM users", 5},
+		{"查询用户", 4},
+		{"查询 users", 4},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSelectHistory(t *testing.T) {
+	_, set := getPromptSet(LanguageChinese)
+	conv := &ConversationContext{Summary: "早期摘要", SummarizedTurns: 1}
+	for i := 0; i < 4; i++ {
+		conv.History = append(conv.History, ConversationTurn{Query: fmt.Sprintf("问题%d", i), SQL: "SELECT 1"})
+	}
+	perTurn := turnTokens(set, conv.History[0])
+	summaryCost := estimateTokens(fmt.Sprintf(set.historySummary, conv.Summary)) + messageOverheadTokens
+
+	tests := []struct {
+		name        string
+		opts        HistoryOptions
+		wantSummary bool
+		wantTurns   int
+		wantPending int
+	}{
+		{"none", HistoryOptions{Strategy: HistoryStrategyNone, BudgetTokens: 10000}, false, 0, 0},
+		{"recent within budget", HistoryOptions{Strategy: HistoryStrategyRecent, BudgetTokens: 10000}, false, 4, 0},
+		{"recent over budget", HistoryOptions{Strategy: HistoryStrategyRecent, BudgetTokens: 2 * perTurn}, false, 2, 0},
+		{"summary skips summarized turns", HistoryOptions{Strategy: HistoryStrategySummary, BudgetTokens: 10000}, true, 3, 0},
+		{"summary over budget", HistoryOptions{Strategy: HistoryStrategySummary, BudgetTokens: summaryCost + 2*perTurn}, true, 2, 1},
+		{"budget too small for one turn", HistoryOptions{Strategy: HistoryStrategySummary, BudgetTokens: summaryCost}, true, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := selectHistory(set, tt.opts, conv)
+			if (sel.summary != "") != tt.wantSummary || len(sel.turns) != tt.wantTurns || sel.pending != tt.wantPending {
+				t.Errorf("selection = summary %q, %d turns, %d pending", sel.summary, len(sel.turns), sel.pending)
+			}
+			if len(sel.turns) > 0 && sel.turns[len(sel.turns)-1].Query != "问题3" {
+				t.Errorf("expected the most recent turns, got %+v", sel.turns)
+			}
+		})
+	}
+}
+
+// summarizingProvider 对摘要请求返回固定摘要，其余请求返回 SQL
+type summarizingProvider struct {
+	recordingProvider
+	summaries int
+}
+
+func (p *summarizingProvider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm.CompleteResponse, error) {
+	p.requests = append(p.requests, req)
+	if strings.HasPrefix(req.Messages[0].Content, "你负责压缩") {
+		p.summaries++
+		return &llm.CompleteResponse{Content: fmt.Sprintf("摘要 v%d", p.summaries)}, nil
+	}
+	return &llm.CompleteResponse{Content: "SELECT id FROM orders"}, nil
+}
+
+func TestService_HistorySummary(t *testing.T) {
+	provider := &summarizingProvider{}
+	_, set := getPromptSet(LanguageChinese)
+	turn := ConversationTurn{Query: "第 0 轮：只看 2024 年已支付的订单", SQL: "SELECT id FROM orders"}
+	perTurn := turnTokens(set, turn)
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{History: HistoryOptions{BudgetTokens: 4 * perTurn, SummaryTokens: 10}})
+
+	var id string
+	for i := 0; i < 6; i++ {
+		resp, err := svc.Generate(context.Background(), &GenerateRequest{
+			Query:          fmt.Sprintf("第 %d 轮：只看 2024 年已支付的订单", i),
+			ConversationID: id,
+			Schema:         Schema{Tables: []Table{{Name: "orders", Columns: []Column{{Name: "id", Type: "int"}}}}},
+			Database:       Database{Type: "mysql"},
+		})
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		id = resp.ConversationID
+	}
+
+	conv, err := svc.GetConversation(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.summaries == 0 || conv.Summary == "" || conv.SummarizedTurns == 0 {
+		t.Fatalf("expected rolling summary, got %q covering %d turns after %d summary calls", conv.Summary, conv.SummarizedTurns, provider.summaries)
+	}
+	// 每次摘要后原样保留的轮次不超过预算的一半，不会每轮都触发摘要
+	if provider.summaries >= 3 {
+		t.Errorf("summarized %d times in 6 turns", provider.summaries)
+	}
+
+	rendered, err := svc.RenderPrompt(context.Background(), &GenerateRequest{Query: "按金额排序", ConversationID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := rendered.Messages
+	if messages[1].Role != "system" || !strings.Contains(messages[1].Content, conv.Summary) {
+		t.Errorf("expected summary message after system prompt, got %+v", messages[1])
+	}
+	for _, m := range messages {
+		if strings.Contains(m.Content, "第 0 轮") {
+			t.Errorf("summarized turn sent verbatim: %q", m.Content)
+		}
+	}
+	if last := messages[len(messages)-1]; last.Role != "user" || !strings.Contains(last.Content, "按金额排序") {
+		t.Errorf("last message = %+v", last)
+	}
+	if prev := messages[len(messages)-3]; prev.Role != "user" || !strings.HasPrefix(prev.Content, "第 5 轮") {
+		t.Errorf("expected most recent turn before the question, got %+v", prev)
+	}
+}
@@ -0,0 +1,237 @@
+package text2sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 支持的解释语言
+const (
+	LanguageChinese = "zh"
+	LanguageEnglish = "en"
+
+	DefaultLanguage = LanguageChinese
+)
+
+// promptSet 一种语言的提示词模板：user 消息、修正反馈、历史回答与解释标记
+type promptSet struct {
+	// explanationLabel 要求 LLM 在解释前输出的标记
+	explanationLabel string
+	// instruction 追加到方言 system prompt 的语言要求；方言提示词本身即为该语言时为空
+	instruction string
+	// userContent 参数依次为 schema JSON、用户问题
+	userContent string
+	// modifyContent 参数依次为现有语句、schema JSON、新需求
+	modifyContent string
+	// repair 参数依次为语句称呼、诊断信息
+	repair string
+	// historyAnswer 参数依次为语句、解释
+	historyAnswer string
+	// historySummary 较早对话的滚动摘要，参数为摘要
+	historySummary string
+	// summarize 生成滚动摘要的 system prompt，参数为摘要的 token 上限
+	summarize string
+	// summarizeContent 参数依次为已有摘要（没有时为 summaryNone）、需要并入摘要的对话
+	summarizeContent string
+	summaryNone      string
+	// schemaChanged 本轮接受了新 schema 时的说明，参数为变更列表
+	schemaChanged string
+	// schemaChangeKinds 各类结构变更的描述，参数依次为对象称呼、名称、旧值、新值
+	schemaChangeKinds map[string]string
+	// schemaObjects 结构变更中对象的称呼
+	schemaObjects map[string]string
+	// structuredOutput 结构化输出模式追加到 system prompt 的输出要求，参数为语句称呼
+	structuredOutput string
+}
+
+var promptSets = map[string]*promptSet{
+	LanguageChinese: {
+		explanationLabel: "解释：",
+		userContent:      "表结构：\n%s\n\n用户问题：%s",
+		modifyContent: `现有 SQL：
+%s
+
+表结构：
+%s
+
+新的需求：%s
+
+请基于现有 SQL，根据新需求进行修改。`,
+		repair:         "生成的 %s 校验失败：%s\n请修正并重新生成。",
+		historyAnswer:  "SQL: %s\n解释: %s",
+		historySummary: "此前对话的摘要（较早的轮次已省略）：\n%s",
+		summarize: `你负责压缩一段生成查询语句的多轮对话。将已有摘要与新的对话合并为一份摘要，不超过 %d 个 token。
+必须保留：用户提出的过滤条件、时间范围、指标与口径定义、排序和分组要求、涉及的表和字段、用户否定或更正过的内容。
+只输出摘要正文，不要输出查询语句或其他说明。`,
+		summarizeContent: "已有摘要：\n%s\n\n需要并入的对话：\n%s",
+		summaryNone:      "（无）",
+		schemaChanged:    "表结构在此前的对话之后发生了变化，此前的语句可能引用已不存在或已改名的对象，请按最新表结构生成：\n%s",
+		schemaChangeKinds: map[string]string{
+			SchemaChangeAdded:            "新增%[1]s %[2]s",
+			SchemaChangeRemoved:          "删除%[1]s %[2]s",
+			SchemaChangePossiblyRenamed:  "%[1]s %[2]s 可能重命名为 %[4]s（也可能是删除后新增）",
+			SchemaChangeTypeChanged:      "%[1]s %[2]s 的类型由 %[3]s 改为 %[4]s",
+			SchemaChangeEndpointsChanged: "%[1]s %[2]s 的起止节点由 %[3]s 改为 %[4]s",
+		},
+		schemaObjects: map[string]string{
+			"table": "表", "column": "列", "key": "key", "field": "字段", "collection": "集合",
+			"index": "索引", "node": "节点标签", "relationship": "关系类型", "property": "属性",
+		},
+		structuredOutput: `
+
+输出要求（优先于上面的输出格式）：只输出一个 JSON 对象，不要输出代码块或其他文字。字段：
+- sql：完整的 %s（字符串，多行时使用 \n 换行）
+- explanation：简要说明
+- tables_used：用到的表（或集合、索引、节点标签）名称数组
+- assumptions：对需求所做的假设数组，没有则为空数组`,
+	},
+	LanguageEnglish: {
+		explanationLabel: "Explanation:",
+		instruction: `
+
+Language: write the explanation in English (in JSON mode, the explanation field) and start it with "Explanation:" instead of "解释：". Keep identifiers exactly as given in the schema.`,
+		userContent: "Schema:\n%s\n\nQuestion: %s",
+		modifyContent: `Existing query:
+%s
+
+Schema:
+%s
+
+New requirement: %s
+
+Modify the existing query according to the new requirement.`,
+		repair:         "The generated %s failed validation: %s\nPlease fix it and generate it again.",
+		historyAnswer:  "SQL: %s\nExplanation: %s",
+		historySummary: "Summary of the earlier conversation (older turns omitted):\n%s",
+		summarize: `You compress a multi-turn conversation about generating queries. Merge the existing summary and the new turns into one summary of at most %d tokens.
+Keep: filters the user asked for, time ranges, metric definitions, ordering and grouping requirements, tables and columns involved, and anything the user rejected or corrected.
+Output only the summary text, without queries or other commentary.`,
+		summarizeContent: "Existing summary:\n%s\n\nTurns to merge:\n%s",
+		summaryNone:      "(none)",
+		schemaChanged:    "The schema has changed since the earlier turns, so earlier queries may reference objects that were removed or renamed. Generate against the current schema:\n%s",
+		schemaChangeKinds: map[string]string{
+			SchemaChangeAdded:            "%[1]s %[2]s added",
+			SchemaChangeRemoved:          "%[1]s %[2]s removed",
+			SchemaChangePossiblyRenamed:  "%[1]s %[2]s possibly renamed to %[4]s (or removed and a new one added)",
+			SchemaChangeTypeChanged:      "%[1]s %[2]s type changed from %[3]s to %[4]s",
+			SchemaChangeEndpointsChanged: "%[1]s %[2]s endpoints changed from %[3]s to %[4]s",
+		},
+		schemaObjects: map[string]string{
+			"table": "table", "column": "column", "key": "key", "field": "field", "collection": "collection",
+			"index": "index", "node": "node label", "relationship": "relationship type", "property": "property",
+		},
+		structuredOutput: `
+
+Output requirements (these override the output format above): output a single JSON object only, without code fences or any other text. Fields:
+- sql: the complete %s (a string; use \n for line breaks)
+- explanation: a short explanation
+- tables_used: array of the table (or collection, index, node label) names used
+- assumptions: array of assumptions made about the request, empty if none`,
+	},
+}
+
+// SupportedLanguages 支持的解释语言
+func SupportedLanguages() []string {
+	return []string{LanguageChinese, LanguageEnglish}
+}
+
+// NormalizeLanguage 将语言标签（如 en-US、zh_CN、EN）归一化为支持的语言，不支持时返回 false
+func NormalizeLanguage(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := promptSets[tag]; ok {
+		return tag, true
+	}
+	return "", false
+}
+
+// LanguageFromAcceptLanguage 从 Accept-Language 请求头中选出权重最高的支持语言，没有时返回空串
+func LanguageFromAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, ok := NormalizeLanguage(tag)
+		if ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// getPromptSet 返回语言对应的提示词模板，未知语言使用默认语言
+func getPromptSet(language string) (string, *promptSet) {
+	if lang, ok := NormalizeLanguage(language); ok {
+		return lang, promptSets[lang]
+	}
+	return DefaultLanguage, promptSets[DefaultLanguage]
+}
+
+// LocalizedDialect 可选接口：方言提供指定语言的完整 system prompt。
+// 未实现或不支持该语言时，使用 SystemPrompt 并追加语言要求
+type LocalizedDialect interface {
+	LocalizedSystemPrompt(language string, database Database, schema Schema, modify bool) (string, bool)
+}
+
+// systemPromptFor 构建指定语言的 system prompt
+func systemPromptFor(dialect Dialect, language string, database Database, schema Schema, modify bool) string {
+	lang, set := getPromptSet(language)
+	if ld, ok := dialect.(LocalizedDialect); ok {
+		if prompt, ok := ld.LocalizedSystemPrompt(lang, database, schema, modify); ok {
+			return prompt
+		}
+	}
+	return dialect.SystemPrompt(database, schema, modify) + set.instruction
+}
+
+func (p *promptSet) buildUserContent(query string, schema Schema) string {
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	return fmt.Sprintf(p.userContent, string(schemaJSON), query)
+}
+
+func (p *promptSet) buildUserContentForModify(query string, schema Schema, previousSQL string) string {
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	return fmt.Sprintf(p.modifyContent, previousSQL, string(schemaJSON), query)
+}
+
+// explanationLabels 各语言的解释标记（不含冒号）。解析 LLM 输出时全部识别，与请求的语言无关
+var explanationLabels = []string{"解释", "说明", "explanation", "説明"}
+
+// isExplanationLine 判断一行是否以解释标记开头（允许 Markdown 加粗或标题前缀）
+func isExplanationLine(line string) bool {
+	line = strings.TrimLeft(line, "*# ")
+	for _, label := range explanationLabels {
+		if startsWithIgnoreCase(line, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutExplanation 去掉行首的"解释："、"Explanation:" 等标记，返回解释内容；不是解释行时返回 false
+func cutExplanation(line string) (string, bool) {
+	line = strings.TrimLeft(line, "*# ")
+	for _, label := range explanationLabels {
+		if !startsWithIgnoreCase(line, label) {
+			continue
+		}
+		rest := strings.TrimLeft(line[len(label):], "*")
+		for _, colon := range []string{"：", ":"} {
+			if after, ok := strings.CutPrefix(rest, colon); ok {
+				return strings.TrimSpace(strings.TrimLeft(after, "* ")), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,127 @@
+package text2sql
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLanguageFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"en-US,en;q=0.9", "en"},
+		{"zh-CN,zh;q=0.9,en;q=0.8", "zh"},
+		{"fr-FR,en;q=0.5,zh;q=0.7", "zh"},
+		{"fr-FR,de;q=0.8", ""},
+		{"EN", "en"},
+		{"en;q=abc,zh_TW", "zh"},
+	}
+	for _, tt := range tests {
+		if got := LanguageFromAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("LanguageFromAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCutExplanation(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   string
+		wantOK bool
+	}{
+		{"解释：查询所有用户", "查询所有用户", true},
+		{"说明: 查询所有用户", "查询所有用户", true},
+		{"Explanation: selects all users", "selects all users", true},
+		{"explanation：selects all users", "selects all users", true},
+		{"**Explanation:** selects all users", "selects all users", true},
+		{"SELECT * FROM users", "", false},
+		{"Explanation follows", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cutExplanation(tt.line)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("cutExplanation(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseLLMOutput_EnglishExplanation(t *testing.T) {
+	sql, explanation := parseLLMOutput("SELECT id\nFROM users\nExplanation: lists user ids")
+	if sql != "SELECT id\nFROM users" || explanation != "lists user ids" {
+		t.Errorf("got sql=%q explanation=%q", sql, explanation)
+	}
+
+	cmd, explanation := parseLLMOutputRedis("GET user:1\nExplanation: reads the user")
+	if cmd != "GET user:1" || explanation != "reads the user" {
+		t.Errorf("redis: got cmd=%q explanation=%q", cmd, explanation)
+	}
+}
+
+func TestService_Generate_Language(t *testing.T) {
+	schema := Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}}
+	tests := []struct {
+		name         string
+		language     string
+		database     string
+		wantLanguage string
+		wantSystem   string
+		wantUser     string
+	}{
+		{"default chinese", "", "mysql", "zh", "只生成 SELECT 查询", "用户问题："},
+		{"english sql prompt", "en-US", "mysql", "en", "Only generate SELECT queries", "Question: "},
+		{"english instruction for other dialects", "en", "redis", "en", `start it with "Explanation:"`, "Question: "},
+		{"unknown falls back", "fr", "sqlite", "zh", "只生成 SELECT 查询", "用户问题："},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &recordingProvider{content: "SELECT id FROM users\nExplanation: lists user ids"}
+			if tt.database == "redis" {
+				provider.content = "SCAN 0 MATCH users:* COUNT 100\nExplanation: scans users"
+			}
+			svc := NewService(provider, NewSQLValidator(), 1)
+			resp, err := svc.Generate(context.Background(), &GenerateRequest{
+				Query:    "list users",
+				Schema:   schema,
+				Database: Database{Type: tt.database},
+				Language: tt.language,
+			})
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if resp.Language != tt.wantLanguage {
+				t.Errorf("language = %q, want %q", resp.Language, tt.wantLanguage)
+			}
+			if resp.Explanation == "" {
+				t.Errorf("expected explanation to be parsed")
+			}
+			messages := provider.requests[0].Messages
+			if !strings.Contains(messages[0].Content, tt.wantSystem) {
+				t.Errorf("system prompt missing %q:\n%s", tt.wantSystem, messages[0].Content)
+			}
+			if !strings.Contains(messages[1].Content, tt.wantUser) {
+				t.Errorf("user message missing %q:\n%s", tt.wantUser, messages[1].Content)
+			}
+		})
+	}
+}
+
+func TestService_Generate_RepairMessageLanguage(t *testing.T) {
+	provider := &recordingProvider{content: "DELETE FROM users"}
+	svc := NewService(provider, NewSQLValidator(), 2)
+	_, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "remove users",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}},
+		Database: Database{Type: "mysql"},
+		Language: "en",
+	})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	retry := provider.requests[1].Messages
+	if last := retry[len(retry)-1].Content; !strings.HasPrefix(last, "The generated SQL failed validation") {
+		t.Errorf("unexpected repair message: %q", last)
+	}
+}
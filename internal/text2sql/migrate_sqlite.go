@@ -0,0 +1,277 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteMigrationFiles SQLite 上下文存储的迁移，文件名为 <版本>_<名称>.sql，版本从 1 开始连续递增。
+// 已发布的迁移不可修改，变更表结构时新增文件
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationFiles embed.FS
+
+// sqliteMigrationLockTimeout 等待其他进程完成迁移的最长时间
+const sqliteMigrationLockTimeout = 30 * time.Second
+
+// Migration 一个版本化的表结构迁移
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationStatus 迁移的执行状态，AppliedAt 为 nil 表示尚未执行
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// sqliteMigrations 按版本排序的内置迁移
+func sqliteMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(sqliteMigrationFiles, "migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		version, label, ok := strings.Cut(name, "_")
+		n, err := strconv.Atoi(version)
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("迁移文件名 %s 无效，应为 <版本>_<名称>.sql", entry.Name())
+		}
+		body, err := fs.ReadFile(sqliteMigrationFiles, path.Join("migrations/sqlite", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: n, Name: label, SQL: string(body)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("迁移版本不连续：缺少版本 %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// legacySQLiteColumns 引入版本化迁移前由启动时逐列补齐的列，用于把旧数据库对齐到版本 1
+var legacySQLiteColumns = []struct{ name, definition string }{
+	{"database_modules", "TEXT NOT NULL DEFAULT ''"},
+	{"title", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "TEXT NOT NULL DEFAULT ''"},
+	{"summary", "TEXT NOT NULL DEFAULT ''"},
+	{"summarized_turns", "INTEGER NOT NULL DEFAULT 0"},
+	{"owner", "TEXT NOT NULL DEFAULT ''"},
+	{"pinned", "INTEGER NOT NULL DEFAULT 0"},
+	{"shared_with", "TEXT NOT NULL DEFAULT ''"},
+	{"key_id", "TEXT NOT NULL DEFAULT ''"},
+	{"data_key", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// SQLiteMigrationStatus 列出 dsn 指向的 SQLite 数据库中各迁移的执行状态，不执行迁移
+func SQLiteMigrationStatus(dsn string) ([]MigrationStatus, error) {
+	db, err := openSQLite(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return sqliteMigrationStatus(context.Background(), db)
+}
+
+// MigrateSQLite 执行 dsn 指向的 SQLite 数据库中尚未执行的迁移，返回本次执行的迁移
+func MigrateSQLite(dsn string) ([]Migration, error) {
+	db, err := openSQLite(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrateSQLite(context.Background(), db)
+}
+
+func sqliteMigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := sqliteMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedSQLiteMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	for version := range applied {
+		if version > len(migrations) {
+			return statuses, newerSchemaError(version, len(migrations))
+		}
+	}
+	return statuses, nil
+}
+
+// pendingSQLiteMigrations 尚未执行的迁移数，数据库版本高于程序时返回错误
+func pendingSQLiteMigrations(ctx context.Context, db *sql.DB) (int, error) {
+	statuses, err := sqliteMigrationStatus(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// sqliteQuerier *sql.DB 与 *sql.Conn 共有的查询方法
+type sqliteQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// appliedSQLiteMigrations 已执行的迁移版本及执行时间，版本表不存在时为空
+func appliedSQLiteMigrations(ctx context.Context, q sqliteQuerier) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	var exists int
+	if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return applied, nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// migrateSQLite 在 BEGIN IMMEDIATE 事务中执行尚未执行的迁移：写锁使多个进程同时启动时依次迁移，
+// 后获得锁的进程重新读取版本后不会重复执行。所有迁移在同一事务中提交，失败时整体回滚
+func migrateSQLite(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := sqliteMigrations()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`PRAGMA busy_timeout = %d`, sqliteMigrationLockTimeout.Milliseconds())); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return nil, fmt.Errorf("获取迁移锁: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		}
+	}()
+
+	var legacy int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'conversations'
+			AND NOT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')
+	`).Scan(&legacy); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`); err != nil {
+		return nil, err
+	}
+	if legacy > 0 {
+		if err := adoptLegacySQLiteSchema(ctx, conn, migrations[0]); err != nil {
+			return nil, fmt.Errorf("对齐旧版本数据库: %w", err)
+		}
+	}
+
+	applied, err := appliedSQLiteMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > len(migrations) {
+			return nil, newerSchemaError(version, len(migrations))
+		}
+	}
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, m.SQL); err != nil {
+			return nil, fmt.Errorf("执行迁移 %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if err := recordSQLiteMigration(ctx, conn, m); err != nil {
+			return nil, err
+		}
+		done = append(done, m)
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return nil, err
+	}
+	committed = true
+	return done, nil
+}
+
+// adoptLegacySQLiteSchema 引入版本化迁移前创建的数据库：补齐缺少的列后记为已执行 init 迁移
+func adoptLegacySQLiteSchema(ctx context.Context, conn *sql.Conn, init Migration) error {
+	for _, column := range legacySQLiteColumns {
+		var exists int
+		if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info('conversations') WHERE name = ?`, column.name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == 0 {
+			if _, err := conn.ExecContext(ctx, `ALTER TABLE conversations ADD COLUMN `+column.name+` `+column.definition); err != nil {
+				return err
+			}
+		}
+	}
+	// init 迁移全部为 IF NOT EXISTS，补齐缺少的表和索引
+	if _, err := conn.ExecContext(ctx, init.SQL); err != nil {
+		return err
+	}
+	return recordSQLiteMigration(ctx, conn, init)
+}
+
+func recordSQLiteMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	_, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, time.Now().UTC())
+	return err
+}
+
+func newerSchemaError(version, latest int) error {
+	return fmt.Errorf("数据库 schema 版本 %d 高于程序支持的版本 %d，请升级程序", version, latest)
+}
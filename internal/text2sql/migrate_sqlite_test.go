@@ -0,0 +1,178 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSQLiteMigrations_Embedded(t *testing.T) {
+	migrations, err := sqliteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) < 2 || migrations[0].Name != "init" {
+		t.Errorf("migrations = %+v", migrations)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || strings.TrimSpace(m.SQL) == "" {
+			t.Errorf("migration %d = %+v", i, m)
+		}
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	migrations, err := sqliteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := len(migrations)
+
+	t.Run("fresh database", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "context.db")
+		statuses, err := SQLiteMigrationStatus(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.AppliedAt != nil {
+				t.Errorf("migration %d should be pending", s.Version)
+			}
+		}
+		applied, err := MigrateSQLite(dsn)
+		if err != nil || len(applied) != latest {
+			t.Fatalf("applied = %d, err %v, want %d", len(applied), err, latest)
+		}
+		if applied, err = MigrateSQLite(dsn); err != nil || len(applied) != 0 {
+			t.Errorf("second run applied = %d, err %v", len(applied), err)
+		}
+		statuses, err = SQLiteMigrationStatus(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.AppliedAt == nil {
+				t.Errorf("migration %d should be applied", s.Version)
+			}
+		}
+	})
+
+	t.Run("legacy database", func(t *testing.T) {
+		// 引入版本化迁移前的最早表结构，已有会话数据
+		dsn := filepath.Join(t.TempDir(), "context.db")
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`
+			CREATE TABLE conversations (
+				id TEXT PRIMARY KEY,
+				schema_json TEXT NOT NULL,
+				database_type TEXT NOT NULL,
+				database_version TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				title TEXT NOT NULL DEFAULT ''
+			);
+			CREATE TABLE conversation_turns (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				conversation_id TEXT NOT NULL,
+				query TEXT NOT NULL,
+				sql TEXT NOT NULL,
+				explanation TEXT,
+				turn_number INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			INSERT INTO conversations (id, schema_json, database_type, database_version, title)
+			VALUES ('conv_legacy', '{"tables":[{"name":"users","columns":[{"name":"id","type":"int"}]}]}', 'mysql', '8.0', '旧会话');
+			INSERT INTO conversation_turns (conversation_id, query, sql, explanation, turn_number)
+			VALUES ('conv_legacy', '查询用户', 'SELECT id FROM users', '', 0);
+		`)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := NewSQLiteContextStore(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		conv, err := store.Get("conv_legacy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conv.Title != "旧会话" || len(conv.History) != 1 || conv.Owner != "" {
+			t.Errorf("legacy conversation = %+v", conv)
+		}
+		if err := store.Save(conv); err != nil {
+			t.Errorf("Save on migrated legacy database: %v", err)
+		}
+		if pending, err := pendingSQLiteMigrations(context.Background(), store.db); err != nil || pending != 0 {
+			t.Errorf("pending = %d, err %v", pending, err)
+		}
+	})
+
+	t.Run("newer database", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "context.db")
+		if _, err := MigrateSQLite(dsn); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)`, latest+1)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewSQLiteContextStore(dsn); err == nil || !strings.Contains(err.Error(), "高于程序支持的版本") {
+			t.Errorf("expected newer schema error, got %v", err)
+		}
+	})
+
+	t.Run("manual migrations", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "context.db")
+		if _, err := NewSQLiteContextStoreWithOptions(dsn, SQLiteStoreOptions{DisableAutoMigrate: true}); err == nil {
+			t.Fatal("expected error for pending migrations")
+		}
+		if _, err := MigrateSQLite(dsn); err != nil {
+			t.Fatal(err)
+		}
+		store, err := NewSQLiteContextStoreWithOptions(dsn, SQLiteStoreOptions{DisableAutoMigrate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Close()
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "context.db")
+		var wg sync.WaitGroup
+		counts := make([]int, 4)
+		errs := make([]error, len(counts))
+		for i := range counts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				applied, err := MigrateSQLite(dsn)
+				counts[i], errs[i] = len(applied), err
+			}(i)
+		}
+		wg.Wait()
+		total := 0
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("migrator %d: %v", i, err)
+			}
+			total += counts[i]
+		}
+		if total != latest {
+			t.Errorf("migrations applied %d times in total, want %d", total, latest)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+-- 会话与对话轮次。引入版本化迁移前的数据库由程序补齐缺少的列后直接记为已执行此版本
+CREATE TABLE IF NOT EXISTS conversations (
+	id TEXT PRIMARY KEY,
+	schema_json TEXT NOT NULL,
+	database_type TEXT NOT NULL,
+	database_version TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	database_modules TEXT NOT NULL DEFAULT '',
+	title TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '',
+	summary TEXT NOT NULL DEFAULT '',
+	summarized_turns INTEGER NOT NULL DEFAULT 0,
+	owner TEXT NOT NULL DEFAULT '',
+	pinned INTEGER NOT NULL DEFAULT 0,
+	shared_with TEXT NOT NULL DEFAULT '',
+	key_id TEXT NOT NULL DEFAULT '',
+	data_key TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS conversation_turns (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL,
+	query TEXT NOT NULL,
+	sql TEXT NOT NULL,
+	explanation TEXT,
+	turn_number INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_conversation_turns_conv ON conversation_turns(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at);
@@ -0,0 +1,2 @@
+-- 按所有者列出会话与统计会话数
+CREATE INDEX idx_conversations_owner ON conversations(owner, updated_at);
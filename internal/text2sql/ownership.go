@@ -0,0 +1,114 @@
+package text2sql
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"text2sql/internal/principal"
+)
+
+const maxConversationShares = 20
+
+// Principal 已认证的请求方。ID 由可选的租户与名称组成，作为会话的所有者；
+// 会话只能共享给同一租户内的其他请求方
+type Principal struct {
+	Name   string // 请求方名称，如用户名或 API Key 的摘要
+	Tenant string // 可选：租户
+}
+
+// ID 请求方的唯一标识：无租户时为名称，否则为 租户/名称
+func (p Principal) ID() string {
+	if p.Tenant == "" {
+		return p.Name
+	}
+	return p.Tenant + "/" + p.Name
+}
+
+// ValidatePrincipalName 校验请求方名称或租户：非空、不超过 64 个字符且不含 / 和空白
+func ValidatePrincipalName(name string) error {
+	return principal.ValidateName(name)
+}
+
+// ownerTenant 从所有者 ID 中取出租户
+func ownerTenant(owner string) string {
+	if i := strings.IndexByte(owner, '/'); i >= 0 {
+		return owner[:i]
+	}
+	return ""
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal 在 ctx 中记录已认证的请求方，Service 据此设置新会话的所有者并校验会话的访问权限
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext 读取 WithPrincipal 记录的请求方
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// conversationAccess 操作需要的会话权限
+type conversationAccess int
+
+const (
+	// accessRead 读取、续会话与分叉，所有者与被共享者可用
+	accessRead conversationAccess = iota
+	// accessOwner 修改、删除、回滚与共享，仅所有者可用
+	accessOwner
+)
+
+// authorize 校验请求方对会话的权限。ctx 中没有请求方（进程内调用）或会话没有所有者（早期版本创建）时不限制；
+// 无权读取的会话视为不存在，避免泄露会话 ID 是否有效
+func authorize(ctx context.Context, conv *ConversationContext, access conversationAccess) error {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || conv.Owner == "" || conv.Owner == p.ID() {
+		return nil
+	}
+	if p.Tenant != ownerTenant(conv.Owner) || !slices.Contains(conv.SharedWith, p.Name) {
+		return ErrConversationNotFound
+	}
+	if access == accessOwner {
+		return fmt.Errorf("%w: 只有会话所有者可以执行此操作", ErrForbidden)
+	}
+	return nil
+}
+
+// loadConversation 读取会话并校验权限
+func (s *Service) loadConversation(ctx context.Context, conversationID string, access conversationAccess) (*ConversationContext, error) {
+	conv, err := s.getConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, conv, access); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// normalizeShares 校验共享名单：去除首尾空白、去重，不能包含所有者自己
+func normalizeShares(owner string, names []string) ([]string, error) {
+	var shares []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if err := ValidatePrincipalName(name); err != nil {
+			return nil, fmt.Errorf("%w: shared_with %v", ErrInvalidConversationUpdate, err)
+		}
+		if owner != "" && (Principal{Name: name, Tenant: ownerTenant(owner)}).ID() == owner {
+			return nil, fmt.Errorf("%w: 不能共享给会话所有者自己", ErrInvalidConversationUpdate)
+		}
+		if !seen[name] {
+			seen[name] = true
+			shares = append(shares, name)
+		}
+	}
+	if len(shares) > maxConversationShares {
+		return nil, fmt.Errorf("%w: 最多共享给 %d 个请求方", ErrInvalidConversationUpdate, maxConversationShares)
+	}
+	return shares, nil
+}
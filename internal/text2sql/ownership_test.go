@@ -0,0 +1,137 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	conv := &ConversationContext{Owner: "acme/alice", SharedWith: []string{"bob"}}
+	tests := []struct {
+		name      string
+		principal *Principal
+		access    conversationAccess
+		want      error
+	}{
+		{"no principal", nil, accessOwner, nil},
+		{"owner", &Principal{Name: "alice", Tenant: "acme"}, accessOwner, nil},
+		{"shared read", &Principal{Name: "bob", Tenant: "acme"}, accessRead, nil},
+		{"shared owner-only", &Principal{Name: "bob", Tenant: "acme"}, accessOwner, ErrForbidden},
+		{"other tenant", &Principal{Name: "bob", Tenant: "other"}, accessRead, ErrConversationNotFound},
+		{"no tenant", &Principal{Name: "bob"}, accessRead, ErrConversationNotFound},
+		{"stranger", &Principal{Name: "carol", Tenant: "acme"}, accessRead, ErrConversationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = WithPrincipal(ctx, *tt.principal)
+			}
+			err := authorize(ctx, conv, tt.access)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("authorize = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 早期版本创建的会话没有所有者，不限制访问
+	if err := authorize(WithPrincipal(context.Background(), Principal{Name: "carol"}), &ConversationContext{}, accessOwner); err != nil {
+		t.Errorf("legacy conversation: %v", err)
+	}
+}
+
+func TestService_ConversationOwnership(t *testing.T) {
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{})
+	alice := WithPrincipal(context.Background(), Principal{Name: "alice", Tenant: "acme"})
+	bob := WithPrincipal(context.Background(), Principal{Name: "bob", Tenant: "acme"})
+	mallory := WithPrincipal(context.Background(), Principal{Name: "bob", Tenant: "evil"})
+	generate := func(ctx context.Context, conversationID string) (*GenerateResponse, error) {
+		return svc.Generate(ctx, &GenerateRequest{
+			Query:          "查询用户",
+			ConversationID: conversationID,
+			Schema:         Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+			Database:       Database{Type: "mysql", Version: "8.0"},
+		})
+	}
+
+	resp, err := generate(alice, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := resp.ConversationID
+	detail, err := svc.GetConversation(alice, id)
+	if err != nil || detail.Owner != "acme/alice" {
+		t.Fatalf("owner detail = %+v, err %v", detail, err)
+	}
+
+	// 未共享时其他请求方看不到会话，续会话会开启新会话
+	if _, err := svc.GetConversation(bob, id); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound before sharing, got %v", err)
+	}
+	if other, err := generate(bob, id); err != nil || other.ConversationID == id {
+		t.Errorf("expected a new conversation for bob, got %+v, err %v", other, err)
+	}
+	if page, err := svc.ListConversations(bob, ConversationFilter{}); err != nil || page.Total != 1 {
+		t.Errorf("bob should only list own conversations, got %+v, err %v", page, err)
+	}
+
+	// 共享后同租户的被共享者可以读取、续会话和分叉，不能修改、回滚或删除
+	shares := []string{" bob ", "bob", "carol"}
+	if detail, err = svc.UpdateConversation(alice, id, ConversationUpdate{SharedWith: &shares}); err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.SharedWith) != 2 || detail.SharedWith[0] != "bob" {
+		t.Errorf("shared_with = %v", detail.SharedWith)
+	}
+	if _, err := svc.GetConversation(bob, id); err != nil {
+		t.Errorf("shared read: %v", err)
+	}
+	if cont, err := generate(bob, id); err != nil || cont.ConversationID != id {
+		t.Errorf("shared continue = %+v, err %v", cont, err)
+	}
+	title := "bob's"
+	if _, err := svc.UpdateConversation(bob, id, ConversationUpdate{Title: &title}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden on update, got %v", err)
+	}
+	if _, err := svc.RollbackConversation(bob, id, 1); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden on rollback, got %v", err)
+	}
+	if err := svc.DeleteConversation(bob, id); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden on delete, got %v", err)
+	}
+	fork, err := svc.ForkConversation(bob, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Owner != "acme/bob" || len(fork.SharedWith) != 0 {
+		t.Errorf("fork owner/shared_with = %q/%v", fork.Owner, fork.SharedWith)
+	}
+	if _, err := svc.RollbackConversation(bob, fork.ConversationID, 1); err != nil {
+		t.Errorf("fork should belong to bob: %v", err)
+	}
+
+	// 其他租户的同名请求方不能访问
+	if _, err := svc.GetConversation(mallory, id); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound across tenants, got %v", err)
+	}
+
+	// 共享名单校验
+	for _, invalid := range [][]string{{""}, {"a/b"}, {"alice"}} {
+		if _, err := svc.UpdateConversation(alice, id, ConversationUpdate{SharedWith: &invalid}); !errors.Is(err, ErrInvalidConversationUpdate) {
+			t.Errorf("shared_with %q: expected ErrInvalidConversationUpdate, got %v", invalid, err)
+		}
+	}
+
+	// 取消共享后恢复隔离
+	none := []string{}
+	if _, err := svc.UpdateConversation(alice, id, ConversationUpdate{SharedWith: &none}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetConversation(bob, id); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound after unsharing, got %v", err)
+	}
+	if err := svc.DeleteConversation(alice, id); err != nil {
+		t.Errorf("owner delete: %v", err)
+	}
+}
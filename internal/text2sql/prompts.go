@@ -0,0 +1,316 @@
+package text2sql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"text2sql/internal/logger"
+)
+
+// 提示词模板的模式
+const (
+	PromptModeGenerate = "generate" // 生成语句的 system prompt
+	PromptModeModify   = "modify"   // 在已有语句基础上修改的 system prompt
+	PromptModeRepair   = "repair"   // 校验失败后反馈给 LLM 的 user 消息
+)
+
+// defaultPromptDialect 对所有方言生效的模板目录名，方言目录中的同名模板优先
+const defaultPromptDialect = "default"
+
+var promptModes = map[string]bool{PromptModeGenerate: true, PromptModeModify: true, PromptModeRepair: true}
+
+// PromptData 提示词模板的数据
+type PromptData struct {
+	Dialect       string   // 方言名，如 mysql
+	DisplayName   string   // 方言展示名，如 MySQL
+	StatementName string   // 语句称呼，如 SQL、Redis 命令
+	Database      Database // 目标数据库
+	Schema        Schema   // 表结构
+	SchemaJSON    string   // 缩进后的 schema JSON
+	Query         string   // 用户问题
+	PreviousSQL   string   // modify 模式下的现有语句
+	Language      string   // 解释语言：zh、en
+	Builtin       string   // 内置提示词，模板可在其基础上追加规则
+	Diagnostics   string   // repair 模式下的校验诊断
+
+	dialect Dialect
+}
+
+// Quote 按方言规则引用标识符，模板中写作 {{.Quote "order"}}
+func (d *PromptData) Quote(name string) string {
+	if d.dialect == nil {
+		return name
+	}
+	return d.dialect.QuoteIdentifier(name)
+}
+
+// newPromptData 构建模板数据的公共部分
+func newPromptData(dialect Dialect, language string, database Database, schema Schema) *PromptData {
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	return &PromptData{
+		Dialect:       dialect.Name(),
+		DisplayName:   dialect.DisplayName(),
+		StatementName: dialect.StatementName(),
+		Database:      database,
+		Schema:        schema,
+		SchemaJSON:    string(schemaJSON),
+		Language:      language,
+		dialect:       dialect,
+	}
+}
+
+var promptFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"json": func(v any) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
+// PromptTemplates 从目录加载的 text/template 提示词，按 <方言>/<模式>[.<语言>].tmpl 组织：
+//
+//	prompts/
+//	├── default/repair.tmpl      # 所有方言
+//	├── mysql/generate.tmpl
+//	└── mysql/generate.en.tmpl   # 英文解释时优先使用
+//
+// 方言目录可以使用别名（如 postgres），未提供的模板使用内置提示词。并发安全，Reload 失败时保留当前模板。
+type PromptTemplates struct {
+	dir string
+
+	mu          sync.RWMutex
+	templates   map[string]*template.Template // key 为 方言/模式[.语言]
+	fingerprint string
+}
+
+// LoadPromptTemplates 加载并校验目录下的全部模板
+func LoadPromptTemplates(dir string) (*PromptTemplates, error) {
+	p := &PromptTemplates{dir: dir}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Dir 模板目录
+func (p *PromptTemplates) Dir() string { return p.dir }
+
+// Names 已加载的模板，如 mysql/generate.en
+func (p *PromptTemplates) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.templates))
+	for name := range p.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reload 重新加载目录下的模板。解析或试渲染失败时返回错误并保留当前模板
+func (p *PromptTemplates) Reload() error {
+	templates, err := parsePromptDir(p.dir)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := promptDirFingerprint(p.dir)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.templates = templates
+	p.fingerprint = fingerprint
+	p.mu.Unlock()
+	return nil
+}
+
+// Watch 每隔 interval 检查模板文件是否变更，变更时重新加载，直到 ctx 结束
+func (p *PromptTemplates) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fingerprint, err := promptDirFingerprint(p.dir)
+		if err != nil {
+			logger.Warn("检查提示词模板失败", "dir", p.dir, "error", err)
+			continue
+		}
+		p.mu.RLock()
+		changed := fingerprint != p.fingerprint
+		p.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := p.Reload(); err != nil {
+			// 记录本次的指纹，避免同一份错误的模板反复报错
+			p.mu.Lock()
+			p.fingerprint = fingerprint
+			p.mu.Unlock()
+			logger.Error("重新加载提示词模板失败，继续使用当前模板", "dir", p.dir, "error", err)
+			continue
+		}
+		logger.Info("提示词模板已重新加载", "dir", p.dir, "templates", len(p.Names()))
+	}
+}
+
+// render 按 方言/模式.语言、方言/模式、default/模式.语言、default/模式 的顺序查找模板并渲染，没有模板时返回 false
+func (p *PromptTemplates) render(mode string, data *PromptData) (string, bool, error) {
+	if p == nil {
+		return "", false, nil
+	}
+	p.mu.RLock()
+	var tmpl *template.Template
+	for _, dialect := range []string{data.Dialect, defaultPromptDialect} {
+		if t, ok := p.templates[dialect+"/"+mode+"."+data.Language]; ok {
+			tmpl = t
+			break
+		}
+		if t, ok := p.templates[dialect+"/"+mode]; ok {
+			tmpl = t
+			break
+		}
+	}
+	p.mu.RUnlock()
+	if tmpl == nil {
+		return "", false, nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", true, fmt.Errorf("渲染提示词模板 %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), true, nil
+}
+
+// parsePromptDir 解析目录下的模板，并用示例数据试渲染，确保启动时即可发现字段名错误
+func parsePromptDir(dir string) (map[string]*template.Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取提示词模板目录: %w", err)
+	}
+	templates := make(map[string]*template.Template)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dialectName := entry.Name()
+		var dialect Dialect
+		if dialectName != defaultPromptDialect {
+			dialect, err = GetDialect(dialectName)
+			if err != nil {
+				return nil, fmt.Errorf("提示词模板目录 %s: %w", dialectName, err)
+			}
+			dialectName = dialect.Name()
+		}
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词模板目录: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".tmpl" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name(), file.Name())
+			key, err := promptTemplateKey(dialectName, file.Name())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if _, dup := templates[key]; dup {
+				return nil, fmt.Errorf("%s: 模板 %s 重复定义", path, key)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("读取提示词模板: %w", err)
+			}
+			tmpl, err := template.New(key).Funcs(promptFuncs).Option("missingkey=error").Parse(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("解析提示词模板 %s: %w", path, err)
+			}
+			if err := checkPromptTemplate(tmpl, dialect); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			templates[key] = tmpl
+		}
+	}
+	return templates, nil
+}
+
+// promptTemplateKey 由文件名 <模式>[.<语言>].tmpl 得到模板的 key
+func promptTemplateKey(dialect, fileName string) (string, error) {
+	mode, lang, hasLang := strings.Cut(strings.TrimSuffix(fileName, ".tmpl"), ".")
+	if !promptModes[mode] {
+		return "", fmt.Errorf("未知的模式 %q（可选 generate、modify、repair）", mode)
+	}
+	if !hasLang {
+		return dialect + "/" + mode, nil
+	}
+	if _, ok := promptSets[lang]; !ok {
+		return "", fmt.Errorf("不支持的语言 %q（可选 %s）", lang, strings.Join(SupportedLanguages(), "、"))
+	}
+	return dialect + "/" + mode + "." + lang, nil
+}
+
+// checkPromptTemplate 用示例数据试渲染模板；default 目录的模板用 MySQL 方言试渲染
+func checkPromptTemplate(tmpl *template.Template, dialect Dialect) error {
+	if dialect == nil {
+		var err error
+		if dialect, err = GetDialect("mysql"); err != nil {
+			return err
+		}
+	}
+	schema := Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}}
+	data := newPromptData(dialect, DefaultLanguage, Database{Type: dialect.Name()}, schema)
+	data.Query = "查询所有用户"
+	data.PreviousSQL = "SELECT id FROM users"
+	data.Builtin = "builtin"
+	data.Diagnostics = "diagnostics"
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("试渲染失败: %w", err)
+	}
+	if strings.TrimSpace(buf.String()) == "" {
+		return fmt.Errorf("渲染结果为空")
+	}
+	return nil
+}
+
+// promptDirFingerprint 目录下模板文件的路径、大小与修改时间的摘要，用于检测变更
+func promptDirFingerprint(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".tmpl" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,187 @@
+package text2sql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePromptFiles 在临时目录中写入模板文件，key 为相对路径
+func writePromptFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadPromptTemplates_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"unknown dialect", map[string]string{"nosuchdb/generate.tmpl": "x"}, "nosuchdb"},
+		{"unknown mode", map[string]string{"mysql/explain.tmpl": "x"}, "未知的模式"},
+		{"unknown language", map[string]string{"mysql/generate.fr.tmpl": "x"}, "不支持的语言"},
+		{"parse error", map[string]string{"mysql/generate.tmpl": "{{.Builtin"}, "解析提示词模板"},
+		{"unknown field", map[string]string{"default/repair.tmpl": "{{.Diagnostic}}"}, "试渲染失败"},
+		{"empty output", map[string]string{"mysql/modify.tmpl": "{{/* nothing */}}"}, "渲染结果为空"},
+		{"alias duplicates canonical", map[string]string{"postgres/generate.tmpl": "a", "postgresql/generate.tmpl": "b"}, "重复定义"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePromptFiles(t, dir, tt.files)
+			_, err := LoadPromptTemplates(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := LoadPromptTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestLoadPromptTemplates_Examples(t *testing.T) {
+	p, err := LoadPromptTemplates("../../prompts")
+	if err != nil {
+		t.Fatalf("example templates should load: %v", err)
+	}
+	if len(p.Names()) == 0 {
+		t.Error("expected example templates")
+	}
+}
+
+func TestService_PromptTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writePromptFiles(t, dir, map[string]string{
+		"mysql/generate.tmpl":    "MYSQL {{.Dialect}} {{.Quote \"order\"}}\n{{.Builtin}}",
+		"mysql/generate.en.tmpl": "MYSQL EN {{.Language}}",
+		"postgres/modify.tmpl":   "PG MODIFY {{.PreviousSQL}}",
+		"default/generate.tmpl":  "DEFAULT {{.DisplayName}} {{len .Schema.Tables}}",
+		"default/repair.tmpl":    "REPAIR {{.StatementName}}: {{.Diagnostics}}",
+		"README.md":              "ignored",
+	})
+	prompts, err := LoadPromptTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates failed: %v", err)
+	}
+	schema := Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}}
+
+	tests := []struct {
+		name        string
+		database    string
+		language    string
+		previousSQL string
+		wantPrefix  string
+	}{
+		{"dialect template", "mysql", "", "", "MYSQL mysql `order`\n你是一个专业的 SQL 专家"},
+		{"language specific template", "mysql", "en", "", "MYSQL EN en"},
+		{"alias directory", "postgresql", "", "SELECT id FROM users", "PG MODIFY SELECT id FROM users"},
+		{"default directory", "sqlite", "", "", "DEFAULT SQLite 1"},
+		{"builtin without template", "mysql", "", "SELECT id FROM users", "你是一个专业的 SQL 专家。用户会提供现有的 SQL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewServiceWithOptions(&recordingProvider{}, nil, ServiceOptions{Prompts: prompts})
+			rendered, err := svc.RenderPrompt(context.Background(), &GenerateRequest{
+				Query:       "list users",
+				Schema:      schema,
+				Database:    Database{Type: tt.database},
+				Language:    tt.language,
+				PreviousSQL: tt.previousSQL,
+			})
+			if err != nil {
+				t.Fatalf("RenderPrompt failed: %v", err)
+			}
+			if system := rendered.Messages[0].Content; !strings.HasPrefix(system, tt.wantPrefix) {
+				t.Errorf("system prompt = %q, want prefix %q", system, tt.wantPrefix)
+			}
+		})
+	}
+
+	provider := &recordingProvider{content: "DELETE FROM users"}
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{MaxRetries: 2, Prompts: prompts})
+	if _, err := svc.Generate(context.Background(), &GenerateRequest{
+		Query:    "remove users",
+		Schema:   schema,
+		Database: Database{Type: "mysql"},
+	}); err == nil {
+		t.Fatal("expected validation error")
+	}
+	retry := provider.requests[1].Messages
+	if last := retry[len(retry)-1].Content; !strings.HasPrefix(last, "REPAIR SQL: ") {
+		t.Errorf("repair message = %q", last)
+	}
+}
+
+func TestService_RenderPrompt_DoesNotCallLLM(t *testing.T) {
+	provider := &recordingProvider{content: "SELECT 1"}
+	store := NewMemoryContextStore()
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{ContextStore: store, StructuredOutput: true})
+	rendered, err := svc.RenderPrompt(context.Background(), &GenerateRequest{
+		Query:    "list users",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id"}}}}},
+		Database: Database{Type: "mysql"},
+	})
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if len(provider.requests) != 0 {
+		t.Errorf("expected no LLM calls, got %d", len(provider.requests))
+	}
+	if rendered.Dialect != "mysql" || rendered.Language != "zh" || len(rendered.Messages) != 2 {
+		t.Errorf("unexpected rendered prompt: %+v", rendered)
+	}
+	if !strings.Contains(rendered.Messages[0].Content, "只输出一个 JSON 对象") || len(rendered.ResponseFormat) == 0 {
+		t.Errorf("expected structured output instruction and response format")
+	}
+}
+
+func TestPromptTemplates_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writePromptFiles(t, dir, map[string]string{"mysql/generate.tmpl": "V1"})
+	prompts, err := LoadPromptTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func() string {
+		out, _, err := prompts.render(PromptModeGenerate, &PromptData{Dialect: "mysql", Language: "zh"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// 模板错误时保留当前模板
+	writePromptFiles(t, dir, map[string]string{"mysql/generate.tmpl": "{{.Nope}}"})
+	if err := prompts.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	if got := render(); got != "V1" {
+		t.Errorf("after failed reload got %q, want V1", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prompts.Watch(ctx, 10*time.Millisecond)
+	writePromptFiles(t, dir, map[string]string{"mysql/generate.tmpl": "V2 changed"})
+	deadline := time.Now().Add(2 * time.Second)
+	for render() != "V2 changed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("watch did not reload, got %q", render())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
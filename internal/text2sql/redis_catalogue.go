@@ -0,0 +1,287 @@
+package text2sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Redis 模块
+const (
+	redisModuleJSON   = "json"   // RedisJSON
+	redisModuleSearch = "search" // RediSearch
+)
+
+// redisModuleNames 模块展示名
+var redisModuleNames = map[string]string{
+	redisModuleJSON:   "RedisJSON",
+	redisModuleSearch: "RediSearch",
+}
+
+// normalizeRedisModule 将 Database.Modules 中的写法统一为模块标识，无法识别时返回空串
+func normalizeRedisModule(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "json", "rejson", "redisjson":
+		return redisModuleJSON
+	case "search", "ft", "redisearch":
+		return redisModuleSearch
+	default:
+		return ""
+	}
+}
+
+// redisCommandSpec Redis 命令目录项
+type redisCommandSpec struct {
+	Group  string // 分组，用于生成 prompt
+	Since  string // 引入版本（模块命令为空）
+	Write  bool   // 写命令或管理命令，始终禁止
+	Module string // 所属模块，空为核心命令
+	Arity  int    // Redis 语义：正数为精确参数个数，负数为最少个数（均含命令名及子命令名）
+	Check  func(c *redisCommand, limits RedisLimits) Diagnostics
+	Keys   func(c *redisCommand) []int // key 参数下标，nil 表示命令名之后的第一个参数
+}
+
+// redisCommandContainers 带子命令的命令，目录中以 "OBJECT ENCODING" 形式登记
+var redisCommandContainers = map[string]bool{
+	"OBJECT": true, "MEMORY": true, "XINFO": true,
+}
+
+// redisCatalogue Redis 命令目录：只读命令及其引入版本、参数规格，写命令仅用于给出明确的拒绝原因
+var redisCatalogue = map[string]redisCommandSpec{
+	// string
+	"GET":      {Group: "string", Since: "1.0.0", Arity: 2},
+	"MGET":     {Group: "string", Since: "1.0.0", Arity: -2, Keys: redisKeyRange(1, -1)},
+	"STRLEN":   {Group: "string", Since: "2.2.0", Arity: 2},
+	"GETRANGE": {Group: "string", Since: "2.4.0", Arity: 4, Check: checkIntArgs(map[int]string{2: "start", 3: "end"})},
+	"GETBIT":   {Group: "string", Since: "2.2.0", Arity: 3, Check: checkIntArgs(map[int]string{2: "offset"})},
+	"BITCOUNT": {Group: "string", Since: "2.6.0", Arity: -2},
+	"BITPOS":   {Group: "string", Since: "2.8.7", Arity: -3},
+	"LCS":      {Group: "string", Since: "7.0.0", Arity: -3, Keys: redisKeyRange(1, 2)},
+	"PFCOUNT":  {Group: "string", Since: "2.8.9", Arity: -2, Keys: redisKeyRange(1, -1)},
+
+	// hash
+	"HGET":       {Group: "hash", Since: "2.0.0", Arity: 3},
+	"HMGET":      {Group: "hash", Since: "2.0.0", Arity: -3},
+	"HGETALL":    {Group: "hash", Since: "2.0.0", Arity: 2},
+	"HKEYS":      {Group: "hash", Since: "2.0.0", Arity: 2},
+	"HVALS":      {Group: "hash", Since: "2.0.0", Arity: 2},
+	"HLEN":       {Group: "hash", Since: "2.0.0", Arity: 2},
+	"HEXISTS":    {Group: "hash", Since: "2.0.0", Arity: 3},
+	"HSTRLEN":    {Group: "hash", Since: "3.2.0", Arity: 3},
+	"HRANDFIELD": {Group: "hash", Since: "6.2.0", Arity: -2, Check: checkRandomCount(2, redisGrammar{"WITHVALUES": {}})},
+	"HSCAN": {Group: "hash", Since: "2.8.0", Arity: -3, Check: checkScan(2, redisGrammar{
+		"MATCH": {Args: 1}, "COUNT": {Args: 1}, "NOVALUES": {Since: "7.4.0"},
+	})},
+
+	// list
+	"LRANGE": {Group: "list", Since: "1.0.0", Arity: 4, Check: checkIndexRange(2)},
+	"LINDEX": {Group: "list", Since: "1.0.0", Arity: 3, Check: checkIntArgs(map[int]string{2: "index"})},
+	"LLEN":   {Group: "list", Since: "1.0.0", Arity: 2},
+	"LPOS": {Group: "list", Since: "6.0.6", Arity: -3, Check: checkOptions(3, redisGrammar{
+		"RANK": {Args: 1}, "COUNT": {Args: 1}, "MAXLEN": {Args: 1},
+	})},
+
+	// set
+	"SMEMBERS":    {Group: "set", Since: "1.0.0", Arity: 2},
+	"SISMEMBER":   {Group: "set", Since: "1.0.0", Arity: 3},
+	"SMISMEMBER":  {Group: "set", Since: "6.2.0", Arity: -3},
+	"SCARD":       {Group: "set", Since: "1.0.0", Arity: 2},
+	"SRANDMEMBER": {Group: "set", Since: "1.0.0", Arity: -2, Check: checkRandomCount(2, nil)},
+	"SINTER":      {Group: "set", Since: "1.0.0", Arity: -2, Keys: redisKeyRange(1, -1)},
+	"SUNION":      {Group: "set", Since: "1.0.0", Arity: -2, Keys: redisKeyRange(1, -1)},
+	"SDIFF":       {Group: "set", Since: "1.0.0", Arity: -2, Keys: redisKeyRange(1, -1)},
+	"SINTERCARD":  {Group: "set", Since: "7.0.0", Arity: -3, Keys: redisNumKeys(1)},
+	"SSCAN":       {Group: "set", Since: "2.8.0", Arity: -3, Check: checkScan(2, redisGrammar{"MATCH": {Args: 1}, "COUNT": {Args: 1}})},
+
+	// sorted set
+	"ZRANGE":           {Group: "zset", Since: "1.2.0", Arity: -4, Check: checkZRange},
+	"ZREVRANGE":        {Group: "zset", Since: "1.2.0", Arity: -4, Check: checkIndexRangeWithOptions(redisGrammar{"WITHSCORES": {}})},
+	"ZRANGEBYSCORE":    {Group: "zset", Since: "1.0.5", Arity: -4, Check: checkScoreRange},
+	"ZREVRANGEBYSCORE": {Group: "zset", Since: "2.2.0", Arity: -4, Check: checkScoreRange},
+	"ZRANGEBYLEX":      {Group: "zset", Since: "2.8.9", Arity: -4, Check: checkScoreRange},
+	"ZRANK":            {Group: "zset", Since: "2.0.0", Arity: -3, Check: checkOptions(3, redisGrammar{"WITHSCORE": {Since: "7.2.0"}})},
+	"ZREVRANK":         {Group: "zset", Since: "2.0.0", Arity: -3, Check: checkOptions(3, redisGrammar{"WITHSCORE": {Since: "7.2.0"}})},
+	"ZSCORE":           {Group: "zset", Since: "1.2.0", Arity: 3},
+	"ZMSCORE":          {Group: "zset", Since: "6.2.0", Arity: -3},
+	"ZCARD":            {Group: "zset", Since: "1.2.0", Arity: 2},
+	"ZCOUNT":           {Group: "zset", Since: "2.0.0", Arity: 4},
+	"ZLEXCOUNT":        {Group: "zset", Since: "2.8.9", Arity: 4},
+	"ZRANDMEMBER":      {Group: "zset", Since: "6.2.0", Arity: -2, Check: checkRandomCount(2, redisGrammar{"WITHSCORES": {}})},
+	"ZSCAN":            {Group: "zset", Since: "2.8.0", Arity: -3, Check: checkScan(2, redisGrammar{"MATCH": {Args: 1}, "COUNT": {Args: 1}})},
+
+	// stream
+	"XLEN":         {Group: "stream", Since: "5.0.0", Arity: 2},
+	"XRANGE":       {Group: "stream", Since: "5.0.0", Arity: -4, Check: checkStreamRange},
+	"XREVRANGE":    {Group: "stream", Since: "5.0.0", Arity: -4, Check: checkStreamRange},
+	"XREAD":        {Group: "stream", Since: "5.0.0", Arity: -4, Check: checkXRead, Keys: redisStreamKeys},
+	"XINFO STREAM": {Group: "stream", Since: "5.0.0", Arity: -3},
+	"XINFO GROUPS": {Group: "stream", Since: "5.0.0", Arity: 3},
+
+	// geo
+	"GEOPOS":    {Group: "geo", Since: "3.2.0", Arity: -2},
+	"GEODIST":   {Group: "geo", Since: "3.2.0", Arity: -4},
+	"GEOHASH":   {Group: "geo", Since: "3.2.0", Arity: -2},
+	"GEOSEARCH": {Group: "geo", Since: "6.2.0", Arity: -7},
+
+	// key
+	"KEYS":        {Group: "key", Since: "1.0.0", Arity: 2, Check: checkKeys, Keys: noRedisKeys},
+	"SCAN":        {Group: "key", Since: "2.8.0", Arity: -2, Check: checkScan(1, redisGrammar{"MATCH": {Args: 1}, "COUNT": {Args: 1}, "TYPE": {Args: 1, Since: "6.0.0"}}), Keys: noRedisKeys},
+	"EXISTS":      {Group: "key", Since: "1.0.0", Arity: -2, Keys: redisKeyRange(1, -1)},
+	"TYPE":        {Group: "key", Since: "1.0.0", Arity: 2},
+	"TTL":         {Group: "key", Since: "1.0.0", Arity: 2},
+	"PTTL":        {Group: "key", Since: "2.6.0", Arity: 2},
+	"EXPIRETIME":  {Group: "key", Since: "7.0.0", Arity: 2},
+	"PEXPIRETIME": {Group: "key", Since: "7.0.0", Arity: 2},
+	"SORT_RO":     {Group: "key", Since: "7.0.0", Arity: -2},
+	"DBSIZE":      {Group: "key", Since: "1.0.0", Arity: 1, Keys: noRedisKeys},
+
+	// introspection
+	"OBJECT ENCODING": {Group: "introspection", Since: "2.2.3", Arity: 3},
+	"OBJECT FREQ":     {Group: "introspection", Since: "4.0.0", Arity: 3},
+	"OBJECT IDLETIME": {Group: "introspection", Since: "2.2.3", Arity: 3},
+	"OBJECT REFCOUNT": {Group: "introspection", Since: "2.2.3", Arity: 3},
+	"MEMORY USAGE":    {Group: "introspection", Since: "4.0.0", Arity: -3, Check: checkOptions(3, redisGrammar{"SAMPLES": {Args: 1}})},
+
+	// RedisJSON
+	"JSON.GET":      {Group: "json", Module: redisModuleJSON, Arity: -2},
+	"JSON.MGET":     {Group: "json", Module: redisModuleJSON, Arity: -3, Keys: redisKeyRange(1, -2)},
+	"JSON.TYPE":     {Group: "json", Module: redisModuleJSON, Arity: -2},
+	"JSON.STRLEN":   {Group: "json", Module: redisModuleJSON, Arity: -2},
+	"JSON.ARRLEN":   {Group: "json", Module: redisModuleJSON, Arity: -2},
+	"JSON.ARRINDEX": {Group: "json", Module: redisModuleJSON, Arity: -4},
+	"JSON.OBJKEYS":  {Group: "json", Module: redisModuleJSON, Arity: -2},
+	"JSON.OBJLEN":   {Group: "json", Module: redisModuleJSON, Arity: -2},
+
+	// RediSearch
+	"FT.SEARCH":    {Group: "search", Module: redisModuleSearch, Arity: -3, Check: checkSearchLimit, Keys: noRedisKeys},
+	"FT.AGGREGATE": {Group: "search", Module: redisModuleSearch, Arity: -3, Check: checkSearchLimit, Keys: noRedisKeys},
+	"FT.INFO":      {Group: "search", Module: redisModuleSearch, Arity: 2, Keys: noRedisKeys},
+	"FT._LIST":     {Group: "search", Module: redisModuleSearch, Arity: 1, Keys: noRedisKeys},
+	"FT.EXPLAIN":   {Group: "search", Module: redisModuleSearch, Arity: -3, Keys: noRedisKeys},
+	"FT.TAGVALS":   {Group: "search", Module: redisModuleSearch, Arity: 3, Keys: noRedisKeys},
+
+	// 写命令与管理命令
+	"SET": {Write: true}, "SETEX": {Write: true}, "PSETEX": {Write: true}, "SETNX": {Write: true}, "MSET": {Write: true}, "MSETNX": {Write: true},
+	"GETSET": {Write: true}, "GETDEL": {Write: true}, "GETEX": {Write: true}, "SETRANGE": {Write: true}, "APPEND": {Write: true}, "SETBIT": {Write: true},
+	"INCR": {Write: true}, "INCRBY": {Write: true}, "INCRBYFLOAT": {Write: true}, "DECR": {Write: true}, "DECRBY": {Write: true},
+	"HSET": {Write: true}, "HSETNX": {Write: true}, "HMSET": {Write: true}, "HDEL": {Write: true}, "HINCRBY": {Write: true}, "HINCRBYFLOAT": {Write: true},
+	"LPUSH": {Write: true}, "RPUSH": {Write: true}, "LPOP": {Write: true}, "RPOP": {Write: true}, "LREM": {Write: true}, "LSET": {Write: true},
+	"LTRIM": {Write: true}, "LINSERT": {Write: true}, "LMOVE": {Write: true}, "RPOPLPUSH": {Write: true}, "BLPOP": {Write: true}, "BRPOP": {Write: true},
+	"SADD": {Write: true}, "SREM": {Write: true}, "SPOP": {Write: true}, "SMOVE": {Write: true},
+	"SINTERSTORE": {Write: true}, "SUNIONSTORE": {Write: true}, "SDIFFSTORE": {Write: true},
+	"ZADD": {Write: true}, "ZREM": {Write: true}, "ZINCRBY": {Write: true}, "ZPOPMIN": {Write: true}, "ZPOPMAX": {Write: true},
+	"ZREMRANGEBYRANK": {Write: true}, "ZREMRANGEBYSCORE": {Write: true}, "ZREMRANGEBYLEX": {Write: true},
+	"ZUNIONSTORE": {Write: true}, "ZINTERSTORE": {Write: true}, "ZRANGESTORE": {Write: true},
+	"XADD": {Write: true}, "XDEL": {Write: true}, "XTRIM": {Write: true}, "XGROUP": {Write: true}, "XACK": {Write: true}, "XREADGROUP": {Write: true}, "XCLAIM": {Write: true},
+	"PFADD": {Write: true}, "PFMERGE": {Write: true}, "BITOP": {Write: true}, "GEOADD": {Write: true}, "GEOSEARCHSTORE": {Write: true},
+	"DEL": {Write: true}, "UNLINK": {Write: true}, "EXPIRE": {Write: true}, "PEXPIRE": {Write: true}, "EXPIREAT": {Write: true}, "PEXPIREAT": {Write: true},
+	"PERSIST": {Write: true}, "RENAME": {Write: true}, "RENAMENX": {Write: true}, "COPY": {Write: true}, "MOVE": {Write: true},
+	"RESTORE": {Write: true}, "MIGRATE": {Write: true}, "SORT": {Write: true},
+	"FLUSHALL": {Write: true}, "FLUSHDB": {Write: true}, "SWAPDB": {Write: true}, "CONFIG": {Write: true}, "SHUTDOWN": {Write: true},
+	"SAVE": {Write: true}, "BGSAVE": {Write: true}, "BGREWRITEAOF": {Write: true}, "REPLICAOF": {Write: true}, "SLAVEOF": {Write: true},
+	"DEBUG": {Write: true}, "MONITOR": {Write: true}, "CLIENT": {Write: true}, "PUBLISH": {Write: true},
+	"EVAL": {Write: true}, "EVALSHA": {Write: true}, "FCALL": {Write: true}, "SCRIPT": {Write: true}, "FUNCTION": {Write: true},
+	"JSON.SET": {Write: true, Module: redisModuleJSON}, "JSON.MSET": {Write: true, Module: redisModuleJSON}, "JSON.MERGE": {Write: true, Module: redisModuleJSON},
+	"JSON.DEL": {Write: true, Module: redisModuleJSON}, "JSON.FORGET": {Write: true, Module: redisModuleJSON}, "JSON.CLEAR": {Write: true, Module: redisModuleJSON},
+	"JSON.TOGGLE": {Write: true, Module: redisModuleJSON}, "JSON.NUMINCRBY": {Write: true, Module: redisModuleJSON}, "JSON.STRAPPEND": {Write: true, Module: redisModuleJSON},
+	"JSON.ARRAPPEND": {Write: true, Module: redisModuleJSON}, "JSON.ARRINSERT": {Write: true, Module: redisModuleJSON},
+	"JSON.ARRPOP": {Write: true, Module: redisModuleJSON}, "JSON.ARRTRIM": {Write: true, Module: redisModuleJSON},
+	"FT.CREATE": {Write: true, Module: redisModuleSearch}, "FT.ALTER": {Write: true, Module: redisModuleSearch}, "FT.DROPINDEX": {Write: true, Module: redisModuleSearch},
+	"FT.ALIASADD": {Write: true, Module: redisModuleSearch}, "FT.ALIASUPDATE": {Write: true, Module: redisModuleSearch}, "FT.ALIASDEL": {Write: true, Module: redisModuleSearch},
+	"FT.SUGADD": {Write: true, Module: redisModuleSearch}, "FT.SUGDEL": {Write: true, Module: redisModuleSearch},
+	"FT.DICTADD": {Write: true, Module: redisModuleSearch}, "FT.DICTDEL": {Write: true, Module: redisModuleSearch}, "FT.SYNUPDATE": {Write: true, Module: redisModuleSearch},
+}
+
+// lookupRedisCommand 按命令名（及子命令名）查找目录项，返回目录中的完整命令名
+func lookupRedisCommand(args []redisArg) (string, redisCommandSpec, bool) {
+	if len(args) == 0 {
+		return "", redisCommandSpec{}, false
+	}
+	name := strings.ToUpper(args[0].value)
+	if redisCommandContainers[name] && len(args) > 1 {
+		full := name + " " + strings.ToUpper(args[1].value)
+		spec, ok := redisCatalogue[full]
+		return full, spec, ok
+	}
+	spec, ok := redisCatalogue[name]
+	return name, spec, ok
+}
+
+// redisTarget 目标 Redis 实例：版本与启用的模块
+type redisTarget struct {
+	rawVersion   string
+	version      dbVersion
+	versionKnown bool
+	modules      map[string]bool
+}
+
+func newRedisTarget(database Database) redisTarget {
+	t := redisTarget{rawVersion: database.Version, modules: make(map[string]bool)}
+	t.version, t.versionKnown = parseDBVersion(database.Version)
+	for _, m := range database.Modules {
+		if id := normalizeRedisModule(m); id != "" {
+			t.modules[id] = true
+		}
+	}
+	return t
+}
+
+// display 版本展示文本
+func (t redisTarget) display() string {
+	return t.rawVersion
+}
+
+// supports 版本未知时视为支持
+func (t redisTarget) supports(since string) bool {
+	if since == "" || !t.versionKnown {
+		return true
+	}
+	v, _ := parseDBVersion(since)
+	return !t.version.less(v)
+}
+
+// available 命令在目标实例上是否可用（只读、版本满足、模块已启用）
+func (t redisTarget) available(spec redisCommandSpec) bool {
+	if spec.Write || !t.supports(spec.Since) {
+		return false
+	}
+	return spec.Module == "" || t.modules[spec.Module]
+}
+
+// redisGroupTitles prompt 中的分组标题，按顺序展示
+var redisGroupTitles = []struct{ group, title string }{
+	{"string", "字符串"}, {"hash", "哈希"}, {"list", "列表"}, {"set", "集合"}, {"zset", "有序集合"},
+	{"stream", "流"}, {"geo", "地理位置"}, {"key", "键空间"}, {"introspection", "对象信息"},
+	{"json", "RedisJSON"}, {"search", "RediSearch"},
+}
+
+// redisAvailableCommands 按分组列出目标实例可用的只读命令，用于 system prompt
+func redisAvailableCommands(database Database) string {
+	target := newRedisTarget(database)
+	groups := make(map[string][]string)
+	for name, spec := range redisCatalogue {
+		if target.available(spec) {
+			groups[spec.Group] = append(groups[spec.Group], name)
+		}
+	}
+	var b strings.Builder
+	for _, g := range redisGroupTitles {
+		names := groups[g.group]
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "- %s：%s\n", g.title, strings.Join(names, "、"))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// isRedisCommandName 判断首个单词是否为目录中的命令（含写命令，便于校验阶段给出明确拒绝）
+func isRedisCommandName(word string) bool {
+	word = strings.ToUpper(word)
+	if redisCommandContainers[word] {
+		return true
+	}
+	_, ok := redisCatalogue[word]
+	return ok
+}
@@ -0,0 +1,546 @@
+package text2sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RedisLimits Redis 命令的资源限制，数值类限制 <= 0 表示不限制
+type RedisLimits struct {
+	AllowUnboundedKeys bool // 是否允许 KEYS 使用无字面前缀的模式（如 KEYS *）
+	MaxScanCount       int  // SCAN/HSCAN/SSCAN/ZSCAN 的 COUNT 上限
+	MaxRangeSize       int  // LRANGE/ZRANGE/XRANGE 等单次返回元素个数上限（含 LIMIT count 与 COUNT）
+}
+
+// DefaultRedisLimits 默认限制：禁止无前缀 KEYS，COUNT 与范围均不超过 1000
+func DefaultRedisLimits() RedisLimits {
+	return RedisLimits{
+		AllowUnboundedKeys: false,
+		MaxScanCount:       1000,
+		MaxRangeSize:       1000,
+	}
+}
+
+// redisArg Redis 命令参数
+type redisArg struct {
+	value string // 去引号、处理转义后的值
+	raw   string // 原始文本
+	pos   int    // 在所在行中的字节偏移
+}
+
+// redisSplitError 命令切分错误（引号不匹配等）
+type redisSplitError struct {
+	pos int
+	msg string
+}
+
+// splitRedisArgs 按 redis-cli 的规则切分参数：
+// 双引号内支持 \n \r \t \b \a \xHH 等转义，单引号内仅支持 \'，闭合引号后必须是空白或行尾。
+func splitRedisArgs(line string) ([]redisArg, *redisSplitError) {
+	var args []redisArg
+	n := len(line)
+	i := 0
+	for {
+		for i < n && isRedisSpace(line[i]) {
+			i++
+		}
+		if i >= n {
+			return args, nil
+		}
+		start := i
+		var buf []byte
+		inDouble, inSingle := false, false
+		quoteStart := 0
+		for done := false; !done; {
+			switch {
+			case inDouble:
+				if i >= n {
+					return nil, &redisSplitError{pos: quoteStart, msg: "双引号未闭合"}
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+3 < n && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					buf = append(buf, byte(b))
+					i += 4
+				case c == '\\' && i+1 < n:
+					buf = append(buf, redisEscape(line[i+1]))
+					i += 2
+				case c == '"':
+					i++
+					if i < n && !isRedisSpace(line[i]) {
+						return nil, &redisSplitError{pos: i, msg: "闭合引号后必须是空白"}
+					}
+					done = true
+				default:
+					buf = append(buf, c)
+					i++
+				}
+			case inSingle:
+				if i >= n {
+					return nil, &redisSplitError{pos: quoteStart, msg: "单引号未闭合"}
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+1 < n && line[i+1] == '\'':
+					buf = append(buf, '\'')
+					i += 2
+				case c == '\'':
+					i++
+					if i < n && !isRedisSpace(line[i]) {
+						return nil, &redisSplitError{pos: i, msg: "闭合引号后必须是空白"}
+					}
+					done = true
+				default:
+					buf = append(buf, c)
+					i++
+				}
+			default:
+				if i >= n || isRedisSpace(line[i]) {
+					done = true
+					break
+				}
+				switch line[i] {
+				case '"':
+					inDouble, quoteStart = true, i
+				case '\'':
+					inSingle, quoteStart = true, i
+				default:
+					buf = append(buf, line[i])
+				}
+				i++
+			}
+		}
+		args = append(args, redisArg{value: string(buf), raw: line[start:i], pos: start})
+	}
+}
+
+func isRedisSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func redisEscape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	default:
+		return c
+	}
+}
+
+// redisCommand 解析后的单条 Redis 命令
+type redisCommand struct {
+	name   string      // 目录中的大写命令名，子命令形如 "OBJECT ENCODING"
+	args   []redisArg  // args[0] 为命令名
+	src    string      // 完整的命令文本，用于计算行列
+	offset int         // 当前行在 src 中的字节偏移
+	target redisTarget // 目标实例的版本与模块
+}
+
+// diag 创建定位到第 idx 个参数的诊断
+func (c *redisCommand) diag(idx int, code string, severity Severity, format string, args ...any) *ValidationError {
+	a := c.args[idx]
+	return newDiagnostic(code, severity, format, args...).at(c.src, c.offset+a.pos, a.raw)
+}
+
+// checkArity 按 Redis 的 arity 语义校验参数个数：正数为精确个数，负数为最少个数（均含命令名）
+func (c *redisCommand) checkArity(arity int) *ValidationError {
+	n := len(c.args)
+	if (arity > 0 && n == arity) || (arity < 0 && n >= -arity) {
+		return nil
+	}
+	want := fmt.Sprintf("%d", arity-1)
+	if arity < 0 {
+		want = fmt.Sprintf("至少 %d", -arity-1)
+	}
+	return c.diag(0, CodeRedisWrongArity, SeverityError, "%s 参数个数错误：需要 %s 个参数，实际 %d 个", c.name, want, n-1)
+}
+
+// intArg 解析第 idx 个参数为整数
+func (c *redisCommand) intArg(idx int, what string) (int64, *ValidationError) {
+	n, err := strconv.ParseInt(c.args[idx].value, 10, 64)
+	if err != nil {
+		return 0, c.diag(idx, CodeRedisInvalidArgument, SeverityError, "%s 的 %s 必须是整数: %s", c.name, what, c.args[idx].value)
+	}
+	return n, nil
+}
+
+// redisOption 选项语法：其后跟随的参数个数及引入版本
+type redisOption struct {
+	Args  int
+	Since string
+}
+
+// redisGrammar 选项名（大写）→ 选项语法
+type redisGrammar map[string]redisOption
+
+// requireVersion 目标版本低于 since 时返回诊断
+func (c *redisCommand) requireVersion(idx int, what, since string) *ValidationError {
+	if c.target.supports(since) {
+		return nil
+	}
+	return c.diag(idx, CodeUnsupportedFeature, SeverityError, "Redis %s 不支持 %s（需要 %s 及以上版本）", c.target.display(), what, since).
+		withSuggestion("改用该版本支持的命令或选项")
+}
+
+// parseOptions 从 args[from:] 开始按语法解析选项，返回选项名 → 选项所在下标
+func (c *redisCommand) parseOptions(from int, grammar redisGrammar) (map[string]int, *ValidationError) {
+	opts := make(map[string]int)
+	for i := from; i < len(c.args); {
+		name := strings.ToUpper(c.args[i].value)
+		opt, ok := grammar[name]
+		if !ok {
+			return nil, c.diag(i, CodeRedisInvalidArgument, SeverityError, "%s 不支持的选项: %s", c.name, c.args[i].value)
+		}
+		if _, dup := opts[name]; dup {
+			return nil, c.diag(i, CodeRedisInvalidArgument, SeverityError, "%s 选项重复: %s", c.name, name)
+		}
+		if i+opt.Args >= len(c.args) && opt.Args > 0 {
+			return nil, c.diag(i, CodeRedisWrongArity, SeverityError, "%s 选项 %s 需要 %d 个参数", c.name, name, opt.Args)
+		}
+		if d := c.requireVersion(i, c.name+" "+name, opt.Since); d != nil {
+			return nil, d
+		}
+		opts[name] = i
+		i += 1 + opt.Args
+	}
+	return opts, nil
+}
+
+// validateRedis 校验 Redis 命令：切分参数，按命令目录校验只读、版本与模块，再按命令规格校验参数与资源限制；
+// 声明了 key 空间时还校验 key 是否符合模式及类型
+func validateRedis(commands string, database Database, keys []RedisKey, limits RedisLimits) Diagnostics {
+	target := newRedisTarget(database)
+	keySpace := newRedisKeySpace(keys)
+	var diags Diagnostics
+	offset := 0
+	for _, raw := range strings.SplitAfter(commands, "\n") {
+		lineStart := offset
+		offset += len(raw)
+		args, serr := splitRedisArgs(strings.TrimRight(raw, "\r\n"))
+		if serr != nil {
+			diags = append(diags, newDiagnostic(CodeRedisSyntaxError, SeverityError, "Redis 命令语法错误: %s", serr.msg).
+				at(commands, lineStart+serr.pos, "").withSuggestion("检查引号是否成对出现"))
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		// Redis 命令大小写不敏感，统一转大写比较
+		name, spec, ok := lookupRedisCommand(args)
+		cmd := &redisCommand{name: name, args: args, src: commands, offset: lineStart, target: target}
+		if !ok {
+			diags = append(diags, cmd.diag(0, CodeRedisUnknownCommand, SeverityError, "不支持的 Redis 命令或非只读命令: %s", name).
+				withSuggestion("仅允许只读命令如 GET、HGET、LRANGE、SCAN 等"))
+			continue
+		}
+		if spec.Write {
+			diags = append(diags, cmd.diag(0, CodeRedisWriteCommand, SeverityError, "不允许的 Redis 写操作或管理命令: %s", name).
+				withSuggestion("只使用 GET、HGET、LRANGE、SCAN 等只读命令"))
+			continue
+		}
+		if spec.Module != "" && !target.modules[spec.Module] {
+			diags = append(diags, cmd.diag(0, CodeUnsupportedFeature, SeverityError, "%s 需要 %s 模块，但目标实例未声明该模块", name, redisModuleNames[spec.Module]).
+				withSuggestion("改用核心命令，或在 database.modules 中声明已安装的模块"))
+			continue
+		}
+		if d := cmd.requireVersion(0, name, spec.Since); d != nil {
+			diags = append(diags, d)
+			continue
+		}
+		if d := cmd.checkArity(spec.Arity); d != nil {
+			diags = append(diags, d)
+			continue
+		}
+		if spec.Check != nil {
+			diags = append(diags, spec.Check(cmd, limits)...)
+		}
+		if keySpace != nil {
+			diags = append(diags, keySpace.check(cmd, spec)...)
+		}
+	}
+	return diags
+}
+
+// checkKeys KEYS 会遍历整个键空间：无字面前缀的模式默认禁止，其余给出警告
+func checkKeys(c *redisCommand, limits RedisLimits) Diagnostics {
+	pattern := c.args[1].value
+	if !limits.AllowUnboundedKeys && (pattern == "" || strings.ContainsRune("*?[", rune(pattern[0]))) {
+		return Diagnostics{c.diag(1, CodeRedisLimitExceeded, SeverityError, "禁止无前缀的 KEYS 全量匹配: KEYS %s", pattern).
+			withSuggestion("改用 SCAN 0 MATCH <前缀>* COUNT 100 迭代")}
+	}
+	return Diagnostics{c.diag(0, CodeRedisLimitExceeded, SeverityWarning, "KEYS 会阻塞并遍历整个键空间").
+		withSuggestion("生产环境建议改用 SCAN 迭代")}
+}
+
+// checkScan SCAN 系列：cursor 必须为整数，COUNT 不超过上限
+func checkScan(cursorIdx int, grammar redisGrammar) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, limits RedisLimits) Diagnostics {
+		if cursor, d := c.intArg(cursorIdx, "cursor"); d != nil {
+			return Diagnostics{d}
+		} else if cursor < 0 {
+			return Diagnostics{c.diag(cursorIdx, CodeRedisInvalidArgument, SeverityError, "%s 的 cursor 不能为负数", c.name)}
+		}
+		opts, d := c.parseOptions(cursorIdx+1, grammar)
+		if d != nil {
+			return Diagnostics{d}
+		}
+		idx, ok := opts["COUNT"]
+		if !ok {
+			return nil
+		}
+		count, d := c.intArg(idx+1, "COUNT")
+		if d != nil {
+			return Diagnostics{d}
+		}
+		if count <= 0 {
+			return Diagnostics{c.diag(idx+1, CodeRedisInvalidArgument, SeverityError, "%s 的 COUNT 必须为正数", c.name)}
+		}
+		if limits.MaxScanCount > 0 && count > int64(limits.MaxScanCount) {
+			return Diagnostics{c.diag(idx+1, CodeRedisLimitExceeded, SeverityError, "%s 的 COUNT %d 超过上限 %d", c.name, count, limits.MaxScanCount).
+				withSuggestion(fmt.Sprintf("COUNT 不超过 %d，通过游标多次迭代", limits.MaxScanCount))}
+		}
+		return nil
+	}
+}
+
+// checkIndexRange 下标范围（start stop）校验
+func checkIndexRange(startIdx int) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, limits RedisLimits) Diagnostics {
+		return c.checkIndexRange(startIdx, limits)
+	}
+}
+
+// checkIndexRangeWithOptions 下标范围 + 选项，如 ZREVRANGE key start stop [WITHSCORES]
+func checkIndexRangeWithOptions(grammar redisGrammar) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, limits RedisLimits) Diagnostics {
+		if _, d := c.parseOptions(4, grammar); d != nil {
+			return Diagnostics{d}
+		}
+		return c.checkIndexRange(2, limits)
+	}
+}
+
+// checkIndexRange 校验 start/stop 下标及返回元素个数。
+// 两端同号或 start 为负时元素个数可确定；start >= 0 且 stop < 0 取决于集合长度，视为无界。
+func (c *redisCommand) checkIndexRange(startIdx int, limits RedisLimits) Diagnostics {
+	start, d := c.intArg(startIdx, "start")
+	if d != nil {
+		return Diagnostics{d}
+	}
+	stop, d := c.intArg(startIdx+1, "stop")
+	if d != nil {
+		return Diagnostics{d}
+	}
+	if limits.MaxRangeSize <= 0 {
+		return nil
+	}
+	suggestion := fmt.Sprintf("分页读取，每次不超过 %d 个元素，如 %s key 0 %d", limits.MaxRangeSize, c.name, limits.MaxRangeSize-1)
+	if start >= 0 && stop < 0 {
+		return Diagnostics{c.diag(startIdx+1, CodeRedisLimitExceeded, SeverityError, "%s %d %d 会返回整个集合，超出单次上限 %d", c.name, start, stop, limits.MaxRangeSize).
+			withSuggestion(suggestion)}
+	}
+	size := stop - start + 1
+	if start < 0 && stop >= 0 {
+		size = stop + 1
+	}
+	if size > int64(limits.MaxRangeSize) {
+		return Diagnostics{c.diag(startIdx, CodeRedisLimitExceeded, SeverityError, "%s 范围包含 %d 个元素，超过上限 %d", c.name, size, limits.MaxRangeSize).
+			withSuggestion(suggestion)}
+	}
+	return nil
+}
+
+// checkLimitCount 校验 LIMIT offset count 中的 count
+func (c *redisCommand) checkLimitCount(limitIdx int, limits RedisLimits) Diagnostics {
+	if _, d := c.intArg(limitIdx+1, "LIMIT offset"); d != nil {
+		return Diagnostics{d}
+	}
+	count, d := c.intArg(limitIdx+2, "LIMIT count")
+	if d != nil {
+		return Diagnostics{d}
+	}
+	if limits.MaxRangeSize > 0 && (count < 0 || count > int64(limits.MaxRangeSize)) {
+		return Diagnostics{c.diag(limitIdx+2, CodeRedisLimitExceeded, SeverityError, "%s 的 LIMIT count %d 超过上限 %d", c.name, count, limits.MaxRangeSize).
+			withSuggestion(fmt.Sprintf("LIMIT count 取 1 到 %d 之间的值", limits.MaxRangeSize))}
+	}
+	return nil
+}
+
+// unboundedRange 按分数/字典序取范围但未指定 LIMIT：配置了范围上限时报错，否则警告
+func (c *redisCommand) unboundedRange(limits RedisLimits) *ValidationError {
+	if limits.MaxRangeSize <= 0 {
+		return c.diag(0, CodeRedisLimitExceeded, SeverityWarning, "%s 未指定 LIMIT，返回元素个数不受控制", c.name).
+			withSuggestion("追加 LIMIT 0 100 分页读取")
+	}
+	return c.diag(0, CodeRedisLimitExceeded, SeverityError, "%s 未指定 LIMIT，可能返回整个集合，超出单次上限 %d", c.name, limits.MaxRangeSize).
+		withSuggestion(fmt.Sprintf("追加 LIMIT 0 %d 分页读取", limits.MaxRangeSize))
+}
+
+// checkZRange ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func checkZRange(c *redisCommand, limits RedisLimits) Diagnostics {
+	opts, d := c.parseOptions(4, redisGrammar{
+		"BYSCORE": {Since: "6.2.0"}, "BYLEX": {Since: "6.2.0"}, "REV": {Since: "6.2.0"}, "LIMIT": {Args: 2, Since: "6.2.0"}, "WITHSCORES": {},
+	})
+	if d != nil {
+		return Diagnostics{d}
+	}
+	_, byScore := opts["BYSCORE"]
+	byLexIdx, byLex := opts["BYLEX"]
+	withScoresIdx, withScores := opts["WITHSCORES"]
+	limitIdx, hasLimit := opts["LIMIT"]
+	switch {
+	case byScore && byLex:
+		return Diagnostics{c.diag(byLexIdx, CodeRedisInvalidArgument, SeverityError, "ZRANGE 的 BYSCORE 与 BYLEX 不能同时使用")}
+	case byLex && withScores:
+		return Diagnostics{c.diag(withScoresIdx, CodeRedisInvalidArgument, SeverityError, "ZRANGE BYLEX 不支持 WITHSCORES")}
+	case !byScore && !byLex:
+		if hasLimit {
+			return Diagnostics{c.diag(limitIdx, CodeRedisInvalidArgument, SeverityError, "ZRANGE 的 LIMIT 只能与 BYSCORE 或 BYLEX 一起使用")}
+		}
+		return c.checkIndexRange(2, limits)
+	case hasLimit:
+		return c.checkLimitCount(limitIdx, limits)
+	default:
+		return Diagnostics{c.unboundedRange(limits)}
+	}
+}
+
+// checkScoreRange ZRANGEBYSCORE / ZREVRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func checkScoreRange(c *redisCommand, limits RedisLimits) Diagnostics {
+	opts, d := c.parseOptions(4, redisGrammar{"WITHSCORES": {}, "LIMIT": {Args: 2}})
+	if d != nil {
+		return Diagnostics{d}
+	}
+	if limitIdx, ok := opts["LIMIT"]; ok {
+		return c.checkLimitCount(limitIdx, limits)
+	}
+	return Diagnostics{c.unboundedRange(limits)}
+}
+
+// checkOptions 仅校验选项语法
+func checkOptions(from int, grammar redisGrammar) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, _ RedisLimits) Diagnostics {
+		if _, d := c.parseOptions(from, grammar); d != nil {
+			return Diagnostics{d}
+		}
+		return nil
+	}
+}
+
+// checkIntArgs 校验指定下标的参数为整数
+func checkIntArgs(args map[int]string) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, _ RedisLimits) Diagnostics {
+		for idx, what := range args {
+			if _, d := c.intArg(idx, what); d != nil {
+				return Diagnostics{d}
+			}
+		}
+		return nil
+	}
+}
+
+// checkRandomCount HRANDFIELD / SRANDMEMBER / ZRANDMEMBER key [count [options]]：count 绝对值不超过上限
+func checkRandomCount(countIdx int, grammar redisGrammar) func(c *redisCommand, limits RedisLimits) Diagnostics {
+	return func(c *redisCommand, limits RedisLimits) Diagnostics {
+		if len(c.args) <= countIdx {
+			return nil
+		}
+		count, d := c.intArg(countIdx, "count")
+		if d != nil {
+			return Diagnostics{d}
+		}
+		if count < 0 {
+			count = -count
+		}
+		if limits.MaxRangeSize > 0 && count > int64(limits.MaxRangeSize) {
+			return Diagnostics{c.diag(countIdx, CodeRedisLimitExceeded, SeverityError, "%s 的 count %d 超过上限 %d", c.name, count, limits.MaxRangeSize)}
+		}
+		if _, d := c.parseOptions(countIdx+1, grammar); d != nil {
+			return Diagnostics{d}
+		}
+		return nil
+	}
+}
+
+// checkCountOption 校验 COUNT 选项：超过上限时报错；缺省时配置了范围上限则报错，否则警告
+func (c *redisCommand) checkCountOption(opts map[string]int, limits RedisLimits) Diagnostics {
+	idx, ok := opts["COUNT"]
+	if !ok {
+		if limits.MaxRangeSize <= 0 {
+			return Diagnostics{c.diag(0, CodeRedisLimitExceeded, SeverityWarning, "%s 未指定 COUNT，返回条目数不受控制", c.name).
+				withSuggestion("追加 COUNT 100 分批读取")}
+		}
+		return Diagnostics{c.diag(0, CodeRedisLimitExceeded, SeverityError, "%s 未指定 COUNT，可能返回整个 stream，超出单次上限 %d", c.name, limits.MaxRangeSize).
+			withSuggestion(fmt.Sprintf("追加 COUNT %d 分批读取", limits.MaxRangeSize))}
+	}
+	count, d := c.intArg(idx+1, "COUNT")
+	if d != nil {
+		return Diagnostics{d}
+	}
+	if limits.MaxRangeSize > 0 && (count <= 0 || count > int64(limits.MaxRangeSize)) {
+		return Diagnostics{c.diag(idx+1, CodeRedisLimitExceeded, SeverityError, "%s 的 COUNT %d 超过上限 %d", c.name, count, limits.MaxRangeSize).
+			withSuggestion(fmt.Sprintf("COUNT 取 1 到 %d 之间的值", limits.MaxRangeSize))}
+	}
+	return nil
+}
+
+// checkStreamRange XRANGE / XREVRANGE key start end [COUNT count]
+func checkStreamRange(c *redisCommand, limits RedisLimits) Diagnostics {
+	opts, d := c.parseOptions(4, redisGrammar{"COUNT": {Args: 1}})
+	if d != nil {
+		return Diagnostics{d}
+	}
+	return c.checkCountOption(opts, limits)
+}
+
+// checkXRead XREAD [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...]：禁止阻塞读取
+func checkXRead(c *redisCommand, limits RedisLimits) Diagnostics {
+	streamsIdx := -1
+	for i := 1; i < len(c.args); i++ {
+		if strings.EqualFold(c.args[i].value, "STREAMS") {
+			streamsIdx = i
+			break
+		}
+	}
+	if streamsIdx < 0 {
+		return Diagnostics{c.diag(0, CodeRedisInvalidArgument, SeverityError, "XREAD 缺少 STREAMS 参数")}
+	}
+	rest := len(c.args) - streamsIdx - 1
+	if rest == 0 || rest%2 != 0 {
+		return Diagnostics{c.diag(streamsIdx, CodeRedisWrongArity, SeverityError, "XREAD STREAMS 之后的 key 与 id 个数必须相同")}
+	}
+	head := &redisCommand{name: c.name, args: c.args[:streamsIdx], src: c.src, offset: c.offset, target: c.target}
+	opts, d := head.parseOptions(1, redisGrammar{"COUNT": {Args: 1}, "BLOCK": {Args: 1}})
+	if d != nil {
+		return Diagnostics{d}
+	}
+	if idx, ok := opts["BLOCK"]; ok {
+		return Diagnostics{c.diag(idx, CodeRedisInvalidArgument, SeverityError, "不允许阻塞读取: XREAD BLOCK").
+			withSuggestion("去掉 BLOCK 选项，只读取当前已有的条目")}
+	}
+	return head.checkCountOption(opts, limits)
+}
+
+// checkSearchLimit FT.SEARCH / FT.AGGREGATE 的 LIMIT offset num 不超过上限
+func checkSearchLimit(c *redisCommand, limits RedisLimits) Diagnostics {
+	for i := 3; i+2 < len(c.args); i++ {
+		if strings.EqualFold(c.args[i].value, "LIMIT") {
+			return c.checkLimitCount(i, limits)
+		}
+	}
+	return nil
+}
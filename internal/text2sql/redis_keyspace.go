@@ -0,0 +1,319 @@
+package text2sql
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redisPlaceholderPatterns 占位符类型对应的正则
+var redisPlaceholderPatterns = map[string]string{
+	"string": `[^:]+`,
+	"int":    `\d+`,
+	"uuid":   `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"date":   `\d{4}-\d{2}-\d{2}`,
+}
+
+// redisGroupKeyTypes 命令分组可操作的 key 类型，未列出的分组（key、introspection）不限类型
+var redisGroupKeyTypes = map[string][]string{
+	"string": {"string"},
+	"hash":   {"hash"},
+	"list":   {"list"},
+	"set":    {"set"},
+	"zset":   {"zset"},
+	"stream": {"stream"},
+	"geo":    {"zset"},
+	"json":   {"json"},
+}
+
+// redisKeyPattern 编译后的 key 模式
+type redisKeyPattern struct {
+	key  RedisKey
+	re   *regexp.Regexp // 匹配具体 key
+	glob []globToken    // 占位符视为 *，用于与 SCAN MATCH / KEYS 的模式求交
+}
+
+// redisKeySpace schema 中声明的 key 空间
+type redisKeySpace struct {
+	patterns []redisKeyPattern
+}
+
+// newRedisKeySpace 编译 schema 中的 key 模式，未声明时返回 nil（不做 key 校验）
+func newRedisKeySpace(keys []RedisKey) *redisKeySpace {
+	if len(keys) == 0 {
+		return nil
+	}
+	ks := &redisKeySpace{}
+	for _, k := range keys {
+		ks.patterns = append(ks.patterns, compileRedisKeyPattern(k))
+	}
+	return ks
+}
+
+// compileRedisKeyPattern 将 user:{id:int}:orders 形式的模板转为正则和 glob
+func compileRedisKeyPattern(k RedisKey) redisKeyPattern {
+	var re, glob strings.Builder
+	re.WriteString("^")
+	rest := k.Pattern
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			break
+		}
+		re.WriteString(regexp.QuoteMeta(rest[:open]))
+		glob.WriteString(escapeGlob(rest[:open]))
+		re.WriteString("(?:" + placeholderPattern(rest[open+1:open+end]) + ")")
+		glob.WriteString("*")
+		rest = rest[open+end+1:]
+	}
+	re.WriteString(regexp.QuoteMeta(rest) + "$")
+	glob.WriteString(escapeGlob(rest))
+	return redisKeyPattern{key: k, re: regexp.MustCompile(re.String()), glob: parseGlob(glob.String())}
+}
+
+// placeholderPattern 占位符 name:type 对应的正则，未知类型按 string 处理
+func placeholderPattern(placeholder string) string {
+	_, typ, _ := strings.Cut(placeholder, ":")
+	if p, ok := redisPlaceholderPatterns[strings.ToLower(strings.TrimSpace(typ))]; ok {
+		return p
+	}
+	return redisPlaceholderPatterns["string"]
+}
+
+// match 返回与具体 key 匹配的模式
+func (ks *redisKeySpace) match(key string) (*redisKeyPattern, bool) {
+	for i := range ks.patterns {
+		if ks.patterns[i].re.MatchString(key) {
+			return &ks.patterns[i], true
+		}
+	}
+	return nil, false
+}
+
+// overlaps glob 模式是否可能匹配到已声明的 key
+func (ks *redisKeySpace) overlaps(pattern string) bool {
+	g := parseGlob(pattern)
+	for _, p := range ks.patterns {
+		if globsOverlap(p.glob, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// declared 已声明的 key 模式列表，用于修改建议
+func (ks *redisKeySpace) declared() string {
+	names := make([]string, len(ks.patterns))
+	for i, p := range ks.patterns {
+		names[i] = p.key.Pattern
+	}
+	return strings.Join(names, "、")
+}
+
+// check 校验命令中的 key 与匹配模式是否符合 schema 声明
+func (ks *redisKeySpace) check(c *redisCommand, spec redisCommandSpec) Diagnostics {
+	var diags Diagnostics
+	for _, idx := range c.keyPatternArgs() {
+		if pattern := c.args[idx].value; !ks.overlaps(pattern) {
+			diags = append(diags, c.diag(idx, CodeRedisUnknownKey, SeverityError, "匹配模式 %s 不会命中 schema 中声明的任何 key", pattern).
+				withSuggestion("按已声明的 key 模式匹配："+ks.declared()))
+		}
+	}
+	for _, idx := range c.keyArgs(spec) {
+		key := c.args[idx].value
+		p, ok := ks.match(key)
+		if !ok {
+			diags = append(diags, c.diag(idx, CodeRedisUnknownKey, SeverityError, "key %s 不符合 schema 中声明的 key 模式", key).
+				withSuggestion("使用已声明的 key 模式并替换占位符："+ks.declared()))
+			continue
+		}
+		if types, ok := redisGroupKeyTypes[spec.Group]; ok && !slices.Contains(types, p.key.Type) {
+			diags = append(diags, c.diag(0, CodeRedisWrongType, SeverityError, "%s 不能用于 %s 类型的 key %s（模式 %s）", c.name, p.key.Type, key, p.key.Pattern).
+				withSuggestion(fmt.Sprintf("改用 %s 类型的命令", p.key.Type)))
+		}
+	}
+	return diags
+}
+
+// keyArgs 命令中作为 key 的参数下标
+func (c *redisCommand) keyArgs(spec redisCommandSpec) []int {
+	if spec.Keys != nil {
+		return spec.Keys(c)
+	}
+	// 默认为命令名（及子命令名）之后的第一个参数
+	idx := len(strings.Fields(c.name))
+	if idx >= len(c.args) {
+		return nil
+	}
+	return []int{idx}
+}
+
+// keyPatternArgs 命令中作为 key 匹配模式的参数下标（KEYS pattern、SCAN MATCH pattern）
+func (c *redisCommand) keyPatternArgs() []int {
+	switch c.name {
+	case "KEYS":
+		return []int{1}
+	case "SCAN":
+		for i := 2; i+1 < len(c.args); i++ {
+			if strings.EqualFold(c.args[i].value, "MATCH") {
+				return []int{i + 1}
+			}
+		}
+	}
+	return nil
+}
+
+// noRedisKeys 不含 key 的命令
+func noRedisKeys(*redisCommand) []int {
+	return nil
+}
+
+// redisKeyRange 下标 first 到 last 的参数均为 key，last 为负数时从末尾倒数（-1 为最后一个参数）
+func redisKeyRange(first, last int) func(c *redisCommand) []int {
+	return func(c *redisCommand) []int {
+		end := last
+		if end < 0 {
+			end = len(c.args) + last
+		}
+		var idx []int
+		for i := first; i <= end && i < len(c.args); i++ {
+			idx = append(idx, i)
+		}
+		return idx
+	}
+}
+
+// redisNumKeys numkeys key [key ...]：numkeys 位于 numIdx
+func redisNumKeys(numIdx int) func(c *redisCommand) []int {
+	return func(c *redisCommand) []int {
+		n, d := c.intArg(numIdx, "numkeys")
+		if d != nil || n <= 0 {
+			return nil
+		}
+		return redisKeyRange(numIdx+1, numIdx+int(n))(c)
+	}
+}
+
+// redisStreamKeys XREAD ... STREAMS key [key ...] id [id ...]
+func redisStreamKeys(c *redisCommand) []int {
+	for i := 1; i < len(c.args); i++ {
+		if strings.EqualFold(c.args[i].value, "STREAMS") {
+			n := (len(c.args) - i - 1) / 2
+			return redisKeyRange(i+1, i+n)(c)
+		}
+	}
+	return nil
+}
+
+// renderRedisKeySpace 将 key 空间渲染为 prompt 文本
+func renderRedisKeySpace(keys []RedisKey) string {
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "- %s（%s）", k.Pattern, k.Type)
+		if k.Comment != "" {
+			fmt.Fprintf(&b, "：%s", k.Comment)
+		}
+		b.WriteString("\n")
+		if k.Member != "" {
+			fmt.Fprintf(&b, "  - 元素：%s\n", k.Member)
+		}
+		if k.Score != "" {
+			fmt.Fprintf(&b, "  - score：%s\n", k.Score)
+		}
+		for _, f := range k.Fields {
+			fmt.Fprintf(&b, "  - field %s", f.Name)
+			if f.Type != "" {
+				fmt.Fprintf(&b, " (%s)", f.Type)
+			}
+			if f.Comment != "" {
+				fmt.Fprintf(&b, "：%s", f.Comment)
+			}
+			b.WriteString("\n")
+		}
+		if k.TTL != "" {
+			fmt.Fprintf(&b, "  - 过期：%s\n", k.TTL)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// globToken glob 模式的单元：字面字符、?（任意单字符，[...] 也按此处理）或 *
+type globToken struct {
+	kind byte // 'c' 字面字符，'?' 任意单字符，'*' 任意串
+	ch   rune
+}
+
+// parseGlob 按 Redis glob 规则解析模式
+func parseGlob(pattern string) []globToken {
+	var toks []globToken
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			toks = append(toks, globToken{kind: '*'})
+		case '?':
+			toks = append(toks, globToken{kind: '?'})
+		case '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			toks = append(toks, globToken{kind: '?'})
+			i = j
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			toks = append(toks, globToken{kind: 'c', ch: runes[i]})
+		default:
+			toks = append(toks, globToken{kind: 'c', ch: r})
+		}
+	}
+	return toks
+}
+
+// escapeGlob 转义 key 模板中的 glob 特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// globsOverlap 判断两个 glob 模式是否存在同时匹配的字符串
+func globsOverlap(a, b []globToken) bool {
+	memo := make(map[[2]int]bool)
+	var walk func(i, j int) bool
+	walk = func(i, j int) bool {
+		k := [2]int{i, j}
+		if v, ok := memo[k]; ok {
+			return v
+		}
+		var res bool
+		switch {
+		case i == len(a) && j == len(b):
+			res = true
+		case i < len(a) && a[i].kind == '*':
+			res = walk(i+1, j) || (j < len(b) && walk(i, j+1))
+		case j < len(b) && b[j].kind == '*':
+			res = walk(i, j+1) || (i < len(a) && walk(i+1, j))
+		case i < len(a) && j < len(b):
+			res = (a[i].kind == '?' || b[j].kind == '?' || a[i].ch == b[j].ch) && walk(i+1, j+1)
+		}
+		memo[k] = res
+		return res
+	}
+	return walk(0, 0)
+}
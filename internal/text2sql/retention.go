@@ -0,0 +1,166 @@
+package text2sql
+
+import (
+	"fmt"
+	"time"
+
+	"text2sql/internal/logger"
+)
+
+// 会话保留策略的默认值
+const (
+	DefaultSlidingTTL      = 24 * time.Hour
+	DefaultCleanupInterval = time.Hour
+)
+
+// RetentionPolicy 会话过期策略：未置顶的会话在最后一次保存 SlidingTTL 后或创建 AbsoluteTTL 后过期，以先到者为准；
+// 置顶的会话不会过期。内存与 SQL 存储按 CleanupInterval 在后台清理，Redis 由原生 TTL 过期
+type RetentionPolicy struct {
+	SlidingTTL      time.Duration // 最后一次保存后的保留时间，0 表示默认 24h，负数表示不按最后使用时间过期
+	AbsoluteTTL     time.Duration // 创建后的最长保留时间，0 表示不限制
+	CleanupInterval time.Duration // 后台清理间隔，0 表示默认 1h
+}
+
+func (p RetentionPolicy) withDefaults() RetentionPolicy {
+	if p.SlidingTTL == 0 {
+		p.SlidingTTL = DefaultSlidingTTL
+	}
+	if p.CleanupInterval <= 0 {
+		p.CleanupInterval = DefaultCleanupInterval
+	}
+	return p
+}
+
+// expiresAt 会话的过期时间，置顶或策略不限制时返回 nil
+func (p RetentionPolicy) expiresAt(pinned bool, createdAt, updatedAt time.Time) *time.Time {
+	p = p.withDefaults()
+	if pinned {
+		return nil
+	}
+	var expires time.Time
+	if p.SlidingTTL > 0 {
+		expires = updatedAt.Add(p.SlidingTTL)
+	}
+	if p.AbsoluteTTL > 0 {
+		if absolute := createdAt.Add(p.AbsoluteTTL); expires.IsZero() || absolute.Before(expires) {
+			expires = absolute
+		}
+	}
+	if expires.IsZero() {
+		return nil
+	}
+	return &expires
+}
+
+// expired 会话在 now 时是否已过期
+func (p RetentionPolicy) expired(conv *ConversationContext, now time.Time) bool {
+	expires := p.expiresAt(conv.Pinned, conv.CreatedAt, conv.UpdatedAt)
+	return expires != nil && !now.Before(*expires)
+}
+
+// cutoffs 清理时的截止时间：updated_at 早于 updatedBefore 或 created_at 早于 createdBefore 的未置顶会话已过期，
+// 零值表示不按该条件清理
+func (p RetentionPolicy) cutoffs(now time.Time) (updatedBefore, createdBefore time.Time) {
+	p = p.withDefaults()
+	if p.SlidingTTL > 0 {
+		updatedBefore = now.Add(-p.SlidingTTL)
+	}
+	if p.AbsoluteTTL > 0 {
+		createdBefore = now.Add(-p.AbsoluteTTL)
+	}
+	return updatedBefore, createdBefore
+}
+
+// ConversationLimits 会话轮数与数量上限，0 表示不限制
+type ConversationLimits struct {
+	MaxTurns int // 单个会话的最大轮数，达到后需分叉、回滚或开启新会话
+	// MaxConversationsPerOwner 每个所有者（API Key）的最大会话数，创建新会话时淘汰最久未使用的未置顶会话，
+	// 全部置顶时拒绝创建
+	MaxConversationsPerOwner int
+}
+
+// getConversation 读取会话，已过期但尚未被后台清理的会话视为不存在并顺带删除
+func (s *Service) getConversation(conversationID string) (*ConversationContext, error) {
+	conv, err := s.contextStore.Get(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if s.retention.expired(conv, time.Now()) {
+		if err := s.contextStore.Delete(conversationID); err != nil {
+			logger.Warn("删除过期会话失败", "conversation_id", conversationID, "error", err)
+		}
+		return nil, ErrConversationNotFound
+	}
+	return conv, nil
+}
+
+// checkTurnLimit 会话已达到最大轮数时拒绝继续追加
+func (s *Service) checkTurnLimit(conv *ConversationContext) error {
+	if s.limits.MaxTurns > 0 && len(conv.History) >= s.limits.MaxTurns {
+		return fmt.Errorf("%w: 会话已达到 %d 轮上限，请分叉、回滚或开启新会话", ErrTurnLimitExceeded, s.limits.MaxTurns)
+	}
+	return nil
+}
+
+// reserveConversation 为 owner 的新会话腾出名额：会话数超出上限时淘汰最久未使用的未置顶会话。
+// created 为已经保存的新会话，尚未保存时为空；created 与 protect 指定的会话不被淘汰
+func (s *Service) reserveConversation(owner, created string, protect ...string) error {
+	evict, err := s.conversationsToEvict(owner, created, protect...)
+	if err != nil {
+		return err
+	}
+	for _, id := range evict {
+		if err := s.contextStore.Delete(id); err != nil {
+			return fmt.Errorf("淘汰会话 %s 失败: %w", id, err)
+		}
+		logger.Info("会话数达到上限，淘汰最久未使用的会话", "owner", owner, "conversation_id", id)
+	}
+	return nil
+}
+
+// conversationsToEvict 返回 owner 的新会话需要淘汰的会话，不删除任何会话；参数同 reserveConversation。
+// 没有足够的未置顶会话可淘汰时返回 ErrConversationLimitExceeded
+func (s *Service) conversationsToEvict(owner, created string, protect ...string) ([]string, error) {
+	limit := s.limits.MaxConversationsPerOwner
+	if limit <= 0 || owner == "" {
+		return nil, nil
+	}
+	page, err := s.contextStore.List(ConversationFilter{Owner: owner, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("统计会话数失败: %w", err)
+	}
+	excess := page.Total - limit + 1
+	keep := make(map[string]bool, len(protect)+1)
+	for _, id := range protect {
+		keep[id] = true
+	}
+	if created != "" {
+		excess--
+		keep[created] = true
+	}
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	// 列表按 updated_at 倒序，最久未使用的会话在末尾；多取 len(keep) 个以便跳过不淘汰的会话
+	unpinned := false
+	filter := ConversationFilter{Owner: owner, Pinned: &unpinned, Limit: 1}
+	if page, err = s.contextStore.List(filter); err != nil {
+		return nil, fmt.Errorf("统计会话数失败: %w", err)
+	}
+	filter.Offset = max(page.Total-excess-len(keep), 0)
+	filter.Limit = page.Total - filter.Offset
+	if page, err = s.contextStore.List(filter); err != nil {
+		return nil, fmt.Errorf("列出待淘汰会话失败: %w", err)
+	}
+	var evict []string
+	for i := len(page.Conversations) - 1; i >= 0 && len(evict) < excess; i-- {
+		if id := page.Conversations[i].ConversationID; !keep[id] {
+			evict = append(evict, id)
+		}
+	}
+	if len(evict) < excess {
+		return nil, fmt.Errorf("%w: 已达到 %d 个会话的上限且没有可淘汰的未置顶会话，请先删除或取消置顶", ErrConversationLimitExceeded, limit)
+	}
+	return evict, nil
+}
@@ -0,0 +1,294 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"text2sql/internal/llm"
+)
+
+func TestRetentionPolicy_ExpiresAt(t *testing.T) {
+	created := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	updated := created.Add(10 * time.Hour)
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		pinned bool
+		want   time.Time // 零值表示不过期
+	}{
+		{"default sliding", RetentionPolicy{}, false, updated.Add(24 * time.Hour)},
+		{"custom sliding", RetentionPolicy{SlidingTTL: time.Hour}, false, updated.Add(time.Hour)},
+		{"absolute first", RetentionPolicy{SlidingTTL: 24 * time.Hour, AbsoluteTTL: 12 * time.Hour}, false, created.Add(12 * time.Hour)},
+		{"sliding first", RetentionPolicy{SlidingTTL: time.Hour, AbsoluteTTL: 48 * time.Hour}, false, updated.Add(time.Hour)},
+		{"absolute only", RetentionPolicy{SlidingTTL: -1, AbsoluteTTL: 48 * time.Hour}, false, created.Add(48 * time.Hour)},
+		{"no expiry", RetentionPolicy{SlidingTTL: -1}, false, time.Time{}},
+		{"pinned", RetentionPolicy{AbsoluteTTL: time.Hour}, true, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.expiresAt(tt.pinned, created, updated)
+			if tt.want.IsZero() {
+				if got != nil {
+					t.Errorf("expiresAt = %v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(tt.want) {
+				t.Errorf("expiresAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ConversationRetention(t *testing.T) {
+	store := NewMemoryContextStore()
+	defer store.Close()
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{
+		ContextStore: store,
+		Retention:    RetentionPolicy{SlidingTTL: time.Hour, AbsoluteTTL: 24 * time.Hour},
+	})
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	resp, err := svc.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.ExpiresAt == nil || time.Until(*resp.ExpiresAt) > time.Hour || time.Until(*resp.ExpiresAt) < 59*time.Minute {
+		t.Errorf("expires_at = %v, want about 1h from now", resp.ExpiresAt)
+	}
+
+	// 置顶后不再过期
+	yes := true
+	detail, err := svc.UpdateConversation(context.Background(), resp.ConversationID, ConversationUpdate{Pinned: &yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !detail.Pinned || detail.ExpiresAt != nil {
+		t.Errorf("pinned detail = %+v", detail.ConversationSummary)
+	}
+	id := resp.ConversationID
+	age := func() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.store[id].UpdatedAt = time.Now().Add(-2 * time.Hour)
+	}
+	age()
+	if _, err := svc.GetConversation(context.Background(), resp.ConversationID); err != nil {
+		t.Errorf("pinned conversation should not expire: %v", err)
+	}
+
+	// 已过期但尚未清理的会话视为不存在
+	no := false
+	if _, err := svc.UpdateConversation(context.Background(), resp.ConversationID, ConversationUpdate{Pinned: &no}); err != nil {
+		t.Fatal(err)
+	}
+	age()
+	if _, err := svc.GetConversation(context.Background(), resp.ConversationID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected expired conversation to be not found, got %v", err)
+	}
+	req.ConversationID = resp.ConversationID
+	if resp, err = svc.Generate(context.Background(), req); err != nil || resp.ConversationID == req.ConversationID {
+		t.Errorf("expected a new conversation after expiry, got %+v, err %v", resp, err)
+	}
+}
+
+func TestService_ConversationLimits(t *testing.T) {
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{
+		Limits: ConversationLimits{MaxTurns: 2, MaxConversationsPerOwner: 2},
+	})
+	ctx := WithPrincipal(context.Background(), Principal{Name: "key_a"})
+	generate := func(ctx context.Context, conversationID string) (*GenerateResponse, error) {
+		return svc.Generate(ctx, &GenerateRequest{
+			Query:          "查询用户",
+			ConversationID: conversationID,
+			Schema:         Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+			Database:       Database{Type: "mysql", Version: "8.0"},
+		})
+	}
+
+	first, err := generate(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(ctx, first.ConversationID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(ctx, first.ConversationID); !errors.Is(err, ErrTurnLimitExceeded) {
+		t.Errorf("expected ErrTurnLimitExceeded, got %v", err)
+	}
+
+	// 达到会话数上限时淘汰最久未使用的未置顶会话
+	yes := true
+	if _, err := svc.UpdateConversation(context.Background(), first.ConversationID, ConversationUpdate{Pinned: &yes}); err != nil {
+		t.Fatal(err)
+	}
+	second, err := generate(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetConversation(context.Background(), second.ConversationID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected least recently used conversation to be evicted, got %v", err)
+	}
+	if _, err := svc.GetConversation(context.Background(), first.ConversationID); err != nil {
+		t.Errorf("pinned conversation should not be evicted: %v", err)
+	}
+
+	// 其他所有者不受影响
+	if _, err := generate(WithPrincipal(context.Background(), Principal{Name: "key_b"}), ""); err != nil {
+		t.Errorf("other owner should not be limited: %v", err)
+	}
+	page, err := svc.ListConversations(context.Background(), ConversationFilter{Owner: "key_a"})
+	if err != nil || page.Total != 2 {
+		t.Errorf("key_a conversations = %+v, err %v", page, err)
+	}
+
+	// 全部置顶时拒绝创建，分叉也计入会话数
+	for _, c := range page.Conversations {
+		if _, err := svc.UpdateConversation(context.Background(), c.ConversationID, ConversationUpdate{Pinned: &yes}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := generate(ctx, ""); !errors.Is(err, ErrConversationLimitExceeded) {
+		t.Errorf("expected ErrConversationLimitExceeded, got %v", err)
+	}
+	if _, err := svc.ForkConversation(context.Background(), first.ConversationID, nil); !errors.Is(err, ErrConversationLimitExceeded) {
+		t.Errorf("expected ErrConversationLimitExceeded on fork, got %v", err)
+	}
+}
+
+func TestService_ConversationLimitsEvictAfterSuccess(t *testing.T) {
+	provider := &recordingProvider{content: "SELECT id FROM users"}
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{
+		Limits: ConversationLimits{MaxConversationsPerOwner: 1},
+	})
+	ctx := WithPrincipal(context.Background(), Principal{Name: "key_a"})
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	first, err := svc.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 生成失败时不淘汰已有会话
+	provider.err = errors.New("llm unavailable")
+	if _, err := svc.Generate(ctx, req); err == nil {
+		t.Fatal("expected generation to fail")
+	}
+	if _, err := svc.GetConversation(context.Background(), first.ConversationID); err != nil {
+		t.Errorf("conversation should survive a failed generation: %v", err)
+	}
+
+	provider.err = nil
+	second, err := svc.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetConversation(context.Background(), first.ConversationID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected first conversation to be evicted after success, got %v", err)
+	}
+	if _, err := svc.GetConversation(context.Background(), second.ConversationID); err != nil {
+		t.Errorf("new conversation should be saved: %v", err)
+	}
+}
+
+func TestService_ForkEvictsAfterSuccess(t *testing.T) {
+	svc := NewServiceWithOptions(&recordingProvider{content: "SELECT id FROM users"}, nil, ServiceOptions{
+		Limits: ConversationLimits{MaxConversationsPerOwner: 2},
+	})
+	ctx := WithPrincipal(context.Background(), Principal{Name: "key_a"})
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	first, err := svc.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 分叉失败时不淘汰已有会话
+	turns := 5
+	if _, err := svc.ForkConversation(ctx, second.ConversationID, &turns); !errors.Is(err, ErrInvalidTurn) {
+		t.Fatalf("expected ErrInvalidTurn, got %v", err)
+	}
+	if _, err := svc.GetConversation(context.Background(), first.ConversationID); err != nil {
+		t.Errorf("conversation should survive a failed fork: %v", err)
+	}
+
+	fork, err := svc.ForkConversation(ctx, second.ConversationID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetConversation(context.Background(), first.ConversationID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected least recently used conversation to be evicted after the fork, got %v", err)
+	}
+	for _, id := range []string{second.ConversationID, fork.ConversationID} {
+		if _, err := svc.GetConversation(context.Background(), id); err != nil {
+			t.Errorf("conversation %s should be kept: %v", id, err)
+		}
+	}
+	page, err := svc.ListConversations(context.Background(), ConversationFilter{Owner: "key_a"})
+	if err != nil || page.Total != 2 {
+		t.Errorf("key_a conversations = %+v, err %v", page, err)
+	}
+}
+
+// pinningProvider 生成期间置顶指定会话，模拟并发请求改变可淘汰的会话
+type pinningProvider struct {
+	recordingProvider
+	pin func()
+}
+
+func (p *pinningProvider) Complete(ctx context.Context, req *llm.CompleteRequest) (*llm.CompleteResponse, error) {
+	if p.pin != nil {
+		p.pin()
+	}
+	return p.recordingProvider.Complete(ctx, req)
+}
+
+func TestService_ConversationLimitsEvictionFails(t *testing.T) {
+	provider := &pinningProvider{recordingProvider: recordingProvider{content: "SELECT id FROM users"}}
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{
+		Limits: ConversationLimits{MaxConversationsPerOwner: 1},
+	})
+	ctx := WithPrincipal(context.Background(), Principal{Name: "key_a"})
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	first, err := svc.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 调用 LLM 前还有可淘汰的会话，生成期间被置顶后不再创建新会话
+	yes := true
+	provider.pin = func() {
+		if _, err := svc.UpdateConversation(context.Background(), first.ConversationID, ConversationUpdate{Pinned: &yes}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := svc.Generate(ctx, req); !errors.Is(err, ErrConversationLimitExceeded) {
+		t.Fatalf("expected ErrConversationLimitExceeded, got %v", err)
+	}
+	page, err := svc.ListConversations(context.Background(), ConversationFilter{Owner: "key_a"})
+	if err != nil || page.Total != 1 || page.Conversations[0].ConversationID != first.ConversationID {
+		t.Errorf("key_a conversations = %+v, err %v", page, err)
+	}
+}
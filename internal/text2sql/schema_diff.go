@@ -0,0 +1,279 @@
+package text2sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// schema 变更的类型
+const (
+	SchemaChangeAdded            = "added"
+	SchemaChangeRemoved          = "removed"
+	SchemaChangePossiblyRenamed  = "possibly_renamed" // 按结构推断的重命名，也可能是删除后新增
+	SchemaChangeTypeChanged      = "type_changed"
+	SchemaChangeEndpointsChanged = "endpoints_changed" // 图数据库关系类型的起点或终点标签变化
+)
+
+// SchemaChange 一项结构变更。Object 为 table、column、key、field、collection、index、node、relationship 或 property；
+// 列、字段和属性的 Parent 为所属的表、key、集合、索引、节点标签或关系类型。
+// Name 为变更前的名称（added 时为新名称）；possibly_renamed 时 From / To 为旧名称和新名称，
+// type_changed 和 endpoints_changed 时为旧值和新值
+type SchemaChange struct {
+	Kind   string `json:"kind"`
+	Object string `json:"object"`
+	Parent string `json:"parent,omitempty"`
+	Name   string `json:"name"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// SchemaDiff 两个 schema 之间的结构变更，只比较名称、类型和层级，不比较注释、行数等描述信息
+type SchemaDiff []SchemaChange
+
+// Error 实现 error 接口，拼接中文描述
+func (d SchemaDiff) Error() string {
+	return d.describe(promptSets[LanguageChinese], "；")
+}
+
+// describe 按语言描述全部变更，sep 为分隔符
+func (d SchemaDiff) describe(set *promptSet, sep string) string {
+	msgs := make([]string, len(d))
+	for i, c := range d {
+		object := set.schemaObjects[c.Object]
+		if object == "" {
+			object = c.Object
+		}
+		name := c.Name
+		if c.Parent != "" {
+			name = c.Parent + "." + c.Name
+		}
+		msgs[i] = fmt.Sprintf(set.schemaChangeKinds[c.Kind], object, name, c.From, c.To)
+	}
+	return strings.Join(msgs, sep)
+}
+
+// DiffSchema 比较会话中的 schema 与请求中的新 schema。删除与新增的对象类型和结构相同、
+// 且在列表中位置相同或彼此唯一匹配时报告为可能的重命名，无法据此确认是重命名还是删除后新增
+func DiffSchema(before, after Schema) SchemaDiff {
+	var diff SchemaDiff
+	diff = append(diff, diffSchemaObjects("table", "column", tableObjects(before.Tables), tableObjects(after.Tables))...)
+	diff = append(diff, diffSchemaObjects("key", "field", keyObjects(before.Keys), keyObjects(after.Keys))...)
+	diff = append(diff, diffSchemaObjects("collection", "field", collectionObjects(before.Collections), collectionObjects(after.Collections))...)
+	diff = append(diff, diffSchemaObjects("index", "field", indexObjects(before.Indices), indexObjects(after.Indices))...)
+	diff = append(diff, diffSchemaObjects("node", "property", nodeObjects(before.Nodes), nodeObjects(after.Nodes))...)
+	diff = append(diff, diffSchemaObjects("relationship", "property", relationshipObjects(before.Relationships), relationshipObjects(after.Relationships))...)
+	return diff
+}
+
+// schemaObject 表、key、集合等顶层对象的统一表示
+type schemaObject struct {
+	name       string
+	kind       string // key 的数据类型或关系类型的起点终点，其他对象为空
+	kindChange string // kind 变化时的变更类型
+	columns    []Column
+}
+
+func tableObjects(tables []Table) []schemaObject {
+	objects := make([]schemaObject, len(tables))
+	for i, t := range tables {
+		objects[i] = schemaObject{name: t.Name, columns: t.Columns}
+	}
+	return objects
+}
+
+func keyObjects(keys []RedisKey) []schemaObject {
+	objects := make([]schemaObject, len(keys))
+	for i, k := range keys {
+		objects[i] = schemaObject{name: k.Pattern, kind: k.Type, kindChange: SchemaChangeTypeChanged, columns: k.Fields}
+	}
+	return objects
+}
+
+func collectionObjects(collections []Collection) []schemaObject {
+	objects := make([]schemaObject, len(collections))
+	for i, c := range collections {
+		objects[i] = schemaObject{name: c.Name, columns: c.Fields}
+	}
+	return objects
+}
+
+// indexObjects 按映射展开后的字段路径与类型比较索引，映射无法解析时没有字段
+func indexObjects(indices []Index) []schemaObject {
+	objects := make([]schemaObject, len(indices))
+	for i, idx := range indices {
+		fields, _ := parseESMapping(idx.Mappings)
+		columns := make([]Column, 0, len(fields))
+		for name, typ := range fields {
+			columns = append(columns, Column{Name: name, Type: typ})
+		}
+		sort.Slice(columns, func(a, b int) bool { return columns[a].Name < columns[b].Name })
+		objects[i] = schemaObject{name: idx.Name, columns: columns}
+	}
+	return objects
+}
+
+func nodeObjects(nodes []NodeLabel) []schemaObject {
+	objects := make([]schemaObject, len(nodes))
+	for i, n := range nodes {
+		objects[i] = schemaObject{name: n.Label, columns: n.Properties}
+	}
+	return objects
+}
+
+func relationshipObjects(relationships []Relationship) []schemaObject {
+	objects := make([]schemaObject, len(relationships))
+	for i, r := range relationships {
+		objects[i] = schemaObject{
+			name:       r.Type,
+			kind:       fmt.Sprintf("(%s)->(%s)", r.From, r.To),
+			kindChange: SchemaChangeEndpointsChanged,
+			columns:    r.Properties,
+		}
+	}
+	return objects
+}
+
+// diffSchemaObjects 按名称比较顶层对象，名称相同的对象继续比较其列（字段、属性）
+func diffSchemaObjects(object, child string, before, after []schemaObject) SchemaDiff {
+	newByName := make(map[string]int, len(after))
+	for j := len(after) - 1; j >= 0; j-- {
+		newByName[after[j].name] = j
+	}
+	oldNames := make(map[string]bool, len(before))
+	var diff SchemaDiff
+	var removed, added []int
+	for i, o := range before {
+		if oldNames[o.name] {
+			continue
+		}
+		oldNames[o.name] = true
+		j, ok := newByName[o.name]
+		if !ok {
+			removed = append(removed, i)
+			continue
+		}
+		if n := after[j]; o.kind != n.kind {
+			diff = append(diff, SchemaChange{Kind: o.kindChange, Object: object, Name: o.name, From: o.kind, To: n.kind})
+		}
+		diff = append(diff, diffColumns(child, o.name, o.columns, after[j].columns)...)
+	}
+	for j, n := range after {
+		if !oldNames[n.name] && newByName[n.name] == j {
+			added = append(added, j)
+		}
+	}
+
+	renamed := pairRenames(removed, added, func(i, j int) bool {
+		sig := columnSignature(before[i].columns)
+		return sig != "" && before[i].kind == after[j].kind && sig == columnSignature(after[j].columns)
+	})
+	return append(diff, renameChanges(object, "", removed, added, renamed,
+		func(i int) string { return before[i].name }, func(j int) string { return after[j].name })...)
+}
+
+// diffColumns 比较同一对象下的列：名称相同比较类型，删除与新增的列类型相同时可能是重命名
+func diffColumns(object, parent string, before, after []Column) SchemaDiff {
+	newByName := make(map[string]int, len(after))
+	for j := len(after) - 1; j >= 0; j-- {
+		newByName[after[j].Name] = j
+	}
+	oldNames := make(map[string]bool, len(before))
+	var diff SchemaDiff
+	var removed, added []int
+	for i, o := range before {
+		if oldNames[o.Name] {
+			continue
+		}
+		oldNames[o.Name] = true
+		j, ok := newByName[o.Name]
+		if !ok {
+			removed = append(removed, i)
+			continue
+		}
+		if n := after[j]; !strings.EqualFold(strings.TrimSpace(o.Type), strings.TrimSpace(n.Type)) {
+			diff = append(diff, SchemaChange{Kind: SchemaChangeTypeChanged, Object: object, Parent: parent, Name: o.Name, From: o.Type, To: n.Type})
+		}
+	}
+	for j, n := range after {
+		if !oldNames[n.Name] && newByName[n.Name] == j {
+			added = append(added, j)
+		}
+	}
+
+	renamed := pairRenames(removed, added, func(i, j int) bool {
+		return strings.EqualFold(strings.TrimSpace(before[i].Type), strings.TrimSpace(after[j].Type))
+	})
+	return append(diff, renameChanges(object, parent, removed, added, renamed,
+		func(i int) string { return before[i].Name }, func(j int) string { return after[j].Name })...)
+}
+
+// pairRenames 在删除与新增的对象之间识别重命名：相似且在原列表中位置相同的优先配对，
+// 其余只在双方都是唯一相似对象时配对。返回删除对象下标到新增对象下标的映射
+func pairRenames(removed, added []int, similar func(i, j int) bool) map[int]int {
+	pairs := make(map[int]int)
+	taken := make(map[int]bool)
+	for _, i := range removed {
+		for _, j := range added {
+			if i == j && similar(i, j) {
+				pairs[i] = j
+				taken[j] = true
+			}
+		}
+	}
+	for _, i := range removed {
+		if _, ok := pairs[i]; ok {
+			continue
+		}
+		candidate, n := -1, 0
+		for _, j := range added {
+			if !taken[j] && similar(i, j) {
+				candidate, n = j, n+1
+			}
+		}
+		if n != 1 {
+			continue
+		}
+		m := 0
+		for _, k := range removed {
+			if _, ok := pairs[k]; !ok && similar(k, candidate) {
+				m++
+			}
+		}
+		if m == 1 {
+			pairs[i] = candidate
+			taken[candidate] = true
+		}
+	}
+	return pairs
+}
+
+// renameChanges 按原列表顺序输出可能的重命名与删除，再输出新增
+func renameChanges(object, parent string, removed, added []int, renamed map[int]int, oldName, newName func(int) string) SchemaDiff {
+	var diff SchemaDiff
+	taken := make(map[int]bool, len(renamed))
+	for _, i := range removed {
+		if j, ok := renamed[i]; ok {
+			taken[j] = true
+			diff = append(diff, SchemaChange{Kind: SchemaChangePossiblyRenamed, Object: object, Parent: parent, Name: oldName(i), From: oldName(i), To: newName(j)})
+			continue
+		}
+		diff = append(diff, SchemaChange{Kind: SchemaChangeRemoved, Object: object, Parent: parent, Name: oldName(i)})
+	}
+	for _, j := range added {
+		if !taken[j] {
+			diff = append(diff, SchemaChange{Kind: SchemaChangeAdded, Object: object, Parent: parent, Name: newName(j)})
+		}
+	}
+	return diff
+}
+
+// columnSignature 与列顺序无关的列名和类型，用于识别重命名的表
+func columnSignature(columns []Column) string {
+	parts := make([]string, len(columns))
+	for i, c := range columns {
+		parts[i] = c.Name + " " + strings.ToLower(strings.TrimSpace(c.Type))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
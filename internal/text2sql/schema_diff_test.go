@@ -0,0 +1,180 @@
+package text2sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	users := Table{Name: "users", Columns: []Column{{Name: "id", Type: "int"}, {Name: "name", Type: "varchar"}}}
+	tests := []struct {
+		name   string
+		before Schema
+		after  Schema
+		want   SchemaDiff
+	}{
+		{
+			name:   "equal",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "name", Type: "VARCHAR", Comment: "用户名"}, {Name: "id", Type: "int"}}}}},
+		},
+		{
+			name:   "table replaced",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "orders", Columns: []Column{{Name: "id", Type: "int"}}}}},
+			want: SchemaDiff{
+				{Kind: SchemaChangeRemoved, Object: "table", Name: "users"},
+				{Kind: SchemaChangeAdded, Object: "table", Name: "orders"},
+			},
+		},
+		{
+			name:   "table renamed",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "accounts", Columns: users.Columns}}},
+			want:   SchemaDiff{{Kind: SchemaChangePossiblyRenamed, Object: "table", Name: "users", From: "users", To: "accounts"}},
+		},
+		{
+			name:   "column added",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "users", Columns: append(append([]Column{}, users.Columns...), Column{Name: "email", Type: "varchar"})}}},
+			want:   SchemaDiff{{Kind: SchemaChangeAdded, Object: "column", Parent: "users", Name: "email"}},
+		},
+		{
+			name:   "column renamed in place",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}, {Name: "full_name", Type: "varchar"}}}}},
+			want:   SchemaDiff{{Kind: SchemaChangePossiblyRenamed, Object: "column", Parent: "users", Name: "name", From: "name", To: "full_name"}},
+		},
+		{
+			name:   "column renamed and moved",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "username", Type: "varchar"}, {Name: "id", Type: "int"}}}}},
+			want:   SchemaDiff{{Kind: SchemaChangePossiblyRenamed, Object: "column", Parent: "users", Name: "name", From: "name", To: "username"}},
+		},
+		{
+			name:   "ambiguous rename",
+			before: Schema{Tables: []Table{{Name: "t", Columns: []Column{{Name: "x", Type: "text"}, {Name: "a", Type: "int"}, {Name: "b", Type: "int"}}}}},
+			after:  Schema{Tables: []Table{{Name: "t", Columns: []Column{{Name: "c", Type: "int"}}}}},
+			want: SchemaDiff{
+				{Kind: SchemaChangeRemoved, Object: "column", Parent: "t", Name: "x"},
+				{Kind: SchemaChangeRemoved, Object: "column", Parent: "t", Name: "a"},
+				{Kind: SchemaChangeRemoved, Object: "column", Parent: "t", Name: "b"},
+				{Kind: SchemaChangeAdded, Object: "column", Parent: "t", Name: "c"},
+			},
+		},
+		{
+			name:   "column type changed",
+			before: Schema{Tables: []Table{users}},
+			after:  Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "bigint"}, {Name: "name", Type: "varchar"}}}}},
+			want:   SchemaDiff{{Kind: SchemaChangeTypeChanged, Object: "column", Parent: "users", Name: "id", From: "int", To: "bigint"}},
+		},
+		{
+			name:   "redis key type",
+			before: Schema{Keys: []RedisKey{{Pattern: "user:{id}", Type: "hash"}}},
+			after:  Schema{Keys: []RedisKey{{Pattern: "user:{id}", Type: "zset"}}},
+			want:   SchemaDiff{{Kind: SchemaChangeTypeChanged, Object: "key", Name: "user:{id}", From: "hash", To: "zset"}},
+		},
+		{
+			name:   "elasticsearch mapping field",
+			before: Schema{Indices: []Index{{Name: "logs-*", Mappings: json.RawMessage(`{"properties":{"level":{"type":"keyword"}}}`)}}},
+			after:  Schema{Indices: []Index{{Name: "logs-*", Mappings: json.RawMessage(`{"properties": {"level": {"type": "keyword"}, "took": {"type": "long"}}}`)}}},
+			want:   SchemaDiff{{Kind: SchemaChangeAdded, Object: "field", Parent: "logs-*", Name: "took"}},
+		},
+		{
+			name:   "relationship endpoints",
+			before: Schema{Relationships: []Relationship{{Type: "FOLLOWS", From: "User", To: "User"}}},
+			after:  Schema{Relationships: []Relationship{{Type: "FOLLOWS", From: "User", To: "Topic"}}},
+			want:   SchemaDiff{{Kind: SchemaChangeEndpointsChanged, Object: "relationship", Name: "FOLLOWS", From: "(User)->(User)", To: "(User)->(Topic)"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffSchema(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffSchema = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SchemaChanges(t *testing.T) {
+	provider := &recordingProvider{content: "SELECT id, full_name FROM users"}
+	svc := NewService(provider, nil, 1)
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}, {Name: "name", Type: "varchar"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	first, err := svc.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}, {Name: "full_name", Type: "varchar"}}}}}
+	next := &GenerateRequest{Query: "加上姓名", ConversationID: first.ConversationID, Schema: renamed}
+	_, err = svc.Generate(context.Background(), next)
+	var diff SchemaDiff
+	if !errors.Is(err, ErrSchemaMismatch) || !errors.As(err, &diff) || len(diff) != 1 || diff[0].Kind != SchemaChangePossiblyRenamed {
+		t.Fatalf("expected ErrSchemaMismatch with the diff, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "列 users.name 可能重命名为 full_name") {
+		t.Errorf("error should describe the change: %v", err)
+	}
+
+	next.AcceptSchemaChanges = true
+	resp, err := svc.Generate(context.Background(), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.SchemaChanges, diff) {
+		t.Errorf("schema_changes = %+v, want %+v", resp.SchemaChanges, diff)
+	}
+	messages := provider.requests[len(provider.requests)-1].Messages
+	note := messages[len(messages)-2]
+	if note.Role != "system" || !strings.Contains(note.Content, "- 列 users.name 可能重命名为 full_name") {
+		t.Errorf("expected schema change note before the question, got %+v", note)
+	}
+
+	// 接受后会话使用新 schema，再次提交不再报告变更
+	detail, err := svc.GetConversation(context.Background(), first.ConversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(detail.Schema, renamed) {
+		t.Errorf("conversation schema = %+v, want %+v", detail.Schema, renamed)
+	}
+	next.AcceptSchemaChanges = false
+	if resp, err = svc.Generate(context.Background(), next); err != nil || resp.SchemaChanges != nil {
+		t.Errorf("expected no schema changes after accepting, got %+v, err %v", resp, err)
+	}
+}
+
+func TestService_SchemaDescriptionUpdate(t *testing.T) {
+	svc := NewService(&recordingProvider{content: "SELECT id FROM users"}, nil, 1)
+	req := &GenerateRequest{
+		Query:    "查询用户",
+		Schema:   Schema{Tables: []Table{{Name: "users", Columns: []Column{{Name: "id", Type: "int"}}}}},
+		Database: Database{Type: "mysql", Version: "8.0"},
+	}
+	first, err := svc.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只修改注释、行数和分区键没有结构变更，无需 accept_schema_changes，但会话保存新的描述
+	described := Schema{Tables: []Table{{Name: "users", Rows: 1000, PartitionKey: []string{"id"}, Columns: []Column{{Name: "id", Type: "int", Comment: "用户 ID"}}}}}
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{Query: "按 ID 排序", ConversationID: first.ConversationID, Schema: described})
+	if err != nil || resp.SchemaChanges != nil {
+		t.Fatalf("expected no schema changes, got %+v, err %v", resp, err)
+	}
+	detail, err := svc.GetConversation(context.Background(), first.ConversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(detail.Schema, described) {
+		t.Errorf("conversation schema = %+v, want %+v", detail.Schema, described)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -15,44 +16,65 @@ import (
 
 // Service Text2SQL 核心服务
 type Service struct {
-	llm          llm.Provider
-	validator    *SQLValidator
-	maxRetries   int
-	contextStore ContextStore
+	llm              llm.Provider
+	validator        *SQLValidator
+	maxRetries       int
+	contextStore     ContextStore
+	structuredOutput bool
+	prompts          *PromptTemplates
+	history          HistoryOptions
+	retention        RetentionPolicy
+	limits           ConversationLimits
+}
+
+// ServiceOptions 服务选项
+type ServiceOptions struct {
+	MaxRetries   int          // 生成与校验的最大尝试次数，默认 1
+	ContextStore ContextStore // 会话上下文存储，默认内存存储
+	// StructuredOutput 要求 LLM 按 JSON Schema 返回 sql、explanation、tables_used、assumptions，
+	// 解码失败时退回文本解析
+	StructuredOutput bool
+	// Prompts 外部提示词模板，为 nil 时只使用内置提示词
+	Prompts *PromptTemplates
+	// History 多轮对话历史的 token 预算与策略，默认按 4000 token 预算发送最近轮次并滚动摘要更早的轮次
+	History HistoryOptions
+	// Retention 会话保留策略，用于计算 expires_at 并在读取时视已过期的会话为不存在，应与 ContextStore 的策略一致
+	Retention RetentionPolicy
+	// Limits 会话轮数与每个所有者的会话数上限，默认不限制
+	Limits ConversationLimits
 }
 
 // NewService 创建 Text2SQL 服务
 func NewService(llmProvider llm.Provider, validator *SQLValidator, maxRetries int) *Service {
-	if validator == nil {
-		validator = &SQLValidator{}
-	}
-	if maxRetries <= 0 {
-		maxRetries = 1
-	}
-	return &Service{
-		llm:          llmProvider,
-		validator:    validator,
-		maxRetries:   maxRetries,
-		contextStore: NewMemoryContextStore(),
-	}
+	return NewServiceWithOptions(llmProvider, validator, ServiceOptions{MaxRetries: maxRetries})
 }
 
 // NewServiceWithContextStore 创建带自定义上下文存储的 Text2SQL 服务
 func NewServiceWithContextStore(llmProvider llm.Provider, validator *SQLValidator, maxRetries int, store ContextStore) *Service {
+	return NewServiceWithOptions(llmProvider, validator, ServiceOptions{MaxRetries: maxRetries, ContextStore: store})
+}
+
+// NewServiceWithOptions 按选项创建 Text2SQL 服务
+func NewServiceWithOptions(llmProvider llm.Provider, validator *SQLValidator, opts ServiceOptions) *Service {
 	if validator == nil {
-		validator = &SQLValidator{}
+		validator = NewSQLValidator()
 	}
-	if maxRetries <= 0 {
-		maxRetries = 1
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 1
 	}
-	if store == nil {
-		store = NewMemoryContextStore()
+	if opts.ContextStore == nil {
+		opts.ContextStore = NewMemoryContextStoreWithRetention(opts.Retention)
 	}
 	return &Service{
-		llm:          llmProvider,
-		validator:    validator,
-		maxRetries:   maxRetries,
-		contextStore: store,
+		llm:              llmProvider,
+		validator:        validator,
+		maxRetries:       opts.MaxRetries,
+		contextStore:     opts.ContextStore,
+		structuredOutput: opts.StructuredOutput,
+		prompts:          opts.Prompts,
+		history:          opts.History.withDefaults(),
+		retention:        opts.Retention.withDefaults(),
+		limits:           opts.Limits,
 	}
 }
 
@@ -64,17 +86,33 @@ type GenerateRequest struct {
 	Database       Database `json:"database,omitempty"`        // 可选：续会话时可省略，从上下文读取
 	ConversationID string   `json:"conversation_id,omitempty"` // 可选：会话ID，用于关联上下文
 	PreviousSQL    string   `json:"previous_sql,omitempty"`    // 可选：上一轮SQL，用于追加修改
+	Language       string   `json:"language,omitempty"`        // 可选：提示词与解释的语言（zh、en），默认 zh
+	// AcceptSchemaChanges 续会话时 schema 与历史不一致，按新 schema 继续并告知 LLM 结构变更，而不是返回 SCHEMA_MISMATCH
+	AcceptSchemaChanges bool `json:"accept_schema_changes,omitempty"`
 }
 
 // Schema 表结构
 type Schema struct {
-	Tables []Table `json:"tables" validate:"omitempty,dive"`
+	Tables        []Table        `json:"tables,omitempty" validate:"omitempty,dive"`
+	Keys          []RedisKey     `json:"keys,omitempty" validate:"omitempty,dive"`          // Redis key 空间，database.type 为 redis 时使用
+	Collections   []Collection   `json:"collections,omitempty" validate:"omitempty,dive"`   // MongoDB 集合，database.type 为 mongodb 时使用
+	Indices       []Index        `json:"indices,omitempty" validate:"omitempty,dive"`       // Elasticsearch 索引，database.type 为 elasticsearch 时使用
+	Nodes         []NodeLabel    `json:"nodes,omitempty" validate:"omitempty,dive"`         // 图数据库节点标签，database.type 为 cypher 时使用
+	Relationships []Relationship `json:"relationships,omitempty" validate:"omitempty,dive"` // 图数据库关系类型，database.type 为 cypher 时使用
+}
+
+// IsEmpty 是否未提供任何表、key、集合、索引或图结构定义
+func (s Schema) IsEmpty() bool {
+	return len(s.Tables) == 0 && len(s.Keys) == 0 && len(s.Collections) == 0 && len(s.Indices) == 0 &&
+		len(s.Nodes) == 0 && len(s.Relationships) == 0
 }
 
 // Table 表定义
 type Table struct {
-	Name    string   `json:"name" validate:"required"`
-	Columns []Column `json:"columns" validate:"required,dive"`
+	Name         string   `json:"name" validate:"required"`
+	Columns      []Column `json:"columns" validate:"required,dive"`
+	PartitionKey []string `json:"partition_key,omitempty"` // 可选：分区键列，用于大表的分区过滤校验（ClickHouse）
+	Rows         int64    `json:"rows,omitempty"`          // 可选：估算行数
 }
 
 // Column 列定义
@@ -84,68 +122,199 @@ type Column struct {
 	Comment string `json:"comment"`
 }
 
+// RedisKey Redis key 模式定义。
+// Pattern 中的占位符写作 {name} 或 {name:type}，type 可选 int、uuid、date、string（默认，匹配不含冒号的一段）。
+type RedisKey struct {
+	Pattern string   `json:"pattern" validate:"required"`                                          // key 模板，如 user:{id:int}:orders
+	Type    string   `json:"type" validate:"required,oneof=string hash list set zset stream json"` // 数据类型
+	Comment string   `json:"comment,omitempty"`
+	Fields  []Column `json:"fields,omitempty" validate:"omitempty,dive"` // hash 的 field、stream 条目的 field 或 JSON 路径
+	Member  string   `json:"member,omitempty"`                           // list/set/zset 元素的含义
+	Score   string   `json:"score,omitempty"`                            // zset score 的含义
+	TTL     string   `json:"ttl,omitempty"`                              // 过期约定，如 "30 分钟"
+}
+
+// Collection MongoDB 集合定义，嵌套字段用点号路径表示，如 address.city
+type Collection struct {
+	Name    string   `json:"name" validate:"required"`
+	Comment string   `json:"comment,omitempty"`
+	Fields  []Column `json:"fields" validate:"omitempty,dive"`
+}
+
+// Index Elasticsearch 索引定义，Name 可以是 logs-* 这样的索引模式
+type Index struct {
+	Name     string          `json:"name" validate:"required"`
+	Comment  string          `json:"comment,omitempty"`
+	Mappings json.RawMessage `json:"mappings" validate:"required"` // 索引映射，即 GET /索引名/_mapping 返回的 mappings（含 properties）
+}
+
+// NodeLabel 图数据库节点标签定义
+type NodeLabel struct {
+	Label      string   `json:"label" validate:"required"`
+	Comment    string   `json:"comment,omitempty"`
+	Properties []Column `json:"properties,omitempty" validate:"omitempty,dive"`
+}
+
+// Relationship 图数据库关系类型定义，From / To 为起点和终点的节点标签
+type Relationship struct {
+	Type       string   `json:"type" validate:"required"`
+	From       string   `json:"from,omitempty"`
+	To         string   `json:"to,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+	Properties []Column `json:"properties,omitempty" validate:"omitempty,dive"`
+}
+
 // Database 目标数据库信息
 type Database struct {
-	Type    string `json:"type" validate:"omitempty,oneof=mysql postgresql sqlite redis"`
-	Version string `json:"version"`
+	Type    string   `json:"type" validate:"omitempty,dialect"` // 已注册的方言名，见 RegisterDialect
+	Version string   `json:"version"`
+	Modules []string `json:"modules,omitempty"` // 可选：Redis 已安装的模块，如 json（RedisJSON）、search（RediSearch）
 }
 
 // GenerateResponse 生成响应
 type GenerateResponse struct {
-	SQL            string `json:"sql"`
-	Explanation    string `json:"explanation"`
-	ConversationID string `json:"conversation_id"` // 会话ID，供后续请求使用
+	SQL            string      `json:"sql"`
+	Explanation    string      `json:"explanation"`
+	ConversationID string      `json:"conversation_id"`          // 会话ID，供后续请求使用
+	Warnings       Diagnostics `json:"warnings,omitempty"`       // 校验通过但需要关注的警告
+	TablesUsed     []string    `json:"tables_used,omitempty"`    // 结构化输出模式下，LLM 报告用到的表
+	Assumptions    []string    `json:"assumptions,omitempty"`    // 结构化输出模式下，LLM 对需求所做的假设
+	Language       string      `json:"language"`                 // 实际使用的解释语言
+	ExpiresAt      *time.Time  `json:"expires_at,omitempty"`     // 会话按保留策略的过期时间，置顶或不限制时省略
+	SchemaChanges  SchemaDiff  `json:"schema_changes,omitempty"` // 本轮接受的 schema 结构变更
 }
 
 // Generate 根据自然语言和表结构生成 SQL
 func (s *Service) Generate(ctx context.Context, req *GenerateRequest) (*GenerateResponse, error) {
-	// 1. 加载或创建会话上下文
-	convCtx, conversationID, err := s.loadOrCreateContext(req)
+	// 1-4. 加载会话上下文，确定方言并构建 LLM 消息
+	p, err := s.prepare(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2. 确定使用的 schema 和 database
-	schema, database := s.resolveSchemaAndDatabase(req, convCtx)
+	// 5. 检查会话轮数上限；新会话记录所有者，并检查会话数上限是否还有可淘汰的会话，
+	// 生成成功保存时才真正淘汰，生成失败不丢失已有会话
+	if p.created {
+		if principal, ok := PrincipalFromContext(ctx); ok {
+			p.convCtx.Owner = principal.ID()
+		}
+		if _, err := s.conversationsToEvict(p.convCtx.Owner, ""); err != nil {
+			return nil, err
+		}
+	} else if err := s.checkTurnLimit(p.convCtx); err != nil {
+		return nil, err
+	}
 
-	// 3. 确定使用的 previous_sql
-	previousSQL := s.resolvePreviousSQL(req, convCtx)
+	// 6. 调用 LLM 生成 SQL
+	out, warnings, err := s.callLLMWithRetry(ctx, p, req.Query)
+	if err != nil {
+		return nil, err
+	}
 
-	// 4. 构建 LLM 消息
-	messages := s.buildMessages(req, schema, database, previousSQL, convCtx)
+	// 7. 保存上下文，历史超出预算时先更新滚动摘要；新会话先淘汰最久未使用的会话，无法淘汰时不创建
+	if err := s.saveContext(ctx, p, req.Query, out.SQL, out.Explanation); err != nil {
+		return nil, err
+	}
 
-	// 5. 调用 LLM 生成 SQL
-	sql, explanation, err := s.callLLMWithRetry(ctx, messages, database)
+	return &GenerateResponse{
+		SQL:            out.SQL,
+		Explanation:    out.Explanation,
+		ConversationID: p.conversationID,
+		Warnings:       warnings,
+		TablesUsed:     out.TablesUsed,
+		Assumptions:    out.Assumptions,
+		Language:       p.language,
+		ExpiresAt:      s.retention.expiresAt(p.convCtx.Pinned, p.convCtx.CreatedAt, p.convCtx.UpdatedAt),
+		SchemaChanges:  p.schemaChanges,
+	}, nil
+}
+
+// RenderedPrompt 按请求构建、尚未发送给 LLM 的消息
+type RenderedPrompt struct {
+	Dialect        string          `json:"dialect"`
+	Language       string          `json:"language"`
+	Messages       []llm.Message   `json:"messages"`
+	ResponseFormat json.RawMessage `json:"response_format,omitempty"` // 结构化输出模式下的 JSON Schema
+}
+
+// RenderPrompt 按请求构建发送给 LLM 的消息，不调用 LLM 也不保存上下文，用于调试提示词模板
+func (s *Service) RenderPrompt(ctx context.Context, req *GenerateRequest) (*RenderedPrompt, error) {
+	p, err := s.prepare(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	rendered := &RenderedPrompt{Dialect: p.dialect.Name(), Language: p.language, Messages: p.messages}
+	if s.structuredOutput {
+		rendered.ResponseFormat = structuredOutputFormat.Schema
+	}
+	return rendered, nil
+}
 
-	// 6. 保存上下文
-	s.saveContext(convCtx, conversationID, schema, database, req.Query, sql, explanation)
+// preparedGeneration 调用 LLM 前确定的会话、方言与消息
+type preparedGeneration struct {
+	convCtx        *ConversationContext
+	conversationID string
+	created        bool // 本次请求新建的会话
+	schema         Schema
+	database       Database
+	dialect        Dialect
+	language       string
+	messages       []llm.Message
+	schemaChanges  SchemaDiff // 本轮接受的 schema 结构变更
+}
 
-	return &GenerateResponse{
-		SQL:            sql,
-		Explanation:    explanation,
-		ConversationID: conversationID,
+// prepare 加载或创建会话上下文，确定 schema、database、方言和 previous_sql，并构建 LLM 消息
+func (s *Service) prepare(ctx context.Context, req *GenerateRequest) (*preparedGeneration, error) {
+	// 1. 加载或创建会话上下文
+	convCtx, conversationID, changes, err := s.loadOrCreateContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 确定使用的 schema、database 和方言
+	schema, database := s.resolveSchemaAndDatabase(req, convCtx)
+	dialect, err := GetDialect(database.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 确定使用的 previous_sql
+	previousSQL := s.resolvePreviousSQL(req, convCtx)
+	language, _ := getPromptSet(req.Language)
+
+	// 4. 构建 LLM 消息
+	return &preparedGeneration{
+		convCtx:        convCtx,
+		conversationID: conversationID,
+		created:        conversationID != req.ConversationID,
+		schema:         schema,
+		database:       database,
+		dialect:        dialect,
+		language:       language,
+		messages:       s.buildMessages(req, dialect, language, schema, database, previousSQL, convCtx, changes),
+		schemaChanges:  changes,
 	}, nil
 }
 
-// loadOrCreateContext 加载或创建会话上下文
-func (s *Service) loadOrCreateContext(req *GenerateRequest) (*ConversationContext, string, error) {
+// loadOrCreateContext 加载或创建会话上下文，请求方无权访问的会话视为不存在。
+// 续会话时请求中的 schema 与历史存在结构差异，设置了 accept_schema_changes 时返回差异，否则返回 ErrSchemaMismatch
+func (s *Service) loadOrCreateContext(ctx context.Context, req *GenerateRequest) (*ConversationContext, string, SchemaDiff, error) {
 	var conversationID string
 	var convCtx *ConversationContext
 	var schema Schema
 	var database Database
+	var changes SchemaDiff
 
 	if req.ConversationID != "" {
-		loadedCtx, err := s.contextStore.Get(req.ConversationID)
+		loadedCtx, err := s.loadConversation(ctx, req.ConversationID, accessRead)
 		if err == nil {
 			convCtx = loadedCtx
 			conversationID = req.ConversationID
-			if len(req.Schema.Tables) > 0 {
+			if !req.Schema.IsEmpty() {
 				schema = req.Schema
-				if !s.schemaEqual(convCtx.Schema, req.Schema) {
-					return nil, "", fmt.Errorf("%w: schema 与历史会话不一致", ErrSchemaMismatch)
+				changes = DiffSchema(convCtx.Schema, req.Schema)
+				if len(changes) > 0 && !req.AcceptSchemaChanges {
+					return nil, "", nil, fmt.Errorf("%w: schema 与历史会话不一致（%w），如需按新 schema 继续请设置 accept_schema_changes", ErrSchemaMismatch, changes)
 				}
 			} else {
 				schema = convCtx.Schema
@@ -153,31 +322,31 @@ func (s *Service) loadOrCreateContext(req *GenerateRequest) (*ConversationContex
 			if req.Database.Type != "" {
 				database = req.Database
 				if convCtx.Database.Type != req.Database.Type || convCtx.Database.Version != req.Database.Version {
-					return nil, "", fmt.Errorf("%w: database 与历史会话不一致", ErrDatabaseMismatch)
+					return nil, "", nil, fmt.Errorf("%w: database 与历史会话不一致", ErrDatabaseMismatch)
 				}
 			} else {
 				database = convCtx.Database
 			}
 		} else if err == ErrConversationNotFound {
 			conversationID = generateConversationID()
-			if len(req.Schema.Tables) == 0 {
-				return nil, "", fmt.Errorf("%w: conversation_id 无效或已过期，请提供 schema", ErrSchemaRequired)
+			if req.Schema.IsEmpty() {
+				return nil, "", nil, fmt.Errorf("%w: conversation_id 无效或已过期，请提供 schema", ErrSchemaRequired)
 			}
 			if req.Database.Type == "" {
-				return nil, "", fmt.Errorf("%w: conversation_id 无效或已过期，请提供 database", ErrDatabaseRequired)
+				return nil, "", nil, fmt.Errorf("%w: conversation_id 无效或已过期，请提供 database", ErrDatabaseRequired)
 			}
 			schema = req.Schema
 			database = req.Database
 		} else {
-			return nil, "", fmt.Errorf("加载上下文失败: %w", err)
+			return nil, "", nil, fmt.Errorf("加载上下文失败: %w", err)
 		}
 	} else {
 		conversationID = generateConversationID()
-		if len(req.Schema.Tables) == 0 {
-			return nil, "", fmt.Errorf("%w: 新会话需提供 schema", ErrSchemaRequired)
+		if req.Schema.IsEmpty() {
+			return nil, "", nil, fmt.Errorf("%w: 新会话需提供 schema", ErrSchemaRequired)
 		}
 		if req.Database.Type == "" {
-			return nil, "", fmt.Errorf("%w: 新会话需提供 database", ErrDatabaseRequired)
+			return nil, "", nil, fmt.Errorf("%w: 新会话需提供 database", ErrDatabaseRequired)
 		}
 		schema = req.Schema
 		database = req.Database
@@ -194,18 +363,21 @@ func (s *Service) loadOrCreateContext(req *GenerateRequest) (*ConversationContex
 		}
 	}
 
-	return convCtx, conversationID, nil
+	return convCtx, conversationID, changes, nil
 }
 
-// resolveSchemaAndDatabase 确定使用的 schema 和 database
+// resolveSchemaAndDatabase 确定使用的 schema 和 database，请求中未提供的从会话上下文读取
 func (s *Service) resolveSchemaAndDatabase(req *GenerateRequest, convCtx *ConversationContext) (Schema, Database) {
-	if len(req.Schema.Tables) > 0 {
-		return req.Schema, req.Database
-	}
+	schema, database := req.Schema, req.Database
 	if convCtx != nil {
-		return convCtx.Schema, convCtx.Database
+		if schema.IsEmpty() {
+			schema = convCtx.Schema
+		}
+		if database.Type == "" {
+			database = convCtx.Database
+		}
 	}
-	return req.Schema, req.Database
+	return schema, database
 }
 
 // resolvePreviousSQL 确定使用的 previous_sql
@@ -220,101 +392,131 @@ func (s *Service) resolvePreviousSQL(req *GenerateRequest, convCtx *Conversation
 }
 
 // buildMessages 构建 LLM 消息列表
-func (s *Service) buildMessages(req *GenerateRequest, schema Schema, database Database, previousSQL string, convCtx *ConversationContext) []llm.Message {
-	var systemPrompt string
-	var userContent string
-
-	if database.Type == "redis" {
-		if previousSQL != "" {
-			systemPrompt = buildSystemPromptForModifyRedis(database.Version)
-			userContent = buildUserContentForModify(req.Query, schema, previousSQL)
-		} else {
-			systemPrompt = buildSystemPromptRedis(database.Version)
-			userContent = buildUserContent(req.Query, schema)
-		}
-	} else {
-		if previousSQL != "" {
-			systemPrompt = buildSystemPromptForModify(database.Type, database.Version)
-			userContent = buildUserContentForModify(req.Query, schema, previousSQL)
-		} else {
-			systemPrompt = buildSystemPrompt(database.Type, database.Version)
-			userContent = buildUserContent(req.Query, schema)
-		}
+func (s *Service) buildMessages(req *GenerateRequest, dialect Dialect, language string, schema Schema, database Database, previousSQL string, convCtx *ConversationContext, changes SchemaDiff) []llm.Message {
+	_, set := getPromptSet(language)
+	systemPrompt := s.systemPrompt(dialect, language, database, schema, req.Query, previousSQL)
+	if s.structuredOutput {
+		systemPrompt += set.structuredOutputInstruction(dialect)
+	}
+	userContent := set.buildUserContent(req.Query, schema)
+	if previousSQL != "" {
+		userContent = set.buildUserContentForModify(req.Query, schema, previousSQL)
 	}
 
-	messages := []llm.Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: userContent},
+	// 历史（滚动摘要与预算内的最近轮次）位于 system prompt 与本次问题之间
+	messages := []llm.Message{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, historyMessages(set, selectHistory(set, s.history, convCtx))...)
+	// 历史基于旧 schema，结构变更的说明紧接在历史之后
+	if len(changes) > 0 {
+		messages = append(messages, llm.Message{Role: "system", Content: fmt.Sprintf(set.schemaChanged, "- "+changes.describe(set, "\n- "))})
 	}
+	return append(messages, llm.Message{Role: "user", Content: userContent})
+}
 
-	if convCtx != nil && len(convCtx.History) > 0 && previousSQL == "" {
-		startIdx := len(convCtx.History) - 3
-		if startIdx < 0 {
-			startIdx = 0
-		}
-		for i := startIdx; i < len(convCtx.History); i++ {
-			turn := convCtx.History[i]
-			messages = append(messages,
-				llm.Message{Role: "user", Content: turn.Query},
-				llm.Message{Role: "assistant", Content: fmt.Sprintf("SQL: %s\n解释: %s", turn.SQL, turn.Explanation)},
-			)
-		}
-		messages = append(messages, llm.Message{Role: "user", Content: req.Query})
+// systemPrompt 构建 system prompt：外部模板优先，没有模板或渲染失败时使用内置提示词
+func (s *Service) systemPrompt(dialect Dialect, language string, database Database, schema Schema, query, previousSQL string) string {
+	mode := PromptModeGenerate
+	if previousSQL != "" {
+		mode = PromptModeModify
 	}
+	data := newPromptData(dialect, language, database, schema)
+	data.Query = query
+	data.PreviousSQL = previousSQL
+	data.Builtin = systemPromptFor(dialect, language, database, schema, previousSQL != "")
+	return s.renderPrompt(mode, data)
+}
 
-	return messages
+// repairMessage 构建校验失败后反馈给 LLM 的消息
+func (s *Service) repairMessage(p *preparedGeneration, query string, diags Diagnostics) string {
+	_, set := getPromptSet(p.language)
+	data := newPromptData(p.dialect, p.language, p.database, p.schema)
+	data.Query = query
+	data.Diagnostics = diags.Error()
+	data.Builtin = fmt.Sprintf(set.repair, p.dialect.StatementName(), data.Diagnostics)
+	return s.renderPrompt(PromptModeRepair, data)
 }
 
-// callLLMWithRetry 调用 LLM 并重试
-func (s *Service) callLLMWithRetry(ctx context.Context, messages []llm.Message, database Database) (string, string, error) {
-	var lastValidationErr error
-	var sql, explanation string
+// renderPrompt 渲染外部模板，渲染失败时记录警告并使用内置提示词
+func (s *Service) renderPrompt(mode string, data *PromptData) string {
+	out, ok, err := s.prompts.render(mode, data)
+	if err != nil {
+		logger.Warn("提示词模板渲染失败，使用内置提示词", "dialect", data.Dialect, "mode", mode, "error", err)
+		return data.Builtin
+	}
+	if !ok || out == "" {
+		return data.Builtin
+	}
+	return out
+}
+
+// callLLMWithRetry 调用 LLM 并重试，校验失败时将诊断反馈给 LLM 修正
+func (s *Service) callLLMWithRetry(ctx context.Context, p *preparedGeneration, query string) (*generatedOutput, Diagnostics, error) {
+	messages, dialect, schema, database := p.messages, p.dialect, p.schema, p.database
+	var lastDiags Diagnostics
+	var format *llm.ResponseFormat
+	if s.structuredOutput {
+		format = structuredOutputFormat
+	}
 
 	for attempt := 0; attempt < s.maxRetries; attempt++ {
 		resp, err := s.llm.Complete(ctx, &llm.CompleteRequest{
-			Model:       "",
-			Messages:    messages,
-			MaxTokens:   2048,
-			Temperature: 0.1,
+			Model:          "",
+			Messages:       messages,
+			MaxTokens:      2048,
+			Temperature:    0.1,
+			ResponseFormat: format,
 		})
 		if err != nil {
-			return "", "", fmt.Errorf("%w: llm complete: %w", ErrLLMError, err)
+			return nil, nil, fmt.Errorf("%w: llm complete: %w", ErrLLMError, err)
 		}
 
-		if database.Type == "redis" {
-			sql, explanation = parseLLMOutputRedis(resp.Content)
-		} else {
-			sql, explanation = parseLLMOutput(resp.Content)
-		}
+		out := s.extractOutput(dialect, resp.Content)
 
-		if err := s.validator.Validate(sql, database.Type, database.Version); err != nil {
-			lastValidationErr = err
+		diags := s.validator.DiagnoseWithSchema(out.SQL, database, schema)
+		if diags.HasErrors() {
+			lastDiags = diags
 			if attempt < s.maxRetries-1 {
-				msg := "生成的 SQL 校验失败：%s\n请修正并重新生成。"
-				if database.Type == "redis" {
-					msg = "生成的 Redis 命令校验失败：%s\n请修正并重新生成。"
-				}
 				messages = append(messages,
 					llm.Message{Role: "assistant", Content: resp.Content},
-					llm.Message{Role: "user", Content: fmt.Sprintf(msg, err.Error())},
+					llm.Message{Role: "user", Content: s.repairMessage(p, query, diags)},
 				)
 				continue
 			}
-			return "", "", fmt.Errorf("%w: %v", ErrSQLValidation, err)
+			return nil, nil, fmt.Errorf("%w: %w", ErrSQLValidation, diags)
 		}
 
-		break
+		out.SQL = s.validator.LimitRows(out.SQL, database)
+		return out, diags.Warnings(), nil
 	}
 
-	if sql == "" {
-		return "", "", fmt.Errorf("%w: %v", ErrSQLValidation, lastValidationErr)
-	}
+	return nil, nil, fmt.Errorf("%w: %w", ErrSQLValidation, lastDiags)
+}
 
-	return sql, explanation, nil
+// extractOutput 结构化模式下按 JSON Schema 解码，失败时退回方言的文本解析
+func (s *Service) extractOutput(dialect Dialect, content string) *generatedOutput {
+	if s.structuredOutput {
+		out, err := decodeStructuredOutput(content)
+		if err == nil {
+			return out
+		}
+		logger.Warn("结构化输出解析失败，退回文本解析", "dialect", dialect.Name(), "error", err)
+	}
+	sql, explanation := dialect.ExtractOutput(content)
+	return &generatedOutput{SQL: sql, Explanation: explanation}
 }
 
-// saveContext 保存会话上下文
-func (s *Service) saveContext(convCtx *ConversationContext, conversationID string, schema Schema, database Database, query, sql, explanation string) {
+// saveContext 追加本轮对话并保存会话上下文。新会话无法腾出名额时返回错误；摘要或保存失败只记录日志，不影响本次响应
+func (s *Service) saveContext(ctx context.Context, p *preparedGeneration, query, sql, explanation string) error {
+	// 生成期间其他请求可能置顶或创建了会话，淘汰失败时不保存新会话，避免超出会话数上限
+	if p.created {
+		if err := s.reserveConversation(p.convCtx.Owner, ""); err != nil {
+			return err
+		}
+	}
+
+	// 请求带有 schema 时以其替换会话中的 schema，注释、行数等不参与比较的修改也一并保存
+	convCtx := p.convCtx
+	convCtx.Schema = p.schema
 	convCtx.History = append(convCtx.History, ConversationTurn{
 		Query:       query,
 		SQL:         sql,
@@ -322,11 +524,17 @@ func (s *Service) saveContext(convCtx *ConversationContext, conversationID strin
 		Timestamp:   time.Now(),
 	})
 
+	if err := s.compactHistory(ctx, p.language, convCtx); err != nil {
+		logger.Warn("更新对话摘要失败",
+			"conversation_id", p.conversationID,
+			"error", err)
+	}
 	if err := s.contextStore.Save(convCtx); err != nil {
 		logger.Error("保存上下文失败",
-			"conversation_id", conversationID,
+			"conversation_id", p.conversationID,
 			"error", err)
 	}
+	return nil
 }
 
 // generateConversationID 生成会话ID
@@ -343,24 +551,6 @@ func generateConversationID() string {
 	return "conv_" + base64.URLEncoding.EncodeToString(b)[:22] // conv_ + 22字符 = 27字符
 }
 
-// schemaEqual 比较两个 Schema 是否相等
-func (s *Service) schemaEqual(s1, s2 Schema) bool {
-	if len(s1.Tables) != len(s2.Tables) {
-		return false
-	}
-	// 简单比较：表名和列数相同即可（实际可以更严格）
-	for i, t1 := range s1.Tables {
-		if i >= len(s2.Tables) {
-			return false
-		}
-		t2 := s2.Tables[i]
-		if t1.Name != t2.Name || len(t1.Columns) != len(t2.Columns) {
-			return false
-		}
-	}
-	return true
-}
-
 // buildSystemPrompt 构建 system prompt
 func buildSystemPrompt(dbType, version string) string {
 	v := ""
@@ -395,54 +585,66 @@ func buildSystemPromptForModify(dbType, version string) string {
 }
 
 // buildSystemPromptRedis 构建 Redis 的 system prompt（只读命令）
-func buildSystemPromptRedis(version string) string {
-	v := ""
-	if version != "" {
-		v = fmt.Sprintf("（版本 %s）", version)
-	}
-	return fmt.Sprintf(`你是一个 Redis 专家。根据用户提供的结构描述（表名表示 key 模式或结构名，列表示 hash 的 field 等）和自然语言问题，生成对应的只读 Redis 命令。%s
+func buildSystemPromptRedis(database Database, schema Schema) string {
+	return fmt.Sprintf(`你是一个 Redis 专家。根据用户提供的%s和自然语言问题，生成对应的只读 Redis 命令。%s
 
+可用的只读命令：
+%s
+%s
 规则：
-1. 只生成只读命令，如 GET、HGET、HGETALL、LRANGE、SMEMBERS、ZRANGE、SCAN、HSCAN、KEYS、EXISTS、TYPE、TTL 等
+1. 只能使用上面列出的只读命令，其他命令在目标实例上不可用或不允许
 2. 禁止 FLUSHALL、DEL、SET、HSET、LPUSH、SADD、ZADD 等任何写操作
-3. 在大键空间场景下优先使用 SCAN/HSCAN 等迭代命令，慎用 KEYS
-4. 表名/列名对应 schema 中的 key 模式或 hash field，请据此生成正确的 key 和 field 名
-5. 输出格式：第一行开始是 Redis 命令（可多行、多条命令），之后空行可选，再以"解释："开头是简要说明（可选）`, v)
+3. 在大键空间场景下优先使用 SCAN/HSCAN 等迭代命令并设置合理的 COUNT；禁止 KEYS * 这类无前缀的全量匹配；LRANGE/ZRANGE 避免 0 -1 这类全量范围，按需分页；禁止 XREAD BLOCK 等阻塞读取
+4. %s
+5. 输出格式：第一行开始是 Redis 命令（可多行、多条命令），之后空行可选，再以"解释："开头是简要说明（可选）`,
+		redisSchemaSubject(schema), versionNote(database.Version), redisAvailableCommands(database), redisKeySpaceSection(schema), redisKeyRule(schema))
 }
 
 // buildSystemPromptForModifyRedis 构建 Redis 追加修改模式的 system prompt
-func buildSystemPromptForModifyRedis(version string) string {
-	v := ""
-	if version != "" {
-		v = fmt.Sprintf("（版本 %s）", version)
-	}
+func buildSystemPromptForModifyRedis(database Database, schema Schema) string {
 	return fmt.Sprintf(`你是一个 Redis 专家。用户会提供现有的 Redis 命令和新的需求，你需要在现有命令基础上进行修改或补充。%s
 
+可用的只读命令：
+%s
+%s
 规则：
 1. 理解现有 Redis 命令的意图
-2. 根据新需求，在现有命令基础上追加或修改，只输出只读命令（GET、HGET、LRANGE、SCAN 等）
+2. 根据新需求，在现有命令基础上追加或修改，只输出上面列出的只读命令
 3. 禁止任何写操作（SET、HSET、DEL、FLUSHALL 等）
-4. 输出格式：第一行开始是修改后的完整 Redis 命令（可多行），之后以"解释："开头是简要说明（可选）`, v)
+4. %s
+5. 输出格式：第一行开始是修改后的完整 Redis 命令（可多行），之后以"解释："开头是简要说明（可选）`,
+		versionNote(database.Version), redisAvailableCommands(database), redisKeySpaceSection(schema), redisKeyRule(schema))
 }
 
-// buildUserContent 构建 user 消息内容
-func buildUserContent(query string, schema Schema) string {
-	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
-	return fmt.Sprintf("表结构：\n%s\n\n用户问题：%s", string(schemaJSON), query)
+// redisSchemaSubject 结构描述的说明：声明了 key 空间时使用 key 模式，否则沿用表结构的约定
+func redisSchemaSubject(schema Schema) string {
+	if len(schema.Keys) > 0 {
+		return " key 空间定义"
+	}
+	return "结构描述（表名表示 key 模式或结构名，列表示 hash 的 field 等）"
 }
 
-// buildUserContentForModify 构建追加修改模式的 user 消息内容
-func buildUserContentForModify(query string, schema Schema, previousSQL string) string {
-	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
-	return fmt.Sprintf(`现有 SQL：
-%s
-
-表结构：
-%s
+// redisKeySpaceSection 渲染 key 空间，未声明时为空
+func redisKeySpaceSection(schema Schema) string {
+	if len(schema.Keys) == 0 {
+		return ""
+	}
+	return "\nKey 空间（{占位符} 需替换为实际值）：\n" + renderRedisKeySpace(schema.Keys) + "\n"
+}
 
-新的需求：%s
+func redisKeyRule(schema Schema) string {
+	if len(schema.Keys) > 0 {
+		return "key 必须符合上面声明的 key 模式，并使用与 key 类型匹配的命令（如 hash 用 HGET、zset 用 ZRANGE）"
+	}
+	return "表名/列名对应 schema 中的 key 模式或 hash field，请据此生成正确的 key 和 field 名"
+}
 
-请基于现有 SQL，根据新需求进行修改。`, previousSQL, string(schemaJSON), query)
+// versionNote 提示词中的版本说明，版本未知时为空
+func versionNote(version string) string {
+	if version == "" {
+		return ""
+	}
+	return fmt.Sprintf("（版本 %s）", version)
 }
 
 // parseLLMOutput 解析 LLM 输出，提取 SQL 和解释
@@ -469,13 +671,13 @@ func parseLLMOutput(content string) (sql, explanation string) {
 			}
 			continue
 		}
-		// 非代码块：第一行以 SELECT 开头，收集到空行或 解释/说明
-		if len(sqlLines) == 0 && trimmed != "" && strings.HasPrefix(strings.ToUpper(trimmed), "SELECT") {
+		// 非代码块：第一行以 SELECT 或 CTE 的 WITH 开头，收集到空行或 解释/说明
+		if len(sqlLines) == 0 && trimmed != "" && (strings.HasPrefix(strings.ToUpper(trimmed), "SELECT") || cteStartPattern.MatchString(trimmed)) {
 			sqlLines = append(sqlLines, trimmed)
 			continue
 		}
 		if len(sqlLines) > 0 && !inSQL {
-			if trimmed == "" || startsWithIgnoreCase(trimmed, "解释") || startsWithIgnoreCase(trimmed, "说明") {
+			if trimmed == "" || isExplanationLine(trimmed) {
 				break
 			}
 			sqlLines = append(sqlLines, trimmed)
@@ -488,34 +690,21 @@ func parseLLMOutput(content string) (sql, explanation string) {
 	}
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		if startsWithIgnoreCase(trimmed, "解释：") || startsWithIgnoreCase(trimmed, "说明：") {
-			explanation = trimPrefix(trimmed, "解释：", "说明：")
+		if e, ok := cutExplanation(trimmed); ok {
+			explanation = e
 			break
 		}
 	}
 	return sql, explanation
 }
 
-// redisCommandPrefixes Redis 只读命令前缀，用于识别 LLM 输出中的命令行
-var redisCommandPrefixes = []string{
-	"GET ", "MGET ", "HGET ", "HGETALL ", "HMGET ", "LRANGE ", "LINDEX ", "LLEN ",
-	"SMEMBERS ", "SISMEMBER ", "SCARD ", "ZRANGE ", "ZREVRANGE ", "ZRANGEBYSCORE ", "ZREVRANGEBYSCORE ",
-	"ZRANK ", "ZREVRANK ", "ZSCORE ", "ZCARD ", "KEYS ", "SCAN ", "HSCAN ", "SSCAN ", "ZSCAN ",
-	"EXISTS ", "TYPE ", "TTL ", "PTTL ", "STRLEN ", "HLEN ",
-}
+// cteStartPattern 匹配以 CTE 开头的 SQL 行，如 "WITH t AS (" 或 "WITH RECURSIVE t(n) AS"
+var cteStartPattern = regexp.MustCompile(`(?i)^WITH\s+(RECURSIVE\s+)?[\w"` + "`" + `]+\s*(\([^)]*\))?\s*(AS\b|$)`)
 
+// isRedisCommandLine 判断一行是否以命令目录中的命令开头（写命令也会被识别，交由校验阶段拒绝）
 func isRedisCommandLine(line string) bool {
-	upper := strings.ToUpper(strings.TrimSpace(line))
-	for _, p := range redisCommandPrefixes {
-		if strings.HasPrefix(upper, p) || upper == strings.TrimSpace(p) {
-			return true
-		}
-	}
-	// GET key 可能没有空格（GET 后直接换行少见，但 GET key 常见）
-	if strings.HasPrefix(upper, "GET ") || upper == "GET" {
-		return true
-	}
-	return false
+	fields := strings.Fields(line)
+	return len(fields) > 0 && isRedisCommandName(fields[0])
 }
 
 // parseLLMOutputRedis 解析 LLM 输出，提取 Redis 命令和解释
@@ -558,7 +747,7 @@ func parseLLMOutputRedis(content string) (commands, explanation string) {
 			continue
 		}
 		if len(cmdLines) > 0 && !inBlock {
-			if trimmed == "" || startsWithIgnoreCase(trimmed, "解释") || startsWithIgnoreCase(trimmed, "说明") {
+			if trimmed == "" || isExplanationLine(trimmed) {
 				break
 			}
 			if isRedisCommandLine(trimmed) {
@@ -571,8 +760,8 @@ func parseLLMOutputRedis(content string) (commands, explanation string) {
 	}
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		if startsWithIgnoreCase(trimmed, "解释：") || startsWithIgnoreCase(trimmed, "说明：") {
-			explanation = trimPrefix(trimmed, "解释：", "说明：")
+		if e, ok := cutExplanation(trimmed); ok {
+			explanation = e
 			break
 		}
 	}
@@ -626,13 +815,3 @@ func startsWithIgnoreCase(s, prefix string) bool {
 	}
 	return true
 }
-
-func trimPrefix(s, p1, p2 string) string {
-	if startsWithIgnoreCase(s, p1) {
-		return s[len(p1):]
-	}
-	if startsWithIgnoreCase(s, p2) {
-		return s[len(p2):]
-	}
-	return s
-}
@@ -2,6 +2,7 @@ package text2sql
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"text2sql/internal/llm"
@@ -97,32 +98,117 @@ func TestService_Generate_ContinueConversation(t *testing.T) {
 	}
 }
 
-func TestService_SchemaEqual(t *testing.T) {
-	svc := &Service{}
+func TestBuildSystemPromptRedis_ListsAvailableCommands(t *testing.T) {
+	prompt := buildSystemPromptRedis(Database{Type: "redis", Version: "6.0"}, Schema{})
+	if !strings.Contains(prompt, "HGETALL") || !strings.Contains(prompt, "XRANGE") {
+		t.Error("expected core read commands in prompt")
+	}
+	if strings.Contains(prompt, "HRANDFIELD") || strings.Contains(prompt, "JSON.GET") {
+		t.Error("commands newer than 6.0 or from undeclared modules must not be listed")
+	}
+	prompt = buildSystemPromptRedis(Database{Type: "redis", Modules: []string{"json"}}, Schema{})
+	if !strings.Contains(prompt, "JSON.GET") {
+		t.Error("expected RedisJSON commands when the module is declared")
+	}
+}
 
-	s1 := Schema{
-		Tables: []Table{
-			{Name: "users", Columns: []Column{{Name: "id"}, {Name: "name"}}},
-		},
+func TestBuildSystemPromptRedis_RendersKeySpace(t *testing.T) {
+	schema := Schema{Keys: []RedisKey{
+		{Pattern: "user:{id:int}:orders", Type: "zset", Comment: "用户订单", Member: "订单 ID", Score: "下单时间戳", TTL: "7 天"},
+		{Pattern: "user:{id:int}", Type: "hash", Fields: []Column{{Name: "name", Type: "string", Comment: "用户名"}}},
+	}}
+	prompt := buildSystemPromptRedis(Database{Type: "redis", Version: "7.2"}, schema)
+	for _, want := range []string{"user:{id:int}:orders（zset）：用户订单", "score：下单时间戳", "field name (string)：用户名", "过期：7 天", "key 必须符合上面声明的 key 模式"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected prompt to contain %q", want)
+		}
 	}
+}
 
-	s2 := Schema{
-		Tables: []Table{
-			{Name: "users", Columns: []Column{{Name: "id"}, {Name: "name"}}},
-		},
+func TestService_Generate_StructuredOutput(t *testing.T) {
+	schema := Schema{Tables: []Table{{Name: "orders", Columns: []Column{{Name: "user_id"}, {Name: "amount"}}}}}
+	database := Database{Type: "postgresql", Version: "15"}
+
+	provider := &recordingProvider{content: `{"sql": "WITH t AS (SELECT user_id, sum(amount) AS total FROM orders GROUP BY user_id)\nSELECT user_id FROM t WHERE total > 100;", "explanation": "消费超过 100 的用户", "tables_used": ["orders"], "assumptions": ["金额单位为元"]}`}
+	svc := NewServiceWithOptions(provider, nil, ServiceOptions{StructuredOutput: true})
+	resp, err := svc.Generate(context.Background(), &GenerateRequest{Query: "消费超过 100 的用户", Schema: schema, Database: database})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.SQL, "WITH t AS") || strings.HasSuffix(resp.SQL, ";") || resp.Explanation != "消费超过 100 的用户" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if len(resp.TablesUsed) != 1 || resp.TablesUsed[0] != "orders" || len(resp.Assumptions) != 1 {
+		t.Errorf("tables_used / assumptions not returned: %+v", resp)
+	}
+	req := provider.requests[0]
+	if req.ResponseFormat == nil || req.ResponseFormat.Name != "text2sql_result" {
+		t.Errorf("expected structured response format, got %+v", req.ResponseFormat)
+	}
+	if !strings.Contains(req.Messages[0].Content, "tables_used") {
+		t.Error("system prompt should describe the JSON fields")
 	}
 
-	if !svc.schemaEqual(s1, s2) {
-		t.Error("Expected schemas to be equal")
+	// 输出要求随解释语言切换
+	if _, err := svc.Generate(context.Background(), &GenerateRequest{Query: "users who spent over 100", Schema: schema, Database: database, Language: "en"}); err != nil {
+		t.Fatal(err)
+	}
+	if system := provider.requests[len(provider.requests)-1].Messages[0].Content; !strings.Contains(system, "Output requirements") || strings.Contains(system, "输出要求") {
+		t.Errorf("English structured output instruction expected:\n%s", system)
 	}
 
-	s3 := Schema{
-		Tables: []Table{
-			{Name: "orders", Columns: []Column{{Name: "id"}}},
-		},
+	// 模型未按 JSON 返回时退回文本解析
+	provider = &recordingProvider{content: "SELECT user_id FROM orders\n解释：所有下单用户"}
+	svc = NewServiceWithOptions(provider, nil, ServiceOptions{StructuredOutput: true})
+	resp, err = svc.Generate(context.Background(), &GenerateRequest{Query: "下单用户", Schema: schema, Database: database})
+	if err != nil {
+		t.Fatalf("Generate with fallback failed: %v", err)
+	}
+	if resp.SQL != "SELECT user_id FROM orders" || resp.Explanation != "所有下单用户" || resp.TablesUsed != nil {
+		t.Errorf("unexpected fallback response: %+v", resp)
 	}
 
-	if svc.schemaEqual(s1, s3) {
-		t.Error("Expected schemas to be different")
+	// 未开启时不携带 response format
+	provider = &recordingProvider{content: "SELECT user_id FROM orders"}
+	if _, err := NewService(provider, nil, 1).Generate(context.Background(), &GenerateRequest{Query: "下单用户", Schema: schema, Database: database}); err != nil {
+		t.Fatal(err)
+	}
+	if provider.requests[0].ResponseFormat != nil {
+		t.Error("response format should be nil when structured output is disabled")
+	}
+}
+
+func TestDecodeStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantSQL string
+		wantErr bool
+	}{
+		{"plain", `{"sql": "SELECT 1", "explanation": "", "tables_used": [], "assumptions": []}`, "SELECT 1", false},
+		{"optional fields omitted", `{"sql": "SELECT 1"}`, "SELECT 1", false},
+		{"code fence", "```json\n{\"sql\": \"SELECT 1;\", \"explanation\": \"x\"}\n```", "SELECT 1", false},
+		{"text", "SELECT 1\n解释：常量", "", true},
+		{"unknown field", `{"sql": "SELECT 1", "confidence": 0.9}`, "", true},
+		{"wrong type", `{"sql": "SELECT 1", "tables_used": "users"}`, "", true},
+		{"empty sql", `{"sql": " ", "explanation": "无法生成"}`, "", true},
+		{"trailing content", `{"sql": "SELECT 1"} {"sql": "SELECT 2"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := decodeStructuredOutput(tt.content)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.SQL != tt.wantSQL {
+				t.Errorf("sql = %q, want %q", out.SQL, tt.wantSQL)
+			}
+		})
 	}
 }
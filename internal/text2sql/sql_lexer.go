@@ -0,0 +1,245 @@
+package text2sql
+
+import (
+	"strings"
+)
+
+// sqlTokenKind 词法单元类型
+type sqlTokenKind int
+
+const (
+	tokWord        sqlTokenKind = iota // 关键字或标识符
+	tokQuotedIdent                     // "ident" / `ident` / [ident]
+	tokString                          // 'string' / $$string$$
+	tokNumber                          // 数字字面量
+	tokOperator                        // 运算符，如 ->、>=、::
+	tokPunct                           // 标点，如 ( ) , ;
+	tokParam                           // 参数，如 Cypher 的 $name
+)
+
+// sqlToken 词法单元
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string // 原始文本
+	upper string // 大写形式，便于关键字比较
+	pos   int    // 在原始 SQL 中的字节偏移
+}
+
+// is 判断是否为指定关键字（大小写不敏感）
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == tokWord && t.upper == keyword
+}
+
+// isPunct 判断是否为指定标点
+func (t sqlToken) isPunct(p string) bool {
+	return t.kind == tokPunct && t.text == p
+}
+
+// isOp 判断是否为指定运算符
+func (t sqlToken) isOp(op string) bool {
+	return t.kind == tokOperator && t.text == op
+}
+
+// sqlStringStyle 字符串字面量的转义规则。按错误的规则切分会把字符串中的内容当作语句（或反之），
+// 使只读与多语句检查失效，因此每个方言必须使用自己的规则
+type sqlStringStyle int
+
+const (
+	sqlStringsStandard  sqlStringStyle = iota // 只有 '' 转义：SQLite、SQL Server
+	sqlStringsBackslash                       // 另支持反斜杠转义，"..." 同样适用：MySQL、ClickHouse
+	sqlStringsPostgres                        // 只在 E'...' 中支持反斜杠转义：PostgreSQL（standard_conforming_strings）、DuckDB
+	sqlStringsOracle                          // 只有 '' 转义，另支持 q'[...]' 替代引号：Oracle
+)
+
+// sqlOperators 多字符运算符，按长度降序匹配
+var sqlOperators = []string{
+	"->>", "#>>", "<=>",
+	"->", "#>", "#-", "@>", "<@", "?|", "?&", "::", "<=", ">=", "<>", "!=", "||", "<<", ">>",
+}
+
+// tokenizeSQL 对 SQL 做轻量级词法分析，跳过空白与注释，字符串按 style 的转义规则切分。
+// 只用于特性识别和只读检查，不做完整的语法分析。
+func tokenizeSQL(sql string, style sqlStringStyle) []sqlToken {
+	var tokens []sqlToken
+	n := len(sql)
+	i := 0
+	for i < n {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && i+1 < n && sql[i+1] == '-':
+			i = skipLineComment(sql, i)
+		case c == '#' && !(i+1 < n && (sql[i+1] == '>' || sql[i+1] == '-')):
+			// MySQL 的 # 注释；#> / #>> / #- 为 PostgreSQL JSON 运算符
+			i = skipLineComment(sql, i)
+		case c == '/' && i+1 < n && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+		case c == '\'':
+			end := scanQuoted(sql, i, '\'', style == sqlStringsBackslash)
+			tokens = append(tokens, newSQLToken(tokString, sql[i:end], i))
+			i = end
+		case style == sqlStringsPostgres && (c == 'E' || c == 'e') && i+1 < n && sql[i+1] == '\'':
+			end := scanQuoted(sql, i+1, '\'', true)
+			tokens = append(tokens, newSQLToken(tokString, sql[i:end], i))
+			i = end
+		case style == sqlStringsOracle && isOracleQuote(sql[i:]):
+			end := scanOracleQuoted(sql, i)
+			tokens = append(tokens, newSQLToken(tokString, sql[i:end], i))
+			i = end
+		case c == '"' || c == '`':
+			end := scanQuoted(sql, i, c, c == '"' && style == sqlStringsBackslash)
+			tokens = append(tokens, newSQLToken(tokQuotedIdent, sql[i:end], i))
+			i = end
+		case c == '$' && i+1 < n && (sql[i+1] == '$' || isIdentStart(sql[i+1])):
+			if end, ok := scanDollarQuoted(sql, i); ok {
+				tokens = append(tokens, newSQLToken(tokString, sql[i:end], i))
+				i = end
+				continue
+			}
+			tokens = append(tokens, newSQLToken(tokOperator, "$", i))
+			i++
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(sql[i+1])):
+			j := i + 1
+			for j < n && (isDigit(sql[j]) || sql[j] == '.' || sql[j] == 'e' || sql[j] == 'E' || isIdentPart(sql[j])) {
+				j++
+			}
+			tokens = append(tokens, newSQLToken(tokNumber, sql[i:j], i))
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < n && isIdentPart(sql[j]) {
+				j++
+			}
+			tokens = append(tokens, newSQLToken(tokWord, sql[i:j], i))
+			i = j
+		case c == '(' || c == ')' || c == ',' || c == ';' || c == '.' || c == '[' || c == ']':
+			tokens = append(tokens, newSQLToken(tokPunct, string(c), i))
+			i++
+		default:
+			matched := false
+			for _, op := range sqlOperators {
+				if strings.HasPrefix(sql[i:], op) {
+					tokens = append(tokens, newSQLToken(tokOperator, op, i))
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				tokens = append(tokens, newSQLToken(tokOperator, string(c), i))
+				i++
+			}
+		}
+	}
+	return tokens
+}
+
+func newSQLToken(kind sqlTokenKind, text string, pos int) sqlToken {
+	upper := text
+	if kind == tokWord {
+		upper = strings.ToUpper(text)
+	}
+	return sqlToken{kind: kind, text: text, upper: upper, pos: pos}
+}
+
+func skipLineComment(sql string, i int) int {
+	end := strings.IndexByte(sql[i:], '\n')
+	if end < 0 {
+		return len(sql)
+	}
+	return i + end + 1
+}
+
+// scanQuoted 扫描引号包围的内容，返回结束位置（不含）。
+// 成对的引号视为转义；backslash 为 true 时同时支持反斜杠转义。
+func scanQuoted(sql string, start int, quote byte, backslash bool) int {
+	i := start + 1
+	for i < len(sql) {
+		c := sql[i]
+		if backslash && c == '\\' {
+			i += 2
+			continue
+		}
+		if c == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(sql)
+}
+
+// isOracleQuote 是否为 Oracle 的 q'<分隔符>...<分隔符>' 或 nq'...' 字符串
+func isOracleQuote(s string) bool {
+	if len(s) > 0 && (s[0] == 'n' || s[0] == 'N') {
+		s = s[1:]
+	}
+	return len(s) >= 3 && (s[0] == 'q' || s[0] == 'Q') && s[1] == '\''
+}
+
+// scanOracleQuoted 扫描 q'[...]' 字符串，返回结束位置（不含）。[ { ( < 以对应的右括号结束，其他分隔符以自身结束；
+// 内容中的单引号不需要转义
+func scanOracleQuoted(sql string, start int) int {
+	i := start
+	if sql[i] == 'n' || sql[i] == 'N' {
+		i++
+	}
+	open := sql[i+2]
+	closing := open
+	switch open {
+	case '[':
+		closing = ']'
+	case '{':
+		closing = '}'
+	case '(':
+		closing = ')'
+	case '<':
+		closing = '>'
+	}
+	end := strings.Index(sql[i+3:], string(closing)+"'")
+	if end < 0 {
+		return len(sql)
+	}
+	return i + 3 + end + 2
+}
+
+// scanDollarQuoted 扫描 PostgreSQL 的 $tag$...$tag$ 字符串
+func scanDollarQuoted(sql string, start int) (int, bool) {
+	j := start + 1
+	for j < len(sql) && sql[j] != '$' {
+		if !isIdentPart(sql[j]) {
+			return 0, false
+		}
+		j++
+	}
+	if j >= len(sql) {
+		return 0, false
+	}
+	tag := sql[start : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql), true
+	}
+	return j + 1 + end + len(tag), true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
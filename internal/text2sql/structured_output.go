@@ -0,0 +1,65 @@
+package text2sql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"text2sql/internal/llm"
+)
+
+// generatedOutput LLM 的生成结果。结构化模式下即模型返回的 JSON，文本模式下只有 SQL 和解释
+type generatedOutput struct {
+	SQL         string   `json:"sql"`
+	Explanation string   `json:"explanation"`
+	TablesUsed  []string `json:"tables_used"`
+	Assumptions []string `json:"assumptions"`
+}
+
+// structuredOutputFormat 结构化模式的 JSON Schema，满足 OpenAI strict 模式的要求（字段全部 required，不允许额外字段）
+var structuredOutputFormat = &llm.ResponseFormat{
+	Name: "text2sql_result",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "sql": {"type": "string"},
+    "explanation": {"type": "string"},
+    "tables_used": {"type": "array", "items": {"type": "string"}},
+    "assumptions": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["sql", "explanation", "tables_used", "assumptions"],
+  "additionalProperties": false
+}`),
+}
+
+// structuredOutputInstruction 追加到 system prompt 的输出要求，覆盖方言提示词中的文本输出格式
+func (p *promptSet) structuredOutputInstruction(dialect Dialect) string {
+	return fmt.Sprintf(p.structuredOutput, dialect.StatementName())
+}
+
+// decodeStructuredOutput 按结构化输出的 schema 严格解码：单个 JSON 对象、字段类型正确、没有多余字段且 sql 非空。
+// 兼容模型在 JSON 外包裹代码块。
+func decodeStructuredOutput(content string) (*generatedOutput, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		if nl := strings.IndexByte(content, '\n'); nl >= 0 {
+			content = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content[nl+1:]), "```"))
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.DisallowUnknownFields()
+	var out generatedOutput
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("解码结构化输出: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("结构化输出的 JSON 之后存在多余内容")
+	}
+	out.SQL = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(out.SQL), ";"))
+	if out.SQL == "" {
+		return nil, errors.New("结构化输出缺少 sql")
+	}
+	out.Explanation = strings.TrimSpace(out.Explanation)
+	return &out, nil
+}
@@ -4,95 +4,312 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/xwb1989/sqlparser"
 )
 
 // SQLValidator SQL 校验器
-type SQLValidator struct{}
+type SQLValidator struct {
+	opts ValidateOptions
+}
 
-// NewSQLValidator 创建 SQLValidator
+// NewSQLValidator 创建 SQLValidator，使用默认限制
 func NewSQLValidator() *SQLValidator {
-	return &SQLValidator{}
+	return &SQLValidator{opts: DefaultValidateOptions()}
+}
+
+// NewSQLValidatorWithRedisLimits 创建带自定义 Redis 限制的 SQLValidator
+func NewSQLValidatorWithRedisLimits(limits RedisLimits) *SQLValidator {
+	opts := DefaultValidateOptions().WithDialect("redis", limits)
+	return &SQLValidator{opts: opts}
 }
 
-// Validate 按数据库类型和版本校验 SQL
+// NewSQLValidatorWithOptions 创建带自定义校验配置的 SQLValidator
+func NewSQLValidatorWithOptions(opts ValidateOptions) *SQLValidator {
+	return &SQLValidator{opts: opts}
+}
+
+// Validate 按数据库类型和版本校验 SQL，存在错误级诊断时返回 Diagnostics
 func (v *SQLValidator) Validate(sql, dbType, version string) error {
+	return v.Diagnose(sql, Database{Type: dbType, Version: version}).Err()
+}
+
+// Diagnose 按数据库类型和版本校验 SQL，返回全部诊断（错误与警告）
+func (v *SQLValidator) Diagnose(sql string, database Database) Diagnostics {
+	return v.DiagnoseWithSchema(sql, database, Schema{})
+}
+
+// DiagnoseWithSchema 同 Diagnose，并按 schema 校验引用的对象（目前为 Redis 的 key 模式）。
+// 校验逻辑由 database.Type 对应的 Dialect 提供。
+func (v *SQLValidator) DiagnoseWithSchema(sql string, database Database, schema Schema) Diagnostics {
 	sql = strings.TrimSpace(sql)
 	if sql == "" {
-		return fmt.Errorf("SQL 不能为空")
-	}
-
-	switch dbType {
-	case "mysql":
-		return v.validateMySQL(sql, version)
-	case "postgresql", "postgres":
-		return v.validatePostgreSQL(sql, version)
-	case "sqlite":
-		return v.validateSQLite(sql, version)
-	case "redis":
-		return v.validateRedis(sql, version)
-	default:
-		return fmt.Errorf("不支持的数据库类型: %s", dbType)
+		return Diagnostics{newDiagnostic(CodeEmptyQuery, SeverityError, "SQL 不能为空")}
+	}
+
+	d, err := GetDialect(database.Type)
+	if err != nil {
+		return Diagnostics{newDiagnostic(CodeUnsupportedDatabase, SeverityError, "不支持的数据库类型: %s", database.Type)}
+	}
+	return d.Validate(sql, database, schema, v.opts)
+}
+
+// LimitRows 按 MaxRows 改写语句的行数上限，方言未实现 RowLimiter 时原样返回
+func (v *SQLValidator) LimitRows(statement string, database Database) string {
+	d, err := GetDialect(database.Type)
+	if err != nil {
+		return statement
+	}
+	if limiter, ok := d.(RowLimiter); ok && v.opts.MaxRows > 0 {
+		return limiter.LimitRows(statement, v.opts.MaxRows)
 	}
+	return statement
 }
 
 var errNotReadOnly = errors.New("仅允许只读查询")
 
-// validateMySQL 使用 MySQL 方言解析
-func (v *SQLValidator) validateMySQL(sql, _ string) error {
-	if err := v.ensureReadOnlySQL(sql); err != nil {
-		if errors.Is(err, errNotReadOnly) {
-			return err
+// diagnoseSQL SQL 方言通用校验：版本特性 → 多语句 → 解析器只读校验 → 解析失败时的结构兜底。
+// strict 为 true 时仅在使用了解析器不支持的扩展语法时才允许兜底。
+// sqlparser 不支持 CTE、窗口函数等较新语法，版本已通过特性校验时才退化为词法级校验。
+// sqlparser 按 MySQL 规则切分字符串，其他方言的语句边界与只读检查以本方言的词法结果为准。
+func diagnoseSQL(sql, dialect, version string, strict bool, style sqlStringStyle) Diagnostics {
+	tokens := tokenizeSQL(sql, style)
+	diags := checkSQLFeatures(dialect, version, sql, tokens)
+	if diags.HasErrors() {
+		return diags
+	}
+	mysqlLexing := style == sqlStringsBackslash
+	if semi, ok := findStatementSeparator(tokens); ok && !mysqlLexing {
+		return append(diags, multipleStatementsDiagnostic(sql, semi))
+	}
+
+	err := ensureReadOnlySQL(sql)
+	if err == nil {
+		if !mysqlLexing {
+			if ro := ensureReadOnlyTokens(sql, tokens); ro != nil {
+				return append(diags, ro)
+			}
 		}
-		return fmt.Errorf("MySQL 语法错误: %w", err)
+		return append(diags, selectStarWarnings(sql, tokens)...)
+	}
+	if errors.Is(err, errNotReadOnly) {
+		return append(diags, notReadOnlyDiagnostic(sql, tokens))
+	}
+
+	name := dialectDisplayNames[dialect]
+	if (!strict || usesExtendedSyntax(tokens)) && basicSelectCheck(sql) {
+		if semi, ok := findStatementSeparator(tokens); ok {
+			return append(diags, multipleStatementsDiagnostic(sql, semi))
+		}
+		if ro := ensureReadOnlyTokens(sql, tokens); ro != nil {
+			return append(diags, ro)
+		}
+		diags = append(diags, newDiagnostic(CodeUnverifiedSyntax, SeverityWarning,
+			"%s 语法无法被完整解析，仅完成了只读与结构检查", name))
+		return append(diags, selectStarWarnings(sql, tokens)...)
+	}
+
+	msg := "%s 语法可能存在问题"
+	if strict {
+		msg = "%s 语法错误"
+	}
+	return append(diags, syntaxErrorDiagnostic(sql, tokens, err, fmt.Sprintf(msg, name)))
+}
+
+// basicSelectCheck 基本 SELECT 结构校验
+func basicSelectCheck(sql string) bool {
+	upper := strings.TrimSpace(strings.ToUpper(sql))
+	if !strings.HasPrefix(upper, "SELECT") && !strings.HasPrefix(upper, "WITH") {
+		return false
+	}
+	// 简单正则：至少包含 SELECT ... FROM
+	re := regexp.MustCompile(`(?is)\bSELECT\b.*\bFROM\b`)
+	return re.MatchString(sql)
+}
+
+// sqlWriteKeywords 词法级只读校验中禁止出现在语句位置的关键字，见 findWriteKeywords
+var sqlWriteKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"DROP": true, "ALTER": true, "CREATE": true, "TRUNCATE": true, "RENAME": true,
+	"GRANT": true, "REVOKE": true, "INTO": true, "COPY": true, "CALL": true, "EXEC": true, "EXECUTE": true,
+}
+
+// ensureReadOnlyTokens 解析器无法处理时的兜底只读校验：
+// 字符串与注释已在词法阶段剔除，语句位置上不得出现写操作（包括 CTE 中的 DELETE ... RETURNING）
+func ensureReadOnlyTokens(sql string, tokens []sqlToken) *ValidationError {
+	if found := findWriteKeywords(tokens, sqlWriteKeywords); len(found) > 0 {
+		return newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+			atToken(sql, found[0]).withSuggestion("只生成 SELECT 查询，不要包含写操作")
 	}
 	return nil
 }
 
-// validatePostgreSQL 基础校验（纯 Go 的 PG 解析器较少，先做基本校验）
-func (v *SQLValidator) validatePostgreSQL(sql, _ string) error {
-	// 尝试用 MySQL parser 解析（SELECT 语法多数兼容）
-	if err := v.ensureReadOnlySQL(sql); err != nil {
-		if errors.Is(err, errNotReadOnly) {
-			return err
+// findWriteKeywords 查找处于语句位置的写操作关键字，避免把同名的列、别名和函数（如 copy、INSERT()）当作写操作：
+//   - 语句开头，或紧跟在 "("、")"、";" 之后（CTE 与子查询体的开头、WITH ... AS (...) 之后的主语句）；
+//     在括号之后且紧跟 "(" 的是函数调用
+//   - INTO 出现在同一层括号内的 SELECT 之后（SELECT ... INTO）
+//   - UPDATE 紧跟在 FOR 或 KEY 之后（FOR UPDATE、FOR NO KEY UPDATE 行锁）
+//
+// 带限定符或其后紧跟 ")"、"," 的都是列引用
+func findWriteKeywords(tokens []sqlToken, keywords map[string]bool) []sqlToken {
+	var found []sqlToken
+	depth := 0
+	selects := map[int]bool{} // 已出现 SELECT 的括号层
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			delete(selects, depth)
+			depth--
+		case t.isPunct(";"):
+			clear(selects)
+		case t.is("SELECT"):
+			selects[depth] = true
+		}
+		if t.kind != tokWord || !keywords[t.upper] {
+			continue
+		}
+		var prev, next sqlToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		if prev.isPunct(".") || next.isPunct(".") || next.isPunct(")") || next.isPunct(",") {
+			continue
+		}
+		switch {
+		case t.is("INTO"):
+			if selects[depth] {
+				found = append(found, t)
+			}
+		case i == 0 || prev.isPunct(";"):
+			found = append(found, t)
+		case prev.isPunct("(") || prev.isPunct(")"):
+			if !next.isPunct("(") {
+				found = append(found, t)
+			}
+		case t.is("UPDATE") && (prev.is("FOR") || prev.is("KEY")):
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// notReadOnlyDiagnostic 解析器判定为非只读语句时的诊断，定位到语句的首个关键字
+func notReadOnlyDiagnostic(sql string, tokens []sqlToken) *ValidationError {
+	d := newDiagnostic(CodeNotReadOnly, SeverityError, "%s", errNotReadOnly.Error()).
+		withSuggestion("只生成 SELECT 查询，不要包含写操作")
+	for _, t := range tokens {
+		if t.kind == tokWord {
+			return d.atToken(sql, t)
 		}
-		// PG 特有语法可能失败，做基本结构校验
-		if v.basicSelectCheck(sql) && !hasMultipleStatements(sql) {
-			return nil
+	}
+	return d
+}
+
+// sqlparserErrorPattern 匹配 sqlparser 错误中的位置，如 "syntax error at position 24 near 'delete'"
+var sqlparserErrorPattern = regexp.MustCompile(`at position (\d+)`)
+
+// syntaxErrorDiagnostic 将 sqlparser 的错误转换为带位置的诊断。
+// sqlparser 报告的 position 为出错 token 结束位置 + 1。
+func syntaxErrorDiagnostic(sql string, tokens []sqlToken, err error, prefix string) *ValidationError {
+	d := newDiagnostic(CodeSyntaxError, SeverityError, "%s: %v", prefix, err)
+	m := sqlparserErrorPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return d
+	}
+	end, _ := strconv.Atoi(m[1])
+	end--
+	var last *sqlToken
+	for i := range tokens {
+		if tokens[i].pos >= end {
+			break
 		}
-		return fmt.Errorf("PostgreSQL 语法可能存在问题: %w", err)
+		last = &tokens[i]
 	}
-	return nil
+	if last == nil {
+		return d.at(sql, 0, "")
+	}
+	return d.atToken(sql, *last)
 }
 
-// validateSQLite 基础校验
-func (v *SQLValidator) validateSQLite(sql, _ string) error {
-	if err := v.ensureReadOnlySQL(sql); err != nil {
-		if errors.Is(err, errNotReadOnly) {
-			return err
+// findStatementSeparator 查找语句之间的分号（末尾单个分号除外）
+func findStatementSeparator(tokens []sqlToken) (sqlToken, bool) {
+	for i, t := range tokens {
+		if t.isPunct(";") && i < len(tokens)-1 {
+			return t, true
 		}
-		if v.basicSelectCheck(sql) && !hasMultipleStatements(sql) {
-			return nil
+	}
+	return sqlToken{}, false
+}
+
+// multipleStatementsDiagnostic 语句之间出现分号时的诊断
+func multipleStatementsDiagnostic(sql string, semi sqlToken) *ValidationError {
+	return newDiagnostic(CodeMultipleStatements, SeverityError, "只允许单条 SQL 语句").
+		atToken(sql, semi).withSuggestion("删除多余的语句，只保留一条 SELECT 查询")
+}
+
+// checkSelectStructure 词法级校验的语句结构检查：以 SELECT / WITH / ( 或 extraStarts 中的关键字开头，
+// 只有一条语句且括号成对。首个关键字为写操作时返回 NOT_READ_ONLY。
+func checkSelectStructure(sql string, tokens []sqlToken, name string, writeKeywords map[string]bool, extraStarts ...string) *ValidationError {
+	first := tokens[0]
+	allowed := first.is("SELECT") || first.is("WITH") || first.isPunct("(")
+	for _, k := range extraStarts {
+		allowed = allowed || first.is(k)
+	}
+	if !allowed {
+		if first.kind == tokWord && writeKeywords[first.upper] {
+			return notReadOnlyDiagnostic(sql, tokens)
 		}
-		return fmt.Errorf("SQLite 语法可能存在问题: %w", err)
+		return newDiagnostic(CodeSyntaxError, SeverityError, "%s 语法错误: 只支持 SELECT 查询", name).atToken(sql, first)
+	}
+	if semi, ok := findStatementSeparator(tokens); ok {
+		return multipleStatementsDiagnostic(sql, semi)
+	}
+	return checkBalancedParens(sql, tokens)
+}
+
+// checkBalancedParens 括号必须成对出现
+func checkBalancedParens(sql string, tokens []sqlToken) *ValidationError {
+	var open []sqlToken
+	for _, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			open = append(open, t)
+		case t.isPunct(")"):
+			if len(open) == 0 {
+				return newDiagnostic(CodeSyntaxError, SeverityError, "括号不匹配: 多余的 ')'").atToken(sql, t)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return newDiagnostic(CodeSyntaxError, SeverityError, "括号不匹配: '(' 未闭合").atToken(sql, open[len(open)-1])
 	}
 	return nil
 }
 
-// basicSelectCheck 基本 SELECT 结构校验
-func (v *SQLValidator) basicSelectCheck(sql string) bool {
-	upper := strings.TrimSpace(strings.ToUpper(sql))
-	if !strings.HasPrefix(upper, "SELECT") {
-		return false
+// selectStarWarnings SELECT * 提示：建议显式列出需要的列
+func selectStarWarnings(sql string, tokens []sqlToken) Diagnostics {
+	for i := 1; i < len(tokens); i++ {
+		if !tokens[i].isOp("*") {
+			continue
+		}
+		prev := tokens[i-1]
+		if prev.is("SELECT") || prev.is("DISTINCT") || prev.isPunct(".") {
+			return Diagnostics{newDiagnostic(CodeSelectStar, SeverityWarning, "查询使用了 SELECT *").
+				atToken(sql, tokens[i]).withSuggestion("显式列出需要的列，避免返回多余数据")}
+		}
 	}
-	// 简单正则：至少包含 SELECT ... FROM
-	re := regexp.MustCompile(`(?i)\bSELECT\b.*\bFROM\b`)
-	return re.MatchString(sql)
+	return nil
 }
 
-func (v *SQLValidator) ensureReadOnlySQL(sql string) error {
+func ensureReadOnlySQL(sql string) error {
 	stmt, err := sqlparser.Parse(sql)
 	if err != nil {
 		return err
@@ -111,63 +328,3 @@ func isReadOnlyStatement(stmt sqlparser.Statement) bool {
 		return false
 	}
 }
-
-func hasMultipleStatements(sql string) bool {
-	trimmed := strings.TrimSpace(sql)
-	if !strings.Contains(trimmed, ";") {
-		return false
-	}
-	if strings.HasSuffix(trimmed, ";") && strings.Count(trimmed, ";") == 1 {
-		return false
-	}
-	return true
-}
-
-// Redis 只读命令白名单（仅允许查询类命令）
-var redisReadOnlyCommands = map[string]bool{
-	"GET": true, "MGET": true, "HGET": true, "HGETALL": true, "HMGET": true,
-	"LRANGE": true, "LINDEX": true, "LLEN": true,
-	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true,
-	"ZRANGE": true, "ZREVRANGE": true, "ZRANGEBYSCORE": true, "ZREVRANGEBYSCORE": true,
-	"ZRANK": true, "ZREVRANK": true, "ZSCORE": true, "ZCARD": true,
-	"KEYS": true, "SCAN": true, "HSCAN": true, "SSCAN": true, "ZSCAN": true,
-	"EXISTS": true, "TYPE": true, "TTL": true, "PTTL": true,
-	"STRLEN": true, "HLEN": true,
-}
-
-// Redis 危险/写命令黑名单
-var redisDangerousCommands = map[string]bool{
-	"FLUSHALL": true, "FLUSHDB": true, "DEL": true, "UNLINK": true,
-	"SET": true, "SETEX": true, "SETNX": true, "MSET": true,
-	"HSET": true, "HSETNX": true, "HMSET": true, "HDEL": true,
-	"LPUSH": true, "RPUSH": true, "LPOP": true, "RPOP": true, "LREM": true, "LSET": true, "LTRIM": true,
-	"SADD": true, "SREM": true, "SPOP": true,
-	"ZADD": true, "ZREM": true, "ZINCRBY": true,
-	"INCR": true, "INCRBY": true, "DECR": true, "DECRBY": true,
-	"EXPIRE": true, "PEXPIRE": true, "PERSIST": true,
-	"RENAME": true, "RENAMENX": true,
-}
-
-// validateRedis 校验 Redis 命令：仅允许只读命令
-func (v *SQLValidator) validateRedis(commands, _ string) error {
-	lines := strings.Split(commands, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		// 取第一个 token 作为命令（Redis 命令大小写不敏感，统一转大写比较）
-		parts := strings.Fields(line)
-		if len(parts) == 0 {
-			continue
-		}
-		cmd := strings.ToUpper(parts[0])
-		if redisDangerousCommands[cmd] {
-			return fmt.Errorf("不允许的 Redis 写操作: %s", cmd)
-		}
-		if !redisReadOnlyCommands[cmd] {
-			return fmt.Errorf("不支持的 Redis 命令或非只读命令: %s（仅允许只读命令如 GET、HGET、LRANGE、SCAN 等）", cmd)
-		}
-	}
-	return nil
-}
@@ -1,6 +1,9 @@
 package text2sql
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestValidateMySQLReadOnly(t *testing.T) {
 	v := NewSQLValidator()
@@ -24,3 +27,320 @@ func TestValidateRejectsMultipleStatements(t *testing.T) {
 		t.Fatalf("expected multiple statements to be rejected")
 	}
 }
+
+func TestValidateFeatureVersions(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name    string
+		sql     string
+		dbType  string
+		version string
+		wantErr bool
+	}{
+		{"mysql 8 cte", "WITH t AS (SELECT id FROM users) SELECT * FROM t", "mysql", "8.0", false},
+		{"mysql 5.7 cte", "WITH t AS (SELECT id FROM users) SELECT * FROM t", "mysql", "5.7", true},
+		{"mysql 5.7 window", "SELECT id, ROW_NUMBER() OVER (ORDER BY id) FROM users", "mysql", "5.7.33", true},
+		{"mysql 8 window", "SELECT id, ROW_NUMBER() OVER (ORDER BY id) FROM users", "mysql", "8.0.32", false},
+		{"mysql filter unsupported", "SELECT COUNT(*) FILTER (WHERE age > 1) FROM users", "mysql", "8.0", true},
+		{"time zone is not cte", "SELECT CAST(created_at AS timestamp with time zone) FROM users", "postgresql", "8.0", false},
+		{"pg 9.3 filter", "SELECT COUNT(*) FILTER (WHERE age > 1) FROM users", "postgresql", "9.3", true},
+		{"pg 14 filter", "SELECT COUNT(*) FILTER (WHERE age > 1) FROM users", "postgresql", "14", false},
+		{"pg 10 groups frame", "SELECT SUM(x) OVER (ORDER BY id GROUPS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM t", "postgresql", "10", true},
+		{"pg 9.3 jsonb", "SELECT * FROM t WHERE data @> '{\"a\":1}'", "postgresql", "9.3", true},
+		{"sqlite 3.37 json arrow", "SELECT data ->> '$.a' FROM t", "sqlite", "3.37.2", true},
+		{"sqlite 3.45 json arrow", "SELECT data ->> '$.a' FROM t", "sqlite", "3.45", false},
+		{"unknown version skips version checks", "WITH t AS (SELECT 1 FROM users) SELECT * FROM t", "mysql", "", false},
+		{"cte hiding delete", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", "postgresql", "14", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.sql, tt.dbType, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFeatureSuggestions(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name    string
+		sql     string
+		db      Database
+		want    string
+		notWant string
+	}{
+		{"mysql json unquote", "SELECT data ->> '$.a' FROM t", Database{Type: "mysql", Version: "5.7.10"}, "JSON_UNQUOTE", ""},
+		{"sqlite json arrow", "SELECT data ->> '$.a' FROM t", Database{Type: "sqlite", Version: "3.37.2"}, "json_extract()", "JSON_UNQUOTE"},
+		{"sql server json arrow", "SELECT data ->> '$.a' FROM t", Database{Type: "mssql", Version: "16"}, "JSON_VALUE()", "JSON_UNQUOTE"},
+		{"old postgresql json arrow", "SELECT data -> 'a' FROM t", Database{Type: "postgresql", Version: "9.2"}, "没有 JSON 运算符和函数", "JSON_EXTRACT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.sql, tt.db).Errors()
+			if len(errs) == 0 || errs[0].Code != CodeUnsupportedFeature {
+				t.Fatalf("expected %s, got %v", CodeUnsupportedFeature, errs)
+			}
+			if s := errs[0].Suggestion; !strings.Contains(s, tt.want) || (tt.notWant != "" && strings.Contains(s, tt.notWant)) {
+				t.Errorf("suggestion = %q, want %q without %q", s, tt.want, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestValidateStringEscapes(t *testing.T) {
+	v := NewSQLValidator()
+	cteDelete := `WITH x AS (SELECT '\'), d AS (DELETE FROM users RETURNING *) SELECT * FROM d --' FROM t) SELECT * FROM x`
+	tests := []struct {
+		name    string
+		sql     string
+		dbType  string
+		wantErr bool
+	}{
+		{"pg backslash ends string in cte", cteDelete, "postgresql", true},
+		{"sqlite backslash ends string in cte", cteDelete, "sqlite", true},
+		{"pg backslash ends string", `SELECT a FROM t WHERE b = '\' ; DELETE FROM t --'`, "postgresql", true},
+		{"sqlite backslash ends string", `SELECT a FROM t WHERE b = '\' ; DELETE FROM t --'`, "sqlite", true},
+		{"pg trailing backslash", `SELECT a FROM t WHERE b = 'C:\'`, "postgresql", false},
+		{"pg escape string", `SELECT a FROM t WHERE b = E'it\'s; DELETE FROM t'`, "postgresql", false},
+		{"sqlite trailing backslash", `SELECT a FROM t WHERE b = 'C:\'`, "sqlite", false},
+		{"mysql backslash escape", `SELECT a FROM t WHERE b = 'it\'s; DELETE FROM t'`, "mysql", false},
+		{"mysql double quoted string", `WITH x AS (SELECT "\" , '" ; DROP TABLE t; -- ' FROM t) SELECT * FROM x`, "mysql", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.sql, tt.dbType, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWriteKeywordPosition(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name    string
+		sql     string
+		dbType  string
+		wantErr bool
+	}{
+		{"columns named like statements", "SELECT copy, rename, merge, call FROM jobs", "postgresql", false},
+		{"columns in cte", "WITH c AS (SELECT call, merge FROM logs) SELECT * FROM c", "postgresql", false},
+		{"function named like statement", "SELECT max(copy) FROM jobs WHERE rename IS NOT NULL", "sqlite", false},
+		{"delete in cte", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", "postgresql", true},
+		{"delete after cte", "WITH x AS (SELECT 1) DELETE FROM users", "postgresql", true},
+		{"select into", "SELECT * INTO backup FROM users", "postgresql", true},
+		{"select into in subquery", "SELECT * FROM (SELECT id INTO backup FROM users) s", "sqlite", true},
+		{"for update", "SELECT id FROM users WHERE id = 1 FOR UPDATE", "postgresql", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.sql, tt.dbType, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiagnoseReportsCodeAndPosition(t *testing.T) {
+	v := NewSQLValidator()
+	diags := v.Diagnose("SELECT id,\n  ROW_NUMBER() OVER (ORDER BY id)\nFROM users", Database{Type: "mysql", Version: "5.7"})
+	if !diags.HasErrors() {
+		t.Fatalf("expected window function to be rejected on MySQL 5.7")
+	}
+	d := diags.Errors()[0]
+	if d.Code != CodeUnsupportedFeature {
+		t.Errorf("code = %s, want %s", d.Code, CodeUnsupportedFeature)
+	}
+	if d.Line != 2 || d.Column != 16 || d.Token != "OVER" {
+		t.Errorf("position = %d:%d %q, want 2:16 \"OVER\"", d.Line, d.Column, d.Token)
+	}
+	if d.Suggestion == "" {
+		t.Error("expected a suggestion")
+	}
+}
+
+func TestDiagnoseSyntaxErrorPosition(t *testing.T) {
+	v := NewSQLValidator()
+	diags := v.Diagnose("SELECT * FROM users; DELETE FROM users", Database{Type: "mysql"})
+	errs := diags.Errors()
+	if len(errs) != 1 || errs[0].Code != CodeSyntaxError {
+		t.Fatalf("expected one syntax error, got %v", diags)
+	}
+	if errs[0].Token != "DELETE" || errs[0].Column != 22 {
+		t.Errorf("position = %d:%d %q, want 1:22 \"DELETE\"", errs[0].Line, errs[0].Column, errs[0].Token)
+	}
+}
+
+func TestDiagnoseWarnings(t *testing.T) {
+	v := NewSQLValidator()
+	diags := v.Diagnose("SELECT * FROM users", Database{Type: "mysql"})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	warnings := diags.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != CodeSelectStar {
+		t.Fatalf("expected SELECT_STAR warning, got %v", warnings)
+	}
+	if diags.Err() != nil {
+		t.Error("warnings alone must not produce an error")
+	}
+}
+
+func TestValidateRedisCommands(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name     string
+		commands string
+		wantCode string
+	}{
+		{"simple get", "GET user:1001", ""},
+		{"quoted key with spaces", `HGET "user:1001 profile" name`, ""},
+		{"escaped quote", `GET 'it\'s'`, ""},
+		{"write command", "DEL user:1001", CodeRedisWriteCommand},
+		{"unbalanced quote", `GET "user:1001`, CodeRedisSyntaxError},
+		{"wrong arity", "HGET user:1001", CodeRedisWrongArity},
+		{"unbounded keys", "KEYS *", CodeRedisLimitExceeded},
+		{"keys with prefix", "KEYS user:*", ""},
+		{"scan count too large", "SCAN 0 MATCH user:* COUNT 10000000", CodeRedisLimitExceeded},
+		{"scan bad option", "SCAN 0 LIMIT 10", CodeRedisInvalidArgument},
+		{"scan bad cursor", "SCAN abc", CodeRedisInvalidArgument},
+		{"lrange whole list", "LRANGE events 0 -1", CodeRedisLimitExceeded},
+		{"lrange tail", "LRANGE events -100 -1", ""},
+		{"zrange byscore limit", "ZRANGE scores 0 100 BYSCORE LIMIT 0 50 WITHSCORES", ""},
+		{"zrange limit without byscore", "ZRANGE scores 0 10 LIMIT 0 5", CodeRedisInvalidArgument},
+		{"zrangebyscore limit too large", "ZRANGEBYSCORE scores -inf +inf LIMIT 0 100000", CodeRedisLimitExceeded},
+		{"zrangebyscore without limit", "ZRANGEBYSCORE scores -inf +inf", CodeRedisLimitExceeded},
+		{"zrangebyscore with limit", "ZRANGEBYSCORE scores -inf +inf WITHSCORES LIMIT 0 100", ""},
+		{"zrange byscore without limit", "ZRANGE scores -inf +inf BYSCORE", CodeRedisLimitExceeded},
+		{"xrange without count", "XRANGE events - +", CodeRedisLimitExceeded},
+		{"xrange count too large", "XRANGE events - + COUNT 100000", CodeRedisLimitExceeded},
+		{"xrevrange with count", "XREVRANGE events + - COUNT 100", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.commands, Database{Type: "redis"}).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRedisCustomLimits(t *testing.T) {
+	v := NewSQLValidatorWithRedisLimits(RedisLimits{AllowUnboundedKeys: true})
+	if err := v.Validate("KEYS *\nLRANGE events 0 -1\nZRANGEBYSCORE scores -inf +inf\nXRANGE events - +", "redis", ""); err != nil {
+		t.Fatalf("expected unlimited validator to accept, got %v", err)
+	}
+}
+
+func TestValidateRedisErrorPosition(t *testing.T) {
+	v := NewSQLValidator()
+	errs := v.Diagnose("GET a\nSCAN 0 COUNT 5000", Database{Type: "redis"}).Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	if errs[0].Line != 2 || errs[0].Column != 14 || errs[0].Token != "5000" {
+		t.Errorf("position = %d:%d %q, want 2:14 \"5000\"", errs[0].Line, errs[0].Column, errs[0].Token)
+	}
+}
+
+func TestValidateRedisCatalogue(t *testing.T) {
+	v := NewSQLValidator()
+	tests := []struct {
+		name     string
+		commands string
+		database Database
+		wantCode string
+	}{
+		{"zrange byscore on 7.0", "ZRANGE scores 0 100 BYSCORE LIMIT 0 10", Database{Type: "redis", Version: "7.0"}, ""},
+		{"zrange byscore on 6.0", "ZRANGE scores 0 100 BYSCORE LIMIT 0 10", Database{Type: "redis", Version: "6.0"}, CodeUnsupportedFeature},
+		{"hrandfield on 6.0", "HRANDFIELD user:1 3", Database{Type: "redis", Version: "6.0.9"}, CodeUnsupportedFeature},
+		{"lpos on 7.2", "LPOS queue job:1 RANK 1", Database{Type: "redis", Version: "7.2"}, ""},
+		{"object encoding", "OBJECT ENCODING user:1", Database{Type: "redis", Version: "7.2"}, ""},
+		{"memory usage", "MEMORY USAGE user:1 SAMPLES 5", Database{Type: "redis"}, ""},
+		{"object unknown subcommand", "OBJECT HELP", Database{Type: "redis"}, CodeRedisUnknownCommand},
+		{"xrange with count", "XRANGE events - + COUNT 10", Database{Type: "redis", Version: "7.0"}, ""},
+		{"xread without block", "XREAD COUNT 10 STREAMS events 0", Database{Type: "redis", Version: "7.0"}, ""},
+		{"xread block", "XREAD COUNT 10 BLOCK 0 STREAMS events $", Database{Type: "redis", Version: "7.0"}, CodeRedisInvalidArgument},
+		{"json without module", "JSON.GET user:1 $.name", Database{Type: "redis"}, CodeUnsupportedFeature},
+		{"json with module", "JSON.GET user:1 $.name", Database{Type: "redis", Modules: []string{"RedisJSON"}}, ""},
+		{"json write", "JSON.SET user:1 $.name '\"bob\"'", Database{Type: "redis", Modules: []string{"json"}}, CodeRedisWriteCommand},
+		{"ft.search", "FT.SEARCH idx:users \"@name:bob\" LIMIT 0 20", Database{Type: "redis", Modules: []string{"search"}}, ""},
+		{"getdel is write", "GETDEL user:1", Database{Type: "redis"}, CodeRedisWriteCommand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.Diagnose(tt.commands, tt.database).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRedisKeySpace(t *testing.T) {
+	v := NewSQLValidator()
+	schema := Schema{Keys: []RedisKey{
+		{Pattern: "user:{id:int}", Type: "hash", Fields: []Column{{Name: "name"}, {Name: "age"}}},
+		{Pattern: "user:{id:int}:orders", Type: "zset", Member: "订单 ID", Score: "下单时间戳"},
+		{Pattern: "session:{token:uuid}", Type: "string", TTL: "30 分钟"},
+		{Pattern: "events:{date:date}", Type: "stream"},
+	}}
+	database := Database{Type: "redis", Version: "7.2"}
+	tests := []struct {
+		name     string
+		commands string
+		wantCode string
+	}{
+		{"hash key", "HGET user:1001 name", ""},
+		{"zset key", "ZRANGE user:1001:orders 0 9", ""},
+		{"uuid placeholder", "GET session:3f2b8c1e-9a4d-4e21-b6a7-1c2d3e4f5a6b", ""},
+		{"stream key in xread", "XREAD COUNT 10 STREAMS events:2024-05-01 0", ""},
+		{"multiple keys", "EXISTS user:1 user:2:orders", ""},
+		{"scan match overlaps", "SCAN 0 MATCH user:*:orders COUNT 100", ""},
+		{"type is generic", "TTL session:3f2b8c1e-9a4d-4e21-b6a7-1c2d3e4f5a6b", ""},
+		{"undeclared key", "HGET customer:1001 name", CodeRedisUnknownKey},
+		{"placeholder type mismatch", "HGET user:abc name", CodeRedisUnknownKey},
+		{"bad date placeholder", "XLEN events:yesterday", CodeRedisUnknownKey},
+		{"wrong type", "HGETALL user:1001:orders", CodeRedisWrongType},
+		{"geo on hash", "GEOPOS user:1 home", CodeRedisWrongType},
+		{"scan match misses", "SCAN 0 MATCH order:* COUNT 100", CodeRedisUnknownKey},
+		{"keys pattern misses", "KEYS product:*", CodeRedisUnknownKey},
+		{"second key undeclared", "MGET session:3f2b8c1e-9a4d-4e21-b6a7-1c2d3e4f5a6b cache:1", CodeRedisUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := v.DiagnoseWithSchema(tt.commands, database, schema).Errors()
+			if tt.wantCode == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, errs)
+			}
+		})
+	}
+
+	// 未声明 key 空间时不校验 key
+	if errs := v.Diagnose("HGET customer:1001 name", database).Errors(); len(errs) > 0 {
+		t.Fatalf("expected no key checks without schema.keys, got %v", errs)
+	}
+}